@@ -0,0 +1,524 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// alertStandIn keeps the alert configuration of an organization in memory.
+type alertStandIn struct {
+	nextID    int
+	receivers map[string]map[string]interface{}
+	rules     map[string]map[string]interface{}
+	strats    map[string]map[string]interface{}
+	inhibits  map[string]map[string]interface{}
+	calls     []string
+}
+
+func newAlertStandIn(t *testing.T) (*alertStandIn, *common.APIClient) {
+	s := &alertStandIn{
+		nextID:    1,
+		receivers: map[string]map[string]interface{}{},
+		rules:     map[string]map[string]interface{}{},
+		strats:    map[string]map[string]interface{}{},
+		inhibits:  map[string]map[string]interface{}{},
+	}
+	return s, apitest.NewClient(t, s)
+}
+
+func (s *alertStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(apitest.OrgPath(r, "org"), "/")
+	parts := strings.Split(strings.TrimPrefix(rest, "alerts/"), "/")
+	var store map[string]map[string]interface{}
+	switch parts[0] {
+	case "receivers":
+		store = s.receivers
+	case "rules":
+		store = s.rules
+	case "strategies":
+		store = s.strats
+	case "inhibits":
+		store = s.inhibits
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		s.calls = append(s.calls, r.Method+" "+strings.Join(parts, "/"))
+	}
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	reply := func(v interface{}) { apitest.WriteJSON(w, http.StatusOK, v) }
+
+	switch {
+	case r.Method == http.MethodGet && parts[0] == "rules":
+		groups := map[string][]interface{}{}
+		for _, rule := range s.rules {
+			g, _ := rule["groupName"].(string)
+			groups[g] = append(groups[g], rule)
+		}
+		items := []interface{}{}
+		for g, rules := range groups {
+			items = append(items, map[string]interface{}{"name": g, "rules": rules})
+		}
+		reply(map[string]interface{}{"items": items})
+	case r.Method == http.MethodGet:
+		items := []interface{}{}
+		for _, v := range store {
+			items = append(items, v)
+		}
+		reply(map[string]interface{}{"items": items})
+	case r.Method == http.MethodPost:
+		id := strconv.Itoa(s.nextID)
+		switch parts[0] {
+		case "rules":
+			id = body["alertName"].(string)
+		case "receivers":
+			body["id"] = id
+			body["category"] = r.URL.Query().Get("category")
+		default:
+			body["id"] = s.nextID
+		}
+		if parts[0] != "rules" {
+			s.nextID++
+		}
+		store[id] = body
+		reply(body)
+	case r.Method == http.MethodPatch:
+		id := ""
+		if len(parts) > 1 {
+			id = parts[1]
+		} else {
+			id = strconv.Itoa(int(body["id"].(float64)))
+		}
+		if _, ok := store[id]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body["id"] = store[id]["id"]
+		if parts[0] == "receivers" {
+			body["category"] = store[id]["category"]
+		}
+		store[id] = body
+		reply(body)
+	case r.Method == http.MethodDelete:
+		delete(store, parts[1])
+		reply(map[string]interface{}{})
+	}
+}
+
+const testConfig = `
+apiVersion: kbcloud.apecloud.com/v1
+kind: AlertConfig
+spec:
+  receivers:
+  - name: ops
+    category: webhook
+    webhook:
+      url: https://hooks.example.com/ops
+  rules:
+  - name: MysqlDown
+    group: mysql
+    expr: mysql_up == 0
+    for: 1m
+    severity: critical
+  strategies:
+  - name: critical-to-ops
+    receivers: [ops]
+    severities: [critical, warning]
+    muteTimeInterval:
+      weekdays: [6, 0]
+      startTime: "17:00"
+      endTime: "24:00"
+  inhibits:
+  - name: down-inhibits-slow
+    sourceMatch:
+      alertname: [MysqlDown]
+    targetMatch:
+      alertname: [MysqlSlowQueries]
+    equal: [cluster]
+`
+
+func TestDiffApply(t *testing.T) {
+	ctx := context.Background()
+	s, client := newAlertStandIn(t)
+	s.receivers["99"] = map[string]interface{}{"id": "99", "name": "legacy", "category": "webhook", "webhookConfig": map[string]interface{}{"url": "https://legacy"}}
+	s.receivers["98"] = map[string]interface{}{"id": "98", "name": "default-email", "category": "receiver-group"}
+
+	cfg, err := Unmarshal([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Diff(ctx, client, "org", cfg, PlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Count(ActionCreate) != 4 || plan.Count(ActionDelete) != 0 || len(plan.Unmanaged) != 2 {
+		t.Fatalf("unexpected initial plan %+v", plan)
+	}
+	if err := Apply(ctx, client, "org", plan); err != nil {
+		t.Fatal(err)
+	}
+	want := "POST receivers,POST rules,POST strategies,POST inhibits"
+	if got := strings.Join(s.calls, ","); got != want {
+		t.Errorf("calls\n got: %s\nwant: %s", got, want)
+	}
+	strategy := s.strats["2"]
+	if ids := strategy["receiverIds"].([]interface{}); len(ids) != 1 || ids[0].(float64) != 1 {
+		t.Errorf("strategy does not reference the created receiver: %v", strategy)
+	}
+
+	// Applied config has no changes, regardless of list order.
+	cfg.Spec.Strategies[0].Severities = []string{"warning", "critical"}
+	if plan, err = Diff(ctx, client, "org", cfg, PlanOptions{}); err != nil || !plan.Empty() {
+		t.Fatalf("plan after apply is not empty: %+v, %v", plan, err)
+	}
+
+	// Change the rule, drop the inhibit and prune, protecting the default receivers.
+	cfg.Spec.Rules[0].For = "5m"
+	cfg.Spec.Inhibits = nil
+	s.calls = nil
+	plan, err = Diff(ctx, client, "org", cfg, PlanOptions{Prune: true, Protect: []string{"receiver/default-*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text bytes.Buffer
+	plan.WriteText(&text)
+	wantText := `~ rule MysqlDown
+    for: "1m" -> "5m"
+- inhibit down-inhibits-slow
+- receiver legacy
+  receiver default-email (unmanaged, kept)
+Plan: 0 to create, 1 to update, 2 to delete.
+`
+	if text.String() != wantText {
+		t.Errorf("plan\n got: %s\nwant: %s", text.String(), wantText)
+	}
+	if err := Apply(ctx, client, "org", plan); err != nil {
+		t.Fatal(err)
+	}
+	want = "PATCH rules/MysqlDown,DELETE inhibits/3,DELETE receivers/99"
+	if got := strings.Join(s.calls, ","); got != want {
+		t.Errorf("calls\n got: %s\nwant: %s", got, want)
+	}
+
+	// A receiver still used by a kept strategy is not pruned.
+	cfg.Spec.Strategies = nil
+	cfg.Spec.Receivers = nil
+	if _, err := Diff(ctx, client, "org", cfg, PlanOptions{Prune: true, Protect: []string{"strategy/*"}}); err == nil || !strings.Contains(err.Error(), `receiver "ops"`) {
+		t.Errorf("expected a pruning error, got %v", err)
+	}
+}
+
+func TestApplyIncompletePlan(t *testing.T) {
+	s, client := newAlertStandIn(t)
+	for _, plan := range []*Plan{
+		{Changes: []Change{{Ref: Ref{KindReceiver, "ops"}, Action: ActionCreate}}},
+		{Changes: []Change{{Ref: Ref{KindStrategy, "s"}, Action: ActionDelete}}},
+	} {
+		if err := Apply(context.Background(), client, "org", plan); !errors.Is(err, ErrIncompletePlan) {
+			t.Errorf("apply %+v: %v", plan.Changes[0], err)
+		}
+	}
+	if len(s.calls) != 0 {
+		t.Errorf("calls made: %v", s.calls)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, doc := range []string{
+		"apiVersion: v0\nkind: AlertConfig",
+		"apiVersion: kbcloud.apecloud.com/v1\nkind: AlertConfig\nspec:\n  rules:\n  - name: a\n    expr: up\n  - name: a\n    expr: up",
+		"apiVersion: kbcloud.apecloud.com/v1\nkind: AlertConfig\nspec:\n  strategies:\n  - name: s\n    receivers: [missing]",
+		"apiVersion: kbcloud.apecloud.com/v1\nkind: AlertConfig\nspec:\n  receivers:\n  - name: r\n    category: webhook",
+	} {
+		if _, err := Unmarshal([]byte(doc)); err == nil {
+			t.Errorf("expected an error for %q", doc)
+		}
+	}
+
+	cfg, err := Unmarshal([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{again.Spec.Rules[0].Name, again.Spec.Receivers[0].Name, again.Spec.Strategies[0].Name, again.Spec.Inhibits[0].Name}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "MysqlDown,critical-to-ops,down-inhibits-slow,ops" {
+		t.Errorf("round trip lost resources: %v", names)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	// checkExpr reports the expressions it is given, and whether metrics are checked.
+	checkExpr := func(expr string, isMetric func(string) bool) Issues {
+		if expr == "ok" {
+			return nil
+		}
+		return Issues{{Level: IssueWarning, Line: 1, Column: 2, Message: fmt.Sprintf("%s, mysql_up known: %v", expr, isMetric != nil && isMetric("mysql_up"))}}
+	}
+	v := NewStaticValidator([]string{"mysql_up"}).WithExprChecker(checkExpr)
+	issues := v.ValidateConfig(&Config{Spec: Spec{
+		Rules: []Rule{
+			{Name: "ok", Expr: "ok", For: "1h30m", Severity: "critical"},
+			{Name: "syntax", Expr: "checked", For: "5 min", Severity: "major"},
+			{Name: "empty"},
+		},
+		Strategies: []Strategy{
+			{Name: "s", RepeatInterval: "0s", Severities: []string{"critical", "urgent"}, MuteTimeInterval: &MuteTimeInterval{Weekdays: []int32{7}, StartTime: "25:00"}},
+		},
+	}})
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+	want := []string{
+		`warning: rule/syntax expr:1:2: checked, mysql_up known: true`,
+		`error: rule/syntax for: invalid duration "5 min", expected e.g. 30s, 5m or 1h30m`,
+		`error: rule/syntax severity: invalid severity "major", expected one of critical, warning, info`,
+		`error: rule/empty expr: expression is empty`,
+		`error: strategy/s repeatInterval: repeat interval must be positive`,
+		`error: strategy/s severities: invalid severity "urgent", expected one of critical, warning, info`,
+		`error: strategy/s muteTimeInterval.weekdays: invalid weekday 7, expected 0 (Sunday) to 6`,
+		`error: strategy/s muteTimeInterval.startTime: invalid time "25:00", expected HH:MM in UTC`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("issues\n got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if err := issues.Err(); err == nil || strings.Contains(err.Error(), "mysql_up known") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Without metrics, the checker is not asked to check metric names.
+	issues = NewStaticValidator(nil).WithExprChecker(checkExpr).ValidateRule(Rule{Name: "r", Expr: "checked"}.toAPI())
+	if len(issues) != 1 || issues[0].Message != "checked, mysql_up known: false" {
+		t.Errorf("issues without metrics: %v", issues)
+	}
+}
+
+func TestWebhookHandler(t *testing.T) {
+	var firing, resolved []string
+	h := NewWebhookHandler(WebhookOptions{
+		Secret: "s3cret",
+		OnFiring: func(ctx context.Context, a Alert) error {
+			firing = append(firing, a.AlertName+"@"+a.ClusterName+"/"+string(a.Severity))
+			return nil
+		},
+		OnResolved: func(ctx context.Context, a Alert) error {
+			resolved = append(resolved, a.Fingerprint)
+			return nil
+		},
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	post := func(query, body string, header map[string]string) int {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/"+query, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	alertmanager := `{"version":"4","receiver":"ops","status":"firing","alerts":[
+		{"status":"firing","fingerprint":"a1","startsAt":"2024-03-01T12:00:00Z","endsAt":"0001-01-01T00:00:00Z",
+		 "labels":{"alertname":"MysqlDown","severity":"critical","app_kubernetes_io_instance":"c1"},
+		 "annotations":{"summary":"MySQL is down"}}]}`
+	if code := post("", alertmanager, nil); code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated request: %d", code)
+	}
+	if code := post("?token=s3cret", alertmanager, nil); code != http.StatusNoContent {
+		t.Errorf("token request: %d", code)
+	}
+	// Repeated notifications of the same firing alert are dispatched once.
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(alertmanager))
+	if code := post("", alertmanager, map[string]string{"X-Signature-256": "sha256=" + hex.EncodeToString(mac.Sum(nil))}); code != http.StatusNoContent {
+		t.Errorf("signed request: %d", code)
+	}
+
+	objects := `[{"alertName":"MysqlDown","clusterName":"c1","severity":"critical","fingerprint":"a1","status":"resolved",
+		"startsAt":"2024-03-01T12:00:00Z","endsAt":"2024-03-01T12:10:00Z"}]`
+	if code := post("", objects, map[string]string{"Authorization": "Bearer s3cret"}); code != http.StatusNoContent {
+		t.Errorf("bearer request: %d", code)
+	}
+	if code := post("?token=s3cret", "{", nil); code != http.StatusBadRequest {
+		t.Errorf("invalid body: %d", code)
+	}
+
+	if strings.Join(firing, ",") != "MysqlDown@c1/critical" || strings.Join(resolved, ",") != "a1" {
+		t.Errorf("dispatched firing %v, resolved %v", firing, resolved)
+	}
+}
+
+func TestWebhookConcurrentDeliveries(t *testing.T) {
+	var calls atomic.Int32
+	entered, release := make(chan struct{}), make(chan struct{})
+	fail := true
+	h := NewWebhookHandler(WebhookOptions{
+		OnFiring: func(ctx context.Context, a Alert) error {
+			if calls.Add(1) == 1 {
+				close(entered)
+				<-release
+			}
+			return nil
+		},
+		OnResolved: func(ctx context.Context, a Alert) error {
+			calls.Add(1)
+			if fail {
+				return errors.New("unavailable")
+			}
+			return nil
+		},
+	})
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	firing := Notification{Alerts: []Alert{{Fingerprint: "a1", AlertName: "MysqlDown", Status: kbcloud.AlertStatusFiring, StartsAt: start}}}
+
+	// A delivery of an alert state whose callback is running is not dispatched again.
+	done := make(chan error)
+	go func() { done <- h.Dispatch(ctx, firing) }()
+	<-entered
+	if err := h.Dispatch(ctx, firing); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("firing dispatched %d times", n)
+	}
+
+	// A failed callback releases the state, so that the retry dispatches it.
+	resolved := Notification{Alerts: []Alert{{Fingerprint: "a1", AlertName: "MysqlDown", Status: kbcloud.AlertStatusResolved, StartsAt: start}}}
+	if err := h.Dispatch(ctx, resolved); err == nil {
+		t.Fatal("failed callback was not reported")
+	}
+	// The firing state is restored, so that its repetitions are still skipped.
+	if err := h.Dispatch(ctx, firing); err != nil || calls.Load() != 2 {
+		t.Fatalf("firing again: %d calls, %v", calls.Load(), err)
+	}
+	fail = false
+	for i := 0; i < 2; i++ {
+		if err := h.Dispatch(ctx, resolved); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("dispatched %d times, want 3", n)
+	}
+}
+
+func TestTriageAndMute(t *testing.T) {
+	ctx := context.Background()
+	objects := `{"items":[
+		{"id":1,"alertName":"MysqlDown","clusterName":"c1","severity":"critical","fingerprint":"f1","status":"firing","count":3,"startsAt":"2024-03-01T12:00:00Z"},
+		{"id":2,"alertName":"SlowQueries","clusterName":"c1","severity":"warning","fingerprint":"f2","status":"firing","startsAt":"2024-03-01T12:05:00Z"},
+		{"id":3,"alertName":"SlowQueries","clusterName":"c2","severity":"warning","fingerprint":"f3","status":"firing","startsAt":"2024-03-01T11:00:00Z"},
+		{"id":4,"alertName":"MysqlDown","clusterName":"c2","severity":"critical","fingerprint":"f4","status":"resolved"}]}`
+	var acked []string
+	disabled := map[string]bool{"c3": true}
+	client := apitest.NewClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := apitest.OrgPath(r, "org")
+		switch {
+		case path == "/alerts/objects" && r.Method == http.MethodGet:
+			apitest.WriteJSON(w, http.StatusOK, objects)
+		case path == "/alerts/objects":
+			var body []map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, a := range body {
+				acked = append(acked, r.URL.Query().Get("status")+":"+a["fingerprint"].(string))
+			}
+			apitest.WriteJSON(w, http.StatusOK, `{"items":[]}`)
+		case strings.HasPrefix(path, "/alerts/cluster/"):
+			cluster := strings.TrimPrefix(path, "/alerts/cluster/")
+			if r.Method == http.MethodPatch {
+				var body struct{ Disabled bool }
+				json.NewDecoder(r.Body).Decode(&body)
+				disabled[cluster] = body.Disabled
+			}
+			apitest.WriteJSON(w, http.StatusOK, map[string]bool{"disabled": disabled[cluster]})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	triage := NewTriage(client, "org")
+	groups, err := triage.Groups(ctx, Query{}, GroupByRule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Key != "MysqlDown" || groups[0].Count != 3 ||
+		groups[1].Key != "SlowQueries" || strings.Join(groups[1].Clusters, ",") != "c1,c2" || !groups[1].FirstSeen.Equal(time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected groups %+v", groups)
+	}
+	ackedAlerts, err := triage.Acknowledge(ctx, Query{AlertNames: []string{"SlowQueries"}, Clusters: []string{"c2"}})
+	if err != nil || len(ackedAlerts) != 1 || strings.Join(acked, ",") != "resolved:f3" {
+		t.Errorf("acknowledged %v (%v), %v", acked, ackedAlerts, err)
+	}
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := NewFileLeaseStore(t.TempDir() + "/leases.json")
+	muter := NewMuter(client, "org", store)
+	muter.Now = func() time.Time { return now }
+	if _, err := muter.Mute(ctx, "c1", time.Hour, "maintenance"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := muter.Mute(ctx, "c3", 30*time.Minute, "already off"); err != nil {
+		t.Fatal(err)
+	}
+	if !disabled["c1"] || !disabled["c3"] {
+		t.Fatalf("alerts not disabled: %v", disabled)
+	}
+
+	// A restarted muter lifts the expired leases it finds in the store.
+	now = now.Add(45 * time.Minute)
+	muter = NewMuter(client, "org", store)
+	muter.Now = func() time.Time { return now }
+	lifted, err := muter.Reconcile(ctx)
+	if err != nil || len(lifted) != 1 || lifted[0].Cluster != "c3" || !disabled["c3"] {
+		t.Fatalf("lifted %+v, %v; switches %v", lifted, err, disabled)
+	}
+	now = now.Add(time.Hour)
+	if lifted, err = muter.Reconcile(ctx); err != nil || len(lifted) != 1 || disabled["c1"] {
+		t.Fatalf("lifted %+v, %v; switches %v", lifted, err, disabled)
+	}
+	if leases, _ := muter.Leases(ctx); len(leases) != 0 {
+		t.Errorf("leases left: %+v", leases)
+	}
+}
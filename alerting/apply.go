@@ -0,0 +1,115 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// Apply makes the changes of plan in orgName, in order. It stops at the first
+// failure; the changes made before it are kept, and a new Diff plans the rest.
+// Changes not planned by Diff fail with ErrIncompletePlan.
+func Apply(ctx context.Context, client *common.APIClient, orgName string, plan *Plan) error {
+	receiverApi := kbcloud.NewAlertReceiverApi(client)
+	ruleApi := kbcloud.NewAlertRuleApi(client)
+	strategyApi := kbcloud.NewAlertStrategyApi(client)
+	inhibitApi := kbcloud.NewAlertInhibitApi(client)
+
+	receiverIDs := map[string]int32{}
+	for name, id := range plan.receiverIDs {
+		receiverIDs[name] = id
+	}
+
+	for _, c := range plan.Changes {
+		if err := c.check(); err != nil {
+			return fmt.Errorf("%s %s %s: %w", c.Action, c.Kind, c.Name, err)
+		}
+		var err error
+		switch c.Kind {
+		case KindReceiver:
+			switch c.Action {
+			case ActionCreate:
+				r := c.desired.(Receiver)
+				var created kbcloud.AlertReceiver
+				created, _, err = receiverApi.CreateAlertReceiver(ctx, orgName, r.Category, r.toAPI())
+				if err == nil {
+					id, perr := strconv.ParseInt(created.GetId(), 10, 32)
+					if perr != nil {
+						err = fmt.Errorf("unexpected receiver id %q", created.GetId())
+					}
+					receiverIDs[r.Name] = int32(id)
+				}
+			case ActionUpdate:
+				_, _, err = receiverApi.PatchAlertReceiver(ctx, orgName, c.id, c.desired.(Receiver).toAPI())
+			case ActionDelete:
+				_, err = receiverApi.DeleteAlertReceiver(ctx, orgName, c.id)
+			}
+		case KindRule:
+			switch c.Action {
+			case ActionCreate:
+				_, _, err = ruleApi.CreateAlertRule(ctx, orgName, c.desired.(Rule).toAPI())
+			case ActionUpdate:
+				_, _, err = ruleApi.UpdateAlertRule(ctx, orgName, c.Name, c.desired.(Rule).toAPI())
+			case ActionDelete:
+				_, _, err = ruleApi.DeleteAlertRule(ctx, orgName, c.Name)
+			}
+		case KindStrategy:
+			switch c.Action {
+			case ActionCreate, ActionUpdate:
+				var body kbcloud.AlertStrategy
+				body, err = c.desired.(Strategy).toAPI(receiverIDs)
+				if err != nil {
+					break
+				}
+				if c.Action == ActionCreate {
+					_, _, err = strategyApi.CreateAlertStrategy(ctx, orgName, body)
+				} else {
+					_, _, err = strategyApi.UpdateAlertStrategy(ctx, orgName, c.id, body)
+				}
+			case ActionDelete:
+				_, _, err = strategyApi.DeleteAlertStrategy(ctx, orgName, c.id)
+			}
+		case KindInhibit:
+			switch c.Action {
+			case ActionCreate:
+				params := kbcloud.NewCreateAlertInhibitOptionalParameters().WithBody(c.desired.(Inhibit).toAPI())
+				_, _, err = inhibitApi.CreateAlertInhibit(ctx, orgName, *params)
+			case ActionUpdate:
+				body := c.desired.(Inhibit).toAPI()
+				id, perr := strconv.ParseInt(c.id, 10, 32)
+				if perr != nil {
+					err = fmt.Errorf("unexpected inhibit id %q", c.id)
+					break
+				}
+				body.Id = common.PtrInt32(int32(id))
+				params := kbcloud.NewPatchAlertInhibitOptionalParameters().WithBody(body)
+				_, _, err = inhibitApi.PatchAlertInhibit(ctx, orgName, *params)
+			case ActionDelete:
+				_, _, err = inhibitApi.DeleteAlertInhibit(ctx, orgName, c.id)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s %s: %w", c.Action, c.Kind, c.Name, err)
+		}
+	}
+	return nil
+}
+
+// check returns ErrIncompletePlan when c lacks what Apply needs to make it.
+func (c Change) check() error {
+	if c.Action != ActionDelete && c.desired == nil {
+		return ErrIncompletePlan
+	}
+	// Rules are addressed by name, the other resources by their live id.
+	if c.Action != ActionCreate && c.Kind != KindRule && c.id == "" {
+		return ErrIncompletePlan
+	}
+	return nil
+}
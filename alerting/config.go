@@ -0,0 +1,410 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package alerting manages the alert configuration of an organization as code:
+// rules, receivers, strategies and inhibits are declared in a YAML document,
+// validated, diffed against the live configuration and applied in dependency
+// order. It also receives the notifications of webhook receivers and helps
+// triage alerts: grouping, bulk acknowledgement and time-boxed mutes.
+package alerting
+
+import (
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+const (
+	// APIVersion is the alert config format version read by this package.
+	APIVersion = "kbcloud.apecloud.com/v1"
+	// Kind identifies alert config documents.
+	Kind = "AlertConfig"
+)
+
+// Config is the declared alert configuration of an organization.
+type Config struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Metadata   Metadata `json:"metadata,omitempty"`
+	Spec       Spec     `json:"spec"`
+}
+
+// Metadata describes a config document.
+type Metadata struct {
+	Name string `json:"name,omitempty"`
+}
+
+// Spec holds the declared resources. Resources are matched with the live
+// configuration by name.
+type Spec struct {
+	Rules      []Rule     `json:"rules,omitempty"`
+	Receivers  []Receiver `json:"receivers,omitempty"`
+	Strategies []Strategy `json:"strategies,omitempty"`
+	Inhibits   []Inhibit  `json:"inhibits,omitempty"`
+}
+
+// Rule is an alert rule.
+type Rule struct {
+	Name        string                `json:"name"`
+	Group       string                `json:"group,omitempty"`
+	Expr        string                `json:"expr"`
+	For         string                `json:"for,omitempty"`
+	Severity    kbcloud.AlertSeverity `json:"severity"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Disabled    bool                  `json:"disabled,omitempty"`
+}
+
+// Receiver is an alert receiver.
+type Receiver struct {
+	Name      string                        `json:"name"`
+	Category  kbcloud.AlertReceiverCategory `json:"category"`
+	Webhook   *Webhook                      `json:"webhook,omitempty"`
+	UserGroup *UserGroup                    `json:"userGroup,omitempty"`
+}
+
+// Webhook is the webhook of a receiver.
+type Webhook struct {
+	URL string `json:"url"`
+}
+
+// UserGroup is the users notified by a receiver group.
+type UserGroup struct {
+	IDs          []string `json:"ids,omitempty"`
+	EmailEnabled bool     `json:"emailEnabled,omitempty"`
+	SMSEnabled   bool     `json:"smsEnabled,omitempty"`
+}
+
+// Strategy routes alerts to receivers.
+type Strategy struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Receivers are the names of the receivers notified.
+	Receivers  []string `json:"receivers"`
+	Severities []string `json:"severities,omitempty"`
+	Engines    []string `json:"engines,omitempty"`
+	Clusters   []string `json:"clusters,omitempty"`
+	Envs       []string `json:"envs,omitempty"`
+	// Rules are the names of the rules routed.
+	Rules            []string          `json:"rules,omitempty"`
+	RepeatInterval   string            `json:"repeatInterval,omitempty"`
+	MuteTimeInterval *MuteTimeInterval `json:"muteTimeInterval,omitempty"`
+	Disabled         bool              `json:"disabled,omitempty"`
+}
+
+// MuteTimeInterval is when a strategy sends no notifications.
+type MuteTimeInterval struct {
+	Weekdays []int32 `json:"weekdays,omitempty"`
+	// StartTime and EndTime are UTC times such as "17:00".
+	StartTime   string `json:"startTime,omitempty"`
+	EndTime     string `json:"endTime,omitempty"`
+	OnceMinutes int32  `json:"onceMinutes,omitempty"`
+}
+
+// Inhibit mutes target alerts while source alerts fire.
+type Inhibit struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description,omitempty"`
+	SourceMatch map[string][]string `json:"sourceMatch,omitempty"`
+	TargetMatch map[string][]string `json:"targetMatch,omitempty"`
+	Equal       []string            `json:"equal,omitempty"`
+}
+
+// Unmarshal parses a YAML or JSON config document and validates it.
+func Unmarshal(data []byte) (*Config, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := common.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Marshal serializes the config as YAML.
+func Marshal(cfg *Config) ([]byte, error) {
+	data, err := common.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(data)
+}
+
+// Validate checks the version of the config, that names are set and unique
+// and that strategies only reference declared receivers.
+func (cfg *Config) Validate() error {
+	if cfg.APIVersion != APIVersion {
+		return fmt.Errorf("unsupported alert config apiVersion %q, expected %q", cfg.APIVersion, APIVersion)
+	}
+	if cfg.Kind != Kind {
+		return fmt.Errorf("unexpected alert config kind %q, expected %q", cfg.Kind, Kind)
+	}
+	names := map[ResourceKind]map[string]bool{}
+	declare := func(kind ResourceKind, name string) error {
+		if name == "" {
+			return fmt.Errorf("%s without a name", kind)
+		}
+		if names[kind] == nil {
+			names[kind] = map[string]bool{}
+		}
+		if names[kind][name] {
+			return fmt.Errorf("duplicate %s %q", kind, name)
+		}
+		names[kind][name] = true
+		return nil
+	}
+	for _, r := range cfg.Spec.Rules {
+		if err := declare(KindRule, r.Name); err != nil {
+			return err
+		}
+		if r.Expr == "" {
+			return fmt.Errorf("rule %q has no expr", r.Name)
+		}
+	}
+	for _, r := range cfg.Spec.Receivers {
+		if err := declare(KindReceiver, r.Name); err != nil {
+			return err
+		}
+		if r.Category == "" {
+			return fmt.Errorf("receiver %q has no category", r.Name)
+		}
+		if r.Category != kbcloud.AlertReceiverCategoryReceiverGroup && (r.Webhook == nil || r.Webhook.URL == "") {
+			return fmt.Errorf("receiver %q of category %s has no webhook url", r.Name, r.Category)
+		}
+	}
+	for _, s := range cfg.Spec.Strategies {
+		if err := declare(KindStrategy, s.Name); err != nil {
+			return err
+		}
+		for _, name := range s.Receivers {
+			if !names[KindReceiver][name] {
+				return fmt.Errorf("strategy %q references undeclared receiver %q", s.Name, name)
+			}
+		}
+	}
+	for _, i := range cfg.Spec.Inhibits {
+		if err := declare(KindInhibit, i.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Rule) toAPI() kbcloud.AlertRule {
+	rule := kbcloud.AlertRule{
+		AlertName:   r.Name,
+		Expr:        common.PtrString(r.Expr),
+		GroupName:   optString(r.Group),
+		For:         optString(r.For),
+		Summary:     optString(r.Summary),
+		Description: optString(r.Description),
+		Disabled:    common.PtrBool(r.Disabled),
+	}
+	if r.Severity != "" {
+		rule.Severity = &r.Severity
+	}
+	return rule
+}
+
+func ruleFromAPI(group string, r kbcloud.AlertRule) Rule {
+	if g := r.GetGroupName(); g != "" {
+		group = g
+	}
+	return Rule{
+		Name:        r.AlertName,
+		Group:       group,
+		Expr:        r.GetExpr(),
+		For:         r.GetFor(),
+		Severity:    r.GetSeverity(),
+		Summary:     r.GetSummary(),
+		Description: r.GetDescription(),
+		Disabled:    r.GetDisabled(),
+	}
+}
+
+func (r Receiver) toAPI() kbcloud.AlertReceiver {
+	receiver := kbcloud.AlertReceiver{
+		Name:     common.PtrString(r.Name),
+		Category: &r.Category,
+	}
+	if r.Webhook != nil {
+		receiver.WebhookConfig = &kbcloud.WebhookConfig{Url: r.Webhook.URL}
+	}
+	if g := r.UserGroup; g != nil {
+		receiver.UserGroup = &kbcloud.AlertReceiverUserGroup{
+			Ids:          g.IDs,
+			EmailEnabled: common.PtrBool(g.EmailEnabled),
+			SmsEnabled:   common.PtrBool(g.SMSEnabled),
+		}
+	}
+	return receiver
+}
+
+func receiverFromAPI(r kbcloud.AlertReceiver) Receiver {
+	receiver := Receiver{Name: r.GetName(), Category: r.GetCategory()}
+	if w, ok := r.GetWebhookConfigOk(); ok && w != nil {
+		receiver.Webhook = &Webhook{URL: w.Url}
+	}
+	if g, ok := r.GetUserGroupOk(); ok && g != nil {
+		receiver.UserGroup = &UserGroup{IDs: g.Ids, EmailEnabled: g.GetEmailEnabled(), SMSEnabled: g.GetSmsEnabled()}
+	}
+	return receiver
+}
+
+// toAPI converts the strategy, resolving receiver names with receiverIDs.
+func (s Strategy) toAPI(receiverIDs map[string]int32) (kbcloud.AlertStrategy, error) {
+	strategy := kbcloud.AlertStrategy{
+		Name:           common.PtrString(s.Name),
+		Description:    optString(s.Description),
+		ReceiverIds:    []int32{},
+		Severities:     s.Severities,
+		Engines:        s.Engines,
+		Clusters:       s.Clusters,
+		Envs:           s.Envs,
+		Rules:          s.Rules,
+		RepeatInterval: optString(s.RepeatInterval),
+		Disabled:       common.PtrBool(s.Disabled),
+	}
+	for _, name := range s.Receivers {
+		id, ok := receiverIDs[name]
+		if !ok {
+			return strategy, fmt.Errorf("strategy %q: unknown receiver %q", s.Name, name)
+		}
+		strategy.ReceiverIds = append(strategy.ReceiverIds, id)
+	}
+	if m := s.MuteTimeInterval; m != nil {
+		strategy.MuteTimeInterval = &kbcloud.AlertStrategyMuteTimeInterval{Weekdays: m.Weekdays}
+		if m.OnceMinutes != 0 {
+			strategy.MuteTimeInterval.OnceMinutes = common.PtrInt32(m.OnceMinutes)
+		}
+		if m.StartTime != "" || m.EndTime != "" {
+			strategy.MuteTimeInterval.Times = &kbcloud.AlertStrategyMuteTimeIntervalTimes{
+				StartTime: optString(m.StartTime),
+				EndTime:   optString(m.EndTime),
+			}
+		}
+	}
+	return strategy, nil
+}
+
+// strategyFromAPI converts a live strategy, naming its receivers with receiverNames.
+func strategyFromAPI(s kbcloud.AlertStrategy, receiverNames map[int32]string) Strategy {
+	strategy := Strategy{
+		Name:           s.GetName(),
+		Description:    s.GetDescription(),
+		Severities:     s.Severities,
+		Engines:        s.Engines,
+		Clusters:       s.Clusters,
+		Envs:           s.Envs,
+		Rules:          s.Rules,
+		RepeatInterval: s.GetRepeatInterval(),
+		Disabled:       s.GetDisabled(),
+	}
+	for _, id := range s.ReceiverIds {
+		name, ok := receiverNames[id]
+		if !ok {
+			name = fmt.Sprintf("#%d", id)
+		}
+		strategy.Receivers = append(strategy.Receivers, name)
+	}
+	if m, ok := s.GetMuteTimeIntervalOk(); ok && m != nil {
+		strategy.MuteTimeInterval = &MuteTimeInterval{Weekdays: m.Weekdays, OnceMinutes: m.GetOnceMinutes()}
+		if t, ok := m.GetTimesOk(); ok && t != nil {
+			strategy.MuteTimeInterval.StartTime = t.GetStartTime()
+			strategy.MuteTimeInterval.EndTime = t.GetEndTime()
+		}
+	}
+	return strategy
+}
+
+func (i Inhibit) toAPI() kbcloud.AlertInhibit {
+	return kbcloud.AlertInhibit{
+		Name:        common.PtrString(i.Name),
+		Description: optString(i.Description),
+		SourceMatch: i.SourceMatch,
+		TargetMatch: i.TargetMatch,
+		Equal:       i.Equal,
+	}
+}
+
+func inhibitFromAPI(i kbcloud.AlertInhibit) Inhibit {
+	return Inhibit{
+		Name:        i.GetName(),
+		Description: i.GetDescription(),
+		SourceMatch: i.SourceMatch,
+		TargetMatch: i.TargetMatch,
+		Equal:       i.Equal,
+	}
+}
+
+// normalize sorts the unordered lists of a resource, so that they compare
+// equal regardless of order.
+func normalize(v interface{}) interface{} {
+	sorted := func(s []string) []string {
+		if len(s) == 0 {
+			return nil
+		}
+		s = append([]string(nil), s...)
+		sort.Strings(s)
+		return s
+	}
+	sortedMatch := func(m map[string][]string) map[string][]string {
+		if len(m) == 0 {
+			return nil
+		}
+		out := make(map[string][]string, len(m))
+		for k, v := range m {
+			out[k] = sorted(v)
+		}
+		return out
+	}
+	switch r := v.(type) {
+	case Receiver:
+		if r.UserGroup != nil {
+			g := *r.UserGroup
+			g.IDs = sorted(g.IDs)
+			r.UserGroup = &g
+		}
+		return r
+	case Strategy:
+		r.Receivers = sorted(r.Receivers)
+		r.Severities = sorted(r.Severities)
+		r.Engines = sorted(r.Engines)
+		r.Clusters = sorted(r.Clusters)
+		r.Envs = sorted(r.Envs)
+		r.Rules = sorted(r.Rules)
+		if r.MuteTimeInterval != nil {
+			m := *r.MuteTimeInterval
+			m.Weekdays = append([]int32(nil), m.Weekdays...)
+			sort.Slice(m.Weekdays, func(i, j int) bool { return m.Weekdays[i] < m.Weekdays[j] })
+			if len(m.Weekdays) == 0 {
+				m.Weekdays = nil
+			}
+			r.MuteTimeInterval = &m
+		}
+		return r
+	case Inhibit:
+		r.SourceMatch = sortedMatch(r.SourceMatch)
+		r.TargetMatch = sortedMatch(r.TargetMatch)
+		r.Equal = sorted(r.Equal)
+		return r
+	}
+	return v
+}
+
+func optString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return common.PtrString(s)
+}
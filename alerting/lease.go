@@ -0,0 +1,273 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// Lease mutes the alerts of a cluster until it expires.
+type Lease struct {
+	Cluster string    `json:"cluster"`
+	Reason  string    `json:"reason,omitempty"`
+	Start   time.Time `json:"start"`
+	Expires time.Time `json:"expires"`
+	// WasDisabled records that alerts were already disabled when the lease
+	// was taken; they are left disabled when it is lifted.
+	WasDisabled bool `json:"wasDisabled,omitempty"`
+}
+
+// LeaseStore persists leases, so that a restarted Muter lifts the leases
+// taken before.
+type LeaseStore interface {
+	// Load returns the saved leases.
+	Load(ctx context.Context) ([]Lease, error)
+	// Save replaces the saved leases.
+	Save(ctx context.Context, leases []Lease) error
+}
+
+// MemoryLeaseStore keeps leases in memory.
+type MemoryLeaseStore struct {
+	mu     sync.Mutex
+	leases []Lease
+}
+
+var _ LeaseStore = (*MemoryLeaseStore)(nil)
+
+// Load returns the leases.
+func (s *MemoryLeaseStore) Load(ctx context.Context) ([]Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Lease(nil), s.leases...), nil
+}
+
+// Save stores a copy of leases.
+func (s *MemoryLeaseStore) Save(ctx context.Context, leases []Lease) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leases = append([]Lease(nil), leases...)
+	return nil
+}
+
+// FileLeaseStore keeps leases in a JSON file.
+type FileLeaseStore struct {
+	path string
+}
+
+var _ LeaseStore = (*FileLeaseStore)(nil)
+
+// NewFileLeaseStore returns a LeaseStore keeping leases in the file at path.
+func NewFileLeaseStore(path string) *FileLeaseStore {
+	return &FileLeaseStore{path: path}
+}
+
+// Load reads the file. A missing file has no leases.
+func (s *FileLeaseStore) Load(ctx context.Context) ([]Lease, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var leases []Lease
+	err = common.Unmarshal(data, &leases)
+	return leases, err
+}
+
+// Save writes the leases to a temporary file and renames it into place.
+func (s *FileLeaseStore) Save(ctx context.Context, leases []Lease) error {
+	if leases == nil {
+		leases = []Lease{}
+	}
+	data, err := common.Marshal(leases)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), ".tmp-"+filepath.Base(s.path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// Muter disables the alerts of clusters for a limited time. A lease is saved
+// before alerts are disabled, so a crash never leaves alerts disabled
+// without a lease that Reconcile eventually lifts.
+type Muter struct {
+	switchApi *kbcloud.ClusterAlertSwitchApi
+	orgName   string
+	store     LeaseStore
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewMuter returns a Muter of the clusters of orgName keeping leases in store.
+// A nil store keeps leases in memory.
+func NewMuter(client *common.APIClient, orgName string, store LeaseStore) *Muter {
+	if store == nil {
+		store = &MemoryLeaseStore{}
+	}
+	return &Muter{
+		switchApi: kbcloud.NewClusterAlertSwitchApi(client),
+		orgName:   orgName,
+		store:     store,
+		Now:       time.Now,
+	}
+}
+
+// Mute disables the alerts of cluster for d. Muting a muted cluster replaces
+// the expiry and reason of its lease.
+func (m *Muter) Mute(ctx context.Context, cluster string, d time.Duration, reason string) (Lease, error) {
+	if d <= 0 {
+		return Lease{}, fmt.Errorf("mute duration must be positive, got %s", d)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	leases, err := m.store.Load(ctx)
+	if err != nil {
+		return Lease{}, fmt.Errorf("load mute leases: %w", err)
+	}
+	now := m.Now()
+	lease := Lease{Cluster: cluster, Reason: reason, Start: now, Expires: now.Add(d)}
+	i := findLease(leases, cluster)
+	if i >= 0 {
+		lease.Start, lease.WasDisabled = leases[i].Start, leases[i].WasDisabled
+		leases[i] = lease
+	} else {
+		current, _, err := m.switchApi.GetClusterAlertDisabled(ctx, m.orgName, cluster)
+		if err != nil {
+			return Lease{}, fmt.Errorf("get alert switch of cluster %s: %w", cluster, err)
+		}
+		lease.WasDisabled = current.Disabled
+		leases = append(leases, lease)
+	}
+	if err := m.store.Save(ctx, leases); err != nil {
+		return Lease{}, fmt.Errorf("save mute leases: %w", err)
+	}
+	if !lease.WasDisabled {
+		if err := m.setDisabled(ctx, cluster, true); err != nil {
+			if i < 0 {
+				// Drop the new lease, alerts were not disabled.
+				m.store.Save(ctx, leases[:len(leases)-1])
+			}
+			return Lease{}, err
+		}
+	}
+	return lease, nil
+}
+
+// Unmute lifts the lease of cluster now. Clusters without a lease are left unchanged.
+func (m *Muter) Unmute(ctx context.Context, cluster string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	leases, err := m.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load mute leases: %w", err)
+	}
+	i := findLease(leases, cluster)
+	if i < 0 {
+		return nil
+	}
+	return m.lift(ctx, leases, i)
+}
+
+// Leases returns the current leases.
+func (m *Muter) Leases(ctx context.Context) ([]Lease, error) {
+	return m.store.Load(ctx)
+}
+
+// Reconcile lifts the expired leases and returns them.
+func (m *Muter) Reconcile(ctx context.Context) ([]Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	leases, err := m.store.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load mute leases: %w", err)
+	}
+	var lifted []Lease
+	now := m.Now()
+	for i := 0; i < len(leases); {
+		if now.Before(leases[i].Expires) {
+			i++
+			continue
+		}
+		lease := leases[i]
+		if err := m.lift(ctx, leases, i); err != nil {
+			return lifted, err
+		}
+		leases = append(leases[:i], leases[i+1:]...)
+		lifted = append(lifted, lease)
+	}
+	return lifted, nil
+}
+
+// Run reconciles every interval until ctx is done or lifting a lease fails.
+func (m *Muter) Run(ctx context.Context, interval time.Duration) error {
+	return wait.Poll(ctx, interval, 0, func(ctx context.Context) (bool, error) {
+		_, err := m.Reconcile(ctx)
+		return false, err
+	})
+}
+
+// lift enables the alerts of the lease at i and removes it from the store.
+func (m *Muter) lift(ctx context.Context, leases []Lease, i int) error {
+	lease := leases[i]
+	if !lease.WasDisabled {
+		if err := m.setDisabled(ctx, lease.Cluster, false); err != nil {
+			return err
+		}
+	}
+	rest := append(append([]Lease(nil), leases[:i]...), leases[i+1:]...)
+	if err := m.store.Save(ctx, rest); err != nil {
+		return fmt.Errorf("save mute leases: %w", err)
+	}
+	return nil
+}
+
+func (m *Muter) setDisabled(ctx context.Context, cluster string, disabled bool) error {
+	params := kbcloud.NewSetClusterAlertDisabledOptionalParameters().WithBody(kbcloud.AlertCluster{Disabled: disabled})
+	if _, _, err := m.switchApi.SetClusterAlertDisabled(ctx, m.orgName, cluster, *params); err != nil {
+		return fmt.Errorf("set alert switch of cluster %s: %w", cluster, err)
+	}
+	return nil
+}
+
+func findLease(leases []Lease, cluster string) int {
+	for i, l := range leases {
+		if l.Cluster == cluster {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,393 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package alerting
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// ResourceKind is the kind of an alert resource.
+type ResourceKind string
+
+// List of ResourceKind, in dependency order.
+const (
+	KindReceiver ResourceKind = "receiver"
+	KindRule     ResourceKind = "rule"
+	KindStrategy ResourceKind = "strategy"
+	KindInhibit  ResourceKind = "inhibit"
+)
+
+var kindOrder = []ResourceKind{KindReceiver, KindRule, KindStrategy, KindInhibit}
+
+// Action is what applying a change does to a resource.
+type Action string
+
+// List of Action.
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Ref names a resource.
+type Ref struct {
+	Kind ResourceKind
+	Name string
+}
+
+func (r Ref) String() string {
+	return string(r.Kind) + "/" + r.Name
+}
+
+// FieldChange is a field changed by an update, with JSON encoded values.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// ErrIncompletePlan is returned by Apply for a change that was not planned by
+// Diff, and so lacks the resource to write or the id of the live resource.
+var ErrIncompletePlan = errors.New("change was not planned by Diff")
+
+// Change is a change to a resource.
+type Change struct {
+	Ref
+	Action Action
+	// Fields lists the fields changed by an update.
+	Fields []FieldChange
+
+	id      string
+	desired interface{}
+}
+
+// Plan is the list of changes converging the live configuration to a config,
+// ordered so that resources are created before the resources referencing
+// them and deleted after.
+//
+// A plan only lives in memory: it carries the resources and live ids Apply
+// needs, which are not serialized, so apply a plan returned by Diff rather
+// than one rebuilt from its text or JSON form.
+type Plan struct {
+	Changes []Change
+	// Unmanaged are the live resources missing from the config that are kept,
+	// because pruning is off or they are protected.
+	Unmanaged []Ref
+
+	receiverIDs map[string]int32
+}
+
+// PlanOptions configures Diff.
+type PlanOptions struct {
+	// Prune deletes live resources missing from the config.
+	Prune bool
+	// Protect are path.Match patterns of resources never deleted, matched
+	// against the name and against "kind/name", e.g. "receiver/default-*".
+	Protect []string
+}
+
+// Empty reports whether the plan has no changes.
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Count returns the number of changes with action.
+func (p *Plan) Count(action Action) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText writes the plan in a human readable form.
+func (p *Plan) WriteText(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	for _, c := range p.Changes {
+		sign := map[Action]string{ActionCreate: "+", ActionUpdate: "~", ActionDelete: "-"}[c.Action]
+		fmt.Fprintf(b, "%s %s %s\n", sign, c.Kind, c.Name)
+		for _, f := range c.Fields {
+			fmt.Fprintf(b, "    %s: %s -> %s\n", f.Field, orNull(f.Old), orNull(f.New))
+		}
+	}
+	for _, r := range p.Unmanaged {
+		fmt.Fprintf(b, "  %s %s (unmanaged, kept)\n", r.Kind, r.Name)
+	}
+	fmt.Fprintf(b, "Plan: %d to create, %d to update, %d to delete.\n", p.Count(ActionCreate), p.Count(ActionUpdate), p.Count(ActionDelete))
+	return b.Flush()
+}
+
+func orNull(s string) string {
+	if s == "" {
+		return "null"
+	}
+	return s
+}
+
+// liveResource is a resource of the live configuration.
+type liveResource struct {
+	id       string
+	resource interface{}
+	// uses are the receivers referenced by a strategy.
+	uses []string
+}
+
+// state is the live configuration indexed by kind and name.
+type state struct {
+	resources   map[ResourceKind]map[string]liveResource
+	receiverIDs map[string]int32
+}
+
+// Diff reads the live alert configuration of orgName and returns the plan
+// converging it to cfg.
+func Diff(ctx context.Context, client *common.APIClient, orgName string, cfg *Config, opts PlanOptions) (*Plan, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	live, err := fetchState(ctx, client, orgName)
+	if err != nil {
+		return nil, err
+	}
+	return diff(cfg, live, opts)
+}
+
+func fetchState(ctx context.Context, client *common.APIClient, orgName string) (*state, error) {
+	s := &state{
+		resources:   map[ResourceKind]map[string]liveResource{},
+		receiverIDs: map[string]int32{},
+	}
+	add := func(kind ResourceKind, name string, r liveResource) error {
+		if s.resources[kind] == nil {
+			s.resources[kind] = map[string]liveResource{}
+		}
+		if _, ok := s.resources[kind][name]; ok {
+			return fmt.Errorf("live configuration has several %ss named %q", kind, name)
+		}
+		s.resources[kind][name] = r
+		return nil
+	}
+
+	receivers, _, err := kbcloud.NewAlertReceiverApi(client).ListAlertReceivers(ctx, orgName)
+	if err != nil {
+		return nil, fmt.Errorf("list alert receivers: %w", err)
+	}
+	receiverNames := map[int32]string{}
+	for _, r := range receivers.Items {
+		if err := add(KindReceiver, r.GetName(), liveResource{id: r.GetId(), resource: receiverFromAPI(r)}); err != nil {
+			return nil, err
+		}
+		if id, err := strconv.ParseInt(r.GetId(), 10, 32); err == nil {
+			receiverNames[int32(id)] = r.GetName()
+			s.receiverIDs[r.GetName()] = int32(id)
+		}
+	}
+
+	rules, _, err := kbcloud.NewAlertRuleApi(client).ListAlertRules(ctx, orgName)
+	if err != nil {
+		return nil, fmt.Errorf("list alert rules: %w", err)
+	}
+	for _, g := range rules.Items {
+		for _, r := range g.Rules {
+			if err := add(KindRule, r.AlertName, liveResource{id: r.AlertName, resource: ruleFromAPI(g.GetName(), r)}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	strategies, _, err := kbcloud.NewAlertStrategyApi(client).ListAlertStrategies(ctx, orgName)
+	if err != nil {
+		return nil, fmt.Errorf("list alert strategies: %w", err)
+	}
+	for _, st := range strategies.Items {
+		strategy := strategyFromAPI(st, receiverNames)
+		r := liveResource{id: strconv.Itoa(int(st.GetId())), resource: strategy, uses: strategy.Receivers}
+		if err := add(KindStrategy, st.GetName(), r); err != nil {
+			return nil, err
+		}
+	}
+
+	inhibits, _, err := kbcloud.NewAlertInhibitApi(client).ListAlertInhibits(ctx, orgName)
+	if err != nil {
+		return nil, fmt.Errorf("list alert inhibits: %w", err)
+	}
+	for _, i := range inhibits.Items {
+		if err := add(KindInhibit, i.GetName(), liveResource{id: strconv.Itoa(int(i.GetId())), resource: inhibitFromAPI(i)}); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func diff(cfg *Config, live *state, opts PlanOptions) (*Plan, error) {
+	desired := map[ResourceKind][]Ref{}
+	resources := map[Ref]interface{}{}
+	for _, r := range cfg.Spec.Receivers {
+		ref := Ref{KindReceiver, r.Name}
+		desired[ref.Kind], resources[ref] = append(desired[ref.Kind], ref), r
+	}
+	for _, r := range cfg.Spec.Rules {
+		ref := Ref{KindRule, r.Name}
+		desired[ref.Kind], resources[ref] = append(desired[ref.Kind], ref), r
+	}
+	for _, s := range cfg.Spec.Strategies {
+		ref := Ref{KindStrategy, s.Name}
+		desired[ref.Kind], resources[ref] = append(desired[ref.Kind], ref), s
+	}
+	for _, i := range cfg.Spec.Inhibits {
+		ref := Ref{KindInhibit, i.Name}
+		desired[ref.Kind], resources[ref] = append(desired[ref.Kind], ref), i
+	}
+
+	plan := &Plan{receiverIDs: live.receiverIDs}
+	for _, kind := range kindOrder {
+		for _, ref := range desired[kind] {
+			want := resources[ref]
+			cur, ok := live.resources[kind][ref.Name]
+			if !ok {
+				plan.Changes = append(plan.Changes, Change{Ref: ref, Action: ActionCreate, desired: want})
+				continue
+			}
+			if r, ok := want.(Rule); ok && r.Group == "" {
+				// Rules declared without a group stay in the group the server put them in.
+				c := cur.resource.(Rule)
+				c.Group = ""
+				cur.resource = c
+			}
+			fields, err := fieldChanges(normalize(cur.resource), normalize(want))
+			if err != nil {
+				return nil, fmt.Errorf("compare %s: %w", ref, err)
+			}
+			if len(fields) > 0 {
+				plan.Changes = append(plan.Changes, Change{Ref: ref, Action: ActionUpdate, Fields: fields, id: cur.id, desired: want})
+			}
+		}
+	}
+
+	// Delete in reverse dependency order, keeping resources still referenced.
+	var deletes []Change
+	deleted := map[Ref]bool{}
+	for i := len(kindOrder) - 1; i >= 0; i-- {
+		kind := kindOrder[i]
+		names := make([]string, 0, len(live.resources[kind]))
+		for name := range live.resources[kind] {
+			if _, ok := resources[Ref{kind, name}]; !ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ref := Ref{kind, name}
+			if !opts.Prune || protected(ref, opts.Protect) {
+				plan.Unmanaged = append(plan.Unmanaged, ref)
+				continue
+			}
+			if kind == KindReceiver {
+				if user := receiverUser(name, cfg, live, deleted); user != "" {
+					return nil, fmt.Errorf("cannot prune receiver %q: it is used by strategy %q", name, user)
+				}
+			}
+			deleted[ref] = true
+			deletes = append(deletes, Change{Ref: ref, Action: ActionDelete, id: live.resources[kind][name].id})
+		}
+	}
+	plan.Changes = append(plan.Changes, deletes...)
+	return plan, nil
+}
+
+// receiverUser returns a strategy that references receiver after the plan is applied.
+func receiverUser(receiver string, cfg *Config, live *state, deleted map[Ref]bool) string {
+	declared := map[string]bool{}
+	for _, s := range cfg.Spec.Strategies {
+		declared[s.Name] = true
+		for _, r := range s.Receivers {
+			if r == receiver {
+				return s.Name
+			}
+		}
+	}
+	for name, s := range live.resources[KindStrategy] {
+		if declared[name] || deleted[Ref{KindStrategy, name}] {
+			continue
+		}
+		for _, r := range s.uses {
+			if r == receiver {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func protected(ref Ref, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, ref.Name); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, ref.String()); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldChanges compares the JSON encodings of two resources field by field.
+func fieldChanges(old, new interface{}) ([]FieldChange, error) {
+	oldFields, err := fields(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := fields(new)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]bool{}
+	for k := range oldFields {
+		keys[k] = true
+	}
+	for k := range newFields {
+		keys[k] = true
+	}
+	var changes []FieldChange
+	for k := range keys {
+		if reflect.DeepEqual(oldFields[k], newFields[k]) {
+			continue
+		}
+		c := FieldChange{Field: k}
+		if v, ok := oldFields[k]; ok {
+			data, _ := common.Marshal(v)
+			c.Old = string(data)
+		}
+		if v, ok := newFields[k]; ok {
+			data, _ := common.Marshal(v)
+			c.New = string(data)
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+func fields(v interface{}) (map[string]interface{}, error) {
+	data, err := common.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = common.Unmarshal(data, &m)
+	return m, err
+}
@@ -0,0 +1,103 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package promql checks the PromQL expressions of alert rules with the
+// Prometheus parser. It is a module of its own, so that the client does not
+// depend on the Prometheus server module. DEVELOPMENT.md describes how both
+// modules are released.
+package promql
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+
+	"github.com/apecloud/kb-cloud-client-go/alerting"
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+)
+
+var _ alerting.ExprChecker = CheckExpr
+
+// NewValidator returns an alerting.NewValidator checking rule expressions with CheckExpr.
+func NewValidator(ctx context.Context, client *common.APIClient, orgName string) (*alerting.Validator, error) {
+	v, err := alerting.NewValidator(ctx, client, orgName)
+	if err != nil {
+		return nil, err
+	}
+	return v.WithExprChecker(CheckExpr), nil
+}
+
+// NewStaticValidator returns an alerting.NewStaticValidator checking rule
+// expressions with CheckExpr.
+func NewStaticValidator(metrics []string) *alerting.Validator {
+	return alerting.NewStaticValidator(metrics).WithExprChecker(CheckExpr)
+}
+
+// CheckExpr parses expr, checks that it returns an instant vector and, when
+// isMetric is not nil, that the metrics it selects are alert metrics.
+func CheckExpr(expr string, isMetric func(name string) bool) alerting.Issues {
+	var issues alerting.Issues
+	add := func(level alerting.IssueLevel, line, col int, message string) {
+		issues = append(issues, alerting.Issue{Level: level, Line: line, Column: col, Message: message})
+	}
+
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		var errs parser.ParseErrors
+		if !errors.As(err, &errs) {
+			add(alerting.IssueError, 0, 0, err.Error())
+			return issues
+		}
+		for _, pe := range errs {
+			line, col := position(expr, int(pe.PositionRange.Start))
+			add(alerting.IssueError, line, col, pe.Err.Error())
+		}
+		return issues
+	}
+
+	// The type concerns the expression as a whole, which has no position.
+	if t := e.Type(); t != parser.ValueTypeVector {
+		add(alerting.IssueError, 0, 0, "expression must return an instant vector, not a "+string(t))
+	}
+	if isMetric == nil {
+		return issues
+	}
+	parser.Inspect(e, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		name := vs.Name
+		if name == "" {
+			for _, m := range vs.LabelMatchers {
+				if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+					name = m.Value
+				}
+			}
+		}
+		if name != "" && !isMetric(name) {
+			line, col := position(expr, int(vs.PositionRange().Start))
+			add(alerting.IssueWarning, line, col, `metric "`+name+`" is not an alert metric of the organization`)
+		}
+		return nil
+	})
+	return issues
+}
+
+// position converts a byte offset in s into a line and column, starting at 1.
+func position(s string, p int) (line, col int) {
+	if p > len(s) {
+		p = len(s)
+	}
+	if p < 0 {
+		p = 0
+	}
+	before := s[:p]
+	line = strings.Count(before, "\n") + 1
+	col = len([]rune(before[strings.LastIndexByte(before, '\n')+1:])) + 1
+	return line, col
+}
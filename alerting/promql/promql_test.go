@@ -0,0 +1,51 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package promql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apecloud/kb-cloud-client-go/alerting"
+)
+
+func TestValidator(t *testing.T) {
+	v := NewStaticValidator([]string{"mysql_up", "mysql_global_status_threads_running"})
+	issues := v.ValidateConfig(&alerting.Config{Spec: alerting.Spec{
+		Rules: []alerting.Rule{
+			{Name: "ok", Expr: `sum by (cluster) (rate(mysql_global_status_threads_running[5m])) > 10`, For: "1h30m", Severity: "critical"},
+			{Name: "syntax", Expr: "mysql_up ==\n  and 0"},
+			{Name: "unknown", Expr: `{__name__="mysql_upp"} == 0 or node_load1 > 4`},
+			{Name: "scalar", Expr: "1 + 1"},
+		},
+	}})
+	var got []string
+	for _, i := range issues {
+		got = append(got, i.String())
+	}
+	want := []string{
+		`error: rule/syntax expr:2:7: unexpected number "0"`,
+		`warning: rule/unknown expr:1:1: metric "mysql_upp" is not an alert metric of the organization`,
+		`warning: rule/unknown expr:1:32: metric "node_load1" is not an alert metric of the organization`,
+		// The type of the expression as a whole has no position.
+		`error: rule/scalar expr: expression must return an instant vector, not a scalar`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("issues\n got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if err := issues.Err(); err == nil || strings.Contains(err.Error(), "node_load1") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCheckExprWithoutMetrics(t *testing.T) {
+	if issues := CheckExpr(`node_load1 > 4`, nil); len(issues) != 0 {
+		t.Errorf("issues = %v", issues)
+	}
+	issues := CheckExpr("rate(", nil)
+	if len(issues) != 1 || issues[0].Level != alerting.IssueError || issues[0].Line != 1 {
+		t.Errorf("issues = %v", issues)
+	}
+}
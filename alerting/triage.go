@@ -0,0 +1,211 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// Query selects alert objects. Empty fields match every alert.
+type Query struct {
+	// Status defaults to firing.
+	Status       kbcloud.AlertStatus
+	Clusters     []string
+	AlertNames   []string
+	Fingerprints []string
+	Severities   []kbcloud.AlertSeverity
+	Engines      []string
+	// StartedAfter and StartedBefore bound the start of the alerts.
+	StartedAfter  time.Time
+	StartedBefore time.Time
+}
+
+// Match reports whether the query selects a.
+func (q Query) Match(a kbcloud.AlertObject) bool {
+	status := q.Status
+	if status == "" {
+		status = kbcloud.AlertStatusFiring
+	}
+	in := func(values []string, v string) bool {
+		if len(values) == 0 {
+			return true
+		}
+		for _, x := range values {
+			if x == v {
+				return true
+			}
+		}
+		return false
+	}
+	severities := make([]string, len(q.Severities))
+	for i, s := range q.Severities {
+		severities[i] = string(s)
+	}
+	starts := a.GetStartsAt()
+	return a.GetStatus() == status &&
+		in(q.Clusters, a.GetClusterName()) &&
+		in(q.AlertNames, a.GetAlertName()) &&
+		in(q.Fingerprints, a.GetFingerprint()) &&
+		in(severities, string(a.GetSeverity())) &&
+		in(q.Engines, a.GetEngine()) &&
+		(q.StartedAfter.IsZero() || !starts.Before(q.StartedAfter)) &&
+		(q.StartedBefore.IsZero() || starts.Before(q.StartedBefore))
+}
+
+// GroupBy is how alerts are grouped.
+type GroupBy string
+
+// List of GroupBy.
+const (
+	GroupByFingerprint GroupBy = "fingerprint"
+	GroupByCluster     GroupBy = "cluster"
+	GroupByRule        GroupBy = "rule"
+)
+
+// Group is a set of alerts sharing a fingerprint, cluster or rule.
+type Group struct {
+	Key    string                `json:"key"`
+	Alerts []kbcloud.AlertObject `json:"alerts"`
+	// Count is the number of notifications of the alerts.
+	Count int `json:"count"`
+	// Severity is the highest severity of the alerts.
+	Severity  kbcloud.AlertSeverity `json:"severity"`
+	Clusters  []string              `json:"clusters"`
+	FirstSeen time.Time             `json:"firstSeen"`
+	LastSeen  time.Time             `json:"lastSeen"`
+}
+
+var severityRank = map[kbcloud.AlertSeverity]int{
+	kbcloud.AlertSeverityInfo:     1,
+	kbcloud.AlertSeverityWarning:  2,
+	kbcloud.AlertSeverityCritical: 3,
+}
+
+// GroupAlerts groups alerts, most severe and then largest group first.
+func GroupAlerts(alerts []kbcloud.AlertObject, by GroupBy) []Group {
+	index := map[string]int{}
+	var groups []Group
+	for _, a := range alerts {
+		var key string
+		switch by {
+		case GroupByCluster:
+			key = a.GetClusterName()
+		case GroupByRule:
+			key = a.GetAlertName()
+		default:
+			key = a.GetFingerprint()
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, Group{Key: key})
+		}
+		g := &groups[i]
+		g.Alerts = append(g.Alerts, a)
+		if n := int(a.GetCount()); n > 0 {
+			g.Count += n
+		} else {
+			g.Count++
+		}
+		if severityRank[a.GetSeverity()] > severityRank[g.Severity] {
+			g.Severity = a.GetSeverity()
+		}
+		if c := a.GetClusterName(); c != "" && !contains(g.Clusters, c) {
+			g.Clusters = append(g.Clusters, c)
+		}
+		if t := a.GetStartsAt(); !t.IsZero() {
+			if g.FirstSeen.IsZero() || t.Before(g.FirstSeen) {
+				g.FirstSeen = t
+			}
+			if t.After(g.LastSeen) {
+				g.LastSeen = t
+			}
+		}
+	}
+	for i := range groups {
+		sort.Strings(groups[i].Clusters)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if ri, rj := severityRank[groups[i].Severity], severityRank[groups[j].Severity]; ri != rj {
+			return ri > rj
+		}
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Triage lists, groups and acknowledges the alerts of an organization.
+type Triage struct {
+	alertApi *kbcloud.AlertObjectApi
+	orgName  string
+	// AckStatus is the status set by Acknowledge. Defaults to resolved.
+	AckStatus string
+}
+
+// NewTriage returns a Triage of the alerts of orgName.
+func NewTriage(client *common.APIClient, orgName string) *Triage {
+	return &Triage{
+		alertApi:  kbcloud.NewAlertObjectApi(client),
+		orgName:   orgName,
+		AckStatus: string(kbcloud.AlertStatusResolved),
+	}
+}
+
+// List returns the alerts selected by q.
+func (t *Triage) List(ctx context.Context, q Query) ([]kbcloud.AlertObject, error) {
+	list, _, err := t.alertApi.ListAlertObjects(ctx, t.orgName)
+	if err != nil {
+		return nil, fmt.Errorf("list alert objects: %w", err)
+	}
+	var alerts []kbcloud.AlertObject
+	for _, a := range list.Items {
+		if q.Match(a) {
+			alerts = append(alerts, a)
+		}
+	}
+	return alerts, nil
+}
+
+// Groups returns the alerts selected by q, grouped.
+func (t *Triage) Groups(ctx context.Context, q Query, by GroupBy) ([]Group, error) {
+	alerts, err := t.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return GroupAlerts(alerts, by), nil
+}
+
+// Acknowledge sets the status of every alert selected by q to AckStatus in a
+// single request and returns the alerts acknowledged.
+func (t *Triage) Acknowledge(ctx context.Context, q Query) ([]kbcloud.AlertObject, error) {
+	alerts, err := t.List(ctx, q)
+	if err != nil || len(alerts) == 0 {
+		return nil, err
+	}
+	params := kbcloud.NewSetAlertObjectsStatusOptionalParameters().WithBody(alerts)
+	if _, _, err := t.alertApi.SetAlertObjectsStatus(ctx, t.orgName, t.AckStatus, *params); err != nil {
+		return nil, fmt.Errorf("set status of %d alert objects: %w", len(alerts), err)
+	}
+	return alerts, nil
+}
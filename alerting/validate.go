@@ -0,0 +1,217 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// IssueLevel is the level of a validation issue.
+type IssueLevel string
+
+// List of IssueLevel.
+const (
+	// IssueError is an issue the server rejects or that breaks the alert.
+	IssueError IssueLevel = "error"
+	// IssueWarning is a likely mistake, such as a metric unknown to KB Cloud.
+	IssueWarning IssueLevel = "warning"
+)
+
+// Issue is a problem found in a rule or strategy.
+type Issue struct {
+	Level IssueLevel `json:"level"`
+	// Resource is the rule or strategy, e.g. "rule/MysqlDown".
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	// Line and Column locate the issue in the field, starting at 1. They are
+	// zero when the issue concerns the field as a whole.
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i Issue) String() string {
+	pos := i.Field
+	if i.Line > 0 {
+		pos = fmt.Sprintf("%s:%d:%d", i.Field, i.Line, i.Column)
+	}
+	return fmt.Sprintf("%s: %s %s: %s", i.Level, i.Resource, pos, i.Message)
+}
+
+// Issues is the result of a validation.
+type Issues []Issue
+
+// Err returns an error listing the issues of level IssueError, or nil if there are none.
+func (is Issues) Err() error {
+	var msgs []string
+	for _, i := range is {
+		if i.Level == IssueError {
+			msgs = append(msgs, i.String())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// ExprChecker checks the PromQL expression of a rule and returns its issues,
+// located in expr. isMetric reports whether a name is an alert metric of the
+// organization; it is nil when metric names are not checked.
+//
+// The PromQL parser pulls in the Prometheus server module, so the checker
+// lives in the separate github.com/apecloud/kb-cloud-client-go/alerting/promql
+// module.
+type ExprChecker func(expr string, isMetric func(name string) bool) Issues
+
+// Validator checks rules and strategies before they are sent to the server.
+type Validator struct {
+	metrics   map[string]bool
+	checkExpr ExprChecker
+}
+
+// NewValidator returns a Validator checking metric names against the alert
+// metrics of orgName.
+func NewValidator(ctx context.Context, client *common.APIClient, orgName string) (*Validator, error) {
+	list, _, err := kbcloud.NewAlertMetricsApi(client).ListAlertMetrics(ctx, orgName)
+	if err != nil {
+		return nil, fmt.Errorf("list alert metrics: %w", err)
+	}
+	metrics := make([]string, 0, len(list.Items))
+	for _, m := range list.Items {
+		metrics = append(metrics, m.Key)
+	}
+	return NewStaticValidator(metrics), nil
+}
+
+// NewStaticValidator returns a Validator checking metric names against
+// metrics. With no metrics, metric names are not checked.
+func NewStaticValidator(metrics []string) *Validator {
+	v := &Validator{}
+	if len(metrics) > 0 {
+		v.metrics = make(map[string]bool, len(metrics))
+		for _, m := range metrics {
+			v.metrics[m] = true
+		}
+	}
+	return v
+}
+
+// WithExprChecker sets the checker of rule expressions and returns v. Without
+// one, expressions are only checked not to be empty.
+func (v *Validator) WithExprChecker(c ExprChecker) *Validator {
+	v.checkExpr = c
+	return v
+}
+
+// ValidateRule checks the expression, duration and severity of a rule.
+func (v *Validator) ValidateRule(rule kbcloud.AlertRule) Issues {
+	return v.validateRule(ruleFromAPI("", rule))
+}
+
+// ValidateStrategy checks the repeat interval, severities and mute time interval of a strategy.
+func (v *Validator) ValidateStrategy(strategy kbcloud.AlertStrategy) Issues {
+	return v.validateStrategy(strategyFromAPI(strategy, nil))
+}
+
+// ValidateConfig checks every rule and strategy of cfg.
+func (v *Validator) ValidateConfig(cfg *Config) Issues {
+	var issues Issues
+	for _, r := range cfg.Spec.Rules {
+		issues = append(issues, v.validateRule(r)...)
+	}
+	for _, s := range cfg.Spec.Strategies {
+		issues = append(issues, v.validateStrategy(s)...)
+	}
+	return issues
+}
+
+func (v *Validator) validateRule(r Rule) Issues {
+	var issues Issues
+	add := func(level IssueLevel, field string, line, col int, format string, args ...interface{}) {
+		issues = append(issues, Issue{level, Ref{KindRule, r.Name}.String(), field, line, col, fmt.Sprintf(format, args...)})
+	}
+
+	if r.Expr == "" {
+		add(IssueError, "expr", 0, 0, "expression is empty")
+	} else if v.checkExpr != nil {
+		var isMetric func(string) bool
+		if v.metrics != nil {
+			isMetric = func(name string) bool { return v.metrics[name] }
+		}
+		for _, i := range v.checkExpr(r.Expr, isMetric) {
+			add(i.Level, "expr", i.Line, i.Column, "%s", i.Message)
+		}
+	}
+
+	if r.For != "" {
+		if _, err := model.ParseDuration(r.For); err != nil {
+			add(IssueError, "for", 0, 0, "invalid duration %q, expected e.g. 30s, 5m or 1h30m", r.For)
+		}
+	}
+	if !validSeverity(string(r.Severity)) {
+		add(IssueError, "severity", 0, 0, "invalid severity %q, expected one of %s", r.Severity, severityList())
+	}
+	return issues
+}
+
+var clockTime = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$|^24:00$`)
+
+func (v *Validator) validateStrategy(s Strategy) Issues {
+	var issues Issues
+	add := func(field, format string, args ...interface{}) {
+		issues = append(issues, Issue{IssueError, Ref{KindStrategy, s.Name}.String(), field, 0, 0, fmt.Sprintf(format, args...)})
+	}
+
+	if s.RepeatInterval != "" {
+		if d, err := model.ParseDuration(s.RepeatInterval); err != nil {
+			add("repeatInterval", "invalid duration %q, expected e.g. 30m or 4h", s.RepeatInterval)
+		} else if d == 0 {
+			add("repeatInterval", "repeat interval must be positive")
+		}
+	}
+	for _, sev := range s.Severities {
+		if sev == "" || !validSeverity(sev) {
+			add("severities", "invalid severity %q, expected one of %s", sev, severityList())
+		}
+	}
+	if m := s.MuteTimeInterval; m != nil {
+		for _, d := range m.Weekdays {
+			if d < 0 || d > 6 {
+				add("muteTimeInterval.weekdays", "invalid weekday %d, expected 0 (Sunday) to 6", d)
+			}
+		}
+		for field, t := range map[string]string{"muteTimeInterval.startTime": m.StartTime, "muteTimeInterval.endTime": m.EndTime} {
+			if t != "" && !clockTime.MatchString(t) {
+				add(field, "invalid time %q, expected HH:MM in UTC", t)
+			}
+		}
+		if m.OnceMinutes < 0 {
+			add("muteTimeInterval.onceMinutes", "must not be negative")
+		}
+	}
+	return issues
+}
+
+func validSeverity(s string) bool {
+	switch kbcloud.AlertSeverity(s) {
+	case "", kbcloud.AlertSeverityCritical, kbcloud.AlertSeverityWarning, kbcloud.AlertSeverityInfo:
+		return true
+	}
+	return false
+}
+
+func severityList() string {
+	return strings.Join([]string{string(kbcloud.AlertSeverityCritical), string(kbcloud.AlertSeverityWarning), string(kbcloud.AlertSeverityInfo)}, ", ")
+}
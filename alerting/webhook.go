@@ -0,0 +1,352 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// Alert is an alert of a webhook notification, aligned with kbcloud.AlertObject.
+type Alert struct {
+	Fingerprint string                `json:"fingerprint"`
+	AlertName   string                `json:"alertName"`
+	GroupName   string                `json:"groupName,omitempty"`
+	Status      kbcloud.AlertStatus   `json:"status"`
+	Severity    kbcloud.AlertSeverity `json:"severity,omitempty"`
+	OrgName     string                `json:"orgName,omitempty"`
+	ClusterName string                `json:"clusterName,omitempty"`
+	Engine      string                `json:"engine,omitempty"`
+	Namespace   string                `json:"namespace,omitempty"`
+	Pod         string                `json:"pod,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	StartsAt    time.Time             `json:"startsAt"`
+	// EndsAt is zero while the alert fires.
+	EndsAt       time.Time         `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// Notification is a webhook notification of a receiver.
+type Notification struct {
+	Receiver          string              `json:"receiver,omitempty"`
+	Status            kbcloud.AlertStatus `json:"status,omitempty"`
+	GroupKey          string              `json:"groupKey,omitempty"`
+	GroupLabels       map[string]string   `json:"groupLabels,omitempty"`
+	CommonLabels      map[string]string   `json:"commonLabels,omitempty"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations,omitempty"`
+	ExternalURL       string              `json:"externalURL,omitempty"`
+	Alerts            []Alert             `json:"alerts"`
+}
+
+// rawAlert accepts both the Alertmanager webhook format, with labels and
+// annotations, and alert objects as returned by the alert object API.
+type rawAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     *time.Time        `json:"startsAt"`
+	EndsAt       *time.Time        `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+	AlertName    string            `json:"alertName"`
+	GroupName    string            `json:"groupName"`
+	ClusterName  string            `json:"clusterName"`
+	Engine       string            `json:"engine"`
+	Namespace    string            `json:"namespace"`
+	Pod          string            `json:"pod"`
+	Severity     string            `json:"severity"`
+	Description  string            `json:"description"`
+	OrgName      string            `json:"orgName"`
+}
+
+type rawNotification struct {
+	Receiver          string            `json:"receiver"`
+	Status            string            `json:"status"`
+	GroupKey          string            `json:"groupKey"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []rawAlert        `json:"alerts"`
+	Items             []rawAlert        `json:"items"`
+}
+
+// DecodeNotification parses a webhook notification body: an Alertmanager
+// style notification, a list of alert objects or an object with "items".
+func DecodeNotification(data []byte) (Notification, error) {
+	var raw rawNotification
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := common.Unmarshal(trimmed, &raw.Alerts); err != nil {
+			return Notification{}, fmt.Errorf("decode alert notification: %w", err)
+		}
+	} else if err := common.Unmarshal(data, &raw); err != nil {
+		return Notification{}, fmt.Errorf("decode alert notification: %w", err)
+	}
+	n := Notification{
+		Receiver:          raw.Receiver,
+		Status:            kbcloud.AlertStatus(raw.Status),
+		GroupKey:          raw.GroupKey,
+		GroupLabels:       raw.GroupLabels,
+		CommonLabels:      raw.CommonLabels,
+		CommonAnnotations: raw.CommonAnnotations,
+		ExternalURL:       raw.ExternalURL,
+	}
+	for _, r := range append(raw.Alerts, raw.Items...) {
+		n.Alerts = append(n.Alerts, r.alert(n.Status))
+	}
+	if n.Status == "" {
+		n.Status = kbcloud.AlertStatusResolved
+		for _, a := range n.Alerts {
+			if a.Status == kbcloud.AlertStatusFiring {
+				n.Status = kbcloud.AlertStatusFiring
+			}
+		}
+	}
+	return n, nil
+}
+
+func (r rawAlert) alert(status kbcloud.AlertStatus) Alert {
+	first := func(values ...string) string {
+		for _, v := range values {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	l, an := r.Labels, r.Annotations
+	a := Alert{
+		Fingerprint:  r.Fingerprint,
+		AlertName:    first(r.AlertName, l["alertname"]),
+		GroupName:    first(r.GroupName, l["alertgroup"], l["group"]),
+		Status:       kbcloud.AlertStatus(first(r.Status, string(status))),
+		Severity:     kbcloud.AlertSeverity(first(r.Severity, l["severity"])),
+		OrgName:      first(r.OrgName, l["org_name"], l["orgName"]),
+		ClusterName:  first(r.ClusterName, l["app_kubernetes_io_instance"], l["cluster_name"], l["cluster"]),
+		Engine:       first(r.Engine, l["engine"], l["app_kubernetes_io_name"]),
+		Namespace:    first(r.Namespace, l["namespace"]),
+		Pod:          first(r.Pod, l["pod"]),
+		Summary:      an["summary"],
+		Description:  first(r.Description, an["description"]),
+		GeneratorURL: r.GeneratorURL,
+		Labels:       l,
+		Annotations:  an,
+	}
+	if r.StartsAt != nil {
+		a.StartsAt = *r.StartsAt
+	}
+	// Alertmanager sets endsAt of firing alerts to the zero time of Go.
+	if r.EndsAt != nil && r.EndsAt.Year() > 1 {
+		a.EndsAt = *r.EndsAt
+	}
+	if a.Fingerprint == "" {
+		a.Fingerprint = labelsFingerprint(l, a)
+	}
+	return a
+}
+
+// labelsFingerprint identifies an alert sent without a fingerprint by its
+// labels, or by its name, cluster, pod and start when it has no labels.
+func labelsFingerprint(labels map[string]string, a Alert) string {
+	h := sha256.New()
+	if len(labels) > 0 {
+		data, _ := common.Marshal(labels)
+		h.Write(data)
+	} else {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d", a.AlertName, a.ClusterName, a.Pod, a.StartsAt.Unix())
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// WebhookOptions configures a WebhookHandler.
+type WebhookOptions struct {
+	// Secret, when set, must be presented by every request: as the "token"
+	// query parameter of the receiver URL, as a bearer token, or as the
+	// hex encoded HMAC-SHA256 of the body in SignatureHeader.
+	Secret string
+	// SignatureHeader defaults to "X-Signature-256". Its value may be
+	// prefixed with "sha256=".
+	SignatureHeader string
+	// OnNotification is called with every notification, before its alerts are dispatched.
+	OnNotification func(ctx context.Context, n Notification) error
+	// OnFiring is called with every alert that starts firing.
+	OnFiring func(ctx context.Context, a Alert) error
+	// OnResolved is called with every alert that is resolved.
+	OnResolved func(ctx context.Context, a Alert) error
+	// DedupTTL is how long a dispatched alert state is remembered, so that
+	// notifications repeated by the strategy are not dispatched again.
+	// Defaults to 24h.
+	DedupTTL time.Duration
+	// MaxBodyBytes defaults to 1MiB.
+	MaxBodyBytes int64
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// WebhookHandler is an http.Handler receiving the notifications of a webhook
+// receiver. Alerts are dispatched once per fingerprint and state; a callback
+// error makes the handler reply 500 so that the notification is sent again.
+type WebhookHandler struct {
+	opts WebhookOptions
+
+	mu   sync.Mutex
+	seen map[string]dispatched
+}
+
+type dispatched struct {
+	status   kbcloud.AlertStatus
+	startsAt time.Time
+	at       time.Time
+}
+
+var _ http.Handler = (*WebhookHandler)(nil)
+
+// NewWebhookHandler returns a WebhookHandler.
+func NewWebhookHandler(opts WebhookOptions) *WebhookHandler {
+	if opts.SignatureHeader == "" {
+		opts.SignatureHeader = "X-Signature-256"
+	}
+	if opts.DedupTTL <= 0 {
+		opts.DedupTTL = 24 * time.Hour
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = 1 << 20
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &WebhookHandler{opts: opts, seen: map[string]dispatched{}}
+}
+
+// ServeHTTP handles a notification.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.opts.MaxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "notification too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.authorized(r, body) {
+		http.Error(w, "invalid token or signature", http.StatusUnauthorized)
+		return
+	}
+	n, err := DecodeNotification(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.Dispatch(r.Context(), n); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Dispatch calls the callbacks with a notification and its new alert states.
+func (h *WebhookHandler) Dispatch(ctx context.Context, n Notification) error {
+	if h.opts.OnNotification != nil {
+		if err := h.opts.OnNotification(ctx, n); err != nil {
+			return err
+		}
+	}
+	for _, a := range n.Alerts {
+		release, ok := h.reserve(a)
+		if !ok {
+			continue
+		}
+		var err error
+		switch {
+		case a.Status == kbcloud.AlertStatusResolved && h.opts.OnResolved != nil:
+			err = h.opts.OnResolved(ctx, a)
+		case a.Status == kbcloud.AlertStatusFiring && h.opts.OnFiring != nil:
+			err = h.opts.OnFiring(ctx, a)
+		}
+		if err != nil {
+			release()
+			return fmt.Errorf("dispatch alert %s (%s): %w", a.AlertName, a.Fingerprint, err)
+		}
+	}
+	return nil
+}
+
+// reserve records the state of a as dispatched before its callback runs, so
+// that concurrent deliveries of the same state dispatch it once. It returns
+// false when the state was already dispatched or reserved; otherwise release
+// restores the previous state when the callback fails.
+func (h *WebhookHandler) reserve(a Alert) (release func(), ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.opts.Now()
+	for fp, d := range h.seen {
+		if now.Sub(d.at) > h.opts.DedupTTL {
+			delete(h.seen, fp)
+		}
+	}
+	prev, seen := h.seen[a.Fingerprint]
+	if seen && prev.status == a.Status && prev.startsAt.Equal(a.StartsAt) {
+		return nil, false
+	}
+	d := dispatched{status: a.Status, startsAt: a.StartsAt, at: now}
+	h.seen[a.Fingerprint] = d
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		// Keep a state reserved since by another delivery.
+		if h.seen[a.Fingerprint] != d {
+			return
+		}
+		if seen {
+			h.seen[a.Fingerprint] = prev
+		} else {
+			delete(h.seen, a.Fingerprint)
+		}
+	}, true
+}
+
+func (h *WebhookHandler) authorized(r *http.Request, body []byte) bool {
+	secret := h.opts.Secret
+	if secret == "" {
+		return true
+	}
+	equal := func(a, b string) bool { return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1 }
+	if token := r.URL.Query().Get("token"); token != "" && equal(token, secret) {
+		return true
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") && equal(strings.TrimPrefix(auth, "Bearer "), secret) {
+		return true
+	}
+	if sig := r.Header.Get(h.opts.SignatureHeader); sig != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return equal(strings.ToLower(strings.TrimPrefix(sig, "sha256=")), hex.EncodeToString(mac.Sum(nil)))
+	}
+	return false
+}
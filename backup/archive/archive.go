@@ -0,0 +1,310 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package archive copies backups out of KubeBlocks Cloud into pluggable
+// storage sinks, keeping a manifest next to every archived backup.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/backup"
+)
+
+const (
+	dataFile     = "backup.data"
+	manifestFile = "manifest.json"
+)
+
+// ErrInvalidBackupID is returned for backup ids that are not a single path
+// element, since their archive would be written outside the prefix.
+var ErrInvalidBackupID = errors.New("invalid backup id")
+
+// Manifest describes an archived backup. It is written after the backup data,
+// so its presence marks the archive as complete.
+type Manifest struct {
+	BackupId            string             `json:"backupId"`
+	BackupName          string             `json:"backupName"`
+	OrgName             string             `json:"orgName"`
+	Cluster             string             `json:"cluster"`
+	ClusterId           string             `json:"clusterId,omitempty"`
+	Engine              string             `json:"engine"`
+	BackupType          kbcloud.BackupType `json:"backupType"`
+	BackupMethod        string             `json:"backupMethod"`
+	CreationTimestamp   time.Time          `json:"creationTimestamp"`
+	CompletionTimestamp *time.Time         `json:"completionTimestamp,omitempty"`
+	TimeRangeStart      *time.Time         `json:"timeRangeStart,omitempty"`
+	TimeRangeEnd        *time.Time         `json:"timeRangeEnd,omitempty"`
+	// TotalSize is the backup size reported by the API.
+	TotalSize string `json:"totalSize"`
+	// Size is the number of bytes archived and SHA256 their checksum.
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	DataKey    string    `json:"dataKey"`
+	ArchivedAt time.Time `json:"archivedAt"`
+}
+
+// Retention decides which archives Prune removes.
+type Retention struct {
+	// MaxAge removes archives of backups created longer ago. Zero keeps archives regardless of age.
+	MaxAge time.Duration
+	// KeepLast always keeps the newest archives of each cluster, even past MaxAge.
+	KeepLast int
+}
+
+// Options configures an Archiver.
+type Options struct {
+	// Prefix is prepended to every key written to the sink.
+	Prefix string
+	// Filter, when set, selects the backups Sync archives.
+	Filter func(kbcloud.Backup) bool
+	// Retention is applied by Prune.
+	Retention Retention
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// SyncResult summarizes a Sync.
+type SyncResult struct {
+	Archived []Manifest
+	// Skipped counts backups that were already archived.
+	Skipped int
+}
+
+// Archiver copies backups into a Sink.
+type Archiver struct {
+	client    *common.APIClient
+	backupApi *kbcloud.BackupApi
+	sink      Sink
+	opts      Options
+}
+
+// NewArchiver returns an Archiver writing to sink.
+func NewArchiver(client *common.APIClient, sink Sink, opts Options) *Archiver {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Archiver{
+		client:    client,
+		backupApi: kbcloud.NewBackupApi(client),
+		sink:      sink,
+		opts:      opts,
+	}
+}
+
+// Archive streams a completed backup into the sink and writes its manifest.
+func (a *Archiver) Archive(ctx context.Context, orgName string, b kbcloud.Backup) (Manifest, error) {
+	if b.Status != kbcloud.BackupStatusCompleted {
+		return Manifest{}, fmt.Errorf("backup %s is %s, not %s", b.Name, b.Status, kbcloud.BackupStatusCompleted)
+	}
+	id := backupID(b)
+	dir, err := a.dir(id)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("archive backup %s: %w", b.Name, err)
+	}
+
+	body, size, err := backup.Open(ctx, a.client, orgName, id)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("download backup %s: %w", b.Name, err)
+	}
+	defer body.Close()
+	h := sha256.New()
+	counter := &countingReader{r: io.TeeReader(body, h)}
+	dataKey := path.Join(dir, dataFile)
+	if err := a.sink.Put(ctx, dataKey, counter, size); err != nil {
+		return Manifest{}, fmt.Errorf("archive backup %s: %w", b.Name, err)
+	}
+	if size >= 0 && counter.n != size {
+		return Manifest{}, fmt.Errorf("archive backup %s: got %d of %d bytes", b.Name, counter.n, size)
+	}
+
+	m := Manifest{
+		BackupId:            id,
+		BackupName:          b.Name,
+		OrgName:             orgName,
+		Cluster:             b.SourceCluster,
+		ClusterId:           b.GetClusterId(),
+		Engine:              b.Engine,
+		BackupType:          b.BackupType,
+		BackupMethod:        b.BackupMethod,
+		CreationTimestamp:   b.CreationTimestamp,
+		CompletionTimestamp: b.CompletionTimestamp,
+		TimeRangeStart:      b.TimeRangeStart,
+		TimeRangeEnd:        b.TimeRangeEnd,
+		TotalSize:           b.TotalSize,
+		Size:                counter.n,
+		SHA256:              hex.EncodeToString(h.Sum(nil)),
+		DataKey:             dataKey,
+		ArchivedAt:          a.opts.Now().UTC(),
+	}
+	data, err := common.Marshal(m)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := a.sink.Put(ctx, path.Join(dir, manifestFile), bytes.NewReader(data), int64(len(data))); err != nil {
+		return Manifest{}, fmt.Errorf("write manifest of backup %s: %w", b.Name, err)
+	}
+	return m, nil
+}
+
+// Sync archives every completed backup of the organization that is not archived
+// yet. Continuous backups are skipped since they are still being written.
+// Failures of single backups do not stop the sync and are returned joined.
+func (a *Archiver) Sync(ctx context.Context, orgName string) (SyncResult, error) {
+	var result SyncResult
+	manifests, err := a.Manifests(ctx)
+	if err != nil {
+		return result, err
+	}
+	archived := make(map[string]bool, len(manifests))
+	for _, m := range manifests {
+		archived[m.BackupId] = true
+	}
+
+	backups, _, err := a.backupApi.ListBackups(ctx, orgName)
+	if err != nil {
+		return result, fmt.Errorf("list backups: %w", err)
+	}
+	var errs []error
+	for _, b := range backups.Items {
+		if b.Status != kbcloud.BackupStatusCompleted || b.BackupType == kbcloud.BackupTypeContinuous {
+			continue
+		}
+		if a.opts.Filter != nil && !a.opts.Filter(b) {
+			continue
+		}
+		if archived[backupID(b)] {
+			result.Skipped++
+			continue
+		}
+		m, err := a.Archive(ctx, orgName, b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			errs = append(errs, err)
+			continue
+		}
+		result.Archived = append(result.Archived, m)
+	}
+	return result, errors.Join(errs...)
+}
+
+// Manifests returns the manifests of all archived backups, oldest first.
+func (a *Archiver) Manifests(ctx context.Context) ([]Manifest, error) {
+	keys, err := a.sink.List(ctx, a.opts.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("list archives: %w", err)
+	}
+	var manifests []Manifest
+	for _, key := range keys {
+		if path.Base(key) != manifestFile {
+			continue
+		}
+		m, err := a.readManifest(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].CreationTimestamp.Before(manifests[j].CreationTimestamp) })
+	return manifests, nil
+}
+
+func (a *Archiver) readManifest(ctx context.Context, key string) (Manifest, error) {
+	var m Manifest
+	r, err := a.sink.Get(ctx, key)
+	if err != nil {
+		return m, fmt.Errorf("read manifest %s: %w", key, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return m, fmt.Errorf("read manifest %s: %w", key, err)
+	}
+	if err := common.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("decode manifest %s: %w", key, err)
+	}
+	return m, nil
+}
+
+// Prune removes the archives the retention rule no longer keeps and returns their manifests.
+// The manifest is removed first, so an interrupted prune never leaves a manifest without data.
+// The data is removed from the directory of the backup, not from the key the manifest records.
+func (a *Archiver) Prune(ctx context.Context) ([]Manifest, error) {
+	if a.opts.Retention.MaxAge <= 0 {
+		return nil, nil
+	}
+	manifests, err := a.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cutoff := a.opts.Now().Add(-a.opts.Retention.MaxAge)
+	byCluster := map[string][]Manifest{}
+	for _, m := range manifests {
+		byCluster[m.Cluster] = append(byCluster[m.Cluster], m)
+	}
+
+	var pruned []Manifest
+	for _, list := range byCluster {
+		// list is oldest first; the last KeepLast entries are always kept.
+		for i, m := range list {
+			if i >= len(list)-a.opts.Retention.KeepLast || !m.CreationTimestamp.Before(cutoff) {
+				continue
+			}
+			dir, err := a.dir(m.BackupId)
+			if err != nil {
+				return pruned, fmt.Errorf("prune backup %s: %w", m.BackupName, err)
+			}
+			if err := a.sink.Delete(ctx, path.Join(dir, manifestFile)); err != nil {
+				return pruned, fmt.Errorf("prune backup %s: %w", m.BackupName, err)
+			}
+			if err := a.sink.Delete(ctx, path.Join(dir, dataFile)); err != nil {
+				return pruned, fmt.Errorf("prune backup %s: %w", m.BackupName, err)
+			}
+			pruned = append(pruned, m)
+		}
+	}
+	sort.Slice(pruned, func(i, j int) bool { return pruned[i].CreationTimestamp.Before(pruned[j].CreationTimestamp) })
+	return pruned, nil
+}
+
+// dir returns the directory of the archive of a backup. backupId must be a
+// single clean path element, so that the archive stays below the prefix.
+func (a *Archiver) dir(backupId string) (string, error) {
+	if backupId == "" || backupId == "." || backupId == ".." || strings.ContainsAny(backupId, `/\`) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidBackupID, backupId)
+	}
+	return strings.TrimPrefix(path.Join(a.opts.Prefix, backupId), "/"), nil
+}
+
+func backupID(b kbcloud.Backup) string {
+	if id := b.GetId(); id != "" {
+		return id
+	}
+	return b.Name
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,249 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+var archiveNow = time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+
+// backupsStandIn lists backups of the organization and serves their data,
+// counting the downloads.
+type backupsStandIn struct {
+	backups []map[string]interface{}
+
+	mu        sync.Mutex
+	downloads []string
+}
+
+func (s *backupsStandIn) add(id, cluster string, backupType kbcloud.BackupType, status kbcloud.BackupStatus, created time.Time) {
+	s.backups = append(s.backups, map[string]interface{}{
+		"id": id, "name": "backup-" + id, "backupType": backupType, "status": status, "sourceCluster": cluster,
+		"creationTimestamp": created, "autoBackup": true, "backupMethod": "xtrabackup", "backupPolicyName": "policy",
+		"orgName": "org", "snapshotVolumes": false, "totalSize": "1Ki", "retentionPeriod": "7d", "cloudProvider": "aws",
+		"cloudRegion": "us-east-1", "environmentName": "prod", "engine": "mysql",
+	})
+}
+
+func (s *backupsStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := apitest.OrgPath(r, "org")
+	if r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	if path == "/backups" {
+		apitest.WriteJSON(w, http.StatusOK, map[string]interface{}{"items": s.backups})
+		return
+	}
+	if id, ok := strings.CutSuffix(strings.TrimPrefix(path, "/backups/"), "/download"); ok {
+		s.mu.Lock()
+		s.downloads = append(s.downloads, id)
+		s.mu.Unlock()
+		w.Write([]byte("data of " + id))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *backupsStandIn) downloaded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.downloads
+	s.downloads = nil
+	sort.Strings(ids)
+	return ids
+}
+
+func keys(t *testing.T, sink Sink) string {
+	t.Helper()
+	list, err := sink.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Join(list, " ")
+}
+
+func TestSync(t *testing.T) {
+	s := &backupsStandIn{}
+	s.add("b1", "db", kbcloud.BackupTypeFull, kbcloud.BackupStatusCompleted, archiveNow.AddDate(0, 0, -2))
+	s.add("b2", "db", kbcloud.BackupTypeIncremental, kbcloud.BackupStatusCompleted, archiveNow.AddDate(0, 0, -1))
+	s.add("running", "db", kbcloud.BackupTypeFull, kbcloud.BackupStatusRunning, archiveNow)
+	s.add("log", "db", kbcloud.BackupTypeContinuous, kbcloud.BackupStatusCompleted, archiveNow)
+	s.add("other", "cache", kbcloud.BackupTypeFull, kbcloud.BackupStatusCompleted, archiveNow)
+	root := t.TempDir()
+	sink := NewLocalSink(filepath.Join(root, "archive"))
+	a := NewArchiver(apitest.NewClient(t, s), sink, Options{
+		Prefix: "kb/",
+		Filter: func(b kbcloud.Backup) bool { return b.SourceCluster == "db" },
+		Now:    func() time.Time { return archiveNow },
+	})
+
+	result, err := a.Sync(context.Background(), "org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Archived) != 2 || result.Skipped != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+	m := result.Archived[0]
+	if m.BackupId != "b1" || m.Cluster != "db" || m.Size != int64(len("data of b1")) || m.DataKey != "kb/b1/backup.data" || !m.ArchivedAt.Equal(archiveNow) {
+		t.Errorf("manifest = %+v", m)
+	}
+	if got := keys(t, sink); got != "kb/b1/backup.data kb/b1/manifest.json kb/b2/backup.data kb/b2/manifest.json" {
+		t.Errorf("keys = %s", got)
+	}
+	if got := s.downloaded(); strings.Join(got, " ") != "b1 b2" {
+		t.Errorf("downloads = %v", got)
+	}
+
+	// Archived backups are skipped without downloading them again.
+	s.add("b3", "db", kbcloud.BackupTypeFull, kbcloud.BackupStatusCompleted, archiveNow)
+	result, err = a.Sync(context.Background(), "org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Archived) != 1 || result.Archived[0].BackupId != "b3" || result.Skipped != 2 {
+		t.Fatalf("result = %+v", result)
+	}
+	if got := s.downloaded(); strings.Join(got, " ") != "b3" {
+		t.Errorf("downloads = %v", got)
+	}
+	manifests, err := a.Manifests(context.Background())
+	if err != nil || len(manifests) != 3 {
+		t.Fatalf("manifests = %+v, %v", manifests, err)
+	}
+}
+
+func TestSyncRejectsEscapingIDs(t *testing.T) {
+	s := &backupsStandIn{}
+	s.add("../../escaped", "db", kbcloud.BackupTypeFull, kbcloud.BackupStatusCompleted, archiveNow)
+	s.add("..", "db", kbcloud.BackupTypeFull, kbcloud.BackupStatusCompleted, archiveNow)
+	s.add("b1", "db", kbcloud.BackupTypeFull, kbcloud.BackupStatusCompleted, archiveNow)
+	root := t.TempDir()
+	sink := NewLocalSink(filepath.Join(root, "archive"))
+	a := NewArchiver(apitest.NewClient(t, s), sink, Options{Prefix: "kb"})
+
+	result, err := a.Sync(context.Background(), "org")
+	if !errors.Is(err, ErrInvalidBackupID) {
+		t.Fatalf("sync error = %v", err)
+	}
+	if len(result.Archived) != 1 || result.Archived[0].BackupId != "b1" {
+		t.Fatalf("result = %+v", result)
+	}
+	if got := s.downloaded(); strings.Join(got, " ") != "b1" {
+		t.Errorf("downloads = %v", got)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 || entries[0].Name() != "archive" {
+		t.Errorf("entries written next to the archive: %v", entries)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	sink := NewLocalSink(t.TempDir())
+	a := NewArchiver(nil, sink, Options{
+		Retention: Retention{MaxAge: 72 * time.Hour, KeepLast: 1},
+		Now:       func() time.Time { return archiveNow },
+	})
+	put := func(m Manifest) {
+		t.Helper()
+		dir := m.BackupId
+		m.DataKey = dir + "/" + dataFile
+		data := encode(t, m)
+		for key, content := range map[string][]byte{m.DataKey: []byte("data"), dir + "/" + manifestFile: data} {
+			if err := sink.Put(context.Background(), key, bytes.NewReader(content), int64(len(content))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	daysAgo := func(n int) time.Time { return archiveNow.AddDate(0, 0, -n) }
+	put(Manifest{BackupId: "a1", BackupName: "a1", Cluster: "a", CreationTimestamp: daysAgo(10)})
+	put(Manifest{BackupId: "a2", BackupName: "a2", Cluster: "a", CreationTimestamp: daysAgo(5)})
+	put(Manifest{BackupId: "a3", BackupName: "a3", Cluster: "a", CreationTimestamp: daysAgo(4)})
+	put(Manifest{BackupId: "a4", BackupName: "a4", Cluster: "a", CreationTimestamp: daysAgo(1)})
+	// The only archive of b is kept although it is past the maximum age.
+	put(Manifest{BackupId: "b1", BackupName: "b1", Cluster: "b", CreationTimestamp: daysAgo(30)})
+
+	pruned, err := a.Prune(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range pruned {
+		names = append(names, m.BackupName)
+	}
+	if strings.Join(names, " ") != "a1 a2 a3" {
+		t.Errorf("pruned = %v", names)
+	}
+	if got := keys(t, sink); got != "a4/backup.data a4/manifest.json b1/backup.data b1/manifest.json" {
+		t.Errorf("keys = %s", got)
+	}
+
+	// Data is removed from the directory of the backup, whatever key its manifest records.
+	putManifest := func(key string, m Manifest) {
+		t.Helper()
+		data := encode(t, m)
+		if err := sink.Put(context.Background(), key, bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	putManifest("a0/manifest.json", Manifest{BackupId: "a0", BackupName: "a0", Cluster: "a", CreationTimestamp: daysAgo(20), DataKey: "a4/backup.data"})
+	if pruned, err := a.Prune(context.Background()); err != nil || len(pruned) != 1 {
+		t.Fatalf("prune = %+v, %v", pruned, err)
+	}
+	// A manifest naming a backup outside the prefix is refused.
+	putManifest("x/manifest.json", Manifest{BackupId: "../a4", BackupName: "tampered", Cluster: "a", CreationTimestamp: daysAgo(20), DataKey: "a4/backup.data"})
+	if _, err := a.Prune(context.Background()); !errors.Is(err, ErrInvalidBackupID) {
+		t.Fatalf("prune of a tampered manifest: %v", err)
+	}
+	if got := keys(t, sink); got != "a4/backup.data a4/manifest.json b1/backup.data b1/manifest.json x/manifest.json" {
+		t.Errorf("keys = %s", got)
+	}
+}
+
+func TestLocalSinkRejectsEscapingKeys(t *testing.T) {
+	root := t.TempDir()
+	sink := NewLocalSink(filepath.Join(root, "archive"))
+	ctx := context.Background()
+	for _, key := range []string{"../outside", "a/../../outside", "/etc/outside"} {
+		if err := sink.Put(ctx, key, strings.NewReader("x"), 1); err == nil {
+			t.Errorf("put %s succeeded", key)
+		}
+		if _, err := sink.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("get %s: %v", key, err)
+		}
+		if err := sink.Delete(ctx, key); err == nil {
+			t.Errorf("delete %s succeeded", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "outside")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file written outside the sink: %v", err)
+	}
+}
+
+// encode marshals a manifest the way Archive writes it.
+func encode(t *testing.T, m Manifest) []byte {
+	t.Helper()
+	data, err := common.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
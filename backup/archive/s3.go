@@ -0,0 +1,398 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize is the multipart upload part size used when none is configured.
+const DefaultPartSize = 64 << 20
+
+// S3Options configures an S3Sink.
+type S3Options struct {
+	// Endpoint is the base URL of the S3-compatible service, e.g. https://s3.us-east-1.amazonaws.com.
+	Endpoint string
+	// Region used to sign requests. Defaults to us-east-1.
+	Region string
+	Bucket string
+	// Prefix is prepended to every key.
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// PartSize is the size of multipart upload parts; objects smaller than a
+	// part are uploaded with a single request. AWS S3 requires at least 5 MiB.
+	// Defaults to DefaultPartSize.
+	PartSize int
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// S3Sink stores objects in a bucket of an S3-compatible service using
+// path-style requests signed with AWS Signature Version 4.
+type S3Sink struct {
+	opts S3Options
+	base *url.URL
+}
+
+var _ Sink = (*S3Sink)(nil)
+
+// NewS3Sink returns a Sink storing objects in an S3 bucket.
+func NewS3Sink(opts S3Options) (*S3Sink, error) {
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("s3 sink: bucket is required")
+	}
+	base, err := url.Parse(opts.Endpoint)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("s3 sink: invalid endpoint %q", opts.Endpoint)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.PartSize <= 0 {
+		opts.PartSize = DefaultPartSize
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &S3Sink{opts: opts, base: base}, nil
+}
+
+// S3Error is an error response of the S3 service.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+// Error returns non-empty string if there was an error.
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Put uploads the object with a single request when it fits in one part and
+// with a multipart upload otherwise.
+func (s *S3Sink) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	buf, full, err := s.readFirstPart(r, size)
+	if err != nil {
+		return err
+	}
+	if !full {
+		resp, err := s.do(ctx, http.MethodPut, key, nil, buf)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	uploadId, err := s.createMultipart(ctx, key)
+	if err != nil {
+		return err
+	}
+	parts, err := s.uploadParts(ctx, key, uploadId, r, buf)
+	if err != nil {
+		if resp, abortErr := s.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadId}}, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return s.completeMultipart(ctx, key, uploadId, parts)
+}
+
+// readFirstPart reads the first part of an object; full reports whether it
+// filled a whole part, so that the object may span several parts. An object
+// announced smaller than a part, such as a manifest, is read into a buffer of
+// its size instead of a whole part.
+func (s *S3Sink) readFirstPart(r io.Reader, size int64) ([]byte, bool, error) {
+	n := s.opts.PartSize
+	if size >= 0 && size < int64(n) {
+		// One byte more than size tells whether the object is larger than announced.
+		n = int(size) + 1
+	}
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return buf[:read], false, nil
+	}
+	if err != nil || n == s.opts.PartSize {
+		return buf, err == nil, err
+	}
+
+	// The object is larger than announced: read on into a whole part.
+	part := make([]byte, s.opts.PartSize)
+	copy(part, buf)
+	more, err := io.ReadFull(r, part[n:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return part[:n+more], false, nil
+	}
+	return part, err == nil, err
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *S3Sink) createMultipart(ctx context.Context, key string) (string, error) {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		UploadId string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("s3: decode multipart upload: %w", err)
+	}
+	return out.UploadId, nil
+}
+
+// uploadParts uploads buf, which holds the first full part, and the rest of r.
+func (s *S3Sink) uploadParts(ctx context.Context, key, uploadId string, r io.Reader, buf []byte) ([]completedPart, error) {
+	var parts []completedPart
+	n := len(buf)
+	for number := 1; n > 0; number++ {
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadId}}
+		resp, err := s.do(ctx, http.MethodPut, key, query, buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+		var readErr error
+		n, readErr = io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return nil, readErr
+		}
+	}
+	return parts, nil
+}
+
+func (s *S3Sink) completeMultipart(ctx context.Context, key, uploadId string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadId}}, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// The service may report a failure in the body of a 200 response.
+	var out struct {
+		XMLName xml.Name
+		S3Error
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if xml.Unmarshal(data, &out) == nil && out.XMLName.Local == "Error" {
+		out.S3Error.StatusCode = resp.StatusCode
+		return &out.S3Error
+	}
+	return nil
+}
+
+// Get downloads the object.
+func (s *S3Sink) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// List pages through ListObjectsV2.
+func (s *S3Sink) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.opts.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: decode object list: %w", err)
+		}
+		for _, c := range out.Contents {
+			keys = append(keys, strings.TrimPrefix(c.Key, s.opts.Prefix))
+		}
+		if !out.IsTruncated || out.NextContinuationToken == "" {
+			break
+		}
+		token = out.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete removes the object.
+func (s *S3Sink) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for key, or for the bucket when key is empty.
+// Responses outside the 2xx range are turned into errors.
+func (s *S3Sink) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *s.base
+	segments := []string{s.opts.Bucket}
+	if key != "" {
+		segments = append(segments, strings.Split(s.opts.Prefix+key, "/")...)
+	}
+	escaped := make([]string, len(segments))
+	for i, seg := range segments {
+		escaped[i] = uriEncode(seg)
+	}
+	u.Path = strings.TrimSuffix(s.base.Path, "/") + "/" + strings.Join(segments, "/")
+	u.RawPath = strings.TrimSuffix(s.base.EscapedPath(), "/") + "/" + strings.Join(escaped, "/")
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && method != http.MethodPost {
+		return nil, ErrNotFound
+	}
+	s3err := &S3Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(resp.Body)
+	_ = xml.Unmarshal(data, s3err)
+	if s3err.Code == "" {
+		s3err.Code = http.StatusText(resp.StatusCode)
+	}
+	return nil, s3err
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *S3Sink) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.opts.SessionToken)
+	}
+
+	names := []string{"host"}
+	for name := range req.Header {
+		if n := strings.ToLower(name); strings.HasPrefix(n, "x-amz-") {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, n := range names {
+		value := req.Host
+		if n != "host" {
+			value = strings.TrimSpace(req.Header.Get(n))
+		}
+		headers.WriteString(n + ":" + value + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + s.opts.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.opts.SecretAccessKey), date)
+	key = hmacSHA256(key, s.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query sorted by key with RFC 3986 escaping, as SigV4 requires.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func uriEncode(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
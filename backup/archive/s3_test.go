@@ -0,0 +1,159 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an in-memory stand-in for the subset of the S3 API used by S3Sink.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != "archive" {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		fmt.Fprint(w, "<ListBucketResult>")
+		var keys []string
+		for k := range f.objects {
+			if strings.HasPrefix(k, q.Get("prefix")) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", k)
+		}
+		fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		id := fmt.Sprint(len(f.uploads) + 1)
+		f.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		var n int
+		fmt.Sscan(q.Get("partNumber"), &n)
+		f.uploads[q.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, n))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		var complete struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		xml.Unmarshal(body, &complete)
+		var data []byte
+		for _, p := range complete.Parts {
+			data = append(data, f.uploads[q.Get("uploadId")][p.PartNumber]...)
+		}
+		f.objects[key] = data
+		fmt.Fprint(w, "<CompleteMultipartUploadResult/>")
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Sink(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	sink, err := NewS3Sink(S3Options{
+		Endpoint:        srv.URL,
+		Bucket:          "archive",
+		Prefix:          "kb/",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		PartSize:        1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	small := []byte(`{"backupId":"b1"}`)
+	large := bytes.Repeat([]byte("0123456789"), 350)
+	if err := sink.Put(ctx, "b1/manifest.json", bytes.NewReader(small), int64(len(small))); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Put(ctx, "b1/backup.data", bytes.NewReader(large), -1); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(fake.uploads); got != 1 {
+		t.Errorf("multipart uploads = %d, want 1", got)
+	}
+	// Small objects are not read into a whole part.
+	if buf, full, err := sink.readFirstPart(bytes.NewReader(small), int64(len(small))); err != nil || full || cap(buf) != len(small)+1 {
+		t.Errorf("first part of a small object: %d bytes of %d, full %v, %v", len(buf), cap(buf), full, err)
+	}
+	// An object larger than announced is still uploaded whole.
+	if err := sink.Put(ctx, "b2/backup.data", bytes.NewReader(large), 10); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := sink.Get(ctx, "b2/backup.data"); err != nil {
+		t.Fatal(err)
+	} else if got, _ := io.ReadAll(r); !bytes.Equal(got, large) {
+		t.Errorf("under-announced object: got %d bytes, want %d", len(got), len(large))
+	}
+
+	keys, err := sink.List(ctx, "b1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b1/backup.data", "b1/manifest.json"}; fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("List = %v, want %v", keys, want)
+	}
+
+	r, err := sink.Get(ctx, "b1/backup.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(r)
+	r.Close()
+	if !bytes.Equal(got, large) {
+		t.Errorf("Get returned %d bytes, want %d", len(got), len(large))
+	}
+
+	if err := sink.Delete(ctx, "b1/backup.data"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sink.Get(ctx, "b1/backup.data"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package compliance
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/schedule"
+)
+
+// checkSchedule matches every run the backup cron expression scheduled in
+// [from, now-Grace] to the automatic backup started for it.
+func (a *Auditor) checkSchedule(cr *ClusterReport, backups []kbcloud.Backup, from, now time.Time) {
+	cron, err := schedule.ParseCron(cr.Policy.CronExpression)
+	if err != nil {
+		cr.add(Finding{Kind: FindingInvalidPolicy, Message: fmt.Sprintf("invalid backup schedule: %v", err)})
+		return
+	}
+	var scheduled []kbcloud.Backup
+	for _, b := range backups {
+		if b.AutoBackup && b.BackupType != kbcloud.BackupTypeContinuous {
+			scheduled = append(scheduled, b)
+		}
+	}
+	used := make([]bool, len(scheduled))
+	grace := a.opts.Grace
+	deadline := now.Add(-grace)
+
+	for t := cron.Next(from.In(a.opts.Location)); !t.IsZero() && !t.After(deadline); t = cron.Next(t) {
+		cr.ExpectedRuns++
+		// A run owns the backups started shortly before it and until the grace
+		// period ends or the next run is due, whichever comes first.
+		start, end := t.Add(-time.Minute), t.Add(grace)
+		if next := cron.Next(t); !next.IsZero() && next.Before(end) {
+			end = next
+		}
+		var completed, failed, pending *kbcloud.Backup
+		for i := range scheduled {
+			created := scheduled[i].CreationTimestamp
+			if used[i] || created.Before(start) || !created.Before(end) {
+				continue
+			}
+			used[i] = true
+			switch scheduled[i].Status {
+			case kbcloud.BackupStatusCompleted:
+				completed = &scheduled[i]
+			case kbcloud.BackupStatusFailed:
+				failed = &scheduled[i]
+			default:
+				pending = &scheduled[i]
+			}
+		}
+
+		run := t
+		switch {
+		case completed != nil && completedAt(*completed).Sub(t) <= grace:
+			cr.CompletedRuns++
+		case completed != nil:
+			cr.add(Finding{Kind: FindingMissedRun, Time: &run, Backup: completed.Name,
+				Message: fmt.Sprintf("scheduled backup completed %s after %s, later than the %s grace period", completedAt(*completed).Sub(t).Round(time.Second), t.Format(time.RFC3339), grace)})
+		case failed != nil:
+			cr.add(Finding{Kind: FindingFailedRun, Time: &run, Backup: failed.Name,
+				Message: fmt.Sprintf("scheduled backup of %s failed: %s", t.Format(time.RFC3339), failed.GetFailureReason())})
+		case pending != nil:
+			cr.add(Finding{Kind: FindingMissedRun, Time: &run, Backup: pending.Name,
+				Message: fmt.Sprintf("scheduled backup of %s is still %s after the %s grace period", t.Format(time.RFC3339), pending.Status, grace)})
+		default:
+			cr.add(Finding{Kind: FindingMissedRun, Time: &run,
+				Message: fmt.Sprintf("no backup was started for the run scheduled at %s", t.Format(time.RFC3339))})
+		}
+	}
+
+	// Failed automatic backups outside any scheduled slot still count as failed runs.
+	for i, b := range scheduled {
+		if !used[i] && b.Status == kbcloud.BackupStatusFailed && !b.CreationTimestamp.Before(from) {
+			created := b.CreationTimestamp
+			cr.add(Finding{Kind: FindingFailedRun, Time: &created, Backup: b.Name,
+				Message: fmt.Sprintf("automatic backup failed: %s", b.GetFailureReason())})
+		}
+	}
+}
+
+// checkRetention flags completed backups kept past their expiration and
+// automatic backups that expire earlier than the policy requires.
+func (a *Auditor) checkRetention(cr *ClusterReport, backups []kbcloud.Backup, now time.Time) {
+	policyRetention, err := ParseRetentionPeriod(cr.Policy.RetentionPeriod)
+	if err != nil {
+		cr.add(Finding{Kind: FindingInvalidPolicy, Message: err.Error()})
+	}
+	grace := a.opts.Grace
+	for _, b := range backups {
+		if b.Status != kbcloud.BackupStatusCompleted {
+			continue
+		}
+		if b.Expiration != nil && b.Expiration.Before(now.Add(-grace)) {
+			cr.add(Finding{Kind: FindingRetentionViolation, Backup: b.Name,
+				Message: fmt.Sprintf("backup is retained past its expiration at %s", b.Expiration.Format(time.RFC3339))})
+			continue
+		}
+		if policyRetention <= 0 || !b.AutoBackup {
+			continue
+		}
+		if b.Expiration != nil && b.Expiration.Before(b.CreationTimestamp.Add(policyRetention-grace)) {
+			cr.add(Finding{Kind: FindingRetentionViolation, Backup: b.Name,
+				Message: fmt.Sprintf("backup expires at %s, before the %s retention period of the policy", b.Expiration.Format(time.RFC3339), cr.Policy.RetentionPeriod)})
+			continue
+		}
+		if retention, err := ParseRetentionPeriod(b.RetentionPeriod); err == nil && retention > 0 && retention < policyRetention {
+			cr.add(Finding{Kind: FindingRetentionViolation, Backup: b.Name,
+				Message: fmt.Sprintf("backup retention period %s is shorter than the %s of the policy", b.RetentionPeriod, cr.Policy.RetentionPeriod)})
+		}
+	}
+}
+
+// checkPITR reports the parts of [from, now-Grace] not covered by the time
+// ranges of continuous backups.
+func (a *Auditor) checkPITR(cr *ClusterReport, backups []kbcloud.Backup, from, now time.Time) {
+	type span struct{ start, end time.Time }
+	var spans []span
+	for _, b := range backups {
+		if b.BackupType != kbcloud.BackupTypeContinuous || b.Status == kbcloud.BackupStatusDeleting ||
+			b.TimeRangeStart == nil || b.TimeRangeEnd == nil {
+			continue
+		}
+		spans = append(spans, span{*b.TimeRangeStart, *b.TimeRangeEnd})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start.Before(spans[j].start) })
+
+	end := now.Add(-a.opts.Grace)
+	gap := func(start, stop time.Time) {
+		if stop.Sub(start) < a.opts.PITRTolerance {
+			return
+		}
+		cr.add(Finding{Kind: FindingPITRGap, Time: &start, End: &stop,
+			Message: fmt.Sprintf("no point-in-time recovery coverage from %s to %s", start.Format(time.RFC3339), stop.Format(time.RFC3339))})
+	}
+	cursor := from
+	for _, s := range spans {
+		if !cursor.Before(end) {
+			break
+		}
+		if !s.end.After(cursor) {
+			continue
+		}
+		if s.start.After(cursor) {
+			stop := s.start
+			if stop.After(end) {
+				stop = end
+			}
+			gap(cursor, stop)
+		}
+		cursor = s.end
+	}
+	if cursor.Before(end) {
+		gap(cursor, end)
+	}
+}
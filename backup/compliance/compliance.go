@@ -0,0 +1,244 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package compliance audits the backups of an organization against the backup
+// policies of its clusters and reports where the backup SLA was not met.
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// FindingKind identifies what a finding is about.
+type FindingKind string
+
+// List of FindingKind.
+const (
+	FindingNoBackupPolicy     FindingKind = "NoBackupPolicy"
+	FindingInvalidPolicy      FindingKind = "InvalidPolicy"
+	FindingAutoBackupDisabled FindingKind = "AutoBackupDisabled"
+	FindingMissedRun          FindingKind = "MissedRun"
+	FindingFailedRun          FindingKind = "FailedRun"
+	FindingRetentionViolation FindingKind = "RetentionViolation"
+	FindingPITRGap            FindingKind = "PITRGap"
+)
+
+// Finding is a single compliance violation of a cluster.
+type Finding struct {
+	Kind    FindingKind `json:"kind"`
+	Message string      `json:"message"`
+	// Time is the scheduled time of a run, or the start of a PITR gap.
+	Time *time.Time `json:"time,omitempty"`
+	// End is the end of a PITR gap.
+	End *time.Time `json:"end,omitempty"`
+	// Backup is the name of the backup the finding is about, if any.
+	Backup string `json:"backup,omitempty"`
+}
+
+// Policy is the backup policy a cluster was audited against.
+type Policy struct {
+	AutoBackup      bool   `json:"autoBackup"`
+	CronExpression  string `json:"cronExpression"`
+	RetentionPeriod string `json:"retentionPeriod"`
+	PitrEnabled     bool   `json:"pitrEnabled"`
+}
+
+// ClusterReport is the audit result of a single cluster.
+type ClusterReport struct {
+	Cluster     string `json:"cluster"`
+	Environment string `json:"environment"`
+	Engine      string `json:"engine"`
+	// Policy is nil when the cluster has no backup policy.
+	Policy *Policy `json:"policy,omitempty"`
+	// ExpectedRuns is the number of scheduled backups within the audit window.
+	ExpectedRuns int `json:"expectedRuns"`
+	// CompletedRuns is the number of scheduled backups that completed.
+	CompletedRuns       int        `json:"completedRuns"`
+	LastCompletedBackup *time.Time `json:"lastCompletedBackup,omitempty"`
+	Findings            []Finding  `json:"findings"`
+	Compliant           bool       `json:"compliant"`
+}
+
+// Report is the audit result of an organization.
+type Report struct {
+	OrgName     string          `json:"orgName"`
+	GeneratedAt time.Time       `json:"generatedAt"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	Clusters    []ClusterReport `json:"clusters"`
+}
+
+// Compliant reports whether every audited cluster is compliant.
+func (r *Report) Compliant() bool {
+	for _, c := range r.Clusters {
+		if !c.Compliant {
+			return false
+		}
+	}
+	return true
+}
+
+// AuditOptions configures an Auditor.
+type AuditOptions struct {
+	// Window is how far back the audit looks. Defaults to 7 days.
+	Window time.Duration
+	// Grace is how long a scheduled backup may take to complete, and how far
+	// PITR coverage may lag behind. Defaults to 1h.
+	Grace time.Duration
+	// PITRTolerance is the shortest PITR gap reported. Defaults to 5m.
+	PITRTolerance time.Duration
+	// Location is the time zone backup cron expressions are evaluated in. Defaults to UTC.
+	Location *time.Location
+	// EnvironmentName restricts the audit to clusters of one environment.
+	EnvironmentName string
+	// Filter, when set, selects the clusters to audit.
+	Filter func(kbcloud.ClusterListItem) bool
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Auditor audits cluster backups against their backup policies.
+type Auditor struct {
+	clusterApi *kbcloud.ClusterApi
+	backupApi  *kbcloud.BackupApi
+	opts       AuditOptions
+}
+
+// NewAuditor returns an Auditor using client.
+func NewAuditor(client *common.APIClient, opts AuditOptions) *Auditor {
+	if opts.Window <= 0 {
+		opts.Window = 7 * 24 * time.Hour
+	}
+	if opts.Grace <= 0 {
+		opts.Grace = time.Hour
+	}
+	if opts.PITRTolerance <= 0 {
+		opts.PITRTolerance = 5 * time.Minute
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Auditor{
+		clusterApi: kbcloud.NewClusterApi(client),
+		backupApi:  kbcloud.NewBackupApi(client),
+		opts:       opts,
+	}
+}
+
+// Audit audits every cluster of the organization.
+func (a *Auditor) Audit(ctx context.Context, orgName string) (*Report, error) {
+	now := a.opts.Now()
+	report := &Report{
+		OrgName:     orgName,
+		GeneratedAt: now,
+		From:        now.Add(-a.opts.Window),
+		To:          now,
+		Clusters:    []ClusterReport{},
+	}
+
+	params := kbcloud.NewListClusterOptionalParameters()
+	if a.opts.EnvironmentName != "" {
+		params = params.WithEnvironmentName(a.opts.EnvironmentName)
+	}
+	clusters, _, err := a.clusterApi.ListCluster(ctx, orgName, *params)
+	if err != nil {
+		return nil, fmt.Errorf("list clusters: %w", err)
+	}
+	backups, _, err := a.backupApi.ListBackups(ctx, orgName)
+	if err != nil {
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+	byCluster := map[string][]kbcloud.Backup{}
+	for _, b := range backups.Items {
+		key := b.SourceCluster
+		if b.GetClusterId() != "" {
+			key = b.GetClusterId()
+		}
+		byCluster[key] = append(byCluster[key], b)
+	}
+
+	for _, c := range clusters.Items {
+		if a.opts.Filter != nil && !a.opts.Filter(c) {
+			continue
+		}
+		clusterBackups := byCluster[c.Id]
+		if len(clusterBackups) == 0 {
+			clusterBackups = byCluster[c.Name]
+		}
+		cr, err := a.auditCluster(ctx, orgName, c, clusterBackups, report.From, now)
+		if err != nil {
+			return nil, err
+		}
+		report.Clusters = append(report.Clusters, cr)
+	}
+	sort.Slice(report.Clusters, func(i, j int) bool { return report.Clusters[i].Cluster < report.Clusters[j].Cluster })
+	return report, nil
+}
+
+func (a *Auditor) auditCluster(ctx context.Context, orgName string, c kbcloud.ClusterListItem, backups []kbcloud.Backup, from, now time.Time) (ClusterReport, error) {
+	cr := ClusterReport{
+		Cluster:     c.Name,
+		Environment: c.EnvironmentName,
+		Engine:      c.Engine,
+		Findings:    []Finding{},
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreationTimestamp.Before(backups[j].CreationTimestamp) })
+	for _, b := range backups {
+		if b.Status == kbcloud.BackupStatusCompleted && b.BackupType != kbcloud.BackupTypeContinuous {
+			t := completedAt(b)
+			cr.LastCompletedBackup = &t
+		}
+	}
+
+	policy, resp, err := a.backupApi.GetClusterBackupPolicy(ctx, orgName, c.Name)
+	if err != nil {
+		if resp != nil && resp.StatusCode == 404 {
+			cr.add(Finding{Kind: FindingNoBackupPolicy, Message: "cluster has no backup policy"})
+			return cr, nil
+		}
+		return cr, fmt.Errorf("get backup policy of cluster %s: %w", c.Name, err)
+	}
+	cr.Policy = &Policy{
+		AutoBackup:      policy.GetAutoBackup(),
+		CronExpression:  policy.GetCronExpression(),
+		RetentionPeriod: policy.GetRetentionPeriod(),
+		PitrEnabled:     policy.GetPitrEnabled(),
+	}
+
+	// Runs scheduled before the cluster existed cannot have been missed.
+	if c.CreatedAt.After(from) {
+		from = c.CreatedAt
+	}
+	if !cr.Policy.AutoBackup {
+		cr.add(Finding{Kind: FindingAutoBackupDisabled, Message: "automatic backups are disabled"})
+	} else {
+		a.checkSchedule(&cr, backups, from, now)
+	}
+	a.checkRetention(&cr, backups, now)
+	if cr.Policy.PitrEnabled {
+		a.checkPITR(&cr, backups, from, now)
+	}
+	cr.Compliant = len(cr.Findings) == 0
+	return cr, nil
+}
+
+func (cr *ClusterReport) add(f Finding) {
+	cr.Findings = append(cr.Findings, f)
+}
+
+func completedAt(b kbcloud.Backup) time.Time {
+	if b.CompletionTimestamp != nil {
+		return *b.CompletionTimestamp
+	}
+	return b.CreationTimestamp
+}
@@ -0,0 +1,257 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package compliance
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+var (
+	auditFrom = time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	auditNow  = time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+)
+
+// at returns the time of day h:m on January day of 2024.
+func at(day, h, m int) time.Time {
+	return time.Date(2024, 1, day, h, m, 0, 0, time.UTC)
+}
+
+func scheduled(name string, created time.Time, took time.Duration, status kbcloud.BackupStatus) kbcloud.Backup {
+	completed := created.Add(took)
+	return kbcloud.Backup{
+		Name: name, AutoBackup: true, BackupType: kbcloud.BackupTypeFull, Status: status,
+		CreationTimestamp: created, CompletionTimestamp: &completed,
+	}
+}
+
+func continuous(start, end time.Time, status kbcloud.BackupStatus) kbcloud.Backup {
+	return kbcloud.Backup{
+		Name: "pitr", AutoBackup: true, BackupType: kbcloud.BackupTypeContinuous, Status: status,
+		CreationTimestamp: start, TimeRangeStart: &start, TimeRangeEnd: &end,
+	}
+}
+
+// findings renders findings as kind@time or kind:backup, in order.
+func findings(cr ClusterReport) string {
+	var out []string
+	for _, f := range cr.Findings {
+		s := string(f.Kind)
+		if f.Time != nil {
+			s += "@" + f.Time.Format("02T15:04")
+		}
+		if f.End != nil {
+			s += "-" + f.End.Format("02T15:04")
+		}
+		if f.Backup != "" {
+			s += ":" + f.Backup
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestCheckSchedule(t *testing.T) {
+	onTime := func(day int) kbcloud.Backup {
+		return scheduled(fmt.Sprintf("b%d", day), at(day, 2, 0), 10*time.Minute, kbcloud.BackupStatusCompleted)
+	}
+	for _, tc := range []struct {
+		name      string
+		cron      string
+		backups   []kbcloud.Backup
+		completed int
+		want      string
+	}{
+		{
+			name:      "every run completed",
+			cron:      "0 2 * * *",
+			backups:   []kbcloud.Backup{onTime(5), onTime(6), onTime(7), onTime(8)},
+			completed: 4,
+		},
+		{
+			name:      "run without backup",
+			cron:      "0 2 * * *",
+			backups:   []kbcloud.Backup{onTime(5), onTime(7), onTime(8)},
+			completed: 3,
+			want:      "MissedRun@06T02:00",
+		},
+		{
+			name: "failed, late and still running runs",
+			cron: "0 2 * * *",
+			backups: []kbcloud.Backup{
+				onTime(5),
+				scheduled("failed", at(6, 2, 0), time.Minute, kbcloud.BackupStatusFailed),
+				scheduled("late", at(7, 2, 1), 3*time.Hour, kbcloud.BackupStatusCompleted),
+				scheduled("stuck", at(8, 2, 0), 0, kbcloud.BackupStatusRunning),
+			},
+			completed: 1,
+			want:      "FailedRun@06T02:00:failed MissedRun@07T02:00:late MissedRun@08T02:00:stuck",
+		},
+		{
+			name: "retried run completes",
+			cron: "0 2 * * *",
+			backups: []kbcloud.Backup{
+				onTime(5), onTime(6), onTime(8),
+				scheduled("first", at(7, 2, 0), time.Minute, kbcloud.BackupStatusFailed),
+				scheduled("retry", at(7, 2, 20), 10*time.Minute, kbcloud.BackupStatusCompleted),
+			},
+			completed: 4,
+		},
+		{
+			name: "failed backup outside any run",
+			cron: "0 2 * * *",
+			backups: []kbcloud.Backup{
+				onTime(5), onTime(6), onTime(7), onTime(8),
+				scheduled("stray", at(6, 14, 0), time.Minute, kbcloud.BackupStatusFailed),
+			},
+			completed: 4,
+			want:      "FailedRun@06T14:00:stray",
+		},
+		{
+			name:    "manual and continuous backups do not count",
+			cron:    "0 2 * * 1",
+			backups: []kbcloud.Backup{{Name: "manual", BackupType: kbcloud.BackupTypeFull, Status: kbcloud.BackupStatusCompleted, CreationTimestamp: at(8, 2, 0)}, continuous(at(1, 0, 0), at(8, 12, 0), kbcloud.BackupStatusRunning)},
+			want:    "MissedRun@08T02:00",
+		},
+		{
+			name: "run not due before the grace period ends",
+			cron: "30 11 * * *",
+			backups: []kbcloud.Backup{
+				scheduled("b5", at(5, 11, 30), time.Minute, kbcloud.BackupStatusCompleted),
+				scheduled("b6", at(6, 11, 30), time.Minute, kbcloud.BackupStatusCompleted),
+				scheduled("b7", at(7, 11, 30), time.Minute, kbcloud.BackupStatusCompleted),
+			},
+			completed: 3,
+		},
+		{
+			name: "invalid cron",
+			cron: "0 25 * * *",
+			want: "InvalidPolicy",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAuditor(nil, AuditOptions{})
+			cr := ClusterReport{Policy: &Policy{AutoBackup: true, CronExpression: tc.cron}}
+			a.checkSchedule(&cr, tc.backups, auditFrom, auditNow)
+			if got := findings(cr); got != tc.want {
+				t.Errorf("findings = %q, want %q", got, tc.want)
+			}
+			if cr.CompletedRuns != tc.completed {
+				t.Errorf("completed runs = %d, want %d", cr.CompletedRuns, tc.completed)
+			}
+		})
+	}
+}
+
+func TestCheckRetention(t *testing.T) {
+	backup := func(name string, auto bool, retention string, expiresIn time.Duration) kbcloud.Backup {
+		b := kbcloud.Backup{
+			Name: name, AutoBackup: auto, BackupType: kbcloud.BackupTypeFull, Status: kbcloud.BackupStatusCompleted,
+			CreationTimestamp: at(7, 2, 0), RetentionPeriod: retention,
+		}
+		if expiresIn != 0 {
+			expiration := b.CreationTimestamp.Add(expiresIn)
+			b.Expiration = &expiration
+		}
+		return b
+	}
+	for _, tc := range []struct {
+		name    string
+		policy  string
+		backups []kbcloud.Backup
+		want    string
+	}{
+		{"matching policy", "7d", []kbcloud.Backup{backup("ok", true, "7d", 7*24*time.Hour), backup("forever", true, "", 0)}, ""},
+		{"kept past expiration", "7d", []kbcloud.Backup{backup("stale", false, "1d", 24*time.Hour)}, "RetentionViolation:stale"},
+		{"expires early", "1w", []kbcloud.Backup{backup("short", true, "7d", 3*24*time.Hour)}, "RetentionViolation:short"},
+		{"shorter retention period", "7d", []kbcloud.Backup{backup("short", true, "3d", 0)}, "RetentionViolation:short"},
+		{"manual backups follow their own retention", "7d", []kbcloud.Backup{backup("manual", false, "2d", 2*24*time.Hour)}, ""},
+		{"expiration within grace", "7d", []kbcloud.Backup{backup("edge", true, "7d", 7*24*time.Hour-30*time.Minute)}, ""},
+		{"unfinished backups", "7d", []kbcloud.Backup{func() kbcloud.Backup {
+			b := backup("failed", true, "1d", 24*time.Hour)
+			b.Status = kbcloud.BackupStatusFailed
+			return b
+		}()}, ""},
+		{"invalid policy", "7x", []kbcloud.Backup{backup("ok", true, "1d", 0)}, "InvalidPolicy"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAuditor(nil, AuditOptions{})
+			cr := ClusterReport{Policy: &Policy{RetentionPeriod: tc.policy}}
+			a.checkRetention(&cr, tc.backups, auditNow)
+			if got := findings(cr); got != tc.want {
+				t.Errorf("findings = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckPITR(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		backups []kbcloud.Backup
+		want    string
+	}{
+		{"covered", []kbcloud.Backup{continuous(at(4, 0, 0), at(8, 12, 0), kbcloud.BackupStatusRunning)}, ""},
+		{"lagging within grace", []kbcloud.Backup{continuous(at(4, 0, 0), at(8, 11, 0), kbcloud.BackupStatusRunning)}, ""},
+		{"gap at start", []kbcloud.Backup{continuous(at(6, 0, 0), at(8, 12, 0), kbcloud.BackupStatusRunning)}, "PITRGap@05T00:00-06T00:00"},
+		{"gap at end", []kbcloud.Backup{continuous(at(4, 0, 0), at(8, 0, 0), kbcloud.BackupStatusCompleted)}, "PITRGap@08T00:00-08T11:00"},
+		{"gap between unordered spans", []kbcloud.Backup{
+			continuous(at(6, 6, 0), at(8, 12, 0), kbcloud.BackupStatusRunning),
+			continuous(at(4, 0, 0), at(6, 0, 0), kbcloud.BackupStatusCompleted),
+		}, "PITRGap@06T00:00-06T06:00"},
+		{"overlapping spans", []kbcloud.Backup{
+			continuous(at(4, 0, 0), at(7, 0, 0), kbcloud.BackupStatusCompleted),
+			continuous(at(5, 0, 0), at(6, 0, 0), kbcloud.BackupStatusCompleted),
+			continuous(at(6, 23, 0), at(8, 12, 0), kbcloud.BackupStatusRunning),
+		}, ""},
+		{"gap below tolerance", []kbcloud.Backup{
+			continuous(at(4, 0, 0), at(6, 0, 0), kbcloud.BackupStatusCompleted),
+			continuous(at(6, 0, 3), at(8, 12, 0), kbcloud.BackupStatusRunning),
+		}, ""},
+		{"deleting backups do not cover", []kbcloud.Backup{continuous(at(4, 0, 0), at(8, 12, 0), kbcloud.BackupStatusDeleting)}, "PITRGap@05T00:00-08T11:00"},
+		{"no continuous backup", nil, "PITRGap@05T00:00-08T11:00"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAuditor(nil, AuditOptions{})
+			cr := ClusterReport{Policy: &Policy{PitrEnabled: true}}
+			a.checkPITR(&cr, tc.backups, auditFrom, auditNow)
+			if got := findings(cr); got != tc.want {
+				t.Errorf("findings = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseRetentionPeriod(t *testing.T) {
+	day := 24 * time.Hour
+	for in, want := range map[string]time.Duration{
+		"":       0,
+		"7d":     7 * day,
+		" 12H ":  12 * time.Hour,
+		"1d12h":  36 * time.Hour,
+		"2w":     14 * day,
+		"3mo":    90 * day,
+		"1y":     365 * day,
+		"90m":    90 * time.Minute,
+		"1y1mo1": -1,
+		"7x":     -1,
+		"d":      -1,
+	} {
+		got, err := ParseRetentionPeriod(in)
+		if want < 0 {
+			if err == nil {
+				t.Errorf("ParseRetentionPeriod(%q) = %s, want an error", in, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("ParseRetentionPeriod(%q) = %s, %v, want %s", in, got, err, want)
+		}
+	}
+}
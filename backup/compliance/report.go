@@ -0,0 +1,92 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package compliance
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+)
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := common.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the report as a Markdown document with a summary table
+// followed by the findings of every non-compliant cluster.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	compliant := 0
+	for _, c := range r.Clusters {
+		if c.Compliant {
+			compliant++
+		}
+	}
+
+	fmt.Fprintf(b, "# Backup compliance report: %s\n\n", r.OrgName)
+	fmt.Fprintf(b, "- Generated: %s\n", r.GeneratedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(b, "- Audit window: %s to %s\n", r.From.UTC().Format(time.RFC3339), r.To.UTC().Format(time.RFC3339))
+	fmt.Fprintf(b, "- Compliant clusters: %d of %d\n\n", compliant, len(r.Clusters))
+
+	if len(r.Clusters) > 0 {
+		b.WriteString("| Cluster | Environment | Auto backup | Schedule | Retention | PITR | Runs | Last backup | Status |\n")
+		b.WriteString("|---|---|---|---|---|---|---|---|---|\n")
+		for _, c := range r.Clusters {
+			auto, cron, retention, pitr := "-", "-", "-", "-"
+			if c.Policy != nil {
+				auto, pitr = yesNo(c.Policy.AutoBackup), yesNo(c.Policy.PitrEnabled)
+				cron, retention = "`"+c.Policy.CronExpression+"`", c.Policy.RetentionPeriod
+			}
+			last := "-"
+			if c.LastCompletedBackup != nil {
+				last = c.LastCompletedBackup.UTC().Format(time.RFC3339)
+			}
+			status := "compliant"
+			if !c.Compliant {
+				status = fmt.Sprintf("%d finding(s)", len(c.Findings))
+			}
+			fmt.Fprintf(b, "| %s | %s | %s | %s | %s | %s | %d/%d | %s | %s |\n",
+				cell(c.Cluster), cell(c.Environment), auto, cell(cron), cell(retention), pitr,
+				c.CompletedRuns, c.ExpectedRuns, last, status)
+		}
+	}
+
+	for _, c := range r.Clusters {
+		if c.Compliant {
+			continue
+		}
+		fmt.Fprintf(b, "\n## %s\n\n", c.Cluster)
+		for _, f := range c.Findings {
+			fmt.Fprintf(b, "- **%s**", f.Kind)
+			if f.Backup != "" {
+				fmt.Fprintf(b, " `%s`", f.Backup)
+			}
+			fmt.Fprintf(b, ": %s\n", f.Message)
+		}
+	}
+	return b.Flush()
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+// cell escapes a value for use in a Markdown table cell.
+func cell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,397 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package backup
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+)
+
+// DefaultChunkSize is the size of ranged requests used when none is configured.
+const DefaultChunkSize int64 = 64 << 20
+
+// ErrChecksumMismatch is returned when the downloaded file does not match the checksum sent by the server.
+var ErrChecksumMismatch = errors.New("downloaded backup does not match the server checksum")
+
+// Progress reports how many bytes of a download are on disk. Total is -1 when unknown.
+type Progress struct {
+	Written int64
+	Total   int64
+}
+
+// DownloadOptions configures DownloadBackupToFile.
+type DownloadOptions struct {
+	// Concurrency is the number of ranged requests in flight. Defaults to 1.
+	Concurrency int
+	// ChunkSize is the size of each ranged request. Defaults to DefaultChunkSize.
+	ChunkSize int64
+	// Progress, when set, is called as data is written. It may be called concurrently.
+	Progress func(Progress)
+}
+
+// DownloadResult describes a completed download.
+type DownloadResult struct {
+	Path string
+	Size int64
+	// Resumed reports whether data from a previous interrupted attempt was reused.
+	Resumed bool
+	// ChecksumVerified reports whether the server sent a checksum that was verified.
+	ChecksumVerified bool
+}
+
+// partState is persisted next to the partial file so an interrupted download can resume.
+type partState struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Size         int64  `json:"size"`
+	ChunkSize    int64  `json:"chunkSize"`
+	Done         []bool `json:"done"`
+}
+
+// DownloadBackupToFile downloads a full backup to path.
+//
+// Data is written to path+".part" and renamed into place once complete, so path
+// never holds a truncated backup. When the server supports HTTP range requests
+// the backup is fetched in chunks, optionally in parallel, and an interrupted
+// download resumes from the chunks already on disk. A checksum sent by the server
+// in a Digest or Content-MD5 header is verified before the rename. An empty
+// backup produces an empty file.
+func DownloadBackupToFile(ctx context.Context, client *common.APIClient, orgName, backupId, path string, opts DownloadOptions) (DownloadResult, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	result := DownloadResult{Path: path}
+	partPath, statePath := path+".part", path+".part.json"
+
+	// Probe with a one byte range to learn the size and whether ranges are supported.
+	resp, err := download(ctx, client, orgName, backupId, map[string]string{"Range": "bytes=0-0"}, nil)
+	if resp != nil && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// An empty backup has no byte to probe: download it without a range.
+		resp, err = download(ctx, client, orgName, backupId, nil, nil)
+	}
+	if err != nil {
+		return result, err
+	}
+	checksum := serverChecksum(resp.Header)
+
+	if resp.StatusCode != http.StatusPartialContent {
+		// No range support: stream the response we already have from the start.
+		defer resp.Body.Close()
+		os.Remove(statePath)
+		size, err := streamToFile(resp.Body, partPath, resp.ContentLength, opts.Progress)
+		if err != nil {
+			return result, err
+		}
+		result.Size = size
+		return finish(result, partPath, statePath, checksum)
+	}
+	resp.Body.Close()
+
+	total, err := contentRangeTotal(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return result, err
+	}
+	result.Size = total
+
+	state := loadState(statePath)
+	if state == nil || state.Size != total || state.ChunkSize != opts.ChunkSize ||
+		state.ETag != resp.Header.Get("ETag") || state.LastModified != resp.Header.Get("Last-Modified") {
+		state = &partState{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Size:         total,
+			ChunkSize:    opts.ChunkSize,
+			Done:         make([]bool, (total+opts.ChunkSize-1)/opts.ChunkSize),
+		}
+		os.Remove(partPath)
+	}
+
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+	if err := f.Truncate(total); err != nil {
+		return result, err
+	}
+
+	var written int64
+	var pending []int
+	for i, done := range state.Done {
+		if done {
+			result.Resumed = true
+			written += chunkLen(state, i)
+		} else {
+			pending = append(pending, i)
+		}
+	}
+	report(opts.Progress, written, total)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+		next     = make(chan int)
+	)
+	validator := state.ETag
+	if validator == "" {
+		validator = state.LastModified
+	}
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				start := int64(i) * state.ChunkSize
+				n, err := fetchRange(ctx, client, orgName, backupId, f, start, chunkLen(state, i), validator, func(delta int64) {
+					report(opts.Progress, atomic.AddInt64(&written, delta), total)
+				})
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					atomic.AddInt64(&written, -n)
+				} else {
+					state.Done[i] = true
+					if err := saveState(statePath, state); err != nil && firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, i := range pending {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(next)
+	wg.Wait()
+	if firstErr != nil {
+		return result, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	if err := f.Sync(); err != nil {
+		return result, err
+	}
+	if err := f.Close(); err != nil {
+		return result, err
+	}
+	return finish(result, partPath, statePath, checksum)
+}
+
+// fetchRange downloads length bytes at offset start into f and returns how many bytes were written.
+func fetchRange(ctx context.Context, client *common.APIClient, orgName, backupId string, f *os.File, start, length int64, validator string, progress func(int64)) (int64, error) {
+	headers := map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", start, start+length-1)}
+	if validator != "" {
+		headers["If-Range"] = validator
+	}
+	resp, err := download(ctx, client, orgName, backupId, headers, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("backup changed on the server while downloading: expected 206 Partial Content, got %s", resp.Status)
+	}
+
+	w := &offsetWriter{f: f, off: start, progress: progress}
+	n, err := io.Copy(w, io.LimitReader(resp.Body, length))
+	if err != nil {
+		return n, err
+	}
+	if n != length {
+		return n, fmt.Errorf("short read for range %s: got %d of %d bytes", headers["Range"], n, length)
+	}
+	return n, nil
+}
+
+type offsetWriter struct {
+	f        *os.File
+	off      int64
+	progress func(int64)
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.off)
+	w.off += int64(n)
+	w.progress(int64(n))
+	return n, err
+}
+
+// streamToFile writes r to path from scratch and returns the number of bytes written.
+func streamToFile(r io.Reader, path string, total int64, progress func(Progress)) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var written int64
+	w := &offsetWriter{f: f, progress: func(delta int64) {
+		written += delta
+		report(progress, written, total)
+	}}
+	if _, err := io.Copy(w, r); err != nil {
+		return written, err
+	}
+	if total >= 0 && written != total {
+		return written, fmt.Errorf("short download: got %d of %d bytes", written, total)
+	}
+	if err := f.Sync(); err != nil {
+		return written, err
+	}
+	return written, f.Close()
+}
+
+// finish verifies the partial file and atomically moves it to its final path.
+func finish(result DownloadResult, partPath, statePath string, checksum *digest) (DownloadResult, error) {
+	if checksum != nil {
+		if err := checksum.verify(partPath); err != nil {
+			os.Remove(partPath)
+			os.Remove(statePath)
+			return result, err
+		}
+		result.ChecksumVerified = true
+	}
+	if err := os.Rename(partPath, result.Path); err != nil {
+		return result, err
+	}
+	os.Remove(statePath)
+	if dir, err := os.Open(filepath.Dir(result.Path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return result, nil
+}
+
+func chunkLen(state *partState, i int) int64 {
+	start := int64(i) * state.ChunkSize
+	if end := start + state.ChunkSize; end < state.Size {
+		return state.ChunkSize
+	}
+	return state.Size - start
+}
+
+func report(progress func(Progress), written, total int64) {
+	if progress != nil {
+		progress(Progress{Written: written, Total: total})
+	}
+}
+
+func loadState(path string) *partState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state partState
+	if err := common.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+	return &state
+}
+
+func saveState(path string, state *partState) error {
+	data, err := common.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// contentRangeTotal parses the complete length from a "bytes 0-0/1234" Content-Range header.
+func contentRangeTotal(header string) (int64, error) {
+	i := strings.LastIndex(header, "/")
+	if !strings.HasPrefix(header, "bytes ") || i < 0 || header[i+1:] == "*" {
+		return 0, fmt.Errorf("cannot determine backup size from Content-Range %q", header)
+	}
+	return strconv.ParseInt(header[i+1:], 10, 64)
+}
+
+// digest is a checksum announced by the server.
+type digest struct {
+	algorithm string
+	newHash   func() hash.Hash
+	expected  []byte
+}
+
+// serverChecksum extracts a checksum from the Digest (RFC 3230) or Content-MD5 headers.
+// A Content-MD5 header on a partial response describes the range only and is ignored.
+func serverChecksum(h http.Header) *digest {
+	for _, part := range strings.Split(h.Get("Digest"), ",") {
+		algo, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		switch strings.ToLower(algo) {
+		case "sha-256":
+			return &digest{algorithm: "sha-256", newHash: sha256.New, expected: sum}
+		case "md5":
+			return &digest{algorithm: "md5", newHash: md5.New, expected: sum}
+		}
+	}
+	if v := h.Get("Content-MD5"); v != "" && h.Get("Content-Range") == "" {
+		if sum, err := base64.StdEncoding.DecodeString(v); err == nil {
+			return &digest{algorithm: "md5", newHash: md5.New, expected: sum}
+		}
+	}
+	return nil
+}
+
+func (d *digest) verify(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := d.newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if sum := h.Sum(nil); string(sum) != string(d.expected) {
+		return fmt.Errorf("%w: %s %s, expected %s", ErrChecksumMismatch, d.algorithm, hex.EncodeToString(sum), hex.EncodeToString(d.expected))
+	}
+	return nil
+}
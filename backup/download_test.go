@@ -0,0 +1,246 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// downloadStandIn serves the full download of backup b1, with or without
+// range support, and records the ranges requested.
+type downloadStandIn struct {
+	data     []byte
+	etag     string
+	digest   string
+	noRanges bool
+	// failAt, when positive, fails the ranged requests starting at that offset.
+	failAt int64
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *downloadStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || apitest.OrgPath(r, "org") != "/backups/b1/download" {
+		http.NotFound(w, r)
+		return
+	}
+	rng := r.Header.Get("Range")
+	s.mu.Lock()
+	s.ranges = append(s.ranges, rng)
+	s.mu.Unlock()
+	if s.failAt > 0 && strings.HasPrefix(rng, "bytes="+strconv.FormatInt(s.failAt, 10)+"-") {
+		http.Error(w, "injected failure", http.StatusForbidden)
+		return
+	}
+	if s.digest != "" {
+		w.Header().Set("Digest", s.digest)
+	}
+	if s.noRanges {
+		w.Header().Set("Content-MD5", md5Sum(s.data))
+		w.Write(s.data)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	if len(s.data) == 0 && rng != "" {
+		// Object stores refuse any range of an empty object.
+		w.Header().Set("Content-Range", "bytes */0")
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	http.ServeContent(w, r, "backup", time.Time{}, bytes.NewReader(s.data))
+}
+
+func (s *downloadStandIn) requested() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ranges := append([]string(nil), s.ranges...)
+	s.ranges = nil
+	sort.Strings(ranges)
+	return ranges
+}
+
+func md5Sum(data []byte) string {
+	sum := md5.Sum(data)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func backupData(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+func checkDownloaded(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded %d bytes differing from the %d bytes served", len(got), len(want))
+	}
+	for _, leftover := range []string{path + ".part", path + ".part.json"} {
+		if _, err := os.Stat(leftover); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left behind: %v", leftover, err)
+		}
+	}
+}
+
+func TestDownloadChunked(t *testing.T) {
+	data := backupData(10_500)
+	s := &downloadStandIn{data: data, etag: `"v1"`, digest: sha256Digest(data)}
+	path := filepath.Join(t.TempDir(), "backup.tar")
+
+	var mu sync.Mutex
+	var last Progress
+	result, err := DownloadBackupToFile(context.Background(), apitest.NewClient(t, s), "org", "b1", path, DownloadOptions{
+		Concurrency: 4,
+		ChunkSize:   1000,
+		Progress: func(p Progress) {
+			mu.Lock()
+			if p.Written > last.Written {
+				last = p
+			}
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Size != int64(len(data)) || result.Resumed || !result.ChecksumVerified {
+		t.Fatalf("result = %+v", result)
+	}
+	if last != (Progress{Written: int64(len(data)), Total: int64(len(data))}) {
+		t.Errorf("last progress = %+v", last)
+	}
+	// The probe, then eleven chunks.
+	if ranges := s.requested(); len(ranges) != 12 {
+		t.Errorf("ranges = %v", ranges)
+	}
+	checkDownloaded(t, path, data)
+}
+
+func TestDownloadResume(t *testing.T) {
+	data := backupData(5_000)
+	s := &downloadStandIn{data: data, etag: `"v1"`, failAt: 3000}
+	client := apitest.NewClient(t, s)
+	path := filepath.Join(t.TempDir(), "backup.tar")
+	opts := DownloadOptions{ChunkSize: 1000}
+
+	if _, err := DownloadBackupToFile(context.Background(), client, "org", "b1", path, opts); err == nil {
+		t.Fatal("download with a failing chunk succeeded")
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("incomplete download renamed into place: %v", err)
+	}
+	s.requested()
+
+	s.failAt = 0
+	result, err := DownloadBackupToFile(context.Background(), client, "org", "b1", path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Resumed {
+		t.Fatalf("result = %+v", result)
+	}
+	want := []string{"bytes=0-0", "bytes=3000-3999", "bytes=4000-4999"}
+	if ranges := s.requested(); strings.Join(ranges, " ") != strings.Join(want, " ") {
+		t.Errorf("ranges after resume = %v, want %v", ranges, want)
+	}
+	checkDownloaded(t, path, data)
+}
+
+func TestDownloadRestartsChangedBackup(t *testing.T) {
+	s := &downloadStandIn{data: backupData(3_000), etag: `"v1"`, failAt: 2000}
+	client := apitest.NewClient(t, s)
+	path := filepath.Join(t.TempDir(), "backup.tar")
+	opts := DownloadOptions{ChunkSize: 1000}
+	if _, err := DownloadBackupToFile(context.Background(), client, "org", "b1", path, opts); err == nil {
+		t.Fatal("download with a failing chunk succeeded")
+	}
+
+	s.data, s.etag, s.failAt = backupData(3_000)[:2500], `"v2"`, 0
+	result, err := DownloadBackupToFile(context.Background(), client, "org", "b1", path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Resumed {
+		t.Fatal("chunks of a changed backup were reused")
+	}
+	checkDownloaded(t, path, s.data)
+}
+
+func TestDownloadWithoutRanges(t *testing.T) {
+	data := backupData(4_096)
+	s := &downloadStandIn{data: data, noRanges: true}
+	path := filepath.Join(t.TempDir(), "backup.tar")
+
+	result, err := DownloadBackupToFile(context.Background(), apitest.NewClient(t, s), "org", "b1", path, DownloadOptions{ChunkSize: 1000, Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Size != int64(len(data)) || !result.ChecksumVerified {
+		t.Fatalf("result = %+v", result)
+	}
+	if ranges := s.requested(); len(ranges) != 1 {
+		t.Errorf("ranges = %v", ranges)
+	}
+	checkDownloaded(t, path, data)
+}
+
+func TestDownloadChecksumMismatch(t *testing.T) {
+	data := backupData(2_000)
+	for _, s := range []*downloadStandIn{
+		{data: data, etag: `"v1"`, digest: sha256Digest([]byte("other"))},
+		{data: data, noRanges: true, digest: "md5=" + md5Sum([]byte("other"))},
+	} {
+		path := filepath.Join(t.TempDir(), "backup.tar")
+		_, err := DownloadBackupToFile(context.Background(), apitest.NewClient(t, s), "org", "b1", path, DownloadOptions{ChunkSize: 1000})
+		if !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("noRanges=%v: err = %v", s.noRanges, err)
+		}
+		entries, _ := os.ReadDir(filepath.Dir(path))
+		if len(entries) != 0 {
+			t.Errorf("noRanges=%v: files left after a checksum mismatch: %v", s.noRanges, entries)
+		}
+	}
+}
+
+func TestDownloadEmpty(t *testing.T) {
+	s := &downloadStandIn{data: []byte{}, etag: `"v1"`, digest: sha256Digest(nil)}
+	path := filepath.Join(t.TempDir(), "backup.tar")
+
+	result, err := DownloadBackupToFile(context.Background(), apitest.NewClient(t, s), "org", "b1", path, DownloadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Size != 0 || !result.ChecksumVerified {
+		t.Fatalf("result = %+v", result)
+	}
+	checkDownloaded(t, path, nil)
+}
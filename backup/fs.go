@@ -0,0 +1,334 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// FSOptions configures NewFS.
+type FSOptions struct {
+	// CacheTTL is how long directory listings are cached. Zero caches them for the
+	// lifetime of the FS, which suits immutable backups; a negative value disables caching.
+	CacheTTL time.Duration
+}
+
+// FS is a read-only fs.FS over the files of a backup. Directories are listed
+// with ViewBackup and files are downloaded lazily, on first read.
+type FS struct {
+	ctx       context.Context
+	client    *common.APIClient
+	backupApi *kbcloud.BackupApi
+	orgName   string
+	backupId  string
+	ttl       time.Duration
+
+	mu   sync.Mutex
+	dirs map[string]cachedDir
+}
+
+type cachedDir struct {
+	entries []*entry
+	at      time.Time
+}
+
+var (
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
+
+// NewFS returns a file system over the files of a backup. ctx is used for every
+// request made by the FS and the files it opens.
+func NewFS(ctx context.Context, client *common.APIClient, orgName, backupId string, opts FSOptions) *FS {
+	return &FS{
+		ctx:       ctx,
+		client:    client,
+		backupApi: kbcloud.NewBackupApi(client),
+		orgName:   orgName,
+		backupId:  backupId,
+		ttl:       opts.CacheTTL,
+		dirs:      map[string]cachedDir{},
+	}
+}
+
+// Open opens the named file or directory.
+func (f *FS) Open(name string) (fs.File, error) {
+	e, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.dir {
+		return &dir{fsys: f, entry: e, name: name}, nil
+	}
+	return &file{fsys: f, entry: e}, nil
+}
+
+// ReadDir lists the named directory, sorted by file name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	entries, err := f.list(name, e.fullPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	out := make([]fs.DirEntry, len(entries))
+	for i, c := range entries {
+		out[i] = c
+	}
+	return out, nil
+}
+
+// Stat returns the file info of the named file or directory.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	return f.lookup("stat", name)
+}
+
+// Invalidate drops all cached directory listings.
+func (f *FS) Invalidate() {
+	f.mu.Lock()
+	f.dirs = map[string]cachedDir{}
+	f.mu.Unlock()
+}
+
+// lookup resolves name by walking the listings of its parent directories.
+func (f *FS) lookup(op, name string) (*entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &entry{name: ".", dir: true}, nil
+	}
+	parent, err := f.lookup(op, path.Dir(name))
+	if err != nil {
+		return nil, err
+	}
+	if !parent.dir {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := f.list(path.Dir(name), parent.fullPath)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	base := path.Base(name)
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].name >= base })
+	if i == len(entries) || entries[i].name != base {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return entries[i], nil
+}
+
+// list returns the sorted entries of the directory name, whose backup path is fullPath.
+func (f *FS) list(name, fullPath string) ([]*entry, error) {
+	f.mu.Lock()
+	cached, ok := f.dirs[name]
+	f.mu.Unlock()
+	if ok && (f.ttl == 0 || time.Since(cached.at) < f.ttl) {
+		return cached.entries, nil
+	}
+
+	params := kbcloud.NewViewBackupOptionalParameters()
+	if fullPath != "" {
+		params.Body = &kbcloud.BackupView{Filepaths: []string{fullPath}}
+	}
+	list, _, err := f.backupApi.ViewBackup(f.ctx, f.orgName, f.backupId, *params)
+	if err != nil {
+		return nil, fmt.Errorf("view backup: %w", err)
+	}
+	entries := make([]*entry, 0, len(list.Items))
+	for _, item := range list.Items {
+		e := &entry{
+			name:     item.GetFilename(),
+			fullPath: item.GetFullPath(),
+			dir:      item.GetIsDir(),
+			size:     item.GetSize(),
+		}
+		if e.name == "" {
+			e.name = path.Base(strings.TrimSuffix(e.fullPath, "/"))
+		}
+		if e.name == "" || e.name == "." || e.name == "/" {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	if f.ttl >= 0 {
+		f.mu.Lock()
+		f.dirs[name] = cachedDir{entries: entries, at: time.Now()}
+		f.mu.Unlock()
+	}
+	return entries, nil
+}
+
+// entry is both the fs.FileInfo and fs.DirEntry of a file in the backup.
+type entry struct {
+	name     string
+	fullPath string
+	dir      bool
+	size     int64
+}
+
+func (e *entry) Name() string               { return e.name }
+func (e *entry) Size() int64                { return e.size }
+func (e *entry) ModTime() time.Time         { return time.Time{} }
+func (e *entry) IsDir() bool                { return e.dir }
+func (e *entry) Sys() any                   { return nil }
+func (e *entry) Type() fs.FileMode          { return e.Mode().Type() }
+func (e *entry) Info() (fs.FileInfo, error) { return e, nil }
+
+func (e *entry) Mode() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// dir is an open directory.
+type dir struct {
+	fsys   *FS
+	entry  *entry
+	name   string
+	offset int
+	closed bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error {
+	d.closed = true
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+	entries, err := d.fsys.ReadDir(d.name)
+	if err != nil {
+		return nil, err
+	}
+	entries = entries[min(d.offset, len(entries)):]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		entries = entries[:min(n, len(entries))]
+	}
+	d.offset += len(entries)
+	return entries, nil
+}
+
+// file is an open file. Its content is downloaded on first read and
+// re-requested from the new offset after a seek.
+type file struct {
+	fsys    *FS
+	entry   *entry
+	offset  int64
+	body    io.ReadCloser
+	bodyOff int64
+	closed  bool
+}
+
+var _ io.ReadSeekCloser = (*file)(nil)
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.entry, nil }
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.fullPath, Err: fs.ErrClosed}
+	}
+	if f.offset >= f.entry.size {
+		return 0, io.EOF
+	}
+	if f.body == nil || f.bodyOff != f.offset {
+		if err := f.open(); err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.entry.fullPath, Err: err}
+		}
+	}
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	f.bodyOff += int64(n)
+	return n, err
+}
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.entry.fullPath, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.entry.size
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.entry.fullPath, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.entry.fullPath, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.entry.fullPath, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+// open starts downloading the file from the current offset, using a range
+// request and falling back to skipping bytes when ranges are not supported.
+func (f *file) open() error {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	var headers map[string]string
+	if f.offset > 0 {
+		headers = map[string]string{"Range": fmt.Sprintf("bytes=%d-", f.offset)}
+	}
+	resp, err := download(f.fsys.ctx, f.fsys.client, f.fsys.orgName, f.fsys.backupId, headers,
+		&kbcloud.BackupDownload{Filepaths: []string{f.entry.fullPath}})
+	if err != nil {
+		return err
+	}
+	if f.offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(io.Discard, resp.Body, f.offset); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	}
+	f.body = resp.Body
+	f.bodyOff = f.offset
+	return nil
+}
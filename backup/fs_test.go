@@ -0,0 +1,123 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// standIn serves the view and download endpoints of a single backup from an in-memory file system.
+type standIn struct {
+	files fstest.MapFS
+	views int32
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Filepaths []string `json:"filepaths"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/view"):
+		atomic.AddInt32(&s.views, 1)
+		dir := "."
+		if len(body.Filepaths) > 0 {
+			dir = strings.TrimPrefix(body.Filepaths[0], "/")
+		}
+		entries, err := s.files.ReadDir(dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		list := kbcloud.FileEntryList{Items: []kbcloud.FileEntry{}}
+		for _, e := range entries {
+			info, _ := e.Info()
+			list.Items = append(list.Items, kbcloud.FileEntry{
+				IsDir:    common.PtrBool(e.IsDir()),
+				FullPath: common.PtrString("/" + path.Join(dir, e.Name())),
+				Filename: common.PtrString(e.Name()),
+				Size:     common.PtrInt64(info.Size()),
+			})
+		}
+		apitest.WriteJSON(w, http.StatusOK, list)
+	case strings.HasSuffix(r.URL.Path, "/download") && r.Method == http.MethodPost:
+		name := strings.TrimPrefix(body.Filepaths[0], "/")
+		f, ok := s.files[name]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, path.Base(name), f.ModTime, strings.NewReader(string(f.Data)))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newStandIn(t *testing.T) (*standIn, *common.APIClient) {
+	s := &standIn{files: fstest.MapFS{
+		"mysql/binlog.000001":      {Data: []byte("binlog one")},
+		"mysql/binlog.000002":      {Data: []byte("binlog two")},
+		"mysql/data/ibdata1":       {Data: []byte(strings.Repeat("x", 4096))},
+		"backup.info":              {Data: []byte(`{"engine":"mysql"}`)},
+		"mysql/data/sub/empty.txt": {Data: []byte{}},
+	}}
+	return s, apitest.NewClient(t, s)
+}
+
+func TestFS(t *testing.T) {
+	s, client := newStandIn(t)
+	fsys := NewFS(context.Background(), client, "org", "backup-1", FSOptions{})
+
+	if err := fstest.TestFS(fsys, "backup.info", "mysql/binlog.000001", "mysql/data/ibdata1", "mysql/data/sub/empty.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	views := atomic.LoadInt32(&s.views)
+	if _, err := fs.ReadDir(fsys, "mysql"); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&s.views); got != views {
+		t.Errorf("listing was not cached: %d view requests, want %d", got, views)
+	}
+
+	f, err := fsys.Open("mysql/data/ibdata1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.(io.Seeker).Seek(4000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 96 {
+		t.Errorf("read %d bytes after seek, want 96", len(rest))
+	}
+
+	if _, err := fsys.Open("mysql/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("open missing file: got %v, want fs.ErrNotExist", err)
+	}
+}
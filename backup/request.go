@@ -0,0 +1,86 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package backup provides streaming helpers on top of the backup endpoints of
+// the KubeBlocks Cloud API: resumable downloads and browsing backup contents.
+package backup
+
+import (
+	"context"
+	"io"
+	_nethttp "net/http"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apiutil"
+)
+
+// download issues a download request for a backup through BackupApi and
+// returns the response with its body unread. Responses outside the 2xx range
+// are turned into errors. A nil body downloads the full backup; otherwise body
+// selects files to download. headers, such as Range, are added to the request.
+func download(ctx context.Context, client *common.APIClient, orgName, backupId string, headers map[string]string, body *kbcloud.BackupDownload) (*_nethttp.Response, error) {
+	api := kbcloud.NewBackupApi(withHeaders(client, headers))
+	var (
+		resp *_nethttp.Response
+		err  error
+	)
+	if body == nil {
+		_, resp, err = api.DownloadBackup(ctx, orgName, backupId)
+	} else {
+		_, resp, err = api.DownloadMutipleBackups(ctx, orgName, backupId, *body)
+	}
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, err
+	}
+	// The generated download calls stream the body and leave error statuses to the caller.
+	if resp.StatusCode >= 300 {
+		localVarBody, _ := common.ReadBody(resp)
+		newErr := common.GenericOpenAPIError{
+			ErrorBody:    localVarBody,
+			ErrorMessage: resp.Status,
+		}
+		if resp.StatusCode == 401 || resp.StatusCode == 403 || resp.StatusCode == 404 {
+			var v kbcloud.APIErrorResponse
+			if err := client.Decode(&v, localVarBody, resp.Header.Get("Content-Type")); err == nil {
+				newErr.ErrorModel = v
+			}
+		}
+		return resp, newErr
+	}
+	return resp, nil
+}
+
+// withHeaders returns a client sending headers on top of the default headers
+// of client, as the generated download calls take no header parameters. The
+// client is a clone, so that the range requests of parallel workers do not
+// share an HTTP client.
+func withHeaders(client *common.APIClient, headers map[string]string) *common.APIClient {
+	if len(headers) == 0 {
+		return client
+	}
+	clone := apiutil.Clone(client)
+	clone.Cfg.DefaultHeader = make(map[string]string, len(client.Cfg.DefaultHeader)+len(headers))
+	for k, v := range client.Cfg.DefaultHeader {
+		clone.Cfg.DefaultHeader[k] = v
+	}
+	for k, v := range headers {
+		clone.Cfg.DefaultHeader[k] = v
+	}
+	return clone
+}
+
+// Open starts downloading a full backup and returns its content as a stream
+// together with its size, which is -1 when the server does not announce it.
+// The caller must close the stream.
+func Open(ctx context.Context, client *common.APIClient, orgName, backupId string) (io.ReadCloser, int64, error) {
+	resp, err := download(ctx, client, orgName, backupId, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
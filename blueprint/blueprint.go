@@ -0,0 +1,162 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package blueprint exports a cluster definition into a portable, versioned
+// document and recreates an equivalent cluster from it in another organization
+// or environment.
+package blueprint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+const (
+	// APIVersion is the blueprint format version written by this package.
+	APIVersion = "kbcloud.apecloud.com/v1"
+	// Kind identifies cluster blueprint documents.
+	Kind = "ClusterBlueprint"
+)
+
+// Format is the serialization format of a blueprint document.
+type Format string
+
+// List of Format.
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// Blueprint is the portable definition of a cluster.
+type Blueprint struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Metadata   Metadata `json:"metadata"`
+	Spec       Spec     `json:"spec"`
+}
+
+// Metadata records where and when a blueprint was exported.
+type Metadata struct {
+	// Name of the source cluster.
+	Name string `json:"name"`
+	// SourceOrg is the organization the cluster was exported from.
+	SourceOrg string `json:"sourceOrg,omitempty"`
+	// SourceEnvironment is the environment the cluster was exported from.
+	SourceEnvironment string `json:"sourceEnvironment,omitempty"`
+	// SourceBackupRepo is the backup repo of the source cluster. Repos belong
+	// to an organization and are not part of the spec.
+	SourceBackupRepo string `json:"sourceBackupRepo,omitempty"`
+	// ExportedAt is the time the blueprint was generated.
+	ExportedAt time.Time `json:"exportedAt"`
+}
+
+// Spec holds everything needed to recreate a cluster.
+type Spec struct {
+	// Cluster is the cluster spec stripped of server-assigned fields.
+	Cluster kbcloud.Cluster `json:"cluster"`
+	// BackupPolicy is the backup policy applied to the cluster.
+	BackupPolicy *kbcloud.BackupPolicy `json:"backupPolicy,omitempty"`
+	// ParamTpls are the parameter templates applied to the cluster.
+	ParamTpls []ParamTpl `json:"paramTpls,omitempty"`
+	// Accounts are the database accounts, without passwords.
+	Accounts []Account `json:"accounts,omitempty"`
+	// Databases are the databases created in the cluster.
+	Databases []Database `json:"databases,omitempty"`
+	// Tags are the key/value tags attached to the cluster.
+	Tags []Tag `json:"tags,omitempty"`
+	// IPWhitelists are the IP whitelists bound to the cluster.
+	IPWhitelists []IPWhitelist `json:"ipWhitelists,omitempty"`
+	// AlertsDisabled records whether alerting is switched off for the cluster.
+	AlertsDisabled bool `json:"alertsDisabled"`
+}
+
+// ParamTpl is a parameter template applied to the cluster.
+type ParamTpl struct {
+	Name      string                    `json:"name"`
+	Partition kbcloud.ParamTplPartition `json:"partition"`
+}
+
+// Account is a database account. Secrets are never exported.
+type Account struct {
+	Name       string                      `json:"name"`
+	Component  string                      `json:"component,omitempty"`
+	Role       kbcloud.AccountRoleType     `json:"role"`
+	Privileges []kbcloud.PrivilegeListItem `json:"privileges,omitempty"`
+}
+
+// Database is a database created in the cluster.
+type Database struct {
+	Name string `json:"name"`
+}
+
+// Tag is a key/value tag attached to the cluster.
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// IPWhitelist is an IP whitelist bound to the cluster.
+type IPWhitelist struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Addresses   []string `json:"addresses"`
+}
+
+// Marshal serializes the blueprint in the given format.
+func Marshal(bp *Blueprint, format Format) ([]byte, error) {
+	data, err := common.Marshal(bp)
+	if err != nil {
+		return nil, err
+	}
+	switch format {
+	case FormatJSON:
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+	case FormatYAML, "":
+		return yaml.JSONToYAML(data)
+	default:
+		return nil, fmt.Errorf("unsupported blueprint format %q", format)
+	}
+}
+
+// Unmarshal parses a YAML or JSON blueprint document and validates its version.
+func Unmarshal(data []byte) (*Blueprint, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	var bp Blueprint
+	if err := common.Unmarshal(data, &bp); err != nil {
+		return nil, err
+	}
+	if err := bp.Validate(); err != nil {
+		return nil, err
+	}
+	return &bp, nil
+}
+
+// Validate checks that the blueprint can be imported by this version of the client.
+func (bp *Blueprint) Validate() error {
+	if bp.APIVersion != APIVersion {
+		return fmt.Errorf("unsupported blueprint apiVersion %q, expected %q", bp.APIVersion, APIVersion)
+	}
+	if bp.Kind != Kind {
+		return fmt.Errorf("unexpected blueprint kind %q, expected %q", bp.Kind, Kind)
+	}
+	if bp.Spec.Cluster.Engine == "" {
+		return fmt.Errorf("blueprint cluster engine is required")
+	}
+	return nil
+}
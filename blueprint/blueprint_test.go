@@ -0,0 +1,178 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package blueprint
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// clusterStandIn serves a source cluster and records the requests that
+// recreate it.
+type clusterStandIn struct {
+	mu     sync.Mutex
+	writes map[string][]map[string]interface{}
+}
+
+func (s *clusterStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := apitest.OrgPath(r, "org")
+	if r.Method != http.MethodGet {
+		var body map[string]interface{}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		s.mu.Lock()
+		s.writes[r.Method+" "+path] = append(s.writes[r.Method+" "+path], body)
+		s.mu.Unlock()
+	}
+	switch r.Method + " " + path {
+	case "GET /clusters/db-copy":
+		apitest.WriteJSON(w, http.StatusOK, `{"id": 43, "name": "db-copy", "engine": "mysql", "environmentName": "staging", "status": "Running"}`)
+	case "GET /clusters/db":
+		apitest.WriteJSON(w, http.StatusOK, `{"id": 42, "name": "db", "engine": "mysql", "environmentName": "prod", "status": "Running",
+			"version": "8.0.33", "mode": "replication", "backup": {"autoBackup": true, "backupRepo": "prod-s3"},
+			"components": [{"component": "mysql", "replicas": 2, "codeShort": "xyz"}]}`)
+	case "GET /clusters/db/backupPolicy":
+		apitest.WriteJSON(w, http.StatusOK, `{"autoBackup": true, "cronExpression": "0 2 * * *", "retentionPeriod": "7d",
+			"backupRepo": "prod-s3", "nextBackupTime": "2024-01-02T02:00:00Z"}`)
+	case "GET /clusters/db/paramTpls":
+		apitest.WriteJSON(w, http.StatusOK, `{"items": [{"name": "tuned", "partition": "custom", "count": 3, "needRestart": false}]}`)
+	case "GET /clusters/db/accounts":
+		apitest.WriteJSON(w, http.StatusOK, `[{"name": "root", "role": "ROOT"}, {"name": "app", "role": "BASICUSER", "component": "mysql"}]`)
+	case "GET /clusters/db/databases":
+		apitest.WriteJSON(w, http.StatusOK, `{"items": [{"name": "shop"}]}`)
+	case "GET /clusterTags":
+		if r.URL.Query().Get("clusterIds") != "42" {
+			http.Error(w, "unexpected cluster ids "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		apitest.WriteJSON(w, http.StatusOK, `[{"clusterId": "42", "tags": [{"id": "t1", "key": "team", "value": "shop"}]}]`)
+	case "GET /clusters/db/ipWhitelist":
+		apitest.WriteJSON(w, http.StatusOK, `{"items": [{"id": "w1", "name": "office", "addresses": ["10.0.0.0/8"]}]}`)
+	case "GET /alerts/cluster/db":
+		apitest.WriteJSON(w, http.StatusOK, `{"disabled": true}`)
+	case "POST /clusters":
+		apitest.WriteJSON(w, http.StatusOK, `{"id": 43, "name": "db-copy", "engine": "mysql", "environmentName": "staging"}`)
+	case "POST /clusters/db-copy/ipWhitelist":
+		apitest.WriteJSON(w, http.StatusOK, `{"id": "w2", "name": "office", "addresses": ["10.0.0.0/8"]}`)
+	case "POST /tags":
+		apitest.WriteJSON(w, http.StatusOK, `{"clusterId": "43", "items": []}`)
+	case "PATCH /clusters/db-copy/backupPolicy":
+		apitest.WriteJSON(w, http.StatusOK, `{}`)
+	case "POST /clusters/db-copy/accounts", "POST /clusters/db-copy/databases", "PATCH /alerts/cluster/db-copy":
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	s := &clusterStandIn{writes: map[string][]map[string]interface{}{}}
+	client := apitest.NewClient(t, s)
+	ctx := context.Background()
+
+	bp, err := Export(ctx, client, "org", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bp.Metadata.SourceBackupRepo != "prod-s3" {
+		t.Fatalf("source backup repo = %q", bp.Metadata.SourceBackupRepo)
+	}
+	if bp.Spec.BackupPolicy.BackupRepo != nil || bp.Spec.BackupPolicy.NextBackupTime != nil {
+		t.Fatalf("backup policy keeps org specific fields: %+v", bp.Spec.BackupPolicy)
+	}
+	if bp.Spec.Cluster.Backup == nil || bp.Spec.Cluster.Backup.BackupRepo != nil || !bp.Spec.Cluster.Backup.GetAutoBackup() {
+		t.Fatalf("cluster backup = %+v", bp.Spec.Cluster.Backup)
+	}
+	if bp.Spec.Cluster.Id != nil || bp.Spec.Cluster.Components[0].CodeShort != nil {
+		t.Fatalf("cluster keeps server assigned fields: %+v", bp.Spec.Cluster)
+	}
+	if len(bp.Spec.Accounts) != 1 || bp.Spec.Accounts[0].Name != "app" {
+		t.Fatalf("accounts = %+v", bp.Spec.Accounts)
+	}
+	if len(bp.Spec.Tags) != 1 || bp.Spec.Tags[0] != (Tag{Key: "team", Value: "shop"}) || !bp.Spec.AlertsDisabled {
+		t.Fatalf("spec = %+v", bp.Spec)
+	}
+
+	for _, format := range []Format{FormatYAML, FormatJSON} {
+		data, err := Marshal(bp, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if got.Metadata.SourceBackupRepo != "prod-s3" || len(got.Spec.IPWhitelists) != 1 || got.Spec.ParamTpls[0].Name != "tuned" {
+			t.Fatalf("%s round trip = %+v", format, got)
+		}
+	}
+
+	_, err = Import(ctx, client, "org", bp, ImportOptions{
+		ClusterName:     "db-copy",
+		EnvironmentName: "staging",
+		BackupRepo:      "staging-s3",
+		PollInterval:    time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := s.writes["POST /clusters"][0]
+	if created["name"] != "db-copy" || created["environmentName"] != "staging" {
+		t.Fatalf("created cluster = %v", created)
+	}
+	if backup := created["backup"].(map[string]interface{}); backup["backupRepo"] != "staging-s3" {
+		t.Fatalf("created cluster backup = %v", backup)
+	}
+	if policy := s.writes["PATCH /clusters/db-copy/backupPolicy"][0]; policy["backupRepo"] != "staging-s3" || policy["cronExpression"] != "0 2 * * *" {
+		t.Fatalf("backup policy = %v", policy)
+	}
+	if tags := s.writes["POST /tags"][0]; tags["clusterId"] != "43" {
+		t.Fatalf("tags = %v", tags)
+	}
+	for _, key := range []string{"POST /clusters/db-copy/accounts", "POST /clusters/db-copy/databases", "POST /clusters/db-copy/ipWhitelist", "PATCH /alerts/cluster/db-copy"} {
+		if len(s.writes[key]) != 1 {
+			t.Errorf("%s: %d requests", key, len(s.writes[key]))
+		}
+	}
+}
+
+func TestImportWithoutBackupRepo(t *testing.T) {
+	s := &clusterStandIn{writes: map[string][]map[string]interface{}{}}
+	client := apitest.NewClient(t, s)
+	ctx := context.Background()
+
+	bp, err := Export(ctx, client, "org", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(ctx, client, "org", bp, ImportOptions{ClusterName: "db-copy", PollInterval: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	created, _ := json.Marshal(s.writes["POST /clusters"][0])
+	policy, _ := json.Marshal(s.writes["PATCH /clusters/db-copy/backupPolicy"][0])
+	if strings.Contains(string(created), "backupRepo") || strings.Contains(string(policy), "backupRepo") {
+		t.Fatalf("source backup repo leaked into the target: %s %s", created, policy)
+	}
+}
+
+func TestUnmarshalValidates(t *testing.T) {
+	for _, doc := range []string{
+		"apiVersion: kbcloud.apecloud.com/v2\nkind: ClusterBlueprint\nspec: {cluster: {engine: mysql}}",
+		"apiVersion: kbcloud.apecloud.com/v1\nkind: Cluster\nspec: {cluster: {engine: mysql}}",
+		"apiVersion: kbcloud.apecloud.com/v1\nkind: ClusterBlueprint\nspec: {cluster: {}}",
+	} {
+		if _, err := Unmarshal([]byte(doc)); err == nil {
+			t.Errorf("Unmarshal(%q) succeeded", doc)
+		}
+	}
+}
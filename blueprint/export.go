@@ -0,0 +1,158 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package blueprint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apiutil"
+)
+
+// Export reads the full definition of a cluster and returns it as a blueprint.
+func Export(ctx context.Context, client *common.APIClient, orgName, clusterName string) (*Blueprint, error) {
+	cluster, _, err := kbcloud.NewClusterApi(client).GetCluster(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("get cluster: %w", err)
+	}
+
+	bp := &Blueprint{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Metadata: Metadata{
+			Name:              cluster.Name,
+			SourceOrg:         orgName,
+			SourceEnvironment: cluster.EnvironmentName,
+			ExportedAt:        time.Now().UTC(),
+		},
+		Spec: Spec{
+			Cluster: sanitizeCluster(cluster),
+		},
+	}
+
+	policy, _, err := kbcloud.NewBackupApi(client).GetClusterBackupPolicy(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("get backup policy: %w", err)
+	}
+	policy.NextBackupTime = nil
+	bp.Metadata.SourceBackupRepo = policy.GetBackupRepo()
+	if bp.Metadata.SourceBackupRepo == "" && cluster.Backup != nil {
+		bp.Metadata.SourceBackupRepo = cluster.Backup.GetBackupRepo()
+	}
+	policy.BackupRepo = nil
+	bp.Spec.BackupPolicy = &policy
+
+	tpls, _, err := kbcloud.NewParamTplApi(client).GetClusterParamTpls(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("get parameter templates: %w", err)
+	}
+	for _, tpl := range tpls.Items {
+		bp.Spec.ParamTpls = append(bp.Spec.ParamTpls, ParamTpl{
+			Name:      tpl.Name,
+			Partition: kbcloud.ParamTplPartition(tpl.Partition),
+		})
+	}
+
+	accounts, _, err := kbcloud.NewAccountApi(client).ListAccounts(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("list accounts: %w", err)
+	}
+	for _, account := range accounts {
+		role := account.GetRole()
+		if role == kbcloud.AccountListRoleTypeRoot {
+			continue
+		}
+		bp.Spec.Accounts = append(bp.Spec.Accounts, Account{
+			Name:       account.Name,
+			Component:  account.GetComponent(),
+			Role:       kbcloud.AccountRoleType(role),
+			Privileges: account.PrivilegesList,
+		})
+	}
+
+	databases, _, err := kbcloud.NewDatabaseApi(client).ListDatabases(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("list databases: %w", err)
+	}
+	for _, db := range databases.Items {
+		bp.Spec.Databases = append(bp.Spec.Databases, Database{Name: db.Name})
+	}
+
+	if id := apiutil.FormatID(cluster.Id); id != "" {
+		tags, _, err := kbcloud.NewTagApi(client).GetTags(ctx, orgName, id)
+		if err != nil {
+			return nil, fmt.Errorf("get tags: %w", err)
+		}
+		for _, tc := range tags {
+			if tc.GetClusterId() != id {
+				continue
+			}
+			for _, tag := range tc.Tags {
+				bp.Spec.Tags = append(bp.Spec.Tags, Tag{Key: tag.GetKey(), Value: tag.GetValue()})
+			}
+		}
+	}
+
+	whitelists, _, err := kbcloud.NewIpWhitelistApi(client).ListIPWhitelist(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("list ip whitelists: %w", err)
+	}
+	for _, wl := range whitelists.Items {
+		bp.Spec.IPWhitelists = append(bp.Spec.IPWhitelists, IPWhitelist{
+			Name:        wl.Name,
+			Description: wl.GetDescription(),
+			Addresses:   wl.Addresses,
+		})
+	}
+
+	alert, _, err := kbcloud.NewClusterAlertSwitchApi(client).GetClusterAlertDisabled(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("get alert switch: %w", err)
+	}
+	bp.Spec.AlertsDisabled = alert.Disabled
+
+	return bp, nil
+}
+
+// sanitizeCluster keeps only the fields that describe the desired state of a cluster,
+// dropping identifiers, status, environment bound placement and the backup repo.
+func sanitizeCluster(c kbcloud.Cluster) kbcloud.Cluster {
+	out := kbcloud.Cluster{
+		EnvironmentName:        c.EnvironmentName,
+		Project:                c.Project,
+		Name:                   c.Name,
+		Engine:                 c.Engine,
+		ParamTpls:              c.ParamTpls,
+		Version:                c.Version,
+		TerminationPolicy:      c.TerminationPolicy,
+		TlsEnabled:             c.TlsEnabled,
+		NodePortEnabled:        c.NodePortEnabled,
+		Mode:                   c.Mode,
+		ProxyEnabled:           c.ProxyEnabled,
+		Extra:                  c.Extra,
+		InitOptions:            c.InitOptions,
+		Tolerations:            c.Tolerations,
+		SingleZone:             c.SingleZone,
+		AvailabilityZones:      c.AvailabilityZones,
+		PodAntiAffinityEnabled: c.PodAntiAffinityEnabled,
+		NodeGroup:              c.NodeGroup,
+		DisplayName:            c.DisplayName,
+		Static:                 c.Static,
+		NetworkMode:            c.NetworkMode,
+	}
+	if c.Backup != nil {
+		backup := *c.Backup
+		backup.BackupRepo = nil
+		out.Backup = &backup
+	}
+	for _, comp := range c.Components {
+		comp.CodeShort = nil
+		out.Components = append(out.Components, comp)
+	}
+	return out
+}
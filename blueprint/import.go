@@ -0,0 +1,151 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package blueprint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apiutil"
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// ImportOptions customizes how a blueprint is materialized.
+type ImportOptions struct {
+	// ClusterName overrides the cluster name recorded in the blueprint.
+	ClusterName string
+	// DisplayName overrides the cluster display name.
+	DisplayName string
+	// EnvironmentName overrides the target environment.
+	EnvironmentName string
+	// BackupRepo is the backup repo of the imported cluster in orgName.
+	// Empty uses the default repo of the target environment.
+	BackupRepo string
+	// AccountPasswords sets passwords of imported accounts by name.
+	// Accounts without an entry get a server generated password.
+	AccountPasswords map[string]string
+	// PollInterval is the interval used while waiting for the cluster to become ready.
+	PollInterval time.Duration
+	// Timeout bounds the wait for the cluster to become ready. Zero waits until ctx is done.
+	Timeout time.Duration
+}
+
+// Import creates a cluster from the blueprint in orgName and restores its
+// backup policy, accounts, databases, tags, IP whitelists and alert switch.
+// The created cluster is returned even when a later step fails.
+func Import(ctx context.Context, client *common.APIClient, orgName string, bp *Blueprint, opts ImportOptions) (kbcloud.Cluster, error) {
+	if err := bp.Validate(); err != nil {
+		return kbcloud.Cluster{}, err
+	}
+
+	spec := bp.Spec.Cluster
+	if opts.ClusterName != "" {
+		spec.Name = opts.ClusterName
+	}
+	if opts.DisplayName != "" {
+		spec.DisplayName = common.PtrString(opts.DisplayName)
+	}
+	if opts.EnvironmentName != "" {
+		spec.EnvironmentName = opts.EnvironmentName
+	}
+	if opts.BackupRepo != "" {
+		if spec.Backup == nil {
+			spec.Backup = &kbcloud.ClusterBackup{}
+		} else {
+			backup := *spec.Backup
+			spec.Backup = &backup
+		}
+		spec.Backup.BackupRepo = common.PtrString(opts.BackupRepo)
+	}
+	if len(spec.ParamTpls) == 0 {
+		for _, tpl := range bp.Spec.ParamTpls {
+			spec.ParamTpls = append(spec.ParamTpls, kbcloud.ParamTplsItem{
+				ParamTplName:      common.PtrString(tpl.Name),
+				ParamTplPartition: common.Ptr(tpl.Partition),
+			})
+		}
+	}
+
+	clusterApi := kbcloud.NewClusterApi(client)
+	cluster, _, err := clusterApi.CreateCluster(ctx, orgName, spec)
+	if err != nil {
+		return cluster, fmt.Errorf("create cluster: %w", err)
+	}
+	cluster, err = wait.ForClusterRunning(ctx, clusterApi, orgName, spec.Name, opts.PollInterval, opts.Timeout)
+	if err != nil {
+		return cluster, fmt.Errorf("wait for cluster %s: %w", spec.Name, err)
+	}
+
+	if bp.Spec.BackupPolicy != nil {
+		policy := *bp.Spec.BackupPolicy
+		if opts.BackupRepo != "" {
+			policy.BackupRepo = common.PtrString(opts.BackupRepo)
+		}
+		if _, _, err := kbcloud.NewBackupApi(client).PatchBackupPolicy(ctx, orgName, spec.Name, policy); err != nil {
+			return cluster, fmt.Errorf("update backup policy: %w", err)
+		}
+	}
+
+	accountApi := kbcloud.NewAccountApi(client)
+	for _, account := range bp.Spec.Accounts {
+		body := kbcloud.Account{
+			Name:           account.Name,
+			Role:           account.Role,
+			PrivilegesList: account.Privileges,
+		}
+		if account.Component != "" {
+			body.Component = common.PtrString(account.Component)
+		}
+		if password, ok := opts.AccountPasswords[account.Name]; ok {
+			body.Password = common.PtrString(password)
+		}
+		if _, err := accountApi.CreateAccount(ctx, orgName, spec.Name, body); err != nil {
+			return cluster, fmt.Errorf("create account %s: %w", account.Name, err)
+		}
+	}
+
+	databaseApi := kbcloud.NewDatabaseApi(client)
+	for _, db := range bp.Spec.Databases {
+		if _, err := databaseApi.CreateDatabase(ctx, orgName, spec.Name, kbcloud.Database{Name: db.Name}); err != nil {
+			return cluster, fmt.Errorf("create database %s: %w", db.Name, err)
+		}
+	}
+
+	whitelistApi := kbcloud.NewIpWhitelistApi(client)
+	for _, wl := range bp.Spec.IPWhitelists {
+		body := map[string]interface{}{
+			"name":      wl.Name,
+			"addresses": wl.Addresses,
+		}
+		if wl.Description != "" {
+			body["description"] = wl.Description
+		}
+		if _, _, err := whitelistApi.CreateIPWhitelist(ctx, orgName, spec.Name, body); err != nil {
+			return cluster, fmt.Errorf("create ip whitelist %s: %w", wl.Name, err)
+		}
+	}
+
+	if len(bp.Spec.Tags) > 0 {
+		body := kbcloud.TagCreate{ClusterId: apiutil.FormatID(cluster.Id)}
+		for _, tag := range bp.Spec.Tags {
+			body.Items = append(body.Items, kbcloud.TagCreateItemsItem{Key: tag.Key, Value: tag.Value})
+		}
+		if _, _, err := kbcloud.NewTagApi(client).CreateTag(ctx, orgName, body); err != nil {
+			return cluster, fmt.Errorf("create tags: %w", err)
+		}
+	}
+
+	if bp.Spec.AlertsDisabled {
+		params := kbcloud.NewSetClusterAlertDisabledOptionalParameters().WithBody(kbcloud.AlertCluster{Disabled: true})
+		if _, _, err := kbcloud.NewClusterAlertSwitchApi(client).SetClusterAlertDisabled(ctx, orgName, spec.Name, *params); err != nil {
+			return cluster, fmt.Errorf("disable alerts: %w", err)
+		}
+	}
+
+	return cluster, nil
+}
@@ -0,0 +1,437 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package clusterops
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// deleteStandIn serves a cluster, its backups and the recycle bin, and moves
+// the cluster to the recycle bin when it is deleted.
+type deleteStandIn struct {
+	mu         sync.Mutex
+	id         int
+	policy     string
+	backupAge  time.Duration
+	dependents bool
+	deleted    bool
+	// recycleBinStatus, when set, is the status of every recycle bin request.
+	recycleBinStatus int
+}
+
+func (s *deleteStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method + " " + apitest.OrgPath(r, "org") {
+	case "GET /clusters/db":
+		if s.deleted {
+			http.NotFound(w, r)
+			return
+		}
+		apitest.WriteJSON(w, http.StatusOK, fmt.Sprintf(`{"id": %d, "name": "db", "engine": "mysql", "environmentName": "prod",
+			"terminationPolicy": %q, "createdAt": "2024-01-01T00:00:00Z"}`, s.id, s.policy))
+	case "GET /backups":
+		done := time.Now().Add(-s.backupAge).UTC().Format(time.RFC3339)
+		apitest.WriteJSON(w, http.StatusOK, fmt.Sprintf(`{"items": [{"id": "b1", "name": "b1", "autoBackup": true, "backupMethod": "xtrabackup",
+			"backupPolicyName": "p", "backupType": "Full", "creationTimestamp": %q, "completionTimestamp": %q, "orgName": "org",
+			"snapshotVolumes": false, "sourceCluster": "db", "status": "Completed", "totalSize": "1Gi", "retentionPeriod": "7d",
+			"cloudProvider": "aws", "cloudRegion": "r", "environmentName": "prod", "engine": "mysql"}]}`, done, done))
+	case "GET /clusters":
+		items := `{"id": "1", "name": "db", "engine": "mysql", "environmentName": "prod", "status": "Running", "cloudProvider": "aws",
+			"terminationPolicy": "Delete", "version": "8.0", "createdAt": "2024-01-01T00:00:00Z", "updatedAt": "2024-01-01T00:00:00Z"}`
+		if s.dependents {
+			items += `, {"id": "2", "name": "db-dr", "engine": "mysql", "environmentName": "prod", "status": "Running", "cloudProvider": "aws",
+				"terminationPolicy": "Delete", "version": "8.0", "createdAt": "2024-01-01T00:00:00Z", "updatedAt": "2024-01-01T00:00:00Z",
+				"parentId": ` + fmt.Sprint(s.id) + `, "clusterType": "DisasterRecovery"}`
+		}
+		apitest.WriteJSON(w, http.StatusOK, `{"items": [`+items+`]}`)
+	case "GET /recycleBin/clusters":
+		apitest.WriteJSON(w, http.StatusOK, `{"items": []}`)
+	case "GET /recycleBin/clusters/db":
+		if s.recycleBinStatus != 0 {
+			apitest.WriteJSON(w, s.recycleBinStatus, `{"code": 403, "message": "forbidden"}`)
+			return
+		}
+		if !s.deleted {
+			http.NotFound(w, r)
+			return
+		}
+		apitest.WriteJSON(w, http.StatusOK, `{"name": "db", "engine": "mysql", "environmentName": "prod"}`)
+	case "DELETE /clusters/db":
+		s.deleted = true
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newDeleteStandIn(t *testing.T) (*deleteStandIn, *SafeDeleter) {
+	s := &deleteStandIn{id: 7, policy: "Delete", backupAge: time.Hour}
+	return s, NewSafeDeleter(apitest.NewClient(t, s), SafeDeleteOptions{PollInterval: time.Millisecond, Timeout: time.Second})
+}
+
+func TestSafeDelete(t *testing.T) {
+	ctx := context.Background()
+
+	s, d := newDeleteStandIn(t)
+	plan, err := d.Preflight(ctx, "org", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Blockers()) != 0 || plan.LatestBackup == nil {
+		t.Fatalf("plan = %+v", plan)
+	}
+	if _, err := d.Execute(ctx, plan, "delete-db-00000000"); !errors.Is(err, ErrConfirmationMismatch) {
+		t.Fatalf("wrong token: %v", err)
+	}
+	recycled, err := d.Execute(ctx, plan, plan.ConfirmationToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recycled.Name != "db" || !s.deleted {
+		t.Fatalf("recycled = %+v, deleted %v", recycled, s.deleted)
+	}
+}
+
+func TestSafeDeleteRecycleBinError(t *testing.T) {
+	s := &deleteStandIn{id: 7, policy: "Delete", backupAge: time.Hour, recycleBinStatus: http.StatusForbidden}
+	// Without a timeout, the wait is still bounded and stops at the error.
+	d := NewSafeDeleter(apitest.NewClient(t, s), SafeDeleteOptions{PollInterval: time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	plan, err := d.Preflight(ctx, "org", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = d.Execute(ctx, plan, plan.ConfirmationToken)
+	if err == nil || !strings.Contains(err.Error(), "403") || ctx.Err() != nil {
+		t.Fatalf("execute with a forbidden recycle bin: %v", err)
+	}
+}
+
+func TestSafeDeleteBlocked(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name  string
+		setup func(*deleteStandIn)
+		check string
+	}{
+		{"do not terminate", func(s *deleteStandIn) { s.policy = "DoNotTerminate" }, "TerminationPolicy"},
+		{"wipe out", func(s *deleteStandIn) { s.policy = "WipeOut" }, "TerminationPolicy"},
+		{"stale backup", func(s *deleteStandIn) { s.backupAge = 48 * time.Hour }, "Backup"},
+		{"dependents", func(s *deleteStandIn) { s.dependents = true }, "DisasterRecovery"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, d := newDeleteStandIn(t)
+			tt.setup(s)
+			plan, err := d.Preflight(ctx, "org", "db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			blockers := plan.Blockers()
+			if len(blockers) != 1 || blockers[0].Name != tt.check {
+				t.Fatalf("blockers = %+v", blockers)
+			}
+			var blocked *BlockedError
+			if _, err := d.Execute(ctx, plan, plan.ConfirmationToken); !errors.As(err, &blocked) || s.deleted {
+				t.Fatalf("execute: %v, deleted %v", err, s.deleted)
+			}
+		})
+	}
+}
+
+func TestSafeDeleteStalePlan(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		change func(*deleteStandIn)
+		stale  bool
+	}{
+		{"recreated", func(s *deleteStandIn) { s.id = 8 }, true},
+		{"termination policy", func(s *deleteStandIn) { s.policy = "WipeOut" }, true},
+		{"new dependent", func(s *deleteStandIn) { s.dependents = true }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, d := newDeleteStandIn(t)
+			plan, err := d.Preflight(ctx, "org", "db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.mu.Lock()
+			tt.change(s)
+			s.mu.Unlock()
+			_, err = d.Execute(ctx, plan, plan.ConfirmationToken)
+			var blocked *BlockedError
+			if tt.stale && !errors.Is(err, ErrStalePlan) || !tt.stale && !errors.As(err, &blocked) {
+				t.Fatalf("execute: %v", err)
+			}
+			if s.deleted {
+				t.Fatal("cluster deleted from a stale plan")
+			}
+		})
+	}
+}
+
+func instance(component, name, role string) kbcloud.Instance {
+	return kbcloud.Instance{Component: component, Name: name, Role: role, Status: kbcloud.InstanceStatus{Phase: InstancePhaseRunning}}
+}
+
+func names(instances []kbcloud.Instance) []string {
+	out := make([]string, len(instances))
+	for i, inst := range instances {
+		out[i] = inst.Name
+	}
+	return out
+}
+
+func TestRollingRestartPlan(t *testing.T) {
+	engine := kbcloud.EngineOption{Components: []kbcloud.ComponentOption{
+		{Name: "mysql", Order: 1, RoleOrder: []string{"leader", "follower", "learner"}},
+		{Name: "proxy", Order: 2},
+		{Name: "postgresql", Order: 1, RoleOrder: []string{"primary", "secondary"}},
+	}}
+	tests := []struct {
+		name       string
+		components []string
+		instances  []kbcloud.Instance
+		want       [][]string
+		primaries  []string
+	}{
+		{
+			name: "primary last",
+			instances: []kbcloud.Instance{
+				instance("mysql", "m-0", "leader"), instance("mysql", "m-1", "follower"), instance("mysql", "m-2", "learner"),
+			},
+			want:      [][]string{{"m-2", "m-1", "m-0"}},
+			primaries: []string{"m-0"},
+		},
+		{
+			name: "unknown and empty roles before listed roles",
+			instances: []kbcloud.Instance{
+				instance("mysql", "m-0", "leader"), instance("mysql", "m-1", ""), instance("mysql", "m-2", "follower"), instance("mysql", "m-3", "witness"),
+			},
+			want:      [][]string{{"m-1", "m-3", "m-2", "m-0"}},
+			primaries: []string{"m-0"},
+		},
+		{
+			name: "components without roles first",
+			instances: []kbcloud.Instance{
+				instance("mysql", "m-0", "leader"), instance("mysql", "m-1", "follower"), instance("proxy", "p-0", ""), instance("proxy", "p-1", ""),
+			},
+			want:      [][]string{{"p-0", "p-1"}, {"m-1", "m-0"}},
+			primaries: []string{"", "m-0"},
+		},
+		{
+			name:      "single instance has no switchover",
+			instances: []kbcloud.Instance{instance("postgresql", "pg-0", "primary")},
+			want:      [][]string{{"pg-0"}},
+			primaries: []string{""},
+		},
+		{
+			name:       "selected components",
+			components: []string{"proxy"},
+			instances:  []kbcloud.Instance{instance("mysql", "m-0", "leader"), instance("proxy", "p-0", "")},
+			want:       [][]string{{"p-0"}},
+			primaries:  []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &RollingRestarter{opts: RollingRestartOptions{Components: tt.components}}
+			plans := r.plan(engine, tt.instances)
+			var got [][]string
+			var primaries []string
+			for _, p := range plans {
+				got = append(got, names(p.instances))
+				primaries = append(primaries, p.primary)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(primaries, tt.primaries) {
+				t.Fatalf("plan = %v primaries %v, want %v primaries %v", got, primaries, tt.want, tt.primaries)
+			}
+		})
+	}
+}
+
+func TestSwitchoverCandidate(t *testing.T) {
+	stopped := instance("mysql", "m-1", "follower")
+	stopped.Status.Phase = "Stopped"
+	plan := componentPlan{primary: "m-0", roleOrder: []string{"leader", "follower", "learner"}}
+	tests := []struct {
+		name      string
+		instances []kbcloud.Instance
+		want      string
+	}{
+		{"follower next to the primary", []kbcloud.Instance{
+			instance("mysql", "m-3", ""), instance("mysql", "m-2", "follower"), instance("mysql", "m-1", "follower"), instance("mysql", "m-0", "leader"),
+		}, "m-1"},
+		{"learners and unknown roles are not promoted", []kbcloud.Instance{
+			instance("mysql", "m-3", "witness"), instance("mysql", "m-2", "learner"), instance("mysql", "m-0", "leader"),
+		}, ""},
+		{"stopped followers are skipped", []kbcloud.Instance{
+			instance("mysql", "m-2", "follower"), stopped, instance("mysql", "m-0", "leader"),
+		}, "m-2"},
+		{"never the primary", []kbcloud.Instance{instance("mysql", "m-0", "follower")}, ""},
+	}
+	for _, tt := range tests {
+		got, ok := plan.candidate(tt.instances)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: candidate = %q, %v, want %q", tt.name, got, ok, tt.want)
+		}
+	}
+}
+
+// restartStandIn serves the instances of a mysql component and restarts one
+// instance per listing once a restart is requested, in the order of queue.
+// Like KubeBlocks, it holds back the restart of an instance while it is the
+// leader, unless eager is set.
+type restartStandIn struct {
+	mu        sync.Mutex
+	roles     map[string]string
+	restarted map[string]bool
+	queue     []string
+	eager     bool
+	// failover adds an HA record of a failover of m-1 nobody asked for.
+	failover bool
+
+	restarting bool
+	cancelled  bool
+	promoted   []string
+	history    []string
+}
+
+func newRestartStandIn() *restartStandIn {
+	return &restartStandIn{
+		roles:     map[string]string{"m-0": "leader", "m-1": "follower", "m-2": "follower"},
+		restarted: map[string]bool{},
+		queue:     []string{"m-1", "m-2", "m-0"},
+	}
+}
+
+func (s *restartStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method + " " + apitest.OrgPath(r, "org") {
+	case "GET /clusters/db/instances":
+		if s.restarting && !s.cancelled && len(s.queue) > 0 && (s.eager || s.roles[s.queue[0]] != "leader") {
+			s.restarted[s.queue[0]] = true
+			s.queue = s.queue[1:]
+		}
+		var items []string
+		for _, name := range []string{"m-0", "m-1", "m-2"} {
+			created := "2024-01-01T00:00:00Z"
+			if s.restarted[name] {
+				created = "2024-01-02T00:00:00Z"
+			}
+			items = append(items, fmt.Sprintf(`{"accessMode": "ReadWrite", "cloud": "aws", "cluster": "db", "component": "mysql", "cpu": "1",
+				"createdAt": %q, "memory": "1Gi", "name": %q, "node": "n", "region": "r", "role": %q, "status": {"phase": "Running"},
+				"storage": [], "zone": "z"}`, created, name, s.roles[name]))
+		}
+		apitest.WriteJSON(w, http.StatusOK, `{"items": [`+strings.Join(items, ",")+`]}`)
+	case "POST /clusters/db/restart":
+		s.restarting = true
+		apitest.WriteJSON(w, http.StatusOK, `{"opsRequestName": "restart-1"}`)
+	case "POST /clusters/db/opsrequests/restart-1/cancel":
+		s.cancelled = true
+		w.WriteHeader(http.StatusOK)
+	case "POST /clusters/db/promote":
+		var body kbcloud.OpsPromote
+		json.NewDecoder(r.Body).Decode(&body)
+		candidate := body.GetInstanceName()
+		if !s.restarted[candidate] {
+			candidate += " (not restarted)"
+		}
+		s.promoted = append(s.promoted, candidate)
+		for name, role := range s.roles {
+			if role == "leader" {
+				s.roles[name] = "follower"
+				s.history = append(s.history, fmt.Sprintf(`{"StartAt": %d, "OldPrimary": %q, "NewPrimary": %q, "Reason": "switchover"}`,
+					time.Now().Unix(), name, body.GetInstanceName()))
+			}
+		}
+		s.roles[body.GetInstanceName()] = "leader"
+		apitest.WriteJSON(w, http.StatusOK, `{"opsRequestName": "promote-1"}`)
+	case "GET /clusters/db/haHistory":
+		records := s.history
+		if s.failover {
+			records = append(records, fmt.Sprintf(`{"StartAt": %d, "OldPrimary": "m-1", "NewPrimary": "m-2", "Reason": "crash"}`, time.Now().Unix()))
+		}
+		apitest.WriteJSON(w, http.StatusOK, `{"componentName": "mysql", "records": [`+strings.Join(records, ",")+`]}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestRestartComponent(t *testing.T) {
+	engine := kbcloud.EngineOption{Components: []kbcloud.ComponentOption{{Name: "mysql", Order: 1, RoleOrder: []string{"leader", "follower"}}}}
+	instances := []kbcloud.Instance{instance("mysql", "m-0", "leader"), instance("mysql", "m-1", "follower"), instance("mysql", "m-2", "follower")}
+	for i := range instances {
+		instances[i].CreatedAt = "2024-01-01T00:00:00Z"
+	}
+	tests := []struct {
+		name     string
+		change   func(s *restartStandIn)
+		err      string
+		promoted []string
+	}{
+		{name: "secondaries, switchover, primary", promoted: []string{"m-2"}},
+		{name: "primary restarted first", change: func(s *restartStandIn) {
+			s.eager, s.queue = true, []string{"m-0", "m-1", "m-2"}
+		}, err: "primary m-0 of component mysql was restarted before secondary m-1"},
+		{name: "unexpected failover", change: func(s *restartStandIn) { s.failover = true }, err: "unexpected failover in component mysql from m-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRestartStandIn()
+			if tt.change != nil {
+				tt.change(s)
+			}
+			var steps []string
+			r := NewRollingRestarter(apitest.NewClient(t, s), RollingRestartOptions{
+				PollInterval: time.Millisecond, Timeout: 5 * time.Second,
+				Progress: func(msg string) { steps = append(steps, msg) },
+			})
+			err := r.restartComponent(context.Background(), "org", "db", r.plan(engine, instances)[0])
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) || !s.cancelled {
+					t.Fatalf("restart: %v, cancelled %v", err, s.cancelled)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.cancelled || !reflect.DeepEqual(s.promoted, tt.promoted) || len(s.queue) != 0 {
+				t.Fatalf("cancelled %v, promoted %v, left %v", s.cancelled, s.promoted, s.queue)
+			}
+			want := []string{
+				"component mysql: restarting",
+				"component mysql: instance m-1 is healthy",
+				"component mysql: instance m-2 is healthy",
+				"component mysql: switching primary m-0 over to m-2",
+				"component mysql: instance m-0 is healthy",
+			}
+			if !reflect.DeepEqual(steps, want) {
+				t.Errorf("steps:\n%s", strings.Join(steps, "\n"))
+			}
+		})
+	}
+}
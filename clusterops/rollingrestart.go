@@ -0,0 +1,348 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package clusterops
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// InstancePhaseRunning is the phase reported by healthy instances.
+const InstancePhaseRunning = "Running"
+
+// UnexpectedFailoverError is returned when the HA history shows a failover the
+// orchestrator did not initiate or expect.
+type UnexpectedFailoverError struct {
+	Component string
+	Record    kbcloud.HaHistoryResponseRecordsItem
+}
+
+// Error returns non-empty string if there was an error.
+func (e *UnexpectedFailoverError) Error() string {
+	return fmt.Sprintf("unexpected failover in component %s from %s to %s: %s",
+		e.Component, e.Record.GetOldPrimary(), e.Record.GetNewPrimary(), e.Record.GetReason())
+}
+
+// RollingRestartOptions configures a RollingRestarter.
+type RollingRestartOptions struct {
+	// Components limits the restart to the given component names. All components are restarted when empty.
+	Components []string
+	// SkipSwitchover disables the controlled switchover before the primary is restarted.
+	SkipSwitchover bool
+	// PollInterval is the interval used while waiting for instances.
+	PollInterval time.Duration
+	// Timeout bounds each wait. Zero waits until ctx is done.
+	Timeout time.Duration
+	// Progress, when set, receives a line for every step taken.
+	Progress func(msg string)
+}
+
+// RollingRestarter restarts cluster components one at a time in role order,
+// switching the primary over to a restarted, healthy secondary before the
+// primary itself is restarted.
+//
+// The API restarts whole components, so the pod order inside a component is
+// carried out by KubeBlocks. The orchestrator verifies that every secondary is
+// back and healthy before the primary is touched and cancels the restart when
+// the order is violated or the HA history shows an unexpected failover.
+type RollingRestarter struct {
+	clusterApi *kbcloud.ClusterApi
+	opsApi     *kbcloud.OpsrequestApi
+	engineApi  *kbcloud.EngineOptionApi
+	opts       RollingRestartOptions
+}
+
+// NewRollingRestarter returns a RollingRestarter using client.
+func NewRollingRestarter(client *common.APIClient, opts RollingRestartOptions) *RollingRestarter {
+	return &RollingRestarter{
+		clusterApi: kbcloud.NewClusterApi(client),
+		opsApi:     kbcloud.NewOpsrequestApi(client),
+		engineApi:  kbcloud.NewEngineOptionApi(client),
+		opts:       opts,
+	}
+}
+
+// componentPlan describes how a single component is restarted.
+type componentPlan struct {
+	name        string
+	order       int32
+	primary     string
+	primaryRole string
+	roleOrder   []string
+	instances   []kbcloud.Instance
+}
+
+// candidate returns the instance the primary is switched over to: a running
+// instance other than the primary holding the role next in line, preferring
+// the one restarted last.
+func (p componentPlan) candidate(instances []kbcloud.Instance) (string, bool) {
+	if len(p.roleOrder) < 2 {
+		return "", false
+	}
+	for i := len(instances) - 1; i >= 0; i-- {
+		inst := instances[i]
+		if inst.Name != p.primary && inst.Role == p.roleOrder[1] && inst.Status.Phase == InstancePhaseRunning {
+			return inst.Name, true
+		}
+	}
+	return "", false
+}
+
+// Restart performs the rolling restart of the cluster.
+func (r *RollingRestarter) Restart(ctx context.Context, orgName, clusterName string) error {
+	cluster, _, err := r.clusterApi.GetCluster(ctx, orgName, clusterName)
+	if err != nil {
+		return fmt.Errorf("get cluster: %w", err)
+	}
+	engine, _, err := r.engineApi.GetEngineOption(ctx, cluster.Engine)
+	if err != nil {
+		return fmt.Errorf("get engine option %s: %w", cluster.Engine, err)
+	}
+	instances, _, err := r.clusterApi.ListInstance(ctx, orgName, clusterName)
+	if err != nil {
+		return fmt.Errorf("list instances: %w", err)
+	}
+	for _, inst := range instances.Items {
+		if inst.Status.Phase != InstancePhaseRunning {
+			return fmt.Errorf("instance %s is %s, refusing to restart an unhealthy cluster", inst.Name, inst.Status.Phase)
+		}
+	}
+
+	for _, plan := range r.plan(engine, instances.Items) {
+		if err := r.restartComponent(ctx, orgName, clusterName, plan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plan groups instances by component and orders each group by role so that
+// secondaries come first and the primary comes last. Instances whose role is
+// empty or not in the role order come before every listed role. Components
+// without roles are restarted before role-bearing components.
+func (r *RollingRestarter) plan(engine kbcloud.EngineOption, instances []kbcloud.Instance) []componentPlan {
+	options := map[string]kbcloud.ComponentOption{}
+	for _, opt := range engine.Components {
+		options[opt.Name] = opt
+	}
+	wanted := map[string]bool{}
+	for _, c := range r.opts.Components {
+		wanted[c] = true
+	}
+
+	byName := map[string]*componentPlan{}
+	var plans []*componentPlan
+	for _, inst := range instances {
+		name := inst.GetComponentName()
+		if name == "" {
+			name = inst.Component
+		}
+		if len(wanted) > 0 && !wanted[name] {
+			continue
+		}
+		p, ok := byName[name]
+		if !ok {
+			p = &componentPlan{name: name, order: options[inst.Component].Order}
+			byName[name] = p
+			plans = append(plans, p)
+		}
+		p.instances = append(p.instances, inst)
+	}
+
+	for _, p := range plans {
+		roleOrder := options[p.instances[0].Component].RoleOrder
+		p.roleOrder = roleOrder
+		rank := map[string]int{}
+		for i, role := range roleOrder {
+			rank[role] = i
+		}
+		rankOf := func(role string) int {
+			if i, ok := rank[role]; ok {
+				return i
+			}
+			return len(roleOrder)
+		}
+		// RoleOrder lists the primary role first; restart it last.
+		sort.SliceStable(p.instances, func(i, j int) bool {
+			return rankOf(p.instances[i].Role) > rankOf(p.instances[j].Role)
+		})
+		if len(roleOrder) > 0 && len(p.instances) > 1 {
+			for _, inst := range p.instances {
+				if inst.Role == roleOrder[0] {
+					p.primary = inst.Name
+					p.primaryRole = inst.Role
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(plans, func(i, j int) bool {
+		if (plans[i].primary == "") != (plans[j].primary == "") {
+			return plans[i].primary == ""
+		}
+		return plans[i].order < plans[j].order
+	})
+	out := make([]componentPlan, 0, len(plans))
+	for _, p := range plans {
+		out = append(out, *p)
+	}
+	return out
+}
+
+// restartComponent restarts a component and follows the restart instance by
+// instance: the secondaries first, then, once they are back and healthy, a
+// switchover of the primary to a restarted secondary, and the old primary
+// last. The restart is cancelled when the primary is restarted before the
+// secondaries or the HA history shows an unexpected failover.
+func (r *RollingRestarter) restartComponent(ctx context.Context, orgName, clusterName string, plan componentPlan) error {
+	since := time.Now()
+	expected := map[string]bool{}
+	primary := plan.primary
+
+	r.progress("component %s: restarting", plan.name)
+	ops, _, err := r.opsApi.RestartCluster(ctx, orgName, clusterName, kbcloud.OpsRestart{Component: common.PtrString(plan.name)})
+	if err != nil {
+		return fmt.Errorf("restart component %s: %w", plan.name, err)
+	}
+	abort := func(cause error) error {
+		if _, err := r.opsApi.CancelOps(ctx, orgName, ops.OpsRequestName, clusterName, string(kbcloud.OpsTypeRestart)); err != nil {
+			return fmt.Errorf("%w (cancel %s: %v)", cause, ops.OpsRequestName, err)
+		}
+		return cause
+	}
+
+	created := map[string]string{}
+	for _, inst := range plan.instances {
+		created[inst.Name] = inst.CreatedAt
+	}
+	restarted := map[string]bool{}
+	// await polls the instances of the component until the named instance is
+	// restarted and running. Until the secondaries are done, the primary must
+	// stay untouched.
+	await := func(name string, secondary bool) (map[string]kbcloud.Instance, error) {
+		var current map[string]kbcloud.Instance
+		err := wait.Poll(ctx, r.opts.PollInterval, r.opts.Timeout, func(ctx context.Context) (bool, error) {
+			instances, err := r.componentInstances(ctx, orgName, clusterName, plan.name)
+			if err != nil {
+				return false, err
+			}
+			current = instances
+			for name, inst := range instances {
+				if inst.CreatedAt != created[name] && inst.Status.Phase == InstancePhaseRunning {
+					restarted[name] = true
+				}
+			}
+			if secondary && primary != "" {
+				if p, ok := instances[primary]; ok && (p.CreatedAt != created[primary] || p.Status.Phase != InstancePhaseRunning) {
+					return false, fmt.Errorf("primary %s of component %s was restarted before secondary %s", primary, plan.name, name)
+				}
+			}
+			if err := r.checkFailovers(ctx, orgName, clusterName, plan.name, since, expected); err != nil {
+				return false, err
+			}
+			return restarted[name], nil
+		})
+		if err != nil {
+			return nil, abort(fmt.Errorf("restart instance %s: %w", name, err))
+		}
+		r.progress("component %s: instance %s is healthy", plan.name, name)
+		return current, nil
+	}
+
+	current := map[string]kbcloud.Instance{}
+	for _, inst := range plan.instances {
+		if inst.Name == primary {
+			continue
+		}
+		if current, err = await(inst.Name, true); err != nil {
+			return err
+		}
+	}
+	if primary == "" {
+		return nil
+	}
+
+	if !r.opts.SkipSwitchover {
+		// Only a secondary that was already restarted may take over, so that
+		// the new primary is not restarted in turn.
+		instances := make([]kbcloud.Instance, 0, len(plan.instances))
+		for _, inst := range plan.instances {
+			if cur, ok := current[inst.Name]; ok && restarted[inst.Name] {
+				instances = append(instances, cur)
+			}
+		}
+		candidate, ok := plan.candidate(instances)
+		if !ok {
+			return abort(fmt.Errorf("component %s has no restarted instance that can take over from primary %s", plan.name, primary))
+		}
+		r.progress("component %s: switching primary %s over to %s", plan.name, primary, candidate)
+		expected[primary] = true
+		if _, _, err := r.opsApi.PromoteCluster(ctx, orgName, clusterName, kbcloud.OpsPromote{
+			ComponentName: common.PtrString(plan.name),
+			InstanceName:  common.PtrString(candidate),
+		}); err != nil {
+			return abort(fmt.Errorf("switchover component %s: %w", plan.name, err))
+		}
+		err = wait.Poll(ctx, r.opts.PollInterval, r.opts.Timeout, func(ctx context.Context) (bool, error) {
+			instances, err := r.componentInstances(ctx, orgName, clusterName, plan.name)
+			if err != nil {
+				return false, err
+			}
+			return instances[candidate].Role == plan.primaryRole, nil
+		})
+		if err != nil {
+			return abort(fmt.Errorf("wait for switchover of component %s: %w", plan.name, err))
+		}
+	} else {
+		// Without a switchover, restarting the primary fails it over.
+		expected[primary] = true
+	}
+	_, err = await(primary, false)
+	return err
+}
+
+// checkFailovers reports HA records since the restart started whose old primary was not expected to fail over.
+func (r *RollingRestarter) checkFailovers(ctx context.Context, orgName, clusterName, component string, since time.Time, expected map[string]bool) error {
+	params := kbcloud.NewDescribeClusterHaHistoryOptionalParameters().WithComponentName(component)
+	history, _, err := r.clusterApi.DescribeClusterHaHistory(ctx, orgName, clusterName, *params)
+	if err != nil {
+		return fmt.Errorf("describe ha history: %w", err)
+	}
+	for _, record := range history.Records {
+		if int64(record.StartAt) < since.Unix() {
+			continue
+		}
+		if !expected[record.GetOldPrimary()] {
+			return &UnexpectedFailoverError{Component: component, Record: record}
+		}
+	}
+	return nil
+}
+
+func (r *RollingRestarter) componentInstances(ctx context.Context, orgName, clusterName, component string) (map[string]kbcloud.Instance, error) {
+	list, _, err := r.clusterApi.ListInstance(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("list instances: %w", err)
+	}
+	instances := map[string]kbcloud.Instance{}
+	for _, inst := range list.Items {
+		if inst.GetComponentName() == component || (inst.GetComponentName() == "" && inst.Component == component) {
+			instances[inst.Name] = inst
+		}
+	}
+	return instances, nil
+}
+
+func (r *RollingRestarter) progress(format string, a ...interface{}) {
+	if r.opts.Progress != nil {
+		r.opts.Progress(fmt.Sprintf(format, a...))
+	}
+}
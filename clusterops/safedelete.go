@@ -0,0 +1,361 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package clusterops implements multi-step cluster operations with safety checks
+// on top of the generated KubeBlocks Cloud API client.
+package clusterops
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apiutil"
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// Severity classifies the outcome of a pre-flight check.
+type Severity string
+
+// List of Severity.
+const (
+	SeverityOK      Severity = "OK"
+	SeverityWarning Severity = "Warning"
+	SeverityBlocker Severity = "Blocker"
+)
+
+// Check is the result of a single pre-flight check.
+type Check struct {
+	Name     string
+	Severity Severity
+	Message  string
+}
+
+// ErrConfirmationMismatch is returned when the confirmation token does not match the plan.
+var ErrConfirmationMismatch = errors.New("confirmation token does not match the deletion plan")
+
+// ErrStalePlan is returned when the cluster changed since the deletion plan was made.
+var ErrStalePlan = errors.New("cluster changed since the deletion plan was made")
+
+// BlockedError is returned when a deletion plan contains blocking checks.
+type BlockedError struct {
+	Checks []Check
+}
+
+// Error returns non-empty string if there was an error.
+func (e *BlockedError) Error() string {
+	msgs := make([]string, 0, len(e.Checks))
+	for _, c := range e.Checks {
+		msgs = append(msgs, c.Name+": "+c.Message)
+	}
+	return "cluster deletion blocked: " + strings.Join(msgs, "; ")
+}
+
+// SafeDeleteOptions configures the pre-flight checks of a guarded deletion.
+type SafeDeleteOptions struct {
+	// MaxBackupAge is how old the latest completed backup may be. Defaults to 24h.
+	MaxBackupAge time.Duration
+	// TakeBackup takes a backup and waits for it when no recent backup exists.
+	TakeBackup bool
+	// BackupMethod is the method used when taking a backup. Defaults to the
+	// auto backup method of the cluster backup policy.
+	BackupMethod string
+	// AllowWipeOut allows deleting clusters whose termination policy is WipeOut.
+	AllowWipeOut bool
+	// AllowDependents allows deleting clusters that disaster recovery clusters depend on.
+	AllowDependents bool
+	// PollInterval is the interval used while waiting for backups and the recycle bin.
+	PollInterval time.Duration
+	// Timeout bounds each wait. Zero waits for backups until ctx is done, and
+	// for the recycle bin DefaultRecycleBinTimeout.
+	Timeout time.Duration
+}
+
+// DefaultRecycleBinTimeout bounds the wait for a deleted cluster to appear in
+// the recycle bin when SafeDeleteOptions.Timeout is zero.
+const DefaultRecycleBinTimeout = 10 * time.Minute
+
+// DeletionPlan is the outcome of the pre-flight checks for a cluster deletion.
+type DeletionPlan struct {
+	OrgName     string
+	ClusterName string
+	Cluster     kbcloud.Cluster
+	// LatestBackup is the most recent completed backup, if any.
+	LatestBackup *kbcloud.Backup
+	// Dependents are the disaster recovery clusters attached to the cluster.
+	Dependents []kbcloud.ClusterListItem
+	Checks     []Check
+	// ConfirmationToken must be passed back to Execute to carry out the deletion.
+	ConfirmationToken string
+}
+
+// Blockers returns the checks that prevent the deletion.
+func (p *DeletionPlan) Blockers() []Check {
+	var blockers []Check
+	for _, c := range p.Checks {
+		if c.Severity == SeverityBlocker {
+			blockers = append(blockers, c)
+		}
+	}
+	return blockers
+}
+
+// Warnings returns the checks that should be reviewed before confirming.
+func (p *DeletionPlan) Warnings() []Check {
+	var warnings []Check
+	for _, c := range p.Checks {
+		if c.Severity == SeverityWarning {
+			warnings = append(warnings, c)
+		}
+	}
+	return warnings
+}
+
+func (p *DeletionPlan) add(name string, severity Severity, format string, a ...interface{}) {
+	p.Checks = append(p.Checks, Check{Name: name, Severity: severity, Message: fmt.Sprintf(format, a...)})
+}
+
+// SafeDeleter deletes clusters only after pre-flight safety checks pass and
+// the caller confirms the plan with its token.
+type SafeDeleter struct {
+	clusterApi    *kbcloud.ClusterApi
+	backupApi     *kbcloud.BackupApi
+	recycleBinApi *kbcloud.RecycleBinClusterApi
+	opts          SafeDeleteOptions
+}
+
+// NewSafeDeleter returns a SafeDeleter using client.
+func NewSafeDeleter(client *common.APIClient, opts SafeDeleteOptions) *SafeDeleter {
+	if opts.MaxBackupAge <= 0 {
+		opts.MaxBackupAge = 24 * time.Hour
+	}
+	return &SafeDeleter{
+		clusterApi:    kbcloud.NewClusterApi(client),
+		backupApi:     kbcloud.NewBackupApi(client),
+		recycleBinApi: kbcloud.NewRecycleBinClusterApi(client),
+		opts:          opts,
+	}
+}
+
+// Preflight runs the safety checks for deleting the cluster and returns the plan.
+// When TakeBackup is set and no recent backup exists, a backup is taken and awaited.
+func (d *SafeDeleter) Preflight(ctx context.Context, orgName, clusterName string) (*DeletionPlan, error) {
+	cluster, _, err := d.clusterApi.GetCluster(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("get cluster: %w", err)
+	}
+	plan := &DeletionPlan{
+		OrgName:     orgName,
+		ClusterName: clusterName,
+		Cluster:     cluster,
+	}
+
+	switch policy := cluster.GetTerminationPolicy(); policy {
+	case kbcloud.ClusterTerminationPolicyDoNotTerminate:
+		plan.add("TerminationPolicy", SeverityBlocker, "termination policy %s forbids deletion", policy)
+	case kbcloud.ClusterTerminationPolicyWipeOut:
+		if d.opts.AllowWipeOut {
+			plan.add("TerminationPolicy", SeverityWarning, "termination policy %s removes all data and backups", policy)
+		} else {
+			plan.add("TerminationPolicy", SeverityBlocker, "termination policy %s removes all data and backups", policy)
+		}
+	default:
+		plan.add("TerminationPolicy", SeverityOK, "termination policy is %s", policy)
+	}
+
+	if err := d.checkBackup(ctx, plan); err != nil {
+		return nil, err
+	}
+	if err := d.checkDependents(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	if _, _, err := d.recycleBinApi.ListRecycleBinCluster(ctx, orgName); err != nil {
+		plan.add("RecycleBin", SeverityBlocker, "recycle bin is not available: %v", err)
+	} else if _, _, err := d.recycleBinApi.GetRecycleBinCluster(ctx, orgName, clusterName); err == nil {
+		plan.add("RecycleBin", SeverityBlocker, "a cluster named %s is already in the recycle bin", clusterName)
+	} else {
+		plan.add("RecycleBin", SeverityOK, "cluster will be moved to the recycle bin")
+	}
+
+	plan.ConfirmationToken = confirmationToken(orgName, cluster)
+	return plan, nil
+}
+
+func (d *SafeDeleter) checkBackup(ctx context.Context, plan *DeletionPlan) error {
+	params := kbcloud.NewListBackupsOptionalParameters().WithClusterName(plan.ClusterName)
+	backups, _, err := d.backupApi.ListBackups(ctx, plan.OrgName, *params)
+	if err != nil {
+		return fmt.Errorf("list backups: %w", err)
+	}
+	for i := range backups.Items {
+		b := backups.Items[i]
+		if b.Status != kbcloud.BackupStatusCompleted || b.CompletionTimestamp == nil {
+			continue
+		}
+		if plan.LatestBackup == nil || b.CompletionTimestamp.After(*plan.LatestBackup.CompletionTimestamp) {
+			plan.LatestBackup = &b
+		}
+	}
+
+	if plan.LatestBackup != nil && time.Since(*plan.LatestBackup.CompletionTimestamp) <= d.opts.MaxBackupAge {
+		plan.add("Backup", SeverityOK, "backup %s completed at %s", plan.LatestBackup.Name, plan.LatestBackup.CompletionTimestamp.Format(time.RFC3339))
+		return nil
+	}
+	if !d.opts.TakeBackup {
+		plan.add("Backup", SeverityBlocker, "no completed backup within the last %s", d.opts.MaxBackupAge)
+		return nil
+	}
+
+	method := d.opts.BackupMethod
+	if method == "" {
+		policy, _, err := d.backupApi.GetClusterBackupPolicy(ctx, plan.OrgName, plan.ClusterName)
+		if err != nil {
+			return fmt.Errorf("get backup policy: %w", err)
+		}
+		method = policy.GetAutoBackupMethod()
+	}
+	created, _, err := d.backupApi.CreateClusterBackup(ctx, plan.OrgName, plan.ClusterName, kbcloud.BackupCreate{BackupMethod: method})
+	if err != nil {
+		return fmt.Errorf("create backup: %w", err)
+	}
+	backup, err := wait.ForBackup(ctx, d.backupApi, plan.OrgName, created.GetId(), d.opts.PollInterval, d.opts.Timeout)
+	if err != nil {
+		plan.add("Backup", SeverityBlocker, "backup %s did not complete: %v", created.Name, err)
+		return nil
+	}
+	plan.LatestBackup = &backup
+	plan.add("Backup", SeverityOK, "backup %s taken before deletion", backup.Name)
+	return nil
+}
+
+func (d *SafeDeleter) checkDependents(ctx context.Context, plan *DeletionPlan) error {
+	if plan.Cluster.GetClusterType() == kbcloud.ClusterTypeDisasterRecovery {
+		plan.add("DisasterRecovery", SeverityWarning, "cluster is a disaster recovery replica of %s", plan.Cluster.GetParentName())
+	}
+
+	clusters, _, err := d.clusterApi.ListCluster(ctx, plan.OrgName)
+	if err != nil {
+		return fmt.Errorf("list clusters: %w", err)
+	}
+	id := apiutil.FormatID(plan.Cluster.Id)
+	for _, c := range clusters.Items {
+		if c.GetParentName() == plan.ClusterName || (c.ParentId.IsSet() && strconv.FormatInt(c.GetParentId(), 10) == id) {
+			plan.Dependents = append(plan.Dependents, c)
+		}
+	}
+	if len(plan.Dependents) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(plan.Dependents))
+	for _, c := range plan.Dependents {
+		names = append(names, c.Name)
+	}
+	severity := SeverityBlocker
+	if d.opts.AllowDependents {
+		severity = SeverityWarning
+	}
+	plan.add("DisasterRecovery", severity, "disaster recovery clusters depend on this cluster: %s", strings.Join(names, ", "))
+	return nil
+}
+
+// Execute deletes the cluster described by plan once confirmationToken matches and
+// no check blocks the deletion, then waits for the cluster to appear in the recycle bin.
+// The cluster is fetched again first; ErrStalePlan is returned when it was
+// recreated or its termination policy changed since the plan was made.
+func (d *SafeDeleter) Execute(ctx context.Context, plan *DeletionPlan, confirmationToken string) (kbcloud.RecycleBinCluster, error) {
+	var recycled kbcloud.RecycleBinCluster
+	if blockers := plan.Blockers(); len(blockers) > 0 {
+		return recycled, &BlockedError{Checks: blockers}
+	}
+	if confirmationToken == "" || confirmationToken != plan.ConfirmationToken {
+		return recycled, ErrConfirmationMismatch
+	}
+	if err := d.recheck(ctx, plan); err != nil {
+		return recycled, err
+	}
+
+	if _, _, err := d.clusterApi.DeleteCluster(ctx, plan.OrgName, plan.ClusterName); err != nil {
+		return recycled, fmt.Errorf("delete cluster: %w", err)
+	}
+
+	timeout := d.opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultRecycleBinTimeout
+	}
+	err := wait.Poll(ctx, d.opts.PollInterval, timeout, func(ctx context.Context) (bool, error) {
+		var err error
+		var resp *http.Response
+		recycled, resp, err = d.recycleBinApi.GetRecycleBinCluster(ctx, plan.OrgName, plan.ClusterName)
+		if err != nil {
+			// The cluster is not in the recycle bin until its deletion completes.
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				return false, nil
+			}
+			return false, err
+		}
+		if recycled.UnparsedObject != nil {
+			return false, fmt.Errorf("unexpected recycle bin cluster %v", recycled.UnparsedObject)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return recycled, fmt.Errorf("wait for cluster %s in recycle bin: %w", plan.ClusterName, err)
+	}
+	return recycled, nil
+}
+
+// recheck fetches the cluster again and refuses the deletion when it no
+// longer matches the plan or gained disaster recovery dependents.
+func (d *SafeDeleter) recheck(ctx context.Context, plan *DeletionPlan) error {
+	cluster, _, err := d.clusterApi.GetCluster(ctx, plan.OrgName, plan.ClusterName)
+	if err != nil {
+		return fmt.Errorf("get cluster: %w", err)
+	}
+	if confirmationToken(plan.OrgName, cluster) != plan.ConfirmationToken {
+		return fmt.Errorf("%w: cluster %s was recreated", ErrStalePlan, plan.ClusterName)
+	}
+	if was, now := plan.Cluster.GetTerminationPolicy(), cluster.GetTerminationPolicy(); was != now {
+		return fmt.Errorf("%w: termination policy changed from %s to %s", ErrStalePlan, was, now)
+	}
+	current := &DeletionPlan{OrgName: plan.OrgName, ClusterName: plan.ClusterName, Cluster: cluster}
+	if err := d.checkDependents(ctx, current); err != nil {
+		return err
+	}
+	if blockers := current.Blockers(); len(blockers) > 0 {
+		return &BlockedError{Checks: blockers}
+	}
+	return nil
+}
+
+// SafeDelete runs the pre-flight checks and deletes the cluster when confirmationToken
+// matches the resulting plan. The plan is returned so callers can display it.
+func (d *SafeDeleter) SafeDelete(ctx context.Context, orgName, clusterName, confirmationToken string) (*DeletionPlan, error) {
+	plan, err := d.Preflight(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	_, err = d.Execute(ctx, plan, confirmationToken)
+	return plan, err
+}
+
+// confirmationToken derives a stable token identifying one specific cluster incarnation,
+// so a token issued for a cluster cannot delete a recreated cluster with the same name.
+func confirmationToken(orgName string, cluster kbcloud.Cluster) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s/%s/%s", orgName, cluster.Name, apiutil.FormatID(cluster.Id))
+	if cluster.CreatedAt != nil {
+		h.Write([]byte(cluster.CreatedAt.UTC().Format(time.RFC3339)))
+	}
+	return fmt.Sprintf("delete-%s-%s", cluster.Name, hex.EncodeToString(h.Sum(nil))[:8])
+}
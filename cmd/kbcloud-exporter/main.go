@@ -0,0 +1,65 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Command kbcloud-exporter serves the fleet state of KubeBlocks Cloud
+// organizations as Prometheus metrics.
+//
+// Credentials are read from KB_CLOUD_API_KEY_NAME and KB_CLOUD_API_KEY_SECRET,
+// and the site from KB_CLOUD_SITE, like the rest of the client.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/exporter"
+)
+
+func main() {
+	var (
+		listen      = flag.String("listen", ":9101", "address to serve metrics on")
+		metricsPath = flag.String("path", "/metrics", "path to serve metrics on")
+		orgs        = flag.String("orgs", "", "comma-separated organizations to export")
+		server      = flag.String("server", "", "API server URL, overriding the configured site")
+		cacheTTL    = flag.Duration("cache-ttl", time.Minute, "how long upstream data is reused across scrapes")
+		rps         = flag.Float64("rps", 5, "maximum upstream requests per second")
+		concurrency = flag.Int("concurrency", 4, "clusters whose instance metrics are fetched concurrently")
+		timeout     = flag.Duration("timeout", 30*time.Second, "timeout of a refresh of all organizations")
+		noInstances = flag.Bool("skip-instance-metrics", false, "skip per-instance CPU, memory and disk metrics")
+	)
+	flag.Parse()
+	if *orgs == "" {
+		log.Fatal("-orgs is required")
+	}
+
+	cfg := common.NewConfiguration()
+	if *server != "" {
+		cfg.Servers = common.ServerConfigurations{{URL: strings.TrimSuffix(*server, "/")}}
+	}
+	client := common.NewAPIClient(cfg)
+
+	collector := exporter.NewCollector(common.NewDefaultContext(context.Background()), client, exporter.Options{
+		Orgs:                strings.Split(*orgs, ","),
+		CacheTTL:            *cacheTTL,
+		RequestsPerSecond:   *rps,
+		Concurrency:         *concurrency,
+		Timeout:             *timeout,
+		SkipInstanceMetrics: *noInstances,
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	http.Handle(*metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	log.Printf("serving metrics on %s%s", *listen, *metricsPath)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
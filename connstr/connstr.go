@@ -0,0 +1,234 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package connstr turns cluster endpoints and accounts into ready-to-use,
+// engine specific connection strings.
+package connstr
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// Engine is a database engine family with its own connection string format.
+type Engine string
+
+// List of Engine.
+const (
+	EngineMySQL      Engine = "mysql"
+	EnginePostgreSQL Engine = "postgresql"
+	EngineRedis      Engine = "redis"
+	EngineMongoDB    Engine = "mongodb"
+	EngineKafka      Engine = "kafka"
+)
+
+// ErrNoEndpoint is returned when no endpoint matches the requested options.
+var ErrNoEndpoint = errors.New("no matching endpoint")
+
+// EngineOf maps a cluster engine name, such as "apecloud-mysql", to its engine family.
+func EngineOf(name string) (Engine, error) {
+	n := strings.ToLower(name)
+	switch {
+	case strings.Contains(n, "mysql"), strings.Contains(n, "mariadb"):
+		return EngineMySQL, nil
+	case strings.Contains(n, "postgres"), strings.Contains(n, "orioledb"):
+		return EnginePostgreSQL, nil
+	case strings.Contains(n, "redis"):
+		return EngineRedis, nil
+	case strings.Contains(n, "mongo"):
+		return EngineMongoDB, nil
+	case strings.Contains(n, "kafka"):
+		return EngineKafka, nil
+	}
+	return "", fmt.Errorf("unsupported engine %q", name)
+}
+
+// Options selects the endpoint and credentials used to build a connection string.
+type Options struct {
+	// Component restricts endpoints to a cluster component.
+	Component string
+	// NetworkType selects internal (Intranet, the default) or public (Internet) endpoints.
+	NetworkType kbcloud.EndpointNetworkType
+	// ReadOnly selects the read-only port instead of the primary one.
+	ReadOnly bool
+	// Username is the account to connect with.
+	Username string
+	// Password of the account. When empty it is taken from the account DSN, if available.
+	Password string
+	// Database is the default database, or the Redis database number.
+	Database string
+	// TLS enables TLS using the cluster certificates.
+	TLS bool
+	// TLSDir is where certificate files are written for drivers that need file paths.
+	// Without it, PostgreSQL and MongoDB encrypt without verifying the server.
+	TLSDir string
+	// Params are extra driver parameters appended to the connection string.
+	Params map[string]string
+}
+
+// Conn is a ready-to-use connection string.
+type Conn struct {
+	Engine Engine
+	// Driver is the database/sql driver name matching DSN, empty for non-SQL engines.
+	Driver string
+	// DSN is the connection string.
+	DSN string
+	// Endpoint is the endpoint the DSN points to.
+	Endpoint kbcloud.Endpoint
+	// TLSConfig holds the client TLS configuration when TLS is enabled. MySQL
+	// users register it with the driver under TLSConfigName.
+	TLSConfig *tls.Config
+}
+
+// Builder builds connection strings for clusters.
+type Builder struct {
+	clusterApi *kbcloud.ClusterApi
+	accountApi *kbcloud.AccountApi
+	tlsApi     *kbcloud.TlsApi
+}
+
+// NewBuilder returns a Builder using client.
+func NewBuilder(client *common.APIClient) *Builder {
+	return &Builder{
+		clusterApi: kbcloud.NewClusterApi(client),
+		accountApi: kbcloud.NewAccountApi(client),
+		tlsApi:     kbcloud.NewTlsApi(client),
+	}
+}
+
+// Build looks up the cluster endpoints, account and certificates and returns a connection string.
+func (b *Builder) Build(ctx context.Context, orgName, clusterName string, opts Options) (*Conn, error) {
+	cluster, _, err := b.clusterApi.GetCluster(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("get cluster: %w", err)
+	}
+	engine, err := EngineOf(cluster.Engine)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, _, err := b.clusterApi.ListEndpoints(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("list endpoints: %w", err)
+	}
+	ep, err := SelectEndpoint(endpoints.Items, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Username != "" && opts.Password == "" {
+		dsn, _, err := b.accountApi.GetDSN(ctx, orgName, clusterName, opts.Username)
+		if err != nil {
+			return nil, fmt.Errorf("get dsn of account %s: %w", opts.Username, err)
+		}
+		opts.Password = passwordFromDSN(dsn)
+	}
+
+	var certs *Certificates
+	if opts.TLS {
+		if !cluster.GetTlsEnabled() {
+			return nil, fmt.Errorf("cluster %s does not have TLS enabled", clusterName)
+		}
+		list, _, err := b.tlsApi.GetTLSCertificate(ctx, orgName, clusterName)
+		if err != nil {
+			return nil, fmt.Errorf("get tls certificate: %w", err)
+		}
+		certs = certificatesFor(list, ep.Component)
+	}
+
+	return Format(engine, ep, opts, certs)
+}
+
+// SelectEndpoint picks the endpoint matching the component, network type and
+// primary or read-only role requested by opts.
+func SelectEndpoint(endpoints []kbcloud.Endpoint, opts Options) (kbcloud.Endpoint, error) {
+	network := opts.NetworkType
+	if network == "" {
+		network = kbcloud.EndpointNetworkTypeIntranet
+	}
+	var candidates []kbcloud.Endpoint
+	for _, ep := range endpoints {
+		if ep.NetworkType != network || len(ep.Hosts) == 0 {
+			continue
+		}
+		if opts.Component != "" && ep.Component != opts.Component {
+			continue
+		}
+		if isReadOnly(ep) != opts.ReadOnly {
+			continue
+		}
+		candidates = append(candidates, ep)
+	}
+	if len(candidates) == 0 {
+		role := "primary"
+		if opts.ReadOnly {
+			role = "read-only"
+		}
+		return kbcloud.Endpoint{}, fmt.Errorf("%w: %s %s endpoint", ErrNoEndpoint, strings.ToLower(string(network)), role)
+	}
+	// Prefer stable addresses: load balancers, then cluster IPs, then node ports.
+	rank := map[kbcloud.EndpointType]int{
+		kbcloud.EndpointTypeLoadBalancer: 0,
+		kbcloud.EndpointTypeClusterIp:    1,
+		kbcloud.EndpointTypeNodePort:     2,
+	}
+	best := candidates[0]
+	for _, ep := range candidates[1:] {
+		if rank[ep.Type] < rank[best.Type] {
+			best = ep
+		}
+	}
+	return best, nil
+}
+
+// isReadOnly reports whether the endpoint serves read-only traffic, based on
+// the role tokens of its port and service naming, such as "mysql-ro" or
+// "Read-Only". Names merely containing a role word, like "replication", do not count.
+func isReadOnly(ep kbcloud.Endpoint) bool {
+	for _, s := range []string{ep.PortName, ep.ServiceName, ep.Title} {
+		tokens := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for i, token := range tokens {
+			switch token {
+			case "ro", "readonly", "replica", "replicas":
+				return true
+			case "read":
+				if i+1 < len(tokens) && tokens[i+1] == "only" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// passwordFromDSN extracts the password from a URL or go-sql-driver style DSN, if present.
+func passwordFromDSN(dsn string) string {
+	dsn = strings.TrimSpace(dsn)
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if p, ok := u.User.Password(); ok {
+			return p
+		}
+	}
+	at := strings.LastIndex(dsn, "@")
+	if at < 0 {
+		return ""
+	}
+	userinfo := dsn[:at]
+	if i := strings.Index(userinfo, "://"); i >= 0 {
+		userinfo = userinfo[i+3:]
+	}
+	if i := strings.Index(userinfo, ":"); i >= 0 {
+		return userinfo[i+1:]
+	}
+	return ""
+}
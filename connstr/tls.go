@@ -0,0 +1,102 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package connstr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// TLSConfigName is the name under which MySQL users register Conn.TLSConfig with
+// the driver, e.g. mysql.RegisterTLSConfig(connstr.TLSConfigName, conn.TLSConfig).
+const TLSConfigName = "kbcloud"
+
+// Certificates holds the PEM encoded certificates of a cluster component.
+type Certificates struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+}
+
+// certificatesFor returns the certificates of component, or of the first component listed.
+func certificatesFor(certs []kbcloud.TlsCert, component string) *Certificates {
+	var picked *kbcloud.TlsConfig
+	for _, c := range certs {
+		if c.TlsConfig == nil {
+			continue
+		}
+		if picked == nil || c.GetComponentName() == component {
+			picked = c.TlsConfig
+		}
+	}
+	if picked == nil {
+		return &Certificates{}
+	}
+	return &Certificates{
+		CACert:     picked.GetCaCert(),
+		ClientCert: picked.GetClientCert(),
+		ClientKey:  picked.GetClientKey(),
+	}
+}
+
+// Config returns a client TLS configuration trusting the cluster CA and, when
+// available, presenting the client certificate.
+func (c *Certificates) Config(serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if c.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New("invalid CA certificate")
+		}
+		cfg.RootCAs = pool
+	}
+	if c.ClientCert != "" && c.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// CertificateFiles are the paths of certificates written to disk; empty paths were not written.
+type CertificateFiles struct {
+	CA, Cert, Key string
+}
+
+// WriteFiles writes the certificates as ca.crt, client.crt and client.key into dir.
+func (c *Certificates) WriteFiles(dir string) (CertificateFiles, error) {
+	var files CertificateFiles
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return files, err
+	}
+	write := func(name, content string, target *string) error {
+		if content == "" {
+			return nil
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			return err
+		}
+		*target = path
+		return nil
+	}
+	if err := write("ca.crt", c.CACert, &files.CA); err != nil {
+		return files, err
+	}
+	if err := write("client.crt", c.ClientCert, &files.Cert); err != nil {
+		return files, err
+	}
+	if err := write("client.key", c.ClientKey, &files.Key); err != nil {
+		return files, err
+	}
+	return files, nil
+}
@@ -0,0 +1,206 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	_nethttp "net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// EventTypePrefix prefixes the type of the CloudEvents of operation events.
+const EventTypePrefix = "com.apecloud.kbcloud.event."
+
+// CloudEvent is a CloudEvents 1.0 event in JSON format.
+type CloudEvent struct {
+	SpecVersion     string        `json:"specversion"`
+	Id              string        `json:"id"`
+	Source          string        `json:"source"`
+	Type            string        `json:"type"`
+	Subject         string        `json:"subject,omitempty"`
+	Time            *time.Time    `json:"time,omitempty"`
+	DataContentType string        `json:"datacontenttype"`
+	Data            kbcloud.Event `json:"data"`
+}
+
+// ToCloudEvent converts an operation event of orgName. The type is
+// EventTypePrefix followed by the resource type and event name, e.g.
+// com.apecloud.kbcloud.event.cluster.Restart, and the subject is the resource.
+func ToCloudEvent(orgName string, e kbcloud.Event) CloudEvent {
+	ce := CloudEvent{
+		SpecVersion:     "1.0",
+		Id:              Key(e),
+		Source:          "/organizations/" + orgName,
+		Type:            EventTypePrefix + typeSegment(string(e.GetResourceType())) + "." + typeSegment(e.GetEventName()),
+		DataContentType: "application/json",
+		Data:            e,
+	}
+	if e.GetResourceName() != "" {
+		ce.Subject = fmt.Sprintf("%s/%s", e.GetResourceType(), e.GetResourceName())
+	}
+	if t := createdAt(e); !t.IsZero() {
+		ce.Time = &t
+	}
+	return ce
+}
+
+func typeSegment(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return strings.NewReplacer(" ", "", "/", "-").Replace(s)
+}
+
+// Sink receives forwarded events.
+type Sink interface {
+	Send(ctx context.Context, e CloudEvent) error
+}
+
+// Forward returns a Watch callback sending every event of orgName to sink.
+func Forward(ctx context.Context, sink Sink, orgName string) func(kbcloud.Event) error {
+	return func(e kbcloud.Event) error {
+		return sink.Send(ctx, ToCloudEvent(orgName, e))
+	}
+}
+
+// Format is the encoding of events written by a WriterSink.
+type Format string
+
+// List of Format.
+const (
+	// FormatJSONL writes one event per line.
+	FormatJSONL Format = "jsonl"
+	// FormatJSON writes every event as an indented JSON document.
+	FormatJSON Format = "json"
+)
+
+// WriterSink writes events to an io.Writer, such as os.Stdout.
+type WriterSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format Format
+}
+
+var _ Sink = (*WriterSink)(nil)
+
+// NewWriterSink returns a Sink writing events to w in format.
+func NewWriterSink(w io.Writer, format Format) *WriterSink {
+	return &WriterSink{w: w, format: format}
+}
+
+// Send writes the event.
+func (s *WriterSink) Send(ctx context.Context, e CloudEvent) error {
+	data, err := encode(e, s.format)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(data)
+	return err
+}
+
+// FileSink appends events to a file as JSON lines.
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+var _ Sink = (*FileSink)(nil)
+
+// NewFileSink returns a Sink appending events to the file at path.
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+// Send appends the event and syncs the file, so a forwarded event is on disk
+// before the watcher saves its cursor.
+func (s *FileSink) Send(ctx context.Context, e CloudEvent) error {
+	data, err := encode(e, FormatJSONL)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// HTTPSink posts events to a webhook in the CloudEvents structured content mode.
+type HTTPSink struct {
+	url     string
+	client  *_nethttp.Client
+	headers map[string]string
+}
+
+var _ Sink = (*HTTPSink)(nil)
+
+// NewHTTPSink returns a Sink posting events to url with client, adding
+// headers, such as an authorization header, to every request. A nil client
+// uses http.DefaultClient.
+func NewHTTPSink(url string, client *_nethttp.Client, headers map[string]string) *HTTPSink {
+	if client == nil {
+		client = _nethttp.DefaultClient
+	}
+	return &HTTPSink{url: url, client: client, headers: headers}
+}
+
+// Send posts the event. Responses outside the 2xx range are errors.
+func (s *HTTPSink) Send(ctx context.Context, e CloudEvent) error {
+	data, err := common.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := _nethttp.NewRequestWithContext(ctx, _nethttp.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("send event %s: %s: %s", e.Id, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+func encode(e CloudEvent, format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := common.NewEncoder(&buf)
+	if format == FormatJSON {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,113 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package events
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+)
+
+// Cursor is the position of a watcher in the event stream: the creation time
+// of the newest event emitted and the keys of the events emitted within the
+// overlap window before it, which are queried again. Start is where the
+// watcher started; events before it are never emitted.
+type Cursor struct {
+	Time  time.Time `json:"time"`
+	Seen  []string  `json:"seen,omitempty"`
+	Start time.Time `json:"start,omitempty"`
+}
+
+// CursorStore persists the cursor of a watcher across restarts.
+type CursorStore interface {
+	// Load returns the saved cursor, or a zero Cursor if none was saved.
+	Load(ctx context.Context) (Cursor, error)
+	// Save replaces the saved cursor.
+	Save(ctx context.Context, c Cursor) error
+}
+
+// MemoryCursorStore keeps the cursor in memory.
+type MemoryCursorStore struct {
+	mu     sync.Mutex
+	cursor Cursor
+}
+
+var _ CursorStore = (*MemoryCursorStore)(nil)
+
+// Load returns the cursor.
+func (s *MemoryCursorStore) Load(ctx context.Context) (Cursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cursor, nil
+}
+
+// Save stores a copy of c.
+func (s *MemoryCursorStore) Save(ctx context.Context, c Cursor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursor = Cursor{Time: c.Time, Seen: append([]string(nil), c.Seen...), Start: c.Start}
+	return nil
+}
+
+// FileCursorStore keeps the cursor in a JSON file.
+type FileCursorStore struct {
+	path string
+}
+
+var _ CursorStore = (*FileCursorStore)(nil)
+
+// NewFileCursorStore returns a CursorStore keeping the cursor in the file at path.
+func NewFileCursorStore(path string) *FileCursorStore {
+	return &FileCursorStore{path: path}
+}
+
+// Load reads the file. A missing file is a zero Cursor.
+func (s *FileCursorStore) Load(ctx context.Context) (Cursor, error) {
+	var c Cursor
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	err = common.Unmarshal(data, &c)
+	return c, err
+}
+
+// Save writes the cursor to a temporary file and renames it into place, so
+// the file always holds a complete cursor.
+func (s *FileCursorStore) Save(ctx context.Context, c Cursor) error {
+	data, err := common.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), ".tmp-"+filepath.Base(s.path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
@@ -0,0 +1,226 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package events turns the operation events of an organization into a stream:
+// a watcher polls the event API from a persisted cursor and emits every event
+// once, and sinks forward the events as CloudEvents.
+package events
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// WatchOptions configures a Watcher.
+type WatchOptions struct {
+	// Filter restricts the events queried. Its Start and End are ignored.
+	Filter kbcloud.QueryClusterEventsOptionalParameters
+	// Store persists the cursor. Defaults to a MemoryCursorStore.
+	Store CursorStore
+	// StartAt is where a watcher without a saved cursor starts. Defaults to now.
+	StartAt time.Time
+	// PollInterval is how often events are queried. Defaults to 10s.
+	PollInterval time.Duration
+	// Overlap is how far before the cursor events are queried again, to catch
+	// events recorded late. Defaults to 1m.
+	Overlap time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Watcher emits the operation events of an organization.
+type Watcher struct {
+	eventApi *kbcloud.EventApi
+	orgName  string
+	opts     WatchOptions
+}
+
+// NewWatcher returns a Watcher for the events of orgName using client.
+func NewWatcher(client *common.APIClient, orgName string, opts WatchOptions) *Watcher {
+	if opts.Store == nil {
+		opts.Store = &MemoryCursorStore{}
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 10 * time.Second
+	}
+	if opts.Overlap <= 0 {
+		opts.Overlap = time.Minute
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Watcher{eventApi: kbcloud.NewEventApi(client), orgName: orgName, opts: opts}
+}
+
+// Watch calls fn with every new event, oldest first, until fn returns an
+// error, the event API fails or ctx is done. The cursor is saved after each
+// event fn accepts, so a restarted watcher continues after it; an event whose
+// fn call was interrupted by a crash is emitted again. A watcher without a
+// saved cursor emits no event from before StartAt, even within the overlap.
+func (w *Watcher) Watch(ctx context.Context, fn func(kbcloud.Event) error) error {
+	cursor, err := w.opts.Store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load event cursor: %w", err)
+	}
+	if cursor.Time.IsZero() {
+		cursor.Time = w.opts.StartAt
+		if cursor.Time.IsZero() {
+			cursor.Time = w.opts.Now()
+		}
+		cursor.Start = cursor.Time
+	}
+	seen := map[string]bool{}
+	for _, key := range cursor.Seen {
+		seen[key] = true
+	}
+
+	return wait.Poll(ctx, w.opts.PollInterval, 0, func(ctx context.Context) (bool, error) {
+		events, err := w.query(ctx, cursor.Time.Add(-w.opts.Overlap), w.opts.Now())
+		if err != nil {
+			return false, err
+		}
+		for _, e := range events {
+			key := Key(e.Event)
+			if seen[key] || e.at.Before(cursor.Time.Add(-w.opts.Overlap)) || e.at.Before(cursor.Start) {
+				continue
+			}
+			if err := fn(e.Event); err != nil {
+				return false, err
+			}
+			seen[key] = true
+			if e.at.After(cursor.Time) {
+				cursor.Time = e.at
+			}
+			cursor.Seen = w.prune(seen, events, cursor.Time)
+			if err := w.opts.Store.Save(ctx, cursor); err != nil {
+				return false, fmt.Errorf("save event cursor: %w", err)
+			}
+		}
+		return false, nil
+	})
+}
+
+// Events watches in a goroutine. The event channel is closed when the watcher
+// stops; the error channel then yields its error, if any.
+func (w *Watcher) Events(ctx context.Context) (<-chan kbcloud.Event, <-chan error) {
+	out := make(chan kbcloud.Event)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(out)
+		err := w.Watch(ctx, func(e kbcloud.Event) error {
+			select {
+			case out <- e:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return out, errc
+}
+
+// timedEvent is an event with the time it is ordered by.
+type timedEvent struct {
+	kbcloud.Event
+	at time.Time
+}
+
+// query returns the events created in [start, end], oldest first. Events
+// without a creation or start time keep their place in the server order: they
+// take the time of the nearest older dated event, or of the oldest one when
+// none is older, or end when no event is dated.
+func (w *Watcher) query(ctx context.Context, start, end time.Time) ([]timedEvent, error) {
+	params := w.opts.Filter
+	params.Start = common.PtrInt64(start.Unix())
+	params.End = common.PtrInt64(end.Unix() + 1)
+	list, _, err := w.eventApi.QueryClusterEvents(ctx, w.orgName, params)
+	if err != nil {
+		return nil, fmt.Errorf("query events: %w", err)
+	}
+	events := make([]timedEvent, 0, len(list.Items))
+	var first, last time.Time
+	for _, e := range list.Items {
+		if t := createdAt(e); !t.IsZero() {
+			if first.IsZero() {
+				first = t
+			}
+			last = t
+		}
+		events = append(events, timedEvent{Event: e})
+	}
+	if !first.Before(last) {
+		// The API lists the newest events first; an ascending listing is kept as is.
+		for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+			events[i], events[j] = events[j], events[i]
+		}
+	}
+	at := end
+	for _, e := range events {
+		if t := createdAt(e.Event); !t.IsZero() {
+			at = t
+			break
+		}
+	}
+	for i := range events {
+		if t := createdAt(events[i].Event); !t.IsZero() {
+			at = t
+		}
+		events[i].at = at
+	}
+	// Events of the same time keep the order of the listing, oldest first.
+	sort.SliceStable(events, func(i, j int) bool { return events[i].at.Before(events[j].at) })
+	return events, nil
+}
+
+// prune drops the keys of events before the overlap window of cursor and
+// returns the remaining keys. The query starts at the window, so events
+// missing from it are out of the window too.
+func (w *Watcher) prune(seen map[string]bool, events []timedEvent, cursor time.Time) []string {
+	horizon := cursor.Add(-w.opts.Overlap)
+	keep := map[string]bool{}
+	for _, e := range events {
+		if key := Key(e.Event); seen[key] && !e.at.Before(horizon) {
+			keep[key] = true
+		}
+	}
+	keys := make([]string, 0, len(keep))
+	for key := range seen {
+		if keep[key] {
+			keys = append(keys, key)
+		} else {
+			delete(seen, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Key identifies an event: its Id, or its creation time, resource and name
+// when it has no Id.
+func Key(e kbcloud.Event) string {
+	if id := e.GetId(); id != "" {
+		return id
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", createdAt(e).UTC().Format(time.RFC3339Nano), e.GetResourceType(), e.GetResourceId(), e.GetEventName())
+}
+
+func createdAt(e kbcloud.Event) time.Time {
+	if e.CreatedAt != nil {
+		return *e.CreatedAt
+	}
+	if e.Start != nil {
+		return *e.Start
+	}
+	return time.Time{}
+}
@@ -0,0 +1,193 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package events
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// eventStandIn serves the events created in the requested range.
+type eventStandIn struct {
+	mu     sync.Mutex
+	events []kbcloud.Event
+}
+
+func (s *eventStandIn) add(id string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rt := kbcloud.EventResourceType("cluster")
+	s.events = append(s.events, kbcloud.Event{
+		Id: common.PtrString(id), CreatedAt: &at, ResourceType: &rt,
+		ResourceName: common.PtrString("db"), EventName: common.PtrString("Restart"),
+	})
+}
+
+// addUndated adds an event without creation and start time.
+func (s *eventStandIn) addUndated(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, kbcloud.Event{Id: common.PtrString(id), EventName: common.PtrString("Restart")})
+}
+
+func (s *eventStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+	end, _ := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+	s.mu.Lock()
+	list := kbcloud.EventList{Items: []kbcloud.Event{}}
+	// Newest first, as the API lists them. Undated events are always listed.
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if e := s.events[i]; e.CreatedAt == nil || e.CreatedAt.Unix() >= start && e.CreatedAt.Unix() <= end {
+			list.Items = append(list.Items, e)
+		}
+	}
+	s.mu.Unlock()
+	apitest.WriteJSON(w, http.StatusOK, list)
+}
+
+// watchIDs runs a watcher for a few polls and returns the ids of the events it emitted.
+func watchIDs(t *testing.T, s *eventStandIn, opts WatchOptions) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	polls := 0
+	now := opts.Now
+	opts.PollInterval = time.Millisecond
+	opts.Now = func() time.Time {
+		if polls++; polls > 6 {
+			cancel()
+		}
+		return now()
+	}
+	var ids []string
+	err := NewWatcher(apitest.NewClient(t, s), "org", opts).Watch(ctx, func(e kbcloud.Event) error {
+		ids = append(ids, e.GetId())
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("watch stopped with %v", err)
+	}
+	return ids
+}
+
+func TestWatchResumes(t *testing.T) {
+	base := time.Unix(1700000000, 0).UTC()
+	s := &eventStandIn{}
+	s.add("e1", base.Add(-time.Hour))
+	s.add("e2", base.Add(time.Second))
+	s.add("e3", base.Add(time.Second))
+	client := apitest.NewClient(t, s)
+
+	dir := t.TempDir()
+	store := NewFileCursorStore(filepath.Join(dir, "cursor.json"))
+	sink := NewFileSink(filepath.Join(dir, "events.jsonl"))
+	now := base.Add(time.Minute)
+	opts := WatchOptions{Store: store, StartAt: base, PollInterval: time.Millisecond, Now: func() time.Time { return now }}
+
+	// watch runs a watcher until it has forwarded n events and a few more polls went by.
+	watch := func(n int) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		forward := Forward(ctx, sink, "org")
+		forwarded, polls := 0, 0
+		w := NewWatcher(client, "org", opts)
+		w.opts.Now = func() time.Time {
+			if forwarded >= n {
+				if polls++; polls > 3 {
+					cancel()
+				}
+			}
+			return now
+		}
+		err := w.Watch(ctx, func(e kbcloud.Event) error {
+			forwarded++
+			return forward(e)
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("watch stopped with %v", err)
+		}
+		if forwarded != n {
+			t.Fatalf("forwarded %d events, want %d", forwarded, n)
+		}
+	}
+
+	watch(2)
+	s.add("e4", base.Add(2*time.Second))
+	watch(1)
+
+	f, err := os.Open(filepath.Join(dir, "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ce CloudEvent
+		if err := common.Unmarshal(scanner.Bytes(), &ce); err != nil {
+			t.Fatal(err)
+		}
+		if ce.Type != "com.apecloud.kbcloud.event.cluster.Restart" || ce.Subject != "cluster/db" || ce.SpecVersion != "1.0" {
+			t.Errorf("unexpected cloud event %+v", ce)
+		}
+		ids = append(ids, ce.Id)
+	}
+	if got := fmt.Sprint(ids); got != "[e2 e3 e4]" {
+		t.Errorf("forwarded %s, want [e2 e3 e4]", got)
+	}
+}
+
+func TestWatchStartsAtStartAt(t *testing.T) {
+	base := time.Unix(1700000000, 0).UTC()
+	s := &eventStandIn{}
+	// Within the overlap before StartAt, but before the watcher started.
+	s.add("early", base.Add(-30*time.Second))
+	s.add("e1", base)
+	s.add("e2", base.Add(time.Second))
+	store := &MemoryCursorStore{}
+	now := func() time.Time { return base.Add(time.Minute) }
+	if got := fmt.Sprint(watchIDs(t, s, WatchOptions{Store: store, StartAt: base, Now: now})); got != "[e1 e2]" {
+		t.Errorf("emitted %s, want [e1 e2]", got)
+	}
+
+	// A resumed watcher does query the overlap, and emits events recorded late.
+	s.add("late", base.Add(500*time.Millisecond))
+	if got := fmt.Sprint(watchIDs(t, s, WatchOptions{Store: store, StartAt: base, Now: now})); got != "[late]" {
+		t.Errorf("emitted %s after resuming, want [late]", got)
+	}
+}
+
+func TestWatchUndatedEvents(t *testing.T) {
+	base := time.Unix(1700000000, 0).UTC()
+	s := &eventStandIn{}
+	s.add("e1", base.Add(time.Second))
+	s.addUndated("u1")
+	s.add("e2", base.Add(2*time.Second))
+	s.addUndated("u2")
+	now := func() time.Time { return base.Add(time.Minute) }
+	// Undated events are emitted once, in the server order of their neighbours.
+	if got := fmt.Sprint(watchIDs(t, s, WatchOptions{StartAt: base, Now: now})); got != "[e1 u1 e2 u2]" {
+		t.Errorf("emitted %s, want [e1 u1 e2 u2]", got)
+	}
+
+	s = &eventStandIn{}
+	s.addUndated("u1")
+	if got := fmt.Sprint(watchIDs(t, s, WatchOptions{StartAt: base, Now: now})); got != "[u1]" {
+		t.Errorf("emitted %s, want [u1]", got)
+	}
+}
@@ -0,0 +1,280 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package exporter exposes the state of a KubeBlocks Cloud fleet as
+// Prometheus metrics: clusters, instance usage, backups, alerts and
+// disaster recovery replication delay.
+package exporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+const namespace = "kbcloud"
+
+var (
+	clustersDesc = prometheus.NewDesc(namespace+"_clusters",
+		"Number of clusters by engine, environment and status.",
+		[]string{"org", "engine", "environment", "status"}, nil)
+	instanceCPUDesc = prometheus.NewDesc(namespace+"_instance_cpu_usage_cores",
+		"CPU usage of a cluster instance in cores.",
+		[]string{"org", "cluster", "instance"}, nil)
+	instanceMemoryDesc = prometheus.NewDesc(namespace+"_instance_memory_usage_bytes",
+		"Memory usage of a cluster instance in bytes.",
+		[]string{"org", "cluster", "instance"}, nil)
+	instanceDiskDesc = prometheus.NewDesc(namespace+"_instance_disk_usage_bytes",
+		"Disk usage of a cluster instance in bytes.",
+		[]string{"org", "cluster", "instance"}, nil)
+	backupsDesc = prometheus.NewDesc(namespace+"_backups",
+		"Number of backups by status.",
+		[]string{"org", "status"}, nil)
+	backupsByEngineDesc = prometheus.NewDesc(namespace+"_backups_by_engine",
+		"Number of backups by engine.",
+		[]string{"org", "engine"}, nil)
+	backupSizeByEngineDesc = prometheus.NewDesc(namespace+"_backup_size_by_engine_bytes",
+		"Total size of backups by engine in bytes.",
+		[]string{"org", "engine"}, nil)
+	backupsByTypeDesc = prometheus.NewDesc(namespace+"_backups_by_type",
+		"Number of backups by backup type.",
+		[]string{"org", "type"}, nil)
+	backupSizeByTypeDesc = prometheus.NewDesc(namespace+"_backup_size_by_type_bytes",
+		"Total size of backups by backup type in bytes.",
+		[]string{"org", "type"}, nil)
+	lastBackupAgeDesc = prometheus.NewDesc(namespace+"_cluster_last_successful_backup_age_seconds",
+		"Time since the last completed backup of a cluster.",
+		[]string{"org", "cluster"}, nil)
+	alertsFiringDesc = prometheus.NewDesc(namespace+"_alerts_firing",
+		"Number of firing alerts by cluster and severity.",
+		[]string{"org", "cluster", "severity"}, nil)
+	replicationDelayDesc = prometheus.NewDesc(namespace+"_dr_replication_delay_seconds",
+		"Replication delay of a disaster recovery cluster behind its parent.",
+		[]string{"org", "cluster", "parent"}, nil)
+	instanceMetricsUpDesc = prometheus.NewDesc(namespace+"_exporter_instance_metrics_up",
+		"Whether the last refresh fetched the instance metrics of a cluster.",
+		[]string{"org", "cluster"}, nil)
+	upDesc = prometheus.NewDesc(namespace+"_exporter_up",
+		"Whether the last refresh of an organization succeeded.",
+		[]string{"org"}, nil)
+	refreshTimeDesc = prometheus.NewDesc(namespace+"_exporter_last_refresh_timestamp_seconds",
+		"Time of the last successful refresh of an organization.",
+		[]string{"org"}, nil)
+	refreshDurationDesc = prometheus.NewDesc(namespace+"_exporter_refresh_duration_seconds",
+		"Duration of the last refresh of an organization.",
+		[]string{"org"}, nil)
+)
+
+// Options configures a Collector.
+type Options struct {
+	// Orgs are the organizations to export.
+	Orgs []string
+	// CacheTTL is how long upstream data is reused across scrapes. Defaults to 1m.
+	CacheTTL time.Duration
+	// RequestsPerSecond limits the rate of upstream calls. Defaults to 5.
+	RequestsPerSecond float64
+	// Concurrency is the number of clusters whose instance metrics are fetched
+	// at the same time. Defaults to 4.
+	Concurrency int
+	// Timeout bounds a refresh of all organizations. Defaults to 30s.
+	Timeout time.Duration
+	// SkipInstanceMetrics skips the per-cluster instance metrics calls.
+	SkipInstanceMetrics bool
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Collector is a prometheus.Collector for the fleet state of organizations.
+type Collector struct {
+	ctx         context.Context
+	client      *common.APIClient
+	clusterApi  *kbcloud.ClusterApi
+	backupApi   *kbcloud.BackupApi
+	alertApi    *kbcloud.AlertObjectApi
+	opts        Options
+	limiter     *limiter
+	mu          sync.Mutex
+	refreshedAt time.Time
+	// refreshing is closed when the refresh in progress, if any, completes.
+	refreshing chan struct{}
+	// orgs is replaced as a whole by a refresh and never modified in place.
+	orgs map[string]orgState
+}
+
+// orgState is the cached state of an organization.
+type orgState struct {
+	samples     []sample
+	up          bool
+	refreshedAt time.Time
+	duration    time.Duration
+}
+
+type sample struct {
+	desc   *prometheus.Desc
+	value  float64
+	labels []string
+}
+
+// NewCollector returns a Collector using client. Upstream calls use ctx, which
+// carries the authentication, e.g. from common.NewDefaultContext.
+func NewCollector(ctx context.Context, client *common.APIClient, opts Options) *Collector {
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = time.Minute
+	}
+	if opts.RequestsPerSecond <= 0 {
+		opts.RequestsPerSecond = 5
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Collector{
+		ctx:        ctx,
+		client:     client,
+		clusterApi: kbcloud.NewClusterApi(client),
+		backupApi:  kbcloud.NewBackupApi(client),
+		alertApi:   kbcloud.NewAlertObjectApi(client),
+		opts:       opts,
+		limiter:    newLimiter(opts.RequestsPerSecond),
+		orgs:       map[string]orgState{},
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		clustersDesc, instanceCPUDesc, instanceMemoryDesc, instanceDiskDesc,
+		backupsDesc, backupsByEngineDesc, backupSizeByEngineDesc, backupsByTypeDesc, backupSizeByTypeDesc,
+		lastBackupAgeDesc, alertsFiringDesc, replicationDelayDesc,
+		instanceMetricsUpDesc, upDesc, refreshTimeDesc, refreshDurationDesc,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector. Upstream data is refreshed when
+// older than CacheTTL; concurrent scrapes share a refresh and export the
+// previous samples meanwhile, unless there are none yet. When the refresh of
+// an organization fails, its previous samples are exported and up is 0. When
+// only the instance metrics of a cluster fail, the cluster has no instance
+// samples and its instance metrics up is 0.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	orgs := c.snapshot()
+	for _, org := range c.opts.Orgs {
+		st, ok := orgs[org]
+		if !ok {
+			continue
+		}
+		for _, s := range st.samples {
+			ch <- prometheus.MustNewConstMetric(s.desc, prometheus.GaugeValue, s.value, s.labels...)
+		}
+		up := 0.0
+		if st.up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up, org)
+		if !st.refreshedAt.IsZero() {
+			ch <- prometheus.MustNewConstMetric(refreshTimeDesc, prometheus.GaugeValue, float64(st.refreshedAt.Unix()), org)
+		}
+		ch <- prometheus.MustNewConstMetric(refreshDurationDesc, prometheus.GaugeValue, st.duration.Seconds(), org)
+	}
+}
+
+// snapshot returns the cached state of the organizations, refreshing it first
+// when it is stale. The lock is not held while upstream is called.
+func (c *Collector) snapshot() map[string]orgState {
+	c.mu.Lock()
+	now := c.opts.Now()
+	orgs, done := c.orgs, c.refreshing
+	if now.Sub(c.refreshedAt) < c.opts.CacheTTL {
+		c.mu.Unlock()
+		return orgs
+	}
+	if done != nil {
+		c.mu.Unlock()
+		if len(orgs) > 0 {
+			return orgs
+		}
+		<-done
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.orgs
+	}
+	done = make(chan struct{})
+	c.refreshing = done
+	c.mu.Unlock()
+
+	orgs = c.refresh(now, orgs)
+	c.mu.Lock()
+	c.orgs, c.refreshedAt, c.refreshing = orgs, now, nil
+	c.mu.Unlock()
+	close(done)
+	return orgs
+}
+
+// refresh fetches the state of every organization and returns it, keeping the
+// samples of prev for the organizations that failed.
+func (c *Collector) refresh(now time.Time, prev map[string]orgState) map[string]orgState {
+	ctx, cancel := context.WithTimeout(c.ctx, c.opts.Timeout)
+	defer cancel()
+	orgs := make(map[string]orgState, len(c.opts.Orgs))
+	for _, org := range c.opts.Orgs {
+		st := prev[org]
+		started := time.Now()
+		samples, err := c.fetch(ctx, org, now)
+		st.duration = time.Since(started)
+		st.up = err == nil
+		if err == nil {
+			st.samples, st.refreshedAt = samples, now
+		}
+		orgs[org] = st
+	}
+	return orgs
+}
+
+// limiter spaces calls evenly at a fixed rate.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(perSecond float64) *limiter {
+	return &limiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next call is allowed or ctx is done.
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	d := at.Sub(now)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
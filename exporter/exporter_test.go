@@ -0,0 +1,216 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// fleetStandIn serves the fleet endpoints of a single organization.
+type fleetStandIn struct {
+	calls int32
+	down  atomic.Bool
+	// hold, when set, holds the cluster list requests until it is closed.
+	// held receives a value for every held request.
+	hold chan struct{}
+	held chan struct{}
+	// brokenCluster, when set, fails the instance metrics of that cluster.
+	brokenCluster string
+}
+
+func (s *fleetStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&s.calls, 1)
+	if s.down.Load() {
+		http.NotFound(w, r)
+		return
+	}
+	path := apitest.OrgPath(r, "org")
+	if s.hold != nil && path == "/clusters" {
+		s.held <- struct{}{}
+		<-s.hold
+	}
+	if s.brokenCluster != "" && path == "/clusters/"+s.brokenCluster+"/instances/metrics" {
+		http.Error(w, "metrics unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch path {
+	case "/clusters":
+		w.Write([]byte(`{"items":[
+			{"id":"1","name":"db","engine":"mysql","environmentName":"prod","status":"Running","cloudProvider":"aws","terminationPolicy":"Delete","version":"8.0","createdAt":"2024-01-01T00:00:00Z","updatedAt":"2024-01-01T00:00:00Z"},
+			{"id":"2","name":"db-dr","engine":"mysql","environmentName":"prod","status":"Running","cloudProvider":"aws","terminationPolicy":"Delete","version":"8.0","createdAt":"2024-01-01T00:00:00Z","updatedAt":"2024-01-01T00:00:00Z","parentName":"db","clusterType":"DisasterRecovery","delay":2.5}]}`))
+	case "/clusters/db/instances/metrics", "/clusters/db-dr/instances/metrics":
+		w.Write([]byte(`{"items":[{"instanceName":"mysql-0","cpuUsage":"500m","memoryUsage":"1.5","diskUsage":"10Gi"}]}`))
+	case "/backupStats":
+		w.Write([]byte(`{"backupStatsStatus":[{"status":"Completed","num":3},{"status":"Failed","num":1}],
+			"backupStatsEngine":[{"engine":"mysql","size":"2Gi","num":4}]}`))
+	case "/backups":
+		w.Write([]byte(`{"items":[
+			{"autoBackup":true,"backupMethod":"xtrabackup","backupPolicyName":"p","name":"n","orgName":"org","snapshotVolumes":false,"totalSize":"1Gi","retentionPeriod":"7d","cloudProvider":"aws","cloudRegion":"r","environmentName":"prod","engine":"mysql","id":"b1","sourceCluster":"db","status":"Completed","backupType":"Full","creationTimestamp":"2024-01-01T10:00:00Z","completionTimestamp":"2024-01-01T11:00:00Z"},
+			{"autoBackup":true,"backupMethod":"xtrabackup","backupPolicyName":"p","name":"n","orgName":"org","snapshotVolumes":false,"totalSize":"1Gi","retentionPeriod":"7d","cloudProvider":"aws","cloudRegion":"r","environmentName":"prod","engine":"mysql","id":"b2","sourceCluster":"db","status":"Failed","backupType":"Full","creationTimestamp":"2024-01-01T12:00:00Z"}]}`))
+	case "/alerts/objects":
+		w.Write([]byte(`{"items":[
+			{"clusterName":"db","severity":"critical","status":"firing"},
+			{"clusterName":"db","severity":"critical","status":"firing"},
+			{"clusterName":"db","severity":"warning","status":"resolved"}]}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	s := &fleetStandIn{}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCollector(context.Background(), apitest.NewClient(t, s), Options{
+		Orgs:              []string{"org"},
+		RequestsPerSecond: 1000,
+		Now:               func() time.Time { return now },
+	})
+
+	expected := `
+# HELP kbcloud_alerts_firing Number of firing alerts by cluster and severity.
+# TYPE kbcloud_alerts_firing gauge
+kbcloud_alerts_firing{cluster="db",org="org",severity="critical"} 2
+# HELP kbcloud_cluster_last_successful_backup_age_seconds Time since the last completed backup of a cluster.
+# TYPE kbcloud_cluster_last_successful_backup_age_seconds gauge
+kbcloud_cluster_last_successful_backup_age_seconds{cluster="db",org="org"} 3600
+# HELP kbcloud_clusters Number of clusters by engine, environment and status.
+# TYPE kbcloud_clusters gauge
+kbcloud_clusters{engine="mysql",environment="prod",org="org",status="Running"} 2
+# HELP kbcloud_dr_replication_delay_seconds Replication delay of a disaster recovery cluster behind its parent.
+# TYPE kbcloud_dr_replication_delay_seconds gauge
+kbcloud_dr_replication_delay_seconds{cluster="db-dr",org="org",parent="db"} 2.5
+# HELP kbcloud_instance_cpu_usage_cores CPU usage of a cluster instance in cores.
+# TYPE kbcloud_instance_cpu_usage_cores gauge
+kbcloud_instance_cpu_usage_cores{cluster="db",instance="mysql-0",org="org"} 0.5
+kbcloud_instance_cpu_usage_cores{cluster="db-dr",instance="mysql-0",org="org"} 0.5
+# HELP kbcloud_instance_memory_usage_bytes Memory usage of a cluster instance in bytes.
+# TYPE kbcloud_instance_memory_usage_bytes gauge
+kbcloud_instance_memory_usage_bytes{cluster="db",instance="mysql-0",org="org"} 1.610612736e+09
+kbcloud_instance_memory_usage_bytes{cluster="db-dr",instance="mysql-0",org="org"} 1.610612736e+09
+# HELP kbcloud_backups Number of backups by status.
+# TYPE kbcloud_backups gauge
+kbcloud_backups{org="org",status="Completed"} 3
+kbcloud_backups{org="org",status="Failed"} 1
+# HELP kbcloud_backup_size_by_engine_bytes Total size of backups by engine in bytes.
+# TYPE kbcloud_backup_size_by_engine_bytes gauge
+kbcloud_backup_size_by_engine_bytes{engine="mysql",org="org"} 2.147483648e+09
+# HELP kbcloud_exporter_up Whether the last refresh of an organization succeeded.
+# TYPE kbcloud_exporter_up gauge
+kbcloud_exporter_up{org="org"} 1
+`
+	names := []string{
+		"kbcloud_alerts_firing", "kbcloud_cluster_last_successful_backup_age_seconds", "kbcloud_clusters",
+		"kbcloud_dr_replication_delay_seconds", "kbcloud_instance_cpu_usage_cores", "kbcloud_instance_memory_usage_bytes",
+		"kbcloud_backups", "kbcloud_backup_size_by_engine_bytes", "kbcloud_exporter_up",
+	}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), names...); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second scrape within the cache TTL does not call upstream.
+	calls := atomic.LoadInt32(&s.calls)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), names...); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&s.calls); got != calls {
+		t.Errorf("cached scrape made %d upstream calls", got-calls)
+	}
+
+	// A failed refresh keeps the previous samples and reports the org as down.
+	s.down.Store(true)
+	now = now.Add(2 * time.Minute)
+	if n := testutil.CollectAndCount(c, "kbcloud_clusters"); n != 1 {
+		t.Errorf("got %d cluster series after a failed refresh, want 1", n)
+	}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP kbcloud_exporter_up Whether the last refresh of an organization succeeded.
+# TYPE kbcloud_exporter_up gauge
+kbcloud_exporter_up{org="org"} 0
+`), "kbcloud_exporter_up"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorInstanceMetricsFailure(t *testing.T) {
+	s := &fleetStandIn{brokenCluster: "db-dr"}
+	c := NewCollector(context.Background(), apitest.NewClient(t, s), Options{
+		Orgs:              []string{"org"},
+		RequestsPerSecond: 1000,
+	})
+
+	// The cluster without instance metrics does not fail the organization.
+	expected := `
+# HELP kbcloud_clusters Number of clusters by engine, environment and status.
+# TYPE kbcloud_clusters gauge
+kbcloud_clusters{engine="mysql",environment="prod",org="org",status="Running"} 2
+# HELP kbcloud_instance_cpu_usage_cores CPU usage of a cluster instance in cores.
+# TYPE kbcloud_instance_cpu_usage_cores gauge
+kbcloud_instance_cpu_usage_cores{cluster="db",instance="mysql-0",org="org"} 0.5
+# HELP kbcloud_exporter_instance_metrics_up Whether the last refresh fetched the instance metrics of a cluster.
+# TYPE kbcloud_exporter_instance_metrics_up gauge
+kbcloud_exporter_instance_metrics_up{cluster="db",org="org"} 1
+kbcloud_exporter_instance_metrics_up{cluster="db-dr",org="org"} 0
+# HELP kbcloud_exporter_up Whether the last refresh of an organization succeeded.
+# TYPE kbcloud_exporter_up gauge
+kbcloud_exporter_up{org="org"} 1
+`
+	names := []string{
+		"kbcloud_clusters", "kbcloud_instance_cpu_usage_cores",
+		"kbcloud_exporter_instance_metrics_up", "kbcloud_exporter_up",
+	}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), names...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorServesStaleSamplesDuringRefresh(t *testing.T) {
+	s := &fleetStandIn{}
+	var now atomic.Int64
+	now.Store(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).Unix())
+	c := NewCollector(context.Background(), apitest.NewClient(t, s), Options{
+		Orgs:                []string{"org"},
+		RequestsPerSecond:   1000,
+		SkipInstanceMetrics: true,
+		Now:                 func() time.Time { return time.Unix(now.Load(), 0) },
+	})
+	if n := testutil.CollectAndCount(c, "kbcloud_clusters"); n != 1 {
+		t.Fatalf("got %d cluster series, want 1", n)
+	}
+
+	s.hold, s.held = make(chan struct{}), make(chan struct{}, 1)
+	release := sync.OnceFunc(func() { close(s.hold) })
+	t.Cleanup(release)
+	now.Add(120)
+	refreshed := make(chan int)
+	go func() { refreshed <- testutil.CollectAndCount(c, "kbcloud_clusters") }()
+	<-s.held
+
+	// The refresh is stuck upstream; other scrapes get the previous samples.
+	scraped := make(chan int)
+	go func() { scraped <- testutil.CollectAndCount(c, "kbcloud_clusters") }()
+	select {
+	case n := <-scraped:
+		if n != 1 {
+			t.Errorf("got %d cluster series during a refresh, want 1", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("scrape blocked by the refresh in progress")
+	}
+	release()
+	if n := <-refreshed; n != 1 {
+		t.Errorf("got %d cluster series after the refresh, want 1", n)
+	}
+}
@@ -0,0 +1,210 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apiutil"
+)
+
+// fetch returns the samples of an organization.
+func (c *Collector) fetch(ctx context.Context, org string, now time.Time) ([]sample, error) {
+	var samples []sample
+	add := func(s sample) { samples = append(samples, s) }
+
+	if err := c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	clusters, _, err := c.clusterApi.ListCluster(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("list clusters: %w", err)
+	}
+	counts := map[[3]string]int{}
+	for _, cl := range clusters.Items {
+		counts[[3]string{cl.Engine, cl.EnvironmentName, cl.Status}]++
+		if delay, ok := cl.GetDelayOk(); ok && delay != nil {
+			add(sample{replicationDelayDesc, *delay, []string{org, cl.Name, cl.GetParentName()}})
+		}
+	}
+	for k, n := range counts {
+		add(sample{clustersDesc, float64(n), []string{org, k[0], k[1], k[2]}})
+	}
+
+	if !c.opts.SkipInstanceMetrics {
+		samples = append(samples, c.fetchInstances(ctx, org, clusters.Items)...)
+	}
+
+	if err := c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	stats, _, err := c.backupApi.GetBackupStats(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("get backup stats: %w", err)
+	}
+	for _, s := range stats.BackupStatsStatus {
+		add(sample{backupsDesc, float64(s.GetNum()), []string{org, s.GetStatus()}})
+	}
+	for _, s := range stats.BackupStatsEngine {
+		add(sample{backupsByEngineDesc, float64(s.GetNum()), []string{org, s.GetEngine()}})
+		if size, ok := parseQuantity(s.GetSize(), 1); ok {
+			add(sample{backupSizeByEngineDesc, size, []string{org, s.GetEngine()}})
+		}
+	}
+	for _, s := range stats.BackupStatsType {
+		add(sample{backupsByTypeDesc, float64(s.GetNum()), []string{org, s.GetType()}})
+		if size, ok := parseQuantity(s.GetSize(), 1); ok {
+			add(sample{backupSizeByTypeDesc, size, []string{org, s.GetType()}})
+		}
+	}
+
+	if err := c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	backups, _, err := c.backupApi.ListBackups(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+	last := map[string]time.Time{}
+	for _, b := range backups.Items {
+		if b.Status != kbcloud.BackupStatusCompleted {
+			continue
+		}
+		t := b.CreationTimestamp
+		if b.CompletionTimestamp != nil {
+			t = *b.CompletionTimestamp
+		}
+		for _, key := range []string{b.GetClusterId(), b.SourceCluster} {
+			if key != "" && t.After(last[key]) {
+				last[key] = t
+			}
+		}
+	}
+	for _, cl := range clusters.Items {
+		t, ok := last[cl.Id]
+		if !ok {
+			t, ok = last[cl.Name]
+		}
+		if ok {
+			add(sample{lastBackupAgeDesc, now.Sub(t).Seconds(), []string{org, cl.Name}})
+		}
+	}
+
+	if err := c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	alerts, _, err := c.alertApi.ListAlertObjects(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("list alert objects: %w", err)
+	}
+	firing := map[[2]string]int{}
+	for _, a := range alerts.Items {
+		if a.GetStatus() == kbcloud.AlertStatusFiring {
+			firing[[2]string{a.GetClusterName(), string(a.GetSeverity())}]++
+		}
+	}
+	for k, n := range firing {
+		add(sample{alertsFiringDesc, float64(n), []string{org, k[0], k[1]}})
+	}
+	return samples, nil
+}
+
+// fetchInstances returns the instance usage samples of the clusters of an
+// organization, fetching up to Concurrency clusters at the same time. A
+// cluster whose instance metrics cannot be fetched has no instance samples and
+// an instance metrics up sample of 0, so that it does not fail the organization.
+func (c *Collector) fetchInstances(ctx context.Context, org string, clusters []kbcloud.ClusterListItem) []sample {
+	var (
+		mu      sync.Mutex
+		samples []sample
+		wg      sync.WaitGroup
+	)
+	names := make(chan string)
+	for i := 0; i < c.opts.Concurrency; i++ {
+		// Each worker has its own client, as the API client is not safe for concurrent use.
+		clusterApi := kbcloud.NewClusterApi(apiutil.Clone(c.client))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				out, err := fetchClusterInstances(ctx, clusterApi, c.limiter, org, name)
+				up := 1.0
+				if err != nil {
+					out, up = nil, 0
+				}
+				mu.Lock()
+				samples = append(samples, out...)
+				samples = append(samples, sample{instanceMetricsUpDesc, up, []string{org, name}})
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, cl := range clusters {
+		names <- cl.Name
+	}
+	close(names)
+	wg.Wait()
+	return samples
+}
+
+func fetchClusterInstances(ctx context.Context, clusterApi *kbcloud.ClusterApi, limiter *limiter, org, cluster string) ([]sample, error) {
+	if err := limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	list, _, err := clusterApi.GetInstacesMetrics(ctx, org, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("get instance metrics of cluster %s: %w", cluster, err)
+	}
+	var samples []sample
+	for _, m := range list.Items {
+		labels := []string{org, cluster, m.InstanceName}
+		// CPU is reported in cores, memory and disk in Gi unless a unit is given.
+		if v, ok := parseQuantity(m.CpuUsage, 1); ok {
+			samples = append(samples, sample{instanceCPUDesc, v, labels})
+		}
+		if v, ok := parseQuantity(m.MemoryUsage, 1<<30); ok {
+			samples = append(samples, sample{instanceMemoryDesc, v, labels})
+		}
+		if v, ok := parseQuantity(m.DiskUsage, 1<<30); ok {
+			samples = append(samples, sample{instanceDiskDesc, v, labels})
+		}
+	}
+	return samples, nil
+}
+
+var quantitySuffixes = []struct {
+	suffix string
+	factor float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50}, {"Ei", 1 << 60},
+	{"k", 1e3}, {"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15}, {"E", 1e18}, {"m", 1e-3},
+}
+
+// parseQuantity parses a Kubernetes style quantity such as "1.5Gi" or "500m".
+// A number without a unit is multiplied by unit.
+func parseQuantity(s string, unit float64) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	factor := unit
+	for _, q := range quantitySuffixes {
+		if strings.HasSuffix(s, q.suffix) {
+			s, factor = strings.TrimSuffix(s, q.suffix), q.factor
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v * factor, true
+}
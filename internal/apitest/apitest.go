@@ -0,0 +1,53 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package apitest runs in-memory stand-ins of the KubeBlocks Cloud API for
+// the package tests of this module. Tests of the helper packages live next
+// to the code they cover, as they exercise unexported logic; the tests
+// module holds the recorded tests of the generated API.
+package apitest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+)
+
+// NewClient serves h until the test ends and returns a client of it.
+func NewClient(t testing.TB, h http.Handler) *common.APIClient {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	cfg := common.NewConfiguration()
+	cfg.Servers = common.ServerConfigurations{{URL: srv.URL}}
+	return common.NewAPIClient(cfg)
+}
+
+// OrgPath returns the path of r below /api/v1/organizations/{orgName}, or
+// the full path when it is not an organization path.
+func OrgPath(r *http.Request, orgName string) string {
+	prefix := "/api/v1/organizations/" + orgName
+	if p, ok := strings.CutPrefix(r.URL.Path, prefix); ok {
+		return p
+	}
+	return r.URL.Path
+}
+
+// WriteJSON writes v as a JSON response. A string or []byte is written as is.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	switch x := v.(type) {
+	case string:
+		w.Write([]byte(x))
+	case []byte:
+		w.Write(x)
+	default:
+		json.NewEncoder(w).Encode(v)
+	}
+}
@@ -0,0 +1,26 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package apiutil holds helpers shared by the packages built on the generated API.
+package apiutil
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// FormatID renders a loosely typed id, which the API may return as a string
+// or a number, as a string. A nil id renders as "".
+func FormatID(id interface{}) string {
+	switch v := id.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
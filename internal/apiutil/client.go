@@ -0,0 +1,20 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package apiutil
+
+import "github.com/apecloud/kb-cloud-client-go/api/common"
+
+// Clone returns a client with its own copy of the configuration and of the
+// HTTP client of client. The generated PrepareRequest sets the transport of
+// the HTTP client on every request, so goroutines sending requests
+// concurrently each need their own clone, made before they start.
+func Clone(client *common.APIClient) *common.APIClient {
+	cfg := *client.Cfg
+	if cfg.HTTPClient != nil {
+		httpClient := *cfg.HTTPClient
+		cfg.HTTPClient = &httpClient
+	}
+	return &common.APIClient{Cfg: &cfg}
+}
@@ -0,0 +1,326 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package audit exports the database audit logs of clusters to SIEM systems:
+// entries are fetched incrementally, normalized into a common Record and
+// written as ECS JSON, CEF or RFC 5424 syslog messages to an Output.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/events"
+	"github.com/apecloud/kb-cloud-client-go/logs"
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// List of Outcome.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeUnknown = "unknown"
+)
+
+// Record is an audit log entry in a common schema.
+type Record struct {
+	Timestamp  time.Time
+	OrgName    string
+	Cluster    string
+	Component  string
+	Instance   string
+	User       string
+	ClientHost string
+	Database   string
+	Statement  string
+	// Result is the result reported by the engine, such as a status or error code.
+	Result string
+	// Outcome is OutcomeSuccess, OutcomeFailure or OutcomeUnknown, derived from Result.
+	Outcome  string
+	Duration time.Duration
+	// Extra holds the engine specific fields of the entry.
+	Extra map[string]string
+}
+
+// Normalize converts an audit log entry of a cluster into a Record.
+func Normalize(orgName, cluster string, e logs.Entry) Record {
+	r := Record{
+		Timestamp:  e.Timestamp,
+		OrgName:    orgName,
+		Cluster:    cluster,
+		Component:  e.Component,
+		Instance:   e.Instance,
+		User:       e.User,
+		ClientHost: clientHost(e.Client),
+		Database:   e.Database,
+		Statement:  e.SQL,
+		Duration:   e.QueryTime,
+		Extra:      e.Extra,
+	}
+	if r.Statement == "" {
+		r.Statement = e.Message
+	}
+	norm := map[string]string{}
+	for k, v := range e.Extra {
+		norm[strings.ReplaceAll(strings.ToLower(k), "_", "")] = v
+	}
+	pick := func(keys ...string) string {
+		for _, k := range keys {
+			if v := norm[k]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	if r.User == "" {
+		r.User = pick("user", "username", "privuser")
+	}
+	if r.ClientHost == "" {
+		r.ClientHost = clientHost(pick("host", "ip", "clienthost", "clientip", "remotehost"))
+	}
+	if r.Database == "" {
+		r.Database = pick("db", "database", "dbname")
+	}
+	r.Result = pick("result", "status", "returncode", "errorcode", "retcode", "sqlstate")
+	r.Outcome = outcome(r.Result)
+	return r
+}
+
+// clientHost extracts the host from a client such as "app@10.0.0.1", "10.0.0.1:3306" or "[::1]:5432".
+func clientHost(client string) string {
+	client = strings.TrimSpace(client)
+	if i := strings.LastIndexByte(client, '@'); i >= 0 {
+		client = client[i+1:]
+	}
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		return host
+	}
+	return strings.Trim(client, "[]")
+}
+
+func outcome(result string) string {
+	switch r := strings.ToLower(strings.TrimSpace(result)); {
+	case r == "":
+		return OutcomeUnknown
+	case r == "0" || r == "00000" || r == "ok" || r == "success" || r == "succeeded":
+		return OutcomeSuccess
+	default:
+		return OutcomeFailure
+	}
+}
+
+// Key identifies a record across overlapping queries. Identical records of
+// the same instant share a key; the exporter numbers their occurrences.
+func (r Record) Key() string {
+	h := sha256.New()
+	for _, s := range []string{strconv.FormatInt(r.Timestamp.UnixNano(), 10), r.Instance, r.User, r.ClientHost, r.Database, r.Statement, r.Result} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:12])
+}
+
+// Options configures an Exporter.
+type Options struct {
+	// Clusters are the clusters whose audit logs are exported.
+	Clusters []string
+	// Formatter encodes records. Defaults to ECS JSON.
+	Formatter Formatter
+	// Output receives the encoded records.
+	Output Output
+	// Checkpoints returns the store of the checkpoint of a cluster. Defaults to
+	// checkpoints kept in memory.
+	Checkpoints func(cluster string) events.CursorStore
+	// StartAt is where a cluster without a checkpoint starts. Defaults to one hour ago.
+	StartAt time.Time
+	// Delay holds back the most recent entries, which may not all be ingested yet. Defaults to 1m.
+	Delay time.Duration
+	// Overlap is how far before the checkpoint entries are queried again, to
+	// catch entries ingested late. Defaults to 5m.
+	Overlap time.Duration
+	// BatchSize is the number of records written before the checkpoint is saved. Defaults to 500.
+	BatchSize int
+	// Query sets the component, instance and page size of the queries.
+	Query logs.Query
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// Exporter exports the audit logs of clusters.
+type Exporter struct {
+	querier *logs.Querier
+	orgName string
+	opts    Options
+	stores  map[string]events.CursorStore
+}
+
+// NewExporter returns an Exporter of the audit logs of clusters of orgName queried with querier.
+func NewExporter(querier *logs.Querier, orgName string, opts Options) *Exporter {
+	if opts.Formatter == nil {
+		opts.Formatter = ECSFormatter{}
+	}
+	if opts.Checkpoints == nil {
+		opts.Checkpoints = func(string) events.CursorStore { return &events.MemoryCursorStore{} }
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if opts.StartAt.IsZero() {
+		opts.StartAt = opts.Now().Add(-time.Hour)
+	}
+	if opts.Delay <= 0 {
+		opts.Delay = time.Minute
+	}
+	if opts.Overlap <= 0 {
+		opts.Overlap = 5 * time.Minute
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	return &Exporter{querier: querier, orgName: orgName, opts: opts, stores: map[string]events.CursorStore{}}
+}
+
+// DirCheckpoints keeps the checkpoint of every cluster in a JSON file in dir.
+func DirCheckpoints(dir string) func(cluster string) events.CursorStore {
+	return func(cluster string) events.CursorStore {
+		return events.NewFileCursorStore(filepath.Join(dir, cluster+".json"))
+	}
+}
+
+// Run exports the entries of every cluster added since its checkpoint and
+// returns the number of records written.
+func (x *Exporter) Run(ctx context.Context) (int, error) {
+	total := 0
+	for _, cluster := range x.opts.Clusters {
+		n, err := x.exportCluster(ctx, cluster)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("export audit logs of cluster %s: %w", cluster, err)
+		}
+	}
+	return total, nil
+}
+
+// Follow runs the exporter every interval until it fails or ctx is done.
+func (x *Exporter) Follow(ctx context.Context, interval time.Duration) error {
+	return wait.Poll(ctx, interval, 0, func(ctx context.Context) (bool, error) {
+		_, err := x.Run(ctx)
+		return false, err
+	})
+}
+
+func (x *Exporter) store(cluster string) events.CursorStore {
+	s, ok := x.stores[cluster]
+	if !ok {
+		s = x.opts.Checkpoints(cluster)
+		x.stores[cluster] = s
+	}
+	return s
+}
+
+// exportCluster writes the new entries of a cluster, saving the checkpoint
+// after every batch the output accepts.
+func (x *Exporter) exportCluster(ctx context.Context, cluster string) (int, error) {
+	store := x.store(cluster)
+	cp, err := store.Load(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("load checkpoint: %w", err)
+	}
+	if cp.Time.IsZero() {
+		cp.Time = x.opts.StartAt
+	}
+	end := x.opts.Now().Add(-x.opts.Delay)
+	start := cp.Time.Add(-x.opts.Overlap)
+	if !end.After(start) {
+		return 0, nil
+	}
+	// The keys of the checkpoint belong to entries in the overlap window
+	// before it; their time is unknown until they are queried again.
+	loaded := cp.Time
+	seen := map[string]time.Time{}
+	for _, key := range cp.Seen {
+		seen[key] = time.Time{}
+	}
+	var (
+		pos     time.Time
+		batch   [][]byte
+		written int
+		// occurrences counts the records of each key at pos. Identical
+		// records share their timestamp, so they are read one after another.
+		occurrences = map[string]int{}
+	)
+	save := func() error {
+		if len(batch) > 0 {
+			if err := x.opts.Output.Write(ctx, batch); err != nil {
+				return err
+			}
+			written += len(batch)
+			batch = batch[:0]
+		}
+		horizon := cp.Time.Add(-x.opts.Overlap)
+		cp.Seen = cp.Seen[:0]
+		for key, t := range seen {
+			if t.IsZero() && pos.After(loaded) || !t.IsZero() && t.Before(horizon) {
+				delete(seen, key)
+				continue
+			}
+			cp.Seen = append(cp.Seen, key)
+		}
+		sort.Strings(cp.Seen)
+		if err := store.Save(ctx, cp); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+		return nil
+	}
+
+	query := x.opts.Query
+	query.Kind, query.Start, query.End, query.Sort = logs.KindAudit, start, end, kbcloud.SortTypeAsc
+	err = x.querier.Iterate(ctx, x.orgName, cluster, query, func(e logs.Entry) error {
+		r := Normalize(x.orgName, cluster, e)
+		if !r.Timestamp.Equal(pos) {
+			clear(occurrences)
+		}
+		key := r.Key()
+		if occurrences[key]++; occurrences[key] > 1 {
+			key += "-" + strconv.Itoa(occurrences[key])
+		}
+		pos = r.Timestamp
+		_, dup := seen[key]
+		seen[key] = r.Timestamp
+		if dup {
+			return nil
+		}
+		msg, err := x.opts.Formatter.Format(r)
+		if err != nil {
+			return fmt.Errorf("format audit record: %w", err)
+		}
+		batch = append(batch, msg)
+		if r.Timestamp.After(cp.Time) {
+			cp.Time = r.Timestamp
+		}
+		if len(batch) >= x.opts.BatchSize {
+			return save()
+		}
+		return nil
+	})
+	if err != nil {
+		return written, err
+	}
+	// Every entry up to end has been read: move the checkpoint of a quiet
+	// cluster forward so its queries do not cover an ever growing range.
+	pos = end
+	if t := end.Add(-x.opts.Overlap); t.After(cp.Time) {
+		cp.Time = t
+	}
+	return written, save()
+}
@@ -0,0 +1,203 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+	"github.com/apecloud/kb-cloud-client-go/logs"
+)
+
+// auditLogStandIn serves the audit logs of a cluster within the requested time range.
+type auditLogStandIn struct {
+	mu      sync.Mutex
+	entries []map[string]interface{}
+}
+
+func (s *auditLogStandIn) add(ts time.Time, sql string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, map[string]interface{}{
+		"timestamp":     ts.UnixMilli(),
+		"command":       sql,
+		"dbName":        "shop",
+		"user":          "app",
+		"client":        "app@10.0.0.7:51234",
+		"executionTime": 0.0,
+		"extra":         map[string]interface{}{"status": "0", "podName": "mysql-0"},
+	})
+}
+
+func (s *auditLogStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := r.URL.Query()
+	start, _ := strconv.ParseInt(q.Get("startTime"), 10, 64)
+	end, _ := strconv.ParseInt(q.Get("endTime"), 10, 64)
+	items := []map[string]interface{}{}
+	for _, e := range s.entries {
+		if ts := e["timestamp"].(int64) / 1000; ts >= start && ts < end {
+			items = append(items, e)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i]["timestamp"].(int64) < items[j]["timestamp"].(int64)
+	})
+	apitest.WriteJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func TestExporter(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	s := &auditLogStandIn{}
+	querier := logs.NewQuerier(apitest.NewClient(t, s), logs.QuerierOptions{})
+
+	now := base.Add(10 * time.Minute)
+	var out bytes.Buffer
+	dir := t.TempDir()
+	newExporter := func() *Exporter {
+		return NewExporter(querier, "org", Options{
+			Clusters:    []string{"c1"},
+			Output:      NewWriterOutput(&out),
+			Checkpoints: DirCheckpoints(dir),
+			StartAt:     base,
+			BatchSize:   2,
+			Now:         func() time.Time { return now },
+		})
+	}
+
+	for i := 0; i < 5; i++ {
+		s.add(base.Add(time.Duration(i)*time.Minute), "SELECT "+strconv.Itoa(i))
+	}
+	// Held back by the delay until the next run.
+	s.add(now.Add(-30*time.Second), "SELECT recent")
+
+	x := newExporter()
+	n, err := x.Run(context.Background())
+	if err != nil || n != 5 {
+		t.Fatalf("first run: %d, %v", n, err)
+	}
+
+	// An entry ingested late, within the overlap window, and a new one.
+	s.add(base.Add(4*time.Minute+30*time.Second), "SELECT late")
+	now = now.Add(time.Minute)
+	s.add(now.Add(-2*time.Minute+time.Second), "SELECT new")
+
+	// A restarted exporter continues from the checkpoints on disk.
+	x = newExporter()
+	n, err = x.Run(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("second run: %d, %v", n, err)
+	}
+	n, err = x.Run(context.Background())
+	if err != nil || n != 0 {
+		t.Fatalf("third run: %d, %v", n, err)
+	}
+
+	var statements []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var doc struct {
+			User   struct{ Name string }
+			Client struct{ Address string }
+			Event  struct{ Outcome string }
+			DB     struct{ Name, Statement string }
+			Labels map[string]string
+		}
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			t.Fatalf("decode %s: %v", line, err)
+		}
+		if doc.User.Name != "app" || doc.Client.Address != "10.0.0.7" || doc.DB.Name != "shop" ||
+			doc.Event.Outcome != OutcomeSuccess || doc.Labels["cluster"] != "c1" {
+			t.Errorf("unexpected document %s", line)
+		}
+		statements = append(statements, doc.DB.Statement)
+	}
+	want := "SELECT 0,SELECT 1,SELECT 2,SELECT 3,SELECT 4,SELECT late,SELECT new,SELECT recent"
+	if got := strings.Join(statements, ","); got != want {
+		t.Errorf("statements\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestExporterIdenticalRecords(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	s := &auditLogStandIn{}
+	now := base.Add(10 * time.Minute)
+	var out bytes.Buffer
+	x := NewExporter(logs.NewQuerier(apitest.NewClient(t, s), logs.QuerierOptions{}), "org", Options{
+		Clusters:  []string{"c1"},
+		Output:    NewWriterOutput(&out),
+		StartAt:   base,
+		BatchSize: 2,
+		Now:       func() time.Time { return now },
+	})
+
+	// The same statement run three times within a millisecond.
+	for i := 0; i < 3; i++ {
+		s.add(base.Add(time.Minute), "COMMIT")
+	}
+	if n, err := x.Run(context.Background()); err != nil || n != 3 {
+		t.Fatalf("first run: %d, %v", n, err)
+	}
+	// A fourth one ingested late.
+	s.add(base.Add(time.Minute), "COMMIT")
+	now = now.Add(time.Minute)
+	if n, err := x.Run(context.Background()); err != nil || n != 1 {
+		t.Fatalf("second run: %d, %v", n, err)
+	}
+	if n, err := x.Run(context.Background()); err != nil || n != 0 {
+		t.Fatalf("third run: %d, %v", n, err)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 4 {
+		t.Errorf("exported %d records, want 4", n)
+	}
+}
+
+func TestFormatters(t *testing.T) {
+	r := Record{
+		Timestamp:  time.Date(2024, 3, 1, 12, 0, 0, 250000000, time.UTC),
+		OrgName:    "org",
+		Cluster:    "c1",
+		Instance:   "c1-mysql-0",
+		User:       "admin",
+		ClientHost: "10.0.0.7",
+		Database:   "shop",
+		Statement:  "UPDATE t SET a = 'x=y'\nWHERE id = 1",
+		Result:     "1045",
+		Outcome:    OutcomeFailure,
+	}
+
+	cef, _ := CEFFormatter{}.Format(r)
+	wantCEF := `CEF:0|ApeCloud|KubeBlocks Cloud|1.0|audit|Database audit|6|rt=1709294400250 suser=admin shost=10.0.0.7 dvchost=c1-mysql-0 outcome=failure ` +
+		`cs1Label=database cs1=shop cs2Label=cluster cs2=c1 cs3Label=org cs3=org cs4Label=result cs4=1045 msg=UPDATE t SET a \= 'x\=y'\nWHERE id \= 1`
+	if string(cef) != wantCEF {
+		t.Errorf("CEF\n got: %s\nwant: %s", cef, wantCEF)
+	}
+
+	r.Extra = map[string]string{"note": `say "hi"]`}
+	syslog, _ := SyslogFormatter{}.Format(r)
+	wantSyslog := `<108>1 2024-03-01T12:00:00.250000Z c1-mysql-0 kbcloud - audit [audit@32473 org="org" cluster="c1" user="admin" client="10.0.0.7" db="shop" result="1045" outcome="failure" note="say \"hi\"\]"] UPDATE t SET a = 'x=y' WHERE id = 1`
+	if string(syslog) != wantSyslog {
+		t.Errorf("syslog\n got: %s\nwant: %s", syslog, wantSyslog)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	r := Normalize("org", "c1", logs.Entry{
+		Message: "connect",
+		Extra:   map[string]string{"Priv_User": "root", "Remote_Host": "[::1]:5432", "SQLSTATE": "00000"},
+	})
+	if r.User != "root" || r.ClientHost != "::1" || r.Statement != "connect" || r.Outcome != OutcomeSuccess {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
@@ -0,0 +1,277 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+)
+
+// Formatter encodes a record as a single message without a trailing newline.
+type Formatter interface {
+	Format(r Record) ([]byte, error)
+}
+
+// ECSFormatter encodes records as Elastic Common Schema JSON documents.
+type ECSFormatter struct{}
+
+var _ Formatter = ECSFormatter{}
+
+type ecsDocument struct {
+	Timestamp string            `json:"@timestamp"`
+	Message   string            `json:"message,omitempty"`
+	Event     ecsEvent          `json:"event"`
+	User      *ecsName          `json:"user,omitempty"`
+	Client    *ecsClient        `json:"client,omitempty"`
+	Host      *ecsName          `json:"host,omitempty"`
+	Service   ecsService        `json:"service"`
+	DB        *ecsDB            `json:"db,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type ecsEvent struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Action   string   `json:"action"`
+	Outcome  string   `json:"outcome"`
+	Dataset  string   `json:"dataset"`
+	Code     string   `json:"code,omitempty"`
+	Duration int64    `json:"duration,omitempty"`
+}
+
+type ecsName struct {
+	Name string `json:"name"`
+}
+
+type ecsClient struct {
+	Address string `json:"address"`
+}
+
+type ecsService struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type ecsDB struct {
+	Name      string `json:"name,omitempty"`
+	Statement string `json:"statement,omitempty"`
+}
+
+// Format encodes r. The organization, cluster and component are labels, and
+// the engine specific fields are labels prefixed with "extra_".
+func (ECSFormatter) Format(r Record) ([]byte, error) {
+	doc := ecsDocument{
+		Timestamp: r.Timestamp.UTC().Format(time.RFC3339Nano),
+		Message:   r.Statement,
+		Event: ecsEvent{
+			Kind:     "event",
+			Category: []string{"database"},
+			Type:     []string{"access"},
+			Action:   "database-audit",
+			Outcome:  r.Outcome,
+			Dataset:  "kbcloud.audit",
+			Code:     r.Result,
+			Duration: r.Duration.Nanoseconds(),
+		},
+		Service: ecsService{Name: r.Cluster, Type: "database"},
+		Labels:  map[string]string{},
+	}
+	if r.User != "" {
+		doc.User = &ecsName{Name: r.User}
+	}
+	if r.ClientHost != "" {
+		doc.Client = &ecsClient{Address: r.ClientHost}
+	}
+	if r.Instance != "" {
+		doc.Host = &ecsName{Name: r.Instance}
+	}
+	if r.Database != "" || r.Statement != "" {
+		doc.DB = &ecsDB{Name: r.Database, Statement: r.Statement}
+	}
+	for k, v := range map[string]string{"org": r.OrgName, "cluster": r.Cluster, "component": r.Component} {
+		if v != "" {
+			doc.Labels[k] = v
+		}
+	}
+	for k, v := range r.Extra {
+		doc.Labels["extra_"+k] = v
+	}
+	data, err := common.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(data, "\n"), nil
+}
+
+// CEFFormatter encodes records as ArcSight Common Event Format messages.
+type CEFFormatter struct {
+	// Version is the device version in the header. Defaults to "1.0".
+	Version string
+}
+
+var _ Formatter = CEFFormatter{}
+
+// Format encodes r. Failed statements have severity 6, others severity 3.
+func (f CEFFormatter) Format(r Record) ([]byte, error) {
+	version := f.Version
+	if version == "" {
+		version = "1.0"
+	}
+	severity := 3
+	if r.Outcome == OutcomeFailure {
+		severity = 6
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeader("ApeCloud"), cefHeader("KubeBlocks Cloud"), cefHeader(version),
+		cefHeader("audit"), cefHeader("Database audit"), severity)
+
+	ext := [][2]string{
+		{"rt", strconv.FormatInt(r.Timestamp.UnixMilli(), 10)},
+		{"suser", r.User},
+		{"shost", r.ClientHost},
+		{"dvchost", r.Instance},
+		{"outcome", r.Outcome},
+		{"cs1Label", "database"}, {"cs1", r.Database},
+		{"cs2Label", "cluster"}, {"cs2", r.Cluster},
+		{"cs3Label", "org"}, {"cs3", r.OrgName},
+		{"cs4Label", "result"}, {"cs4", r.Result},
+		{"cs5Label", "component"}, {"cs5", r.Component},
+		{"msg", r.Statement},
+	}
+	first := true
+	for i, kv := range ext {
+		// Skip a label whose value is empty along with the value.
+		if strings.HasSuffix(kv[0], "Label") && i+1 < len(ext) && ext[i+1][1] == "" {
+			continue
+		}
+		if kv[1] == "" {
+			continue
+		}
+		if !first {
+			b.WriteByte(' ')
+		}
+		first = false
+		b.WriteString(kv[0])
+		b.WriteByte('=')
+		b.WriteString(cefValue(kv[1]))
+	}
+	return []byte(b.String()), nil
+}
+
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ").Replace(s)
+}
+
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// SyslogFormatter encodes records as RFC 5424 syslog messages.
+type SyslogFormatter struct {
+	// Facility defaults to 13, log audit.
+	Facility int
+	// AppName defaults to "kbcloud".
+	AppName string
+	// SDID is the id of the structured data element holding the fields of
+	// the record. Defaults to "audit@32473"; replace the example enterprise
+	// number with your own.
+	SDID string
+}
+
+var _ Formatter = SyslogFormatter{}
+
+// Format encodes r. The hostname is the instance, the message is the
+// statement and failed statements have severity warning, others notice.
+func (f SyslogFormatter) Format(r Record) ([]byte, error) {
+	facility, app, sdid := f.Facility, f.AppName, f.SDID
+	if facility <= 0 || facility > 23 {
+		facility = 13
+	}
+	if app == "" {
+		app = "kbcloud"
+	}
+	if sdid == "" {
+		sdid = "audit@32473"
+	}
+	severity := 5
+	if r.Outcome == OutcomeFailure {
+		severity = 4
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s - audit [%s", facility*8+severity,
+		r.Timestamp.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeader(r.Instance, 255), syslogHeader(app, 48), sdid)
+	params := [][2]string{
+		{"org", r.OrgName}, {"cluster", r.Cluster}, {"component", r.Component},
+		{"user", r.User}, {"client", r.ClientHost}, {"db", r.Database},
+		{"result", r.Result}, {"outcome", r.Outcome},
+	}
+	if r.Duration > 0 {
+		params = append(params, [2]string{"durationMs", strconv.FormatInt(r.Duration.Milliseconds(), 10)})
+	}
+	extra := make([]string, 0, len(r.Extra))
+	for k := range r.Extra {
+		extra = append(extra, k)
+	}
+	sort.Strings(extra)
+	for _, k := range extra {
+		params = append(params, [2]string{k, r.Extra[k]})
+	}
+	for _, p := range params {
+		if name := sdName(p[0]); name != "" && p[1] != "" {
+			fmt.Fprintf(&b, ` %s="%s"`, name, sdValue(p[1]))
+		}
+	}
+	b.WriteByte(']')
+	if r.Statement != "" {
+		b.WriteByte(' ')
+		b.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(r.Statement))
+	}
+	return []byte(b.String()), nil
+}
+
+// syslogHeader returns s as a header field: printable ASCII of at most n
+// characters, or "-" when empty.
+func syslogHeader(s string, n int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > n {
+		s = s[:n]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// sdName returns s as a structured data parameter name.
+func sdName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' || r == ' ' {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	return s
+}
+
+func sdValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "]", `\]`).Replace(s)
+}
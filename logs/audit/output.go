@@ -0,0 +1,164 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Output receives batches of formatted records. A batch is accepted once
+// Write returns nil; the checkpoint is saved after it.
+type Output interface {
+	Write(ctx context.Context, msgs [][]byte) error
+}
+
+// WriterOutput writes every message as a line to an io.Writer, such as os.Stdout.
+type WriterOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var _ Output = (*WriterOutput)(nil)
+
+// NewWriterOutput returns an Output writing lines to w.
+func NewWriterOutput(w io.Writer) *WriterOutput {
+	return &WriterOutput{w: w}
+}
+
+// Write writes the batch.
+func (o *WriterOutput) Write(ctx context.Context, msgs [][]byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, err := o.w.Write(lines(msgs))
+	return err
+}
+
+// FileOutput appends messages as lines to a file.
+type FileOutput struct {
+	mu   sync.Mutex
+	path string
+}
+
+var _ Output = (*FileOutput)(nil)
+
+// NewFileOutput returns an Output appending lines to the file at path.
+func NewFileOutput(path string) *FileOutput {
+	return &FileOutput{path: path}
+}
+
+// Write appends the batch and syncs the file, so the records are on disk
+// before the checkpoint is saved.
+func (o *FileOutput) Write(ctx context.Context, msgs [][]byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f, err := os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(lines(msgs)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SyslogOutput sends messages to a syslog collector or SIEM listener.
+// Over TCP and TLS connections messages are framed by octet counting
+// (RFC 6587); over UDP every message is a datagram.
+type SyslogOutput struct {
+	mu      sync.Mutex
+	network string
+	dial    func(ctx context.Context) (net.Conn, error)
+	conn    net.Conn
+	timeout time.Duration
+}
+
+var _ Output = (*SyslogOutput)(nil)
+
+// NewSyslogOutput returns an Output sending messages to addr over network,
+// "tcp" or "udp". A nil dial uses a net.Dialer; pass one wrapping tls.Dial
+// for TLS.
+func NewSyslogOutput(network, addr string, dial func(ctx context.Context) (net.Conn, error)) *SyslogOutput {
+	if dial == nil {
+		dial = func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	return &SyslogOutput{network: network, dial: dial, timeout: 30 * time.Second}
+}
+
+// Write sends the batch, connecting first if needed. The connection is
+// closed on failure and opened again by the next Write.
+func (o *SyslogOutput) Write(ctx context.Context, msgs [][]byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.conn == nil {
+		conn, err := o.dial(ctx)
+		if err != nil {
+			return err
+		}
+		o.conn = conn
+	}
+	deadline := time.Now().Add(o.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	o.conn.SetWriteDeadline(deadline)
+
+	var err error
+	if o.network == "udp" || o.network == "udp4" || o.network == "udp6" {
+		for _, m := range msgs {
+			if _, err = o.conn.Write(m); err != nil {
+				break
+			}
+		}
+	} else {
+		var buf bytes.Buffer
+		for _, m := range msgs {
+			buf.WriteString(strconv.Itoa(len(m)))
+			buf.WriteByte(' ')
+			buf.Write(m)
+		}
+		_, err = o.conn.Write(buf.Bytes())
+	}
+	if err != nil {
+		o.conn.Close()
+		o.conn = nil
+	}
+	return err
+}
+
+// Close closes the connection.
+func (o *SyslogOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.conn == nil {
+		return nil
+	}
+	err := o.conn.Close()
+	o.conn = nil
+	return err
+}
+
+func lines(msgs [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, m := range msgs {
+		buf.Write(m)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,221 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package logs provides helpers on top of the log endpoints of the KubeBlocks
+// Cloud API, such as typed cluster log queries, streaming instance logs and
+// following logs that are only served as snapshots.
+package logs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// anchorLines is how many trailing lines of a pod log are remembered to find
+// where the previous snapshot ended when the log is served as a sliding window.
+const anchorLines = 16
+
+// Line is a log line emitted by a follower.
+type Line struct {
+	Pod  string
+	Text string
+}
+
+// PodLog is the log of one pod in a snapshot. CreatedAt identifies the pod
+// incarnation; when it changes the pod was recreated and its log starts over.
+type PodLog struct {
+	Pod       string
+	CreatedAt time.Time
+	Log       string
+}
+
+// SnapshotFunc fetches the current logs and reports whether their owner has
+// reached a terminal state. Implementations should check the state before
+// fetching the logs, so the logs of the final snapshot are complete.
+type SnapshotFunc func(ctx context.Context) (logs []PodLog, done bool, err error)
+
+// FollowOptions configures a follower.
+type FollowOptions struct {
+	// PollInterval is how often the snapshot is fetched. Defaults to 2s.
+	PollInterval time.Duration
+	// PrefixPod prefixes lines written by Reader with the pod name.
+	PrefixPod bool
+}
+
+// Follow polls fetch and calls fn with every line appended since the previous
+// poll, until the owner reaches a terminal state, fetch fails or ctx is done.
+// Incomplete trailing lines are held back until they are completed or the owner finishes.
+func Follow(ctx context.Context, fetch SnapshotFunc, opts FollowOptions, fn func(Line)) error {
+	return follow(ctx, fetch, opts, map[string]*podState{}, fn)
+}
+
+// follow is Follow continuing from the emitted state of pods.
+func follow(ctx context.Context, fetch SnapshotFunc, opts FollowOptions, pods map[string]*podState, fn func(Line)) error {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+
+	// wait.Poll with a zero timeout runs until the condition is done or ctx ends.
+	return wait.Poll(ctx, interval, 0, func(ctx context.Context) (bool, error) {
+		snapshot, done, err := fetch(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, p := range snapshot {
+			st, ok := pods[p.Pod]
+			if !ok {
+				st = &podState{}
+				pods[p.Pod] = st
+			}
+			if !p.CreatedAt.IsZero() && !p.CreatedAt.Equal(st.createdAt) {
+				if !st.createdAt.IsZero() {
+					// The pod was recreated and its log starts over.
+					*st = podState{}
+				}
+				st.createdAt = p.CreatedAt
+			}
+			for _, text := range st.advance(p.Log, done) {
+				fn(Line{Pod: p.Pod, Text: text})
+			}
+		}
+		return done, nil
+	})
+}
+
+// podState tracks how much of a pod log has been emitted.
+type podState struct {
+	createdAt time.Time
+	// offset is the end of the last emitted line in the previous snapshot.
+	offset int
+	// anchor holds the last emitted lines, each terminated by a newline.
+	anchor string
+}
+
+// advance returns the lines of log that were not emitted yet. The trailing
+// incomplete line is only returned when flush is set.
+func (s *podState) advance(log string, flush bool) []string {
+	var fresh string
+	switch {
+	case s.offset <= len(log) && strings.HasSuffix(log[:s.offset], s.anchor):
+		// The log grew in place.
+		fresh = log[s.offset:]
+	default:
+		// The log is a sliding window: continue after the longest run of
+		// last seen lines it contains, or start over if it contains none.
+		fresh = log
+		for seen := s.anchor; seen != ""; seen = seen[strings.IndexByte(seen, '\n')+1:] {
+			if i := strings.LastIndex(log, seen); i >= 0 && (i == 0 || log[i-1] == '\n') {
+				fresh = log[i+len(seen):]
+				break
+			}
+		}
+	}
+	consumed := len(log) - len(fresh)
+
+	complete := ""
+	if i := strings.LastIndexByte(fresh, '\n'); i >= 0 {
+		complete = fresh[:i+1]
+	}
+	if flush && len(complete) < len(fresh) {
+		complete = fresh + "\n"
+		consumed = len(log)
+	} else {
+		consumed += len(complete)
+	}
+	if complete == "" {
+		return nil
+	}
+
+	s.offset = consumed
+	s.anchor = lastLines(s.anchor+complete, anchorLines)
+	return strings.Split(strings.TrimSuffix(complete, "\n"), "\n")
+}
+
+// lastLines returns the last n newline-terminated lines of s.
+func lastLines(s string, n int) string {
+	end := len(s) - 1
+	for i := end; i >= 0; i-- {
+		if s[i] == '\n' && i != end {
+			n--
+			if n == 0 {
+				return s[i+1:]
+			}
+		}
+	}
+	return s
+}
+
+// Lines follows the logs in a goroutine. The line channel is closed when the
+// follower stops; the error channel then yields its error, if any.
+func Lines(ctx context.Context, fetch SnapshotFunc, opts FollowOptions) (<-chan Line, <-chan error) {
+	lines := make(chan Line, 64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(lines)
+		err := Follow(ctx, fetch, opts, func(l Line) {
+			select {
+			case lines <- l:
+			case <-ctx.Done():
+			}
+		})
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return lines, errc
+}
+
+// Reader follows the logs and returns them as text, one line per log line.
+// Reading returns io.EOF once the owner reaches a terminal state; closing the
+// reader stops the follower and waits for it to return.
+func Reader(ctx context.Context, fetch SnapshotFunc, opts FollowOptions) io.ReadCloser {
+	return newFollowReader(ctx, func(ctx context.Context, write func(text string)) error {
+		return Follow(ctx, fetch, opts, func(l Line) {
+			text := l.Text
+			if opts.PrefixPod {
+				text = fmt.Sprintf("[%s] %s", l.Pod, text)
+			}
+			write(text)
+		})
+	})
+}
+
+// newFollowReader runs follower in a goroutine and returns the lines it writes
+// as text. The reader ends with the error of follower.
+func newFollowReader(ctx context.Context, follower func(ctx context.Context, write func(text string)) error) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := follower(ctx, func(text string) {
+			if _, err := io.WriteString(pw, text+"\n"); err != nil {
+				cancel()
+			}
+		})
+		pw.CloseWithError(err)
+	}()
+	return &followReader{PipeReader: pr, cancel: cancel, done: done}
+}
+
+type followReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+	// done is closed when the follower returned.
+	done chan struct{}
+}
+
+func (r *followReader) Close() error {
+	r.cancel()
+	err := r.PipeReader.Close()
+	<-r.done
+	return err
+}
@@ -0,0 +1,111 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package logs
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPodStateAdvance(t *testing.T) {
+	type poll struct {
+		log   string
+		flush bool
+		want  string
+	}
+	for _, tc := range []struct {
+		name  string
+		polls []poll
+	}{
+		{"grows in place", []poll{
+			{log: "a\nb\n", want: "a|b"},
+			{log: "a\nb\n", want: ""},
+			{log: "a\nb\nc\n", want: "c"},
+		}},
+		{"partial lines are held back", []poll{
+			{log: "a\nb", want: "a"},
+			{log: "a\nbc", want: ""},
+			{log: "a\nbcd\ne", want: "bcd"},
+			{log: "a\nbcd\nef", flush: true, want: "ef"},
+		}},
+		{"overlapping pages", []poll{
+			{log: "1\n2\n3\n", want: "1|2|3"},
+			{log: "2\n3\n4\n5\n", want: "4|5"},
+			{log: "5\n6\n", want: "6"},
+		}},
+		{"page ending in a partial line", []poll{
+			{log: "1\n2\n3", want: "1|2"},
+			{log: "2\n3 done\n4\n", want: "3 done|4"},
+		}},
+		{"repeated lines", []poll{
+			{log: "x\nx\n", want: "x|x"},
+			{log: "x\nx\nx\n", want: "x"},
+			{log: "x\nx\nx\ny\n", want: "y"},
+		}},
+		{"page without seen lines starts over", []poll{
+			{log: "1\n2\n", want: "1|2"},
+			{log: "8\n9\n", want: "8|9"},
+		}},
+		{"seen line inside another line", []poll{
+			{log: "ab\n", want: "ab"},
+			{log: "xab\nc\n", want: "xab|c"},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var s podState
+			for i, p := range tc.polls {
+				if got := strings.Join(s.advance(p.log, p.flush), "|"); got != p.want {
+					t.Errorf("poll %d of %q: lines = %q, want %q", i, p.log, got, p.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc\n", 3, "a\nb\nc\n"},
+		{"a\nb\nc\n", 5, "a\nb\nc\n"},
+		{"\n\n", 1, "\n"},
+	} {
+		if got := lastLines(tc.s, tc.n); got != tc.want {
+			t.Errorf("lastLines(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	snapshots := [][]PodLog{
+		{{Pod: "db-0", CreatedAt: first, Log: "a\nb"}, {Pod: "db-1", Log: "x\n"}},
+		{{Pod: "db-0", CreatedAt: first, Log: "a\nb\n"}, {Pod: "db-1", Log: "x\ny\n"}},
+		// db-0 was recreated and its log starts over.
+		{{Pod: "db-0", CreatedAt: second, Log: "a\n"}, {Pod: "db-1", Log: "y\nz"}},
+	}
+	polls := 0
+	fetch := func(ctx context.Context) ([]PodLog, bool, error) {
+		polls++
+		return snapshots[polls-1], polls == len(snapshots), nil
+	}
+	r := Reader(context.Background(), fetch, FollowOptions{PollInterval: time.Millisecond, PrefixPod: true})
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[db-0] a\n[db-1] x\n[db-0] b\n[db-1] y\n[db-0] a\n[db-1] z\n"
+	if string(data) != want {
+		t.Errorf("followed:\n%s\nwant:\n%s", data, want)
+	}
+}
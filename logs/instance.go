@@ -0,0 +1,195 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package logs
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	_nethttp "net/http"
+	_neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+const instanceLogPath = "/api/v1/organizations/{orgName}/clusters/{clusterName}/workloads/{workloadName}/log"
+
+// maxLineSize is the longest line ScanInstanceLog accepts.
+const maxLineSize = 1 << 20
+
+// InstanceLogOptions configures OpenInstanceLog.
+type InstanceLogOptions struct {
+	WorkloadType string
+	// Previous reads the log of the previous container. It cannot be followed.
+	Previous     bool
+	SinceSeconds int32
+	TailLines    int32
+	// Follow keeps the log open and returns new lines as they are written.
+	Follow bool
+	// PollInterval is how often the log is polled when following. Defaults to 2s.
+	PollInterval time.Duration
+}
+
+// OpenInstanceLog returns the container log of a cluster instance as a stream.
+// The caller must close the stream; canceling ctx also ends it.
+//
+// The API serves the log as a snapshot, so following streams the first
+// snapshot, then polls the log with SinceSeconds covering the time since the
+// previous poll and drops the lines already returned. Only the last lines of
+// the log and the lines written since the previous poll are held in memory.
+func OpenInstanceLog(ctx context.Context, client *common.APIClient, orgName, clusterName, workloadName string, opts InstanceLogOptions) (io.ReadCloser, error) {
+	started := time.Now()
+	resp, err := instanceLog(ctx, client, orgName, clusterName, workloadName, instanceLogQuery(opts))
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Follow || opts.Previous {
+		return resp.Body, nil
+	}
+
+	last := started
+	fetch := func(ctx context.Context) ([]PodLog, bool, error) {
+		// Overlap the previous poll by a second, as SinceSeconds is coarse.
+		since := int32(math.Ceil(time.Since(last).Seconds())) + 1
+		last = time.Now()
+		query := instanceLogQuery(InstanceLogOptions{WorkloadType: opts.WorkloadType, SinceSeconds: since})
+		resp, err := instanceLog(ctx, client, orgName, clusterName, workloadName, query)
+		if err != nil {
+			return nil, false, err
+		}
+		body, err := common.ReadBody(resp)
+		if err != nil {
+			return nil, false, err
+		}
+		return []PodLog{{Pod: workloadName, Log: string(body)}}, false, nil
+	}
+	return newFollowReader(ctx, func(ctx context.Context, write func(text string)) error {
+		// Closing the reader must not wait for a stalled first snapshot.
+		stop := context.AfterFunc(ctx, func() { resp.Body.Close() })
+		anchor, err := copyLines(resp.Body, write)
+		stop()
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		pods := map[string]*podState{workloadName: {offset: len(anchor), anchor: anchor}}
+		return follow(ctx, fetch, FollowOptions{PollInterval: opts.PollInterval}, pods, func(l Line) {
+			write(l.Text)
+		})
+	}), nil
+}
+
+// copyLines calls write with every complete line of r and returns the last
+// anchorLines of them, each terminated by a newline. A trailing incomplete
+// line is dropped, as the next poll returns it once it is complete.
+func copyLines(r io.Reader, write func(text string)) (string, error) {
+	br := bufio.NewReader(r)
+	anchor := ""
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			return anchor, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		write(strings.TrimSuffix(line, "\n"))
+		anchor = lastLines(anchor+line, anchorLines)
+	}
+}
+
+// ScanInstanceLog calls fn with every line of the container log of a cluster
+// instance, until the log ends, fn returns an error or ctx is done.
+func ScanInstanceLog(ctx context.Context, client *common.APIClient, orgName, clusterName, workloadName string, opts InstanceLogOptions, fn func(line string) error) error {
+	r, err := OpenInstanceLog(ctx, client, orgName, clusterName, workloadName, opts)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		if err := fn(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func instanceLogQuery(opts InstanceLogOptions) _neturl.Values {
+	query := _neturl.Values{}
+	if opts.WorkloadType != "" {
+		query.Add("workloadType", opts.WorkloadType)
+	}
+	if opts.Previous {
+		query.Add("previous", "true")
+	}
+	if opts.SinceSeconds > 0 {
+		query.Add("sinceSeconds", common.ParameterToString(opts.SinceSeconds, ""))
+	}
+	if opts.TailLines > 0 {
+		query.Add("tailLines", common.ParameterToString(opts.TailLines, ""))
+	}
+	return query
+}
+
+// instanceLog issues a log request for a cluster instance and returns the
+// response with its body unread, as the generated GetClusterInstanceLog call
+// reads the whole log into a string. Responses outside the 2xx range are
+// turned into errors.
+func instanceLog(ctx context.Context, client *common.APIClient, orgName, clusterName, workloadName string, query _neturl.Values) (*_nethttp.Response, error) {
+	localBasePath, err := client.Cfg.ServerURLWithContext(ctx, ".ClusterApi.GetClusterInstanceLog")
+	if err != nil {
+		return nil, common.GenericOpenAPIError{ErrorMessage: err.Error()}
+	}
+
+	localVarPath := localBasePath + instanceLogPath
+	localVarPath = strings.Replace(localVarPath, "{"+"orgName"+"}", _neturl.PathEscape(common.ParameterToString(orgName, "")), -1)
+	localVarPath = strings.Replace(localVarPath, "{"+"clusterName"+"}", _neturl.PathEscape(common.ParameterToString(clusterName, "")), -1)
+	localVarPath = strings.Replace(localVarPath, "{"+"workloadName"+"}", _neturl.PathEscape(common.ParameterToString(workloadName, "")), -1)
+
+	localVarHeaderParams := make(map[string]string)
+	localVarHeaderParams["Accept"] = "application/json"
+	common.SetAuthKeys(
+		ctx,
+		&localVarHeaderParams,
+		[2]string{"BearerToken", "authorization"},
+	)
+	req, err := client.PrepareRequest(ctx, localVarPath, _nethttp.MethodGet, nil, localVarHeaderParams, query, _neturl.Values{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.CallAPI(req)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		localVarBody, _ := common.ReadBody(resp)
+		newErr := common.GenericOpenAPIError{
+			ErrorBody:    localVarBody,
+			ErrorMessage: resp.Status,
+		}
+		if resp.StatusCode == 401 {
+			var v kbcloud.APIErrorResponse
+			if err := client.Decode(&v, localVarBody, resp.Header.Get("Content-Type")); err == nil {
+				newErr.ErrorModel = v
+			}
+		}
+		return nil, newErr
+	}
+	return resp, nil
+}
@@ -0,0 +1,145 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package logs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// instanceLogStandIn serves a container log that grows by one line per
+// request, and records the query of every request.
+type instanceLogStandIn struct {
+	mu      sync.Mutex
+	lines   []string
+	queries []string
+}
+
+func (s *instanceLogStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if apitest.OrgPath(r, "org") != "/clusters/cluster/workloads/mysql-0/log" {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, r.URL.RawQuery)
+	s.lines = append(s.lines, fmt.Sprintf("line %d", len(s.lines)))
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, strings.Join(s.lines, "\n")+"\n")
+}
+
+func TestOpenInstanceLog(t *testing.T) {
+	s := &instanceLogStandIn{}
+	r, err := OpenInstanceLog(context.Background(), apitest.NewClient(t, s), "org", "cluster", "mysql-0", InstanceLogOptions{
+		WorkloadType: "Pod", TailLines: 10, Previous: true, Follow: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "line 0\n" {
+		t.Fatalf("log = %q, %v", data, err)
+	}
+	if len(s.queries) != 1 || s.queries[0] != "previous=true&tailLines=10&workloadType=Pod" {
+		t.Errorf("queries = %v", s.queries)
+	}
+}
+
+func TestOpenInstanceLogStreams(t *testing.T) {
+	for _, follow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("follow=%v", follow), func(t *testing.T) {
+			read := make(chan struct{})
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Has("sinceSeconds") {
+					io.WriteString(w, "line 1\nline 2\n")
+					return
+				}
+				io.WriteString(w, "line 0\n")
+				w.(http.Flusher).Flush()
+				// The rest of the log is only sent once the first line was read.
+				select {
+				case <-read:
+				case <-time.After(5 * time.Second):
+					t.Error("the log was not streamed")
+				}
+				io.WriteString(w, "line 1\n")
+			})
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			r, err := OpenInstanceLog(ctx, apitest.NewClient(t, h), "org", "cluster", "mysql-0", InstanceLogOptions{
+				Follow: follow, PollInterval: time.Millisecond,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			br := bufio.NewReader(r)
+			var got []string
+			for len(got) < 2 || follow && len(got) < 3 {
+				line, err := br.ReadString('\n')
+				if err != nil {
+					t.Fatalf("lines %q: %v", got, err)
+				}
+				if len(got) == 0 {
+					close(read)
+				}
+				got = append(got, line)
+			}
+			want := []string{"line 0\n", "line 1\n", "line 2\n"}
+			if strings.Join(got, "") != strings.Join(want[:len(got)], "") {
+				t.Errorf("lines = %q", got)
+			}
+		})
+	}
+}
+
+func TestScanInstanceLog(t *testing.T) {
+	s := &instanceLogStandIn{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stop := errors.New("stop")
+	var got []string
+	err := ScanInstanceLog(ctx, apitest.NewClient(t, s), "org", "cluster", "mysql-0", InstanceLogOptions{
+		TailLines: 5, Follow: true, PollInterval: time.Millisecond,
+	}, func(line string) error {
+		got = append(got, line)
+		if len(got) == 5 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("got error %v, want %v", err, stop)
+	}
+	for i, line := range got {
+		if want := fmt.Sprintf("line %d", i); line != want {
+			t.Errorf("line %d = %q, want %q", i, line, want)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queries[0] != "tailLines=5" {
+		t.Errorf("first query = %s", s.queries[0])
+	}
+	for _, q := range s.queries[1:] {
+		if !strings.HasPrefix(q, "sinceSeconds=") {
+			t.Errorf("poll query = %s", q)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package logs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// Kind selects the cluster log endpoint to query.
+type Kind string
+
+// List of Kind.
+const (
+	KindAudit   Kind = "audit"
+	KindError   Kind = "error"
+	KindPod     Kind = "pod"
+	KindRunning Kind = "running"
+	KindSlow    Kind = "slow"
+)
+
+// List of normalized log levels.
+const (
+	LevelFatal = "FATAL"
+	LevelError = "ERROR"
+	LevelWarn  = "WARN"
+	LevelInfo  = "INFO"
+	LevelDebug = "DEBUG"
+)
+
+// Entry is a typed cluster log entry. Message logs (error, pod and running)
+// fill Message and Level; execution logs (audit and slow) fill the statement fields.
+type Entry struct {
+	Timestamp time.Time
+	Component string
+	Instance  string
+	Level     string
+	Message   string
+
+	Client   string
+	Database string
+	User     string
+	// SQL is the statement text of an execution log entry.
+	SQL string
+	// QueryTime is the statement execution time.
+	QueryTime    time.Duration
+	LockTime     time.Duration
+	RowsExamined int64
+	RowsSent     int64
+
+	// Extra holds the engine specific fields of the entry as returned by the API.
+	Extra map[string]string
+}
+
+// Query selects cluster log entries.
+type Query struct {
+	Kind      Kind
+	Start     time.Time
+	End       time.Time
+	Component string
+	Instance  string
+	// Limit is the maximum number of entries per request. Zero uses the server default.
+	Limit int
+	// Sort orders entries by time. Defaults to ascending.
+	Sort kbcloud.SortType
+}
+
+// Page is the result of a single request.
+type Page struct {
+	Entries []Entry
+	// NextStart and NextEnd are the window of the next page when the server provides one.
+	NextStart, NextEnd time.Time
+}
+
+// QuerierOptions configures a Querier.
+type QuerierOptions struct {
+	// ExecutionTimeUnit is the unit of the executionTime field of execution logs. Defaults to time.Millisecond.
+	ExecutionTimeUnit time.Duration
+	// FormatTime formats the startTime and endTime parameters. Defaults to Unix seconds.
+	FormatTime func(time.Time) string
+	// Precision is the resolution of FormatTime. Defaults to time.Second.
+	Precision time.Duration
+	// WindowSize splits the range of Iterate into windows queried one after
+	// another. It should be a multiple of Precision. Zero queries the whole range.
+	WindowSize time.Duration
+}
+
+// Querier queries cluster logs with typed inputs and results.
+type Querier struct {
+	clusterLogApi *kbcloud.ClusterLogApi
+	opts          QuerierOptions
+}
+
+// NewQuerier returns a Querier using client.
+func NewQuerier(client *common.APIClient, opts QuerierOptions) *Querier {
+	if opts.ExecutionTimeUnit <= 0 {
+		opts.ExecutionTimeUnit = time.Millisecond
+	}
+	if opts.FormatTime == nil {
+		opts.FormatTime = func(t time.Time) string { return strconv.FormatInt(t.Unix(), 10) }
+	}
+	if opts.Precision <= 0 {
+		opts.Precision = time.Second
+	}
+	return &Querier{clusterLogApi: kbcloud.NewClusterLogApi(client), opts: opts}
+}
+
+// Query runs a single request.
+func (q *Querier) Query(ctx context.Context, orgName, clusterName string, query Query) (Page, error) {
+	start, end := q.opts.FormatTime(query.Start), q.opts.FormatTime(query.End)
+	var limit *string
+	if query.Limit > 0 {
+		limit = common.PtrString(strconv.Itoa(query.Limit))
+	}
+	component, instance := optional(query.Component), optional(query.Instance)
+	sort := query.Sort
+	if sort == "" {
+		sort = kbcloud.SortTypeAsc
+	}
+
+	var raw interface{}
+	var err error
+	switch query.Kind {
+	case KindAudit:
+		raw, _, err = q.clusterLogApi.QueryAuditLogs(ctx, orgName, clusterName, start, end, kbcloud.QueryAuditLogsOptionalParameters{
+			Limit: limit, ComponentName: component, InstanceName: instance, SortType: &sort})
+	case KindError:
+		raw, _, err = q.clusterLogApi.QueryErrorLogs(ctx, orgName, clusterName, start, end, kbcloud.QueryErrorLogsOptionalParameters{
+			Limit: limit, ComponentName: component, InstanceName: instance, SortType: &sort})
+	case KindPod:
+		raw, _, err = q.clusterLogApi.QueryPodLogs(ctx, orgName, clusterName, start, end, kbcloud.QueryPodLogsOptionalParameters{
+			Limit: limit, ComponentName: component, InstanceName: instance, SortType: &sort})
+	case KindRunning:
+		raw, _, err = q.clusterLogApi.QueryRunningLogs(ctx, orgName, clusterName, start, end, kbcloud.QueryRunningLogsOptionalParameters{
+			Limit: limit, ComponentName: component, InstanceName: instance, SortType: &sort})
+	case KindSlow:
+		raw, _, err = q.clusterLogApi.QuerySlowLogs(ctx, orgName, clusterName, start, end, kbcloud.QuerySlowLogsOptionalParameters{
+			Limit: limit, ComponentName: component, InstanceName: instance, SortType: &sort})
+	default:
+		return Page{}, fmt.Errorf("unknown log kind %q", query.Kind)
+	}
+	if err != nil {
+		return Page{}, fmt.Errorf("query %s logs: %w", query.Kind, err)
+	}
+	return q.decode(raw, query)
+}
+
+// Iterate calls fn with every entry of query in Sort order until the range is
+// exhausted, fn returns an error or ctx is done. The range is split into
+// windows of WindowSize, and a window whose page is full is queried again
+// from the last entry seen, so more than Limit entries can be read. Entries
+// sharing the boundary instant are only returned once.
+func (q *Querier) Iterate(ctx context.Context, orgName, clusterName string, query Query, fn func(Entry) error) error {
+	if !query.End.After(query.Start) {
+		return fmt.Errorf("invalid log range [%s, %s)", query.Start, query.End)
+	}
+	desc := query.Sort == kbcloud.SortTypeDesc
+	for lo, hi := query.Start, query.End; lo.Before(hi); {
+		window := query
+		window.Start, window.End = lo, hi
+		if size := q.opts.WindowSize; size > 0 {
+			if desc && hi.Sub(lo) > size {
+				window.Start = hi.Add(-size)
+			} else if !desc && hi.Sub(lo) > size {
+				window.End = lo.Add(size)
+			}
+		}
+		if err := q.iterateWindow(ctx, orgName, clusterName, window, fn); err != nil {
+			return err
+		}
+		if desc {
+			hi = window.Start
+		} else {
+			lo = window.End
+		}
+	}
+	return nil
+}
+
+// iterateWindow pages through a single window.
+func (q *Querier) iterateWindow(ctx context.Context, orgName, clusterName string, window Query, fn func(Entry) error) error {
+	desc := window.Sort == kbcloud.SortTypeDesc
+	// seen counts the entries at the boundary instant, which the next page
+	// may return again. Identical entries are counted, not collapsed.
+	var seen map[string]int
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page, err := q.Query(ctx, orgName, clusterName, window)
+		if err != nil {
+			return err
+		}
+		for _, e := range page.Entries {
+			if key := entryKey(e); seen[key] > 0 {
+				seen[key]--
+				continue
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+
+		if len(page.Entries) == 0 {
+			return nil
+		}
+
+		next := window
+		switch {
+		case !page.NextStart.IsZero() || !page.NextEnd.IsZero():
+			if !page.NextStart.IsZero() {
+				next.Start = page.NextStart
+			}
+			if !page.NextEnd.IsZero() {
+				next.End = page.NextEnd
+			}
+		case window.Limit > 0 && len(page.Entries) >= window.Limit:
+			// The bounds are sent with Precision, so the next page starts
+			// with the whole instant of the last entry.
+			last := page.Entries[len(page.Entries)-1].Timestamp.Truncate(q.opts.Precision)
+			if desc {
+				if end := last.Add(q.opts.Precision); end.Before(window.End) {
+					next.End = end
+				}
+			} else if last.After(window.Start) {
+				next.Start = last
+			}
+		default:
+			return nil
+		}
+		if !next.End.After(next.Start) {
+			return nil
+		}
+		if next.Start.Equal(window.Start) && next.End.Equal(window.End) {
+			return fmt.Errorf("more than %d %s logs within %s at %s: raise the limit to page past them",
+				window.Limit, window.Kind, q.opts.Precision, page.Entries[len(page.Entries)-1].Timestamp)
+		}
+
+		instant := page.Entries[len(page.Entries)-1].Timestamp.Truncate(q.opts.Precision)
+		seen = map[string]int{}
+		for _, e := range page.Entries {
+			if e.Timestamp.Truncate(q.opts.Precision).Equal(instant) {
+				seen[entryKey(e)]++
+			}
+		}
+		window = next
+	}
+}
+
+// entryKey identifies an entry across overlapping pages.
+func entryKey(e Entry) string {
+	return strings.Join([]string{strconv.FormatInt(e.Timestamp.UnixNano(), 10), e.Instance, e.Level, e.Message, e.SQL}, "\x00")
+}
+
+type rawResponse struct {
+	Items      []json.RawMessage `json:"items"`
+	Pagination struct {
+		NextStartTime flexTime `json:"nextStartTime"`
+		NextEndTime   flexTime `json:"nextEndTime"`
+	} `json:"pagination"`
+}
+
+// messageLog is an entry of the message logs (error, pod and running), which
+// the API leaves untyped. Execution logs decode into kbcloud.ClusterExecutionLog.
+type messageLog struct {
+	Timestamp flexTime               `json:"timestamp"`
+	Message   string                 `json:"message"`
+	Extra     map[string]interface{} `json:"extra"`
+}
+
+// decode converts the untyped API result into a Page.
+func (q *Querier) decode(raw interface{}, query Query) (Page, error) {
+	data, err := common.Marshal(raw)
+	if err != nil {
+		return Page{}, err
+	}
+	var resp rawResponse
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		// Some deployments return the entries without the list envelope.
+		err = common.Unmarshal(trimmed, &resp.Items)
+	} else {
+		err = common.Unmarshal(data, &resp)
+	}
+	if err != nil {
+		return Page{}, fmt.Errorf("decode %s logs: %w", query.Kind, err)
+	}
+	page := Page{
+		Entries:   make([]Entry, 0, len(resp.Items)),
+		NextStart: time.Time(resp.Pagination.NextStartTime),
+		NextEnd:   time.Time(resp.Pagination.NextEndTime),
+	}
+	for _, item := range resp.Items {
+		e, err := q.decodeEntry(item, query)
+		if err != nil {
+			return Page{}, fmt.Errorf("decode %s logs: %w", query.Kind, err)
+		}
+		page.Entries = append(page.Entries, e)
+	}
+	return page, nil
+}
+
+func (q *Querier) decodeEntry(data []byte, query Query) (Entry, error) {
+	if query.Kind != KindAudit && query.Kind != KindSlow {
+		var item messageLog
+		if err := common.Unmarshal(data, &item); err != nil {
+			return Entry{}, err
+		}
+		return q.entry(Entry{Timestamp: time.Time(item.Timestamp), Message: item.Message}, item.Extra, query), nil
+	}
+	var item kbcloud.ClusterExecutionLog
+	if err := common.Unmarshal(data, &item); err != nil {
+		return Entry{}, err
+	}
+	if item.UnparsedObject != nil {
+		return Entry{}, fmt.Errorf("invalid execution log %s", data)
+	}
+	return q.entry(Entry{
+		Timestamp: unixTime(float64(item.Timestamp)),
+		Client:    item.Client,
+		Database:  item.DbName,
+		User:      item.User,
+		SQL:       item.Command,
+		QueryTime: time.Duration(item.ExecutionTime * float64(q.opts.ExecutionTimeUnit)),
+	}, item.Extra, query), nil
+}
+
+// entry completes e with the query scope and the fields found in extra.
+func (q *Querier) entry(e Entry, extra map[string]interface{}, query Query) Entry {
+	e.Component, e.Instance = query.Component, query.Instance
+	e.Extra = make(map[string]string, len(extra))
+	// Index extra fields by a normalized key, so "rows_examined" and "rowsExamined" both match.
+	norm := map[string]string{}
+	for k, v := range extra {
+		s := fmt.Sprint(v)
+		e.Extra[k] = s
+		norm[strings.ReplaceAll(strings.ToLower(k), "_", "")] = s
+	}
+	pick := func(keys ...string) string {
+		for _, k := range keys {
+			if v, ok := norm[k]; ok && v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	if v := pick("instancename", "instance", "podname", "pod"); v != "" {
+		e.Instance = v
+	}
+	if v := pick("componentname", "component"); v != "" {
+		e.Component = v
+	}
+	if e.QueryTime == 0 {
+		e.QueryTime = seconds(pick("querytime", "duration"))
+	}
+	e.LockTime = seconds(pick("locktime"))
+	e.RowsExamined, _ = strconv.ParseInt(pick("rowsexamined"), 10, 64)
+	e.RowsSent, _ = strconv.ParseInt(pick("rowssent", "rows"), 10, 64)
+	if e.Level = normalizeLevel(pick("level", "severity")); e.Level == "" {
+		e.Level = levelOf(e.Message)
+	}
+	return e
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// seconds parses a duration given in seconds, such as the query_time of a MySQL slow log.
+func seconds(s string) time.Duration {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
+
+var levelPattern = regexp.MustCompile(`(?i)\blevel=["']?(\w+)|\[(fatal|panic|error|err|warning|warn|note|info|debug|system)\]|\b(FATAL|PANIC|ERROR|WARNING|WARN|NOTICE|INFO|LOG|DEBUG\d?)\b:?`)
+
+// levelOf extracts the level of a message log line.
+func levelOf(message string) string {
+	m := levelPattern.FindStringSubmatch(message)
+	if m == nil {
+		return ""
+	}
+	for _, g := range m[1:] {
+		if g != "" {
+			return normalizeLevel(g)
+		}
+	}
+	return ""
+}
+
+func normalizeLevel(level string) string {
+	switch l := strings.ToUpper(strings.TrimSpace(level)); {
+	case l == "":
+		return ""
+	case l == "FATAL" || l == "PANIC" || l == "CRITICAL":
+		return LevelFatal
+	case l == "ERROR" || l == "ERR":
+		return LevelError
+	case l == "WARNING" || l == "WARN":
+		return LevelWarn
+	case l == "INFO" || l == "NOTE" || l == "NOTICE" || l == "LOG" || l == "SYSTEM":
+		return LevelInfo
+	case strings.HasPrefix(l, "DEBUG"):
+		return LevelDebug
+	default:
+		return l
+	}
+}
+
+// flexTime decodes timestamps sent as RFC 3339 strings or as Unix seconds,
+// milliseconds or nanoseconds, either quoted or not.
+type flexTime time.Time
+
+func (t *flexTime) UnmarshalJSON(data []byte) error {
+	s := string(bytes.Trim(data, `"`))
+	if s == "" || s == "null" {
+		return nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		*t = flexTime(unixTime(n))
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999"} {
+		if v, err := time.Parse(layout, s); err == nil {
+			*t = flexTime(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid timestamp %q", s)
+}
+
+// unixTime interprets n as seconds, milliseconds, microseconds or nanoseconds by its magnitude.
+func unixTime(n float64) time.Time {
+	switch {
+	case n >= 1e17:
+		return time.Unix(0, int64(n))
+	case n >= 1e14:
+		return time.UnixMicro(int64(n))
+	case n >= 1e11:
+		return time.UnixMilli(int64(n))
+	default:
+		sec := int64(n)
+		return time.Unix(sec, int64((n-float64(sec))*1e9))
+	}
+}
@@ -0,0 +1,192 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package logs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// slowLogStandIn serves slow logs from a fixed set of entries, honoring the
+// time range, limit and sort order of the request.
+type slowLogStandIn struct {
+	entries  []map[string]interface{}
+	requests int
+}
+
+func (s *slowLogStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests++
+	q := r.URL.Query()
+	start, _ := strconv.ParseInt(q.Get("startTime"), 10, 64)
+	end, _ := strconv.ParseInt(q.Get("endTime"), 10, 64)
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	items := []map[string]interface{}{}
+	for _, e := range s.entries {
+		if ts := e["timestamp"].(int64) / 1000; ts >= start && ts < end {
+			items = append(items, e)
+		}
+	}
+	desc := q.Get("sortType") == string(kbcloud.SortTypeDesc)
+	sort.SliceStable(items, func(i, j int) bool {
+		if desc {
+			return items[i]["timestamp"].(int64) > items[j]["timestamp"].(int64)
+		}
+		return items[i]["timestamp"].(int64) < items[j]["timestamp"].(int64)
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	apitest.WriteJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+}
+
+func newSlowLogStandIn(t *testing.T, base time.Time, n int) (*slowLogStandIn, *common.APIClient) {
+	s := &slowLogStandIn{}
+	for i := 0; i < n; i++ {
+		// Two entries per second, so pages end in the middle of a second.
+		ts := base.Add(time.Duration(i) * 500 * time.Millisecond)
+		s.entries = append(s.entries, map[string]interface{}{
+			"timestamp":     ts.UnixMilli(),
+			"command":       "SELECT " + strconv.Itoa(i),
+			"dbName":        "app",
+			"user":          "root",
+			"client":        "app@10.0.0.7",
+			"executionTime": 1500.0,
+			"extra":         map[string]interface{}{"rows_examined": i, "Rows_sent": "1", "podName": "mysql-0"},
+		})
+	}
+	return s, apitest.NewClient(t, s)
+}
+
+func TestIterate(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	for _, order := range []kbcloud.SortType{kbcloud.SortTypeAsc, kbcloud.SortTypeDesc} {
+		t.Run(string(order), func(t *testing.T) {
+			s, client := newSlowLogStandIn(t, base, 25)
+			q := NewQuerier(client, QuerierOptions{WindowSize: 5 * time.Second})
+
+			var got []Entry
+			err := q.Iterate(context.Background(), "org", "cluster", Query{
+				Kind: KindSlow, Start: base, End: base.Add(time.Minute), Limit: 3, Sort: order,
+			}, func(e Entry) error {
+				got = append(got, e)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 25 {
+				t.Fatalf("got %d entries, want 25", len(got))
+			}
+			for i := 1; i < len(got); i++ {
+				before := got[i-1].Timestamp.Before(got[i].Timestamp)
+				if (order == kbcloud.SortTypeAsc) != before {
+					t.Fatalf("entries %d and %d are not in %s order", i-1, i, order)
+				}
+			}
+			if s.requests <= 12 {
+				t.Errorf("served %d requests, want the windows to be paged", s.requests)
+			}
+
+			e := got[0]
+			if order == kbcloud.SortTypeDesc {
+				e = got[len(got)-1]
+			}
+			if e.SQL != "SELECT 0" || e.Instance != "mysql-0" || e.RowsSent != 1 || e.QueryTime != 1500*time.Millisecond || !e.Timestamp.Equal(base) {
+				t.Errorf("unexpected entry %+v", e)
+			}
+		})
+	}
+}
+
+func TestLevelOf(t *testing.T) {
+	for message, want := range map[string]string{
+		"2024-01-01T00:00:00.000000Z 0 [Warning] [MY-010068] CA certificate is self signed.": LevelWarn,
+		"2024-01-01 00:00:00.000 UTC [1] LOG:  database system is ready":                     LevelInfo,
+		`time="2024-01-01T00:00:00Z" level=error msg="lost connection"`:                      LevelError,
+		"plain text": "",
+	} {
+		if got := levelOf(message); got != want {
+			t.Errorf("levelOf(%q) = %q, want %q", message, got, want)
+		}
+	}
+}
+
+func TestQueryDecode(t *testing.T) {
+	var body string
+	client := apitest.NewClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apitest.WriteJSON(w, http.StatusOK, body)
+	}))
+	q := NewQuerier(client, QuerierOptions{})
+	query := func(kind Kind) (Page, error) {
+		return q.Query(context.Background(), "org", "cluster", Query{Kind: kind, Component: "mysql", Start: time.Unix(0, 0), End: time.Unix(60, 0)})
+	}
+
+	// Message logs are untyped and may send RFC 3339 timestamps without the list envelope.
+	body = `[{"timestamp": "2024-01-01T00:00:00.5Z", "message": "2024-01-01T00:00:00Z 0 [Warning] slow disk", "extra": {"podName": "mysql-1"}}]`
+	page, err := query(KindError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := page.Entries[0]; !e.Timestamp.Equal(time.Date(2024, 1, 1, 0, 0, 0, 5e8, time.UTC)) || e.Level != LevelWarn ||
+		e.Instance != "mysql-1" || e.Component != "mysql" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	body = `{"items": [{"timestamp": 1700000000000, "client": "app@10.0.0.7", "dbName": "shop", "user": "app", "executionTime": 2.5,
+		"command": "SELECT 1", "extra": {"lock_time": "0.001"}}], "pagination": {"nextStartTime": 1700000001}}`
+	page, err = query(KindSlow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := page.Entries[0]; !e.Timestamp.Equal(time.UnixMilli(1700000000000)) || e.SQL != "SELECT 1" || e.Database != "shop" ||
+		e.QueryTime != 2500*time.Microsecond || e.LockTime != time.Millisecond || !page.NextStart.Equal(time.Unix(1700000001, 0)) {
+		t.Errorf("unexpected page %+v", page)
+	}
+
+	// Execution logs are decoded into the API model, which requires every field.
+	body = `{"items": [{"timestamp": 1700000000000, "command": "SELECT 1"}]}`
+	if _, err := query(KindAudit); err == nil {
+		t.Error("incomplete execution log accepted")
+	}
+}
+
+func TestIterateIdenticalEntries(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	s := &slowLogStandIn{}
+	for _, e := range []struct {
+		at  time.Duration
+		sql string
+	}{{0, "SELECT x"}, {0, "SELECT y"}, {time.Second, "SELECT 1"}, {time.Second, "SELECT 1"}} {
+		s.entries = append(s.entries, map[string]interface{}{
+			"timestamp": base.Add(e.at).UnixMilli(), "command": e.sql, "dbName": "app", "user": "root",
+			"client": "app@10.0.0.7", "executionTime": 1.0, "extra": map[string]interface{}{},
+		})
+	}
+	q := NewQuerier(apitest.NewClient(t, s), QuerierOptions{})
+
+	// The first page ends between the identical entries, which the second page returns again.
+	var got []string
+	err := q.Iterate(context.Background(), "org", "cluster", Query{Kind: KindSlow, Start: base, End: base.Add(time.Minute), Limit: 3},
+		func(e Entry) error {
+			got = append(got, e.SQL)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != "[SELECT x SELECT y SELECT 1 SELECT 1]" {
+		t.Errorf("entries = %q", got)
+	}
+}
@@ -0,0 +1,337 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package slowlog
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Dialect is the SQL dialect of the statements to fingerprint.
+type Dialect string
+
+// List of Dialect.
+const (
+	DialectMySQL      Dialect = "mysql"
+	DialectPostgreSQL Dialect = "postgresql"
+)
+
+// DialectOf maps a cluster engine name, such as "apecloud-mysql", to its SQL dialect.
+func DialectOf(engine string) (Dialect, error) {
+	n := strings.ToLower(engine)
+	switch {
+	case strings.Contains(n, "mysql"), strings.Contains(n, "mariadb"):
+		return DialectMySQL, nil
+	case strings.Contains(n, "postgres"), strings.Contains(n, "orioledb"):
+		return DialectPostgreSQL, nil
+	}
+	return "", fmt.Errorf("no slow log dialect for engine %q", engine)
+}
+
+// Fingerprint normalizes a statement so that statements differing only in
+// their literals are equal: comments are removed, literals and bind parameters
+// become ?, keywords and identifiers are lower-cased, whitespace is
+// canonicalized, and IN lists and multi-row VALUES lists collapse to (?+).
+func Fingerprint(dialect Dialect, sql string) string {
+	tokens := collapseLists(tokenize(dialect, sql))
+	for len(tokens) > 0 && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	var b strings.Builder
+	for i, t := range tokens {
+		if i > 0 && space(tokens[i-1], t) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+// ID returns a short checksum of a fingerprint, as used to identify query
+// classes in reports.
+func ID(fingerprint string) string {
+	sum := md5.Sum([]byte(fingerprint))
+	return strings.ToUpper(hex.EncodeToString(sum[8:]))
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenLiteral
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+const operatorChars = "<>=!|&+-*/%^~:@#"
+
+func tokenize(dialect Dialect, sql string) []token {
+	var tokens []token
+	literal := func() {
+		tokens = append(tokens, token{kind: tokenLiteral, text: "?"})
+	}
+	afterValue := func() bool {
+		if len(tokens) == 0 {
+			return false
+		}
+		last := tokens[len(tokens)-1]
+		return last.kind != tokenPunct || last.text == ")"
+	}
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+		case strings.HasPrefix(sql[i:], "--") || (c == '#' && dialect == DialectMySQL):
+			if j := strings.IndexByte(sql[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(sql)
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			if j := strings.Index(sql[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(sql)
+			}
+		case c == '\'':
+			// MySQL always honors backslash escapes; PostgreSQL only in E'' strings.
+			escapes := dialect == DialectMySQL || (i > 0 && (sql[i-1] == 'e' || sql[i-1] == 'E'))
+			i = skipQuoted(sql, i, '\'', escapes)
+			literal()
+		case c == '"' && dialect == DialectMySQL:
+			i = skipQuoted(sql, i, '"', true)
+			literal()
+		case c == '"' || c == '`':
+			// Quoted identifiers keep their case but lose the quotes.
+			end := skipQuoted(sql, i, c, false)
+			name := strings.ReplaceAll(sql[i+1:end-1], string([]byte{c, c}), string(c))
+			tokens = append(tokens, token{kind: tokenWord, text: name})
+			i = end
+		case c == '$' && dialect == DialectPostgreSQL:
+			j := i + 1
+			for j < len(sql) && (isDigit(sql[j])) {
+				j++
+			}
+			if j > i+1 {
+				// A bind parameter such as $1.
+				i = j
+				literal()
+				break
+			}
+			if tag := dollarTag(sql[i:]); tag != "" {
+				if k := strings.Index(sql[i+len(tag):], tag); k >= 0 {
+					i += len(tag) + k + len(tag)
+				} else {
+					i = len(sql)
+				}
+				literal()
+				break
+			}
+			tokens = append(tokens, token{kind: tokenPunct, text: "$"})
+			i++
+		case c == '?':
+			i++
+			literal()
+		case isDigit(c) || (c == '.' && i+1 < len(sql) && isDigit(sql[i+1]) && !afterValue()):
+			i = skipNumber(sql, i)
+			// A sign directly after an operator or at the start belongs to the number.
+			if n := len(tokens); n > 0 && (tokens[n-1].text == "-" || tokens[n-1].text == "+") &&
+				(n == 1 || tokens[n-2].kind == tokenPunct && tokens[n-2].text != ")") {
+				tokens = tokens[:n-1]
+			}
+			literal()
+		case c == '(' || c == ')' || c == ',' || c == ';' || c == '.' || c == '[' || c == ']' || c == '{' || c == '}':
+			tokens = append(tokens, token{kind: tokenPunct, text: string(c)})
+			i++
+		case strings.IndexByte(operatorChars, c) >= 0:
+			j := i + 1
+			for j < len(sql) && strings.IndexByte(operatorChars, sql[j]) >= 0 &&
+				!strings.HasPrefix(sql[j:], "--") && !strings.HasPrefix(sql[j:], "/*") {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenPunct, text: sql[i:j]})
+			i = j
+		default:
+			j := i
+			for j < len(sql) {
+				r, size := utf8.DecodeRuneInString(sql[j:])
+				if r != '_' && r != '$' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				j += size
+			}
+			if j == i {
+				_, size := utf8.DecodeRuneInString(sql[i:])
+				j = i + size
+			}
+			word := strings.ToLower(sql[i:j])
+			switch {
+			case word == "null" || word == "true" || word == "false":
+				literal()
+			case len(word) == 1 && strings.Contains("bxne", word) && j < len(sql) && sql[j] == '\'':
+				// The prefix of a bit, hex, national or escape string literal.
+			default:
+				tokens = append(tokens, token{kind: tokenWord, text: word})
+			}
+			i = j
+		}
+	}
+	return tokens
+}
+
+// skipQuoted returns the index after the quoted string starting at sql[i].
+// A doubled quote always escapes it; a backslash does when escapes is set.
+func skipQuoted(sql string, i int, quote byte, escapes bool) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch sql[j] {
+		case '\\':
+			if escapes {
+				j++
+			}
+		case quote:
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+// dollarTag returns the opening tag of a PostgreSQL dollar-quoted string, such as $$ or $body$.
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+		if c == '$' {
+			return s[:j+1]
+		}
+		if c != '_' && !unicode.IsLetter(rune(c)) && !(j > 1 && isDigit(c)) {
+			return ""
+		}
+	}
+	return ""
+}
+
+// skipNumber returns the index after the numeric literal starting at sql[i].
+func skipNumber(sql string, i int) int {
+	j := i
+	if strings.HasPrefix(sql[i:], "0x") || strings.HasPrefix(sql[i:], "0X") || strings.HasPrefix(sql[i:], "0b") {
+		j += 2
+		for j < len(sql) && isHex(sql[j]) {
+			j++
+		}
+		return j
+	}
+	for j < len(sql) && (isDigit(sql[j]) || sql[j] == '.') {
+		j++
+	}
+	if j < len(sql) && (sql[j] == 'e' || sql[j] == 'E') {
+		k := j + 1
+		if k < len(sql) && (sql[k] == '+' || sql[k] == '-') {
+			k++
+		}
+		if k < len(sql) && isDigit(sql[k]) {
+			j = k
+			for j < len(sql) && isDigit(sql[j]) {
+				j++
+			}
+		}
+	}
+	return j
+}
+
+// collapseLists replaces IN lists and multi-row VALUES lists made only of
+// literals with a single (?+), so that their length does not matter.
+func collapseLists(tokens []token) []token {
+	out := tokens[:0:0]
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		out = append(out, t)
+		if t.kind != tokenWord || (t.text != "in" && t.text != "values" && t.text != "value") {
+			continue
+		}
+		end := literalTuple(tokens, i+1)
+		if end < 0 {
+			continue
+		}
+		if t.text != "in" {
+			for end+1 < len(tokens) && tokens[end].text == "," {
+				next := literalTuple(tokens, end+1)
+				if next < 0 {
+					break
+				}
+				end = next
+			}
+		}
+		out = append(out, token{kind: tokenPunct, text: "("}, token{kind: tokenLiteral, text: "?+"}, token{kind: tokenPunct, text: ")"})
+		i = end - 1
+	}
+	return out
+}
+
+// literalTuple returns the index after the parenthesized list of literals
+// starting at tokens[i], or -1 if there is none.
+func literalTuple(tokens []token, i int) int {
+	if i >= len(tokens) || tokens[i].text != "(" {
+		return -1
+	}
+	for j := i + 1; j+1 < len(tokens); j += 2 {
+		if tokens[j].kind != tokenLiteral {
+			return -1
+		}
+		switch tokens[j+1].text {
+		case ")":
+			return j + 2
+		case ",":
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// space reports whether a space separates two adjacent tokens in a fingerprint.
+func space(prev, next token) bool {
+	switch {
+	case next.text == "," || next.text == ")" || next.text == ";" || next.text == "." || next.text == "::" || next.text == "]":
+		return false
+	case prev.text == "(" || prev.text == "." || prev.text == "::" || prev.text == "[":
+		return false
+	case next.text == "(" && prev.kind == tokenWord && !keywordBeforeList[prev.text]:
+		// A function call.
+		return false
+	case next.text == "[" && prev.kind != tokenPunct:
+		return false
+	}
+	return true
+}
+
+// keywordBeforeList holds the keywords that are followed by a parenthesized
+// list rather than called like a function.
+var keywordBeforeList = map[string]bool{
+	"and": true, "or": true, "not": true, "on": true, "from": true, "join": true, "where": true,
+	"select": true, "as": true, "exists": true, "with": true, "using": true, "union": true, "all": true,
+	"any": true, "some": true, "into": true, "when": true, "then": true, "else": true, "set": true,
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
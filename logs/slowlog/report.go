@@ -0,0 +1,76 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package slowlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+)
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := common.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the report as a Markdown document with a profile of the
+// ranked query classes followed by the details of every class.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	b := bufio.NewWriter(w)
+
+	b.WriteString("# Slow query digest\n\n")
+	if !r.FirstSeen.IsZero() {
+		fmt.Fprintf(b, "- Time range: %s to %s\n", r.FirstSeen.UTC().Format(time.RFC3339), r.LastSeen.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(b, "- Queries: %d total, %d unique\n", r.Count, r.Unique)
+	fmt.Fprintf(b, "- Total query time: %s\n", r.TotalTime)
+	fmt.Fprintf(b, "- Ranked by: %s\n\n", r.SortBy)
+
+	if len(r.Classes) > 0 {
+		b.WriteString("| Rank | Query ID | Total time | Share | Calls | Avg | P95 | Rows examined | Fingerprint |\n")
+		b.WriteString("|---|---|---|---|---|---|---|---|---|\n")
+		for i, c := range r.Classes {
+			fmt.Fprintf(b, "| %d | %s | %s | %.1f%% | %d | %s | %s | %d | `%s` |\n",
+				i+1, c.ID, c.TotalTime, c.TimeShare*100, c.Count, c.AvgTime, c.P95Time, c.RowsExamined, cell(abbreviate(c.Fingerprint, 60)))
+		}
+	}
+
+	for i, c := range r.Classes {
+		fmt.Fprintf(b, "\n## %d. Query %s\n\n", i+1, c.ID)
+		fmt.Fprintf(b, "- Calls: %d\n", c.Count)
+		fmt.Fprintf(b, "- Query time: total %s, min %s, avg %s, p95 %s, max %s\n", c.TotalTime, c.MinTime, c.AvgTime, c.P95Time, c.MaxTime)
+		fmt.Fprintf(b, "- Rows examined: total %d, avg %d; rows sent: %d\n", c.RowsExamined, c.AvgRowsExamined, c.RowsSent)
+		if len(c.Databases) > 0 {
+			fmt.Fprintf(b, "- Databases: %s\n", strings.Join(c.Databases, ", "))
+		}
+		if len(c.Users) > 0 {
+			fmt.Fprintf(b, "- Users: %s\n", strings.Join(c.Users, ", "))
+		}
+		if !c.FirstSeen.IsZero() {
+			fmt.Fprintf(b, "- Seen: %s to %s\n", c.FirstSeen.UTC().Format(time.RFC3339), c.LastSeen.UTC().Format(time.RFC3339))
+		}
+		fmt.Fprintf(b, "\n```sql\n%s\n```\n", c.Example)
+	}
+	return b.Flush()
+}
+
+// abbreviate shortens s to at most n runes.
+func abbreviate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-3]) + "..."
+	}
+	return s
+}
+
+// cell escapes a value for use in a Markdown table cell.
+func cell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "`", "'").Replace(s)
+}
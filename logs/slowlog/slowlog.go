@@ -0,0 +1,235 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package slowlog digests the slow logs of a cluster: statements are grouped
+// by fingerprint into query classes, which are ranked by their impact, in the
+// manner of pt-query-digest.
+package slowlog
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/logs"
+)
+
+// SortBy selects the metric query classes are ranked by.
+type SortBy string
+
+// List of SortBy.
+const (
+	SortByTotalTime    SortBy = "totalTime"
+	SortByCount        SortBy = "count"
+	SortByAvgTime      SortBy = "avgTime"
+	SortByP95Time      SortBy = "p95Time"
+	SortByMaxTime      SortBy = "maxTime"
+	SortByRowsExamined SortBy = "rowsExamined"
+)
+
+// Class aggregates the slow log entries sharing a fingerprint.
+type Class struct {
+	ID          string `json:"id"`
+	Fingerprint string `json:"fingerprint"`
+	// Example is the statement of the slowest entry of the class.
+	Example string `json:"example"`
+
+	Count     int           `json:"count"`
+	TotalTime time.Duration `json:"totalTime"`
+	MinTime   time.Duration `json:"minTime"`
+	MaxTime   time.Duration `json:"maxTime"`
+	AvgTime   time.Duration `json:"avgTime"`
+	P95Time   time.Duration `json:"p95Time"`
+	// TimeShare is the fraction of the query time of all entries spent in the class.
+	TimeShare float64 `json:"timeShare"`
+
+	RowsExamined    int64 `json:"rowsExamined"`
+	AvgRowsExamined int64 `json:"avgRowsExamined"`
+	RowsSent        int64 `json:"rowsSent"`
+
+	Databases []string  `json:"databases,omitempty"`
+	Users     []string  `json:"users,omitempty"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+
+	times     []time.Duration
+	databases map[string]bool
+	users     map[string]bool
+}
+
+// Report is the ranked digest of a set of slow log entries.
+type Report struct {
+	Count     int           `json:"count"`
+	TotalTime time.Duration `json:"totalTime"`
+	// Unique is the number of distinct fingerprints.
+	Unique    int       `json:"unique"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	SortBy    SortBy    `json:"sortBy"`
+	Classes   []Class   `json:"classes"`
+}
+
+// ReportOptions configures a report.
+type ReportOptions struct {
+	// SortBy ranks the classes. Defaults to SortByTotalTime.
+	SortBy SortBy
+	// Limit keeps only the top classes. Zero keeps all of them.
+	Limit int
+}
+
+// Analyzer groups slow log entries into query classes.
+type Analyzer struct {
+	dialect Dialect
+	classes map[string]*Class
+}
+
+// NewAnalyzer returns an Analyzer fingerprinting statements of dialect.
+func NewAnalyzer(dialect Dialect) *Analyzer {
+	return &Analyzer{dialect: dialect, classes: map[string]*Class{}}
+}
+
+// Add adds an entry to its query class. Entries without a statement are ignored.
+func (a *Analyzer) Add(e logs.Entry) {
+	if e.SQL == "" {
+		return
+	}
+	fp := Fingerprint(a.dialect, e.SQL)
+	c, ok := a.classes[fp]
+	if !ok {
+		c = &Class{ID: ID(fp), Fingerprint: fp, databases: map[string]bool{}, users: map[string]bool{}}
+		a.classes[fp] = c
+	}
+
+	if c.Count == 0 || e.QueryTime > c.MaxTime {
+		c.MaxTime, c.Example = e.QueryTime, e.SQL
+	}
+	if c.Count == 0 || e.QueryTime < c.MinTime {
+		c.MinTime = e.QueryTime
+	}
+	c.Count++
+	c.TotalTime += e.QueryTime
+	c.times = append(c.times, e.QueryTime)
+	c.RowsExamined += e.RowsExamined
+	c.RowsSent += e.RowsSent
+	if e.Database != "" {
+		c.databases[e.Database] = true
+	}
+	if e.User != "" {
+		c.users[e.User] = true
+	}
+	if !e.Timestamp.IsZero() {
+		if c.FirstSeen.IsZero() || e.Timestamp.Before(c.FirstSeen) {
+			c.FirstSeen = e.Timestamp
+		}
+		if e.Timestamp.After(c.LastSeen) {
+			c.LastSeen = e.Timestamp
+		}
+	}
+}
+
+// Report returns the query classes ranked by opts.SortBy, in decreasing order.
+func (a *Analyzer) Report(opts ReportOptions) Report {
+	if opts.SortBy == "" {
+		opts.SortBy = SortByTotalTime
+	}
+	r := Report{Unique: len(a.classes), SortBy: opts.SortBy, Classes: make([]Class, 0, len(a.classes))}
+	for _, c := range a.classes {
+		r.Count += c.Count
+		r.TotalTime += c.TotalTime
+		if !c.FirstSeen.IsZero() && (r.FirstSeen.IsZero() || c.FirstSeen.Before(r.FirstSeen)) {
+			r.FirstSeen = c.FirstSeen
+		}
+		if c.LastSeen.After(r.LastSeen) {
+			r.LastSeen = c.LastSeen
+		}
+	}
+
+	for _, c := range a.classes {
+		out := *c
+		out.AvgTime = c.TotalTime / time.Duration(c.Count)
+		out.AvgRowsExamined = c.RowsExamined / int64(c.Count)
+		out.P95Time = percentile(c.times, 0.95)
+		if r.TotalTime > 0 {
+			out.TimeShare = float64(c.TotalTime) / float64(r.TotalTime)
+		}
+		out.Databases, out.Users = keys(c.databases), keys(c.users)
+		out.times, out.databases, out.users = nil, nil, nil
+		r.Classes = append(r.Classes, out)
+	}
+
+	metric := sortKey(opts.SortBy)
+	sort.Slice(r.Classes, func(i, j int) bool {
+		if mi, mj := metric(r.Classes[i]), metric(r.Classes[j]); mi != mj {
+			return mi > mj
+		}
+		return r.Classes[i].Fingerprint < r.Classes[j].Fingerprint
+	})
+	if opts.Limit > 0 && len(r.Classes) > opts.Limit {
+		r.Classes = r.Classes[:opts.Limit]
+	}
+	return r
+}
+
+// Analyze fetches the slow logs selected by query and returns their digest.
+// The Kind of query is ignored; Limit and Sort only affect how entries are fetched.
+func Analyze(ctx context.Context, q *logs.Querier, orgName, clusterName string, query logs.Query, dialect Dialect, opts ReportOptions) (Report, error) {
+	query.Kind = logs.KindSlow
+	if query.Sort == "" {
+		query.Sort = kbcloud.SortTypeAsc
+	}
+	a := NewAnalyzer(dialect)
+	err := q.Iterate(ctx, orgName, clusterName, query, func(e logs.Entry) error {
+		a.Add(e)
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return a.Report(opts), nil
+}
+
+func sortKey(by SortBy) func(Class) float64 {
+	switch by {
+	case SortByCount:
+		return func(c Class) float64 { return float64(c.Count) }
+	case SortByAvgTime:
+		return func(c Class) float64 { return float64(c.AvgTime) }
+	case SortByP95Time:
+		return func(c Class) float64 { return float64(c.P95Time) }
+	case SortByMaxTime:
+		return func(c Class) float64 { return float64(c.MaxTime) }
+	case SortByRowsExamined:
+		return func(c Class) float64 { return float64(c.RowsExamined) }
+	default:
+		return func(c Class) float64 { return float64(c.TotalTime) }
+	}
+}
+
+// percentile returns the nearest-rank percentile p of times.
+func percentile(times []time.Duration, p float64) time.Duration {
+	if len(times) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func keys(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
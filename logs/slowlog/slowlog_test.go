@@ -0,0 +1,93 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package slowlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/logs"
+)
+
+func TestFingerprint(t *testing.T) {
+	for _, tc := range []struct {
+		dialect Dialect
+		sql     string
+		want    string
+	}{
+		{DialectMySQL, "SELECT * FROM `Users` WHERE id = 42", "select * from Users where id = ?"},
+		{DialectMySQL, "select  *\n from users where id=7 ;", "select * from users where id = ?"},
+		{DialectMySQL, `SELECT name FROM t WHERE a = 'it\'s' AND b = "x" AND c = -1.5e3 AND d = 0xFF`, "select name from t where a = ? and b = ? and c = ? and d = ?"},
+		{DialectMySQL, "SELECT * FROM t WHERE id IN (1, 2, 3) /* app:42 */ # trailing", "select * from t where id in(?+)"},
+		{DialectMySQL, "SELECT * FROM t WHERE id IN (7)", "select * from t where id in(?+)"},
+		{DialectMySQL, "INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y'), (3, NULL)", "insert into t(a, b) values(?+)"},
+		{DialectMySQL, "SELECT COUNT(*) FROM t1 WHERE a - 1 > 2 LIMIT 10, 20", "select count(*) from t1 where a - ? > ? limit ?, ?"},
+		{DialectPostgreSQL, `SELECT "UserId" FROM public.users WHERE email = 'a''b' AND id = $1`, `select UserId from public.users where email = ? and id = ?`},
+		{DialectPostgreSQL, "select $tag$ body; 'quoted' $tag$::text, E'\\n'::bytea, now() - interval '1 day'", "select ?::text, ?::bytea, now() - interval ?"},
+		{DialectPostgreSQL, "SELECT data->>'name' FROM docs WHERE id = ANY('{1,2}') -- note", "select data ->> ? from docs where id = any (?)"},
+	} {
+		if got := Fingerprint(tc.dialect, tc.sql); got != tc.want {
+			t.Errorf("Fingerprint(%s, %q)\n got: %q\nwant: %q", tc.dialect, tc.sql, got, tc.want)
+		}
+	}
+
+	a := Fingerprint(DialectMySQL, "SELECT * FROM t WHERE id IN (1,2,3)")
+	b := Fingerprint(DialectMySQL, "select * from t where id in ( 4 )")
+	if a != b || ID(a) != ID(b) || len(ID(a)) != 16 {
+		t.Errorf("IN lists of different lengths fingerprint differently: %q (%s) and %q (%s)", a, ID(a), b, ID(b))
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	a := NewAnalyzer(DialectMySQL)
+	for i := 0; i < 20; i++ {
+		a.Add(logs.Entry{
+			Timestamp:    base.Add(time.Duration(i) * time.Second),
+			SQL:          "SELECT * FROM orders WHERE id = " + strings.Repeat("9", i+1),
+			QueryTime:    time.Duration(i+1) * 100 * time.Millisecond,
+			RowsExamined: 10,
+			Database:     "shop",
+			User:         "app",
+		})
+	}
+	for i := 0; i < 2; i++ {
+		a.Add(logs.Entry{Timestamp: base, SQL: "DELETE FROM sessions WHERE expires < NOW()", QueryTime: 5 * time.Second, RowsExamined: 100000})
+	}
+	a.Add(logs.Entry{Timestamp: base, Message: "not a statement"})
+
+	r := a.Report(ReportOptions{})
+	if r.Count != 22 || r.Unique != 2 || len(r.Classes) != 2 {
+		t.Fatalf("got %d entries in %d classes, want 22 in 2", r.Count, r.Unique)
+	}
+	top := r.Classes[0]
+	if top.Fingerprint != "select * from orders where id = ?" {
+		t.Fatalf("top class by total time is %q", top.Fingerprint)
+	}
+	if top.Count != 20 || top.TotalTime != 21*time.Second || top.AvgTime != 1050*time.Millisecond ||
+		top.P95Time != 1900*time.Millisecond || top.MaxTime != 2*time.Second || top.RowsExamined != 200 {
+		t.Errorf("unexpected aggregates %+v", top)
+	}
+	if top.Example != "SELECT * FROM orders WHERE id = 99999999999999999999" {
+		t.Errorf("example is %q, want the slowest statement", top.Example)
+	}
+	if len(top.Databases) != 1 || !top.LastSeen.Equal(base.Add(19*time.Second)) {
+		t.Errorf("unexpected databases %v or last seen %s", top.Databases, top.LastSeen)
+	}
+
+	r = a.Report(ReportOptions{SortBy: SortByRowsExamined, Limit: 1})
+	if len(r.Classes) != 1 || !strings.HasPrefix(r.Classes[0].Fingerprint, "delete") {
+		t.Errorf("top class by rows examined is %+v", r.Classes)
+	}
+
+	var md strings.Builder
+	if err := r.WriteMarkdown(&md); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(md.String(), r.Classes[0].ID) {
+		t.Errorf("markdown report does not mention the query ID:\n%s", md.String())
+	}
+}
@@ -0,0 +1,92 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package logs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud/admin"
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// List of terminal workflow phases.
+const (
+	WorkflowPhaseSucceeded = "Succeeded"
+	WorkflowPhaseFailed    = "Failed"
+	WorkflowPhaseError     = "Error"
+)
+
+// BackupLogs returns a SnapshotFunc for the logs of a backup, done once the
+// backup completes or fails.
+func BackupLogs(api *kbcloud.BackupApi, orgName, backupId string) SnapshotFunc {
+	return func(ctx context.Context) ([]PodLog, bool, error) {
+		backup, _, err := api.GetBackup(ctx, orgName, backupId)
+		if err != nil {
+			return nil, false, fmt.Errorf("get backup: %w", err)
+		}
+		done := backup.Status == kbcloud.BackupStatusCompleted || backup.Status == kbcloud.BackupStatusFailed
+		log, _, err := api.GetBackupLog(ctx, orgName, backupId)
+		if err != nil {
+			return nil, false, fmt.Errorf("get backup log: %w", err)
+		}
+		out := make([]PodLog, 0, len(log.Items))
+		for _, p := range log.Items {
+			out = append(out, PodLog{Pod: p.GetPodName(), CreatedAt: p.GetCreationTimestamp(), Log: p.GetLog()})
+		}
+		return out, done, nil
+	}
+}
+
+// RestoreLogs returns a SnapshotFunc for the logs of a restore of a cluster,
+// done once the restore completes or fails.
+func RestoreLogs(api *kbcloud.RestoreApi, orgName, clusterName, restoreId string) SnapshotFunc {
+	return func(ctx context.Context) ([]PodLog, bool, error) {
+		restores, _, err := api.ListClusterRestore(ctx, orgName, clusterName)
+		if err != nil {
+			return nil, false, fmt.Errorf("list restores: %w", err)
+		}
+		done := false
+		for _, r := range restores.Items {
+			if r.GetId() == restoreId || r.GetName() == restoreId {
+				phase := r.Status.GetPhase()
+				done = phase == wait.RestorePhaseCompleted || phase == wait.RestorePhaseFailed
+			}
+		}
+		log, _, err := api.GetRestoreLog(ctx, orgName, clusterName, restoreId)
+		if err != nil {
+			return nil, false, fmt.Errorf("get restore log: %w", err)
+		}
+		out := make([]PodLog, 0, len(log.Items))
+		for _, p := range log.Items {
+			out = append(out, PodLog{Pod: p.GetPodName(), CreatedAt: p.GetCreationTimestamp(), Log: p.GetLog()})
+		}
+		return out, done, nil
+	}
+}
+
+// WorkflowLogs returns a SnapshotFunc for the log of an environment workflow,
+// done once the workflow finishes. The log is reported under the workflow name.
+func WorkflowLogs(api *admin.EnvironmentApi, environmentName, workflowName string) SnapshotFunc {
+	return func(ctx context.Context) ([]PodLog, bool, error) {
+		workflow, _, err := api.GetWorkflow(ctx, environmentName, workflowName)
+		if err != nil {
+			return nil, false, fmt.Errorf("get workflow: %w", err)
+		}
+		var done bool
+		switch workflow.GetPhase() {
+		case WorkflowPhaseSucceeded, WorkflowPhaseFailed, WorkflowPhaseError:
+			done = true
+		default:
+			done = workflow.FinishedAt.IsSet() && workflow.FinishedAt.Get() != nil
+		}
+		log, _, err := api.GetWorkflowLog(ctx, environmentName, workflowName)
+		if err != nil {
+			return nil, false, fmt.Errorf("get workflow log: %w", err)
+		}
+		return []PodLog{{Pod: workflowName, Log: log}}, done, nil
+	}
+}
@@ -0,0 +1,202 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// opsStandIn serves clusters that stay Running, records the alert switches
+// and holds the restart of cluster a until cluster b is restarted too.
+type opsStandIn struct {
+	store Store
+
+	mu sync.Mutex
+	// switches holds, by cluster, the alert switch values set, and whether
+	// the operation recorded the mute when alerts were disabled.
+	switches map[string][]string
+	bRestart chan struct{}
+}
+
+func (s *opsStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := apitest.OrgPath(r, "org")
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "clusters":
+		apitest.WriteJSON(w, http.StatusOK, `{"id": 1, "name": "`+parts[1]+`", "engine": "mysql", "environmentName": "prod", "status": "Running"}`)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/alerts/cluster/"):
+		apitest.WriteJSON(w, http.StatusOK, `{"disabled": false}`)
+	case r.Method == http.MethodPatch && strings.HasPrefix(path, "/alerts/cluster/"):
+		var body struct{ Disabled bool }
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		cluster := parts[2]
+		entry := "enabled"
+		if body.Disabled {
+			entry = "disabled, mute recorded"
+			ops, _ := s.store.Load()
+			for _, op := range ops {
+				if op.ClusterName == cluster && op.Status == OpStatusRunning && !op.AlertsMuted {
+					entry = "disabled, mute not recorded"
+				}
+			}
+		}
+		s.mu.Lock()
+		s.switches[cluster] = append(s.switches[cluster], entry)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[2] == "restart":
+		switch parts[1] {
+		case "a":
+			select {
+			case <-s.bRestart:
+			case <-time.After(5 * time.Second):
+				http.Error(w, "cluster b was not restarted concurrently", http.StatusConflict)
+				return
+			}
+		case "b":
+			close(s.bRestart)
+		}
+		apitest.WriteJSON(w, http.StatusOK, `{"opsRequestName": "restart-`+parts[1]+`"}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestScheduler(t *testing.T, store Store) (*Scheduler, *opsStandIn) {
+	s := &opsStandIn{store: store, switches: map[string][]string{}, bRestart: make(chan struct{})}
+	sched := NewScheduler(apitest.NewClient(t, s), store, SchedulerOptions{
+		PollInterval: time.Millisecond,
+		SettleGrace:  5 * time.Millisecond,
+	})
+	sched.now = func() time.Time { return time.Date(2024, 1, 1, 2, 30, 0, 0, time.UTC) }
+	return sched, s
+}
+
+func restartOp(cluster string) Op {
+	return Op{OrgName: "org", ClusterName: cluster, Type: OpTypeRestart, Restart: kbcloud.NewOpsRestart()}
+}
+
+func TestSchedulerRunOnce(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "queue.json"))
+	sched, standIn := newTestScheduler(t, store)
+	window, err := NewWindow("0 2 * * *", time.Hour, "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cluster := range []string{"a", "b"} {
+		if err := sched.SetWindow("org", cluster, window); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sched.Enqueue(restartOp(cluster)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sched.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ops, err := sched.Ops()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		if op.Status != OpStatusSucceeded || op.AlertsMuted || op.OpsRequestName != "restart-"+op.ClusterName {
+			t.Errorf("op %s = %+v", op.ClusterName, op)
+		}
+	}
+	for _, cluster := range []string{"a", "b"} {
+		got := strings.Join(standIn.switches[cluster], "; ")
+		if got != "disabled, mute recorded; enabled" {
+			t.Errorf("alert switches of %s = %s", cluster, got)
+		}
+	}
+}
+
+func TestSchedulerWindowsPersist(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "queue.json"))
+	sched, _ := newTestScheduler(t, store)
+	window, err := NewWindow("30 1 * * sat", 2*time.Hour, "Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sched.SetWindow("org", "a", window); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, _ := newTestScheduler(t, NewFileStore(store.path))
+	windows, err := restarted.Windows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 1 || windows[0].ClusterName != "a" || windows[0].Window.String() != window.String() {
+		t.Fatalf("windows = %+v", windows)
+	}
+	if _, err := restarted.Enqueue(restartOp("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.Enqueue(restartOp("b")); !errors.Is(err, ErrNoWindow) {
+		t.Fatalf("enqueue without window: %v", err)
+	}
+	if err := restarted.SetWindow("org", "a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if windows, _ := sched.Windows(); len(windows) != 0 {
+		t.Fatalf("windows after removal = %+v", windows)
+	}
+}
+
+func TestSchedulerExpires(t *testing.T) {
+	sched, _ := newTestScheduler(t, nil)
+	window, _ := NewWindow("0 4 * * *", time.Hour, "")
+	sched.SetWindow("org", "a", window)
+	deadline := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	late := restartOp("a")
+	late.Deadline = &deadline
+	for _, op := range []Op{late, restartOp("a")} {
+		if _, err := sched.Enqueue(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sched.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ops, _ := sched.Ops()
+	if ops[0].Status != OpStatusExpired || ops[1].Status != OpStatusPending {
+		t.Fatalf("statuses = %s, %s", ops[0].Status, ops[1].Status)
+	}
+}
+
+func TestSchedulerRecover(t *testing.T) {
+	store := &MemoryStore{}
+	sched, standIn := newTestScheduler(t, store)
+	op := restartOp("a")
+	op.ID, op.Status, op.AlertsMuted = "1", OpStatusRunning, true
+	store.Save([]Op{op})
+
+	if err := sched.Recover(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ops, _ := store.Load()
+	if ops[0].Status != OpStatusFailed || ops[0].AlertsMuted {
+		t.Fatalf("op = %+v", ops[0])
+	}
+	if got := strings.Join(standIn.switches["a"], "; "); got != "enabled" {
+		t.Fatalf("alert switches = %s", got)
+	}
+}
@@ -0,0 +1,103 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package maintenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// OpType is the kind of a queued operation.
+type OpType string
+
+// List of OpType.
+const (
+	OpTypeUpgrade     OpType = "Upgrade"
+	OpTypeVScale      OpType = "VerticalScaling"
+	OpTypeRestart     OpType = "Restart"
+	OpTypeReconfigure OpType = "Reconfiguring"
+)
+
+// OpStatus is the lifecycle state of a queued operation.
+type OpStatus string
+
+// List of OpStatus.
+const (
+	OpStatusPending   OpStatus = "Pending"
+	OpStatusRunning   OpStatus = "Running"
+	OpStatusSucceeded OpStatus = "Succeeded"
+	OpStatusFailed    OpStatus = "Failed"
+	OpStatusExpired   OpStatus = "Expired"
+)
+
+// Op is an operation queued for execution in the maintenance window of a cluster.
+// Exactly one of the payload fields matching Type must be set.
+type Op struct {
+	ID          string `json:"id"`
+	OrgName     string `json:"orgName"`
+	ClusterName string `json:"clusterName"`
+	Type        OpType `json:"type"`
+
+	Upgrade     *kbcloud.OpsUpgrade        `json:"upgrade,omitempty"`
+	VScale      *kbcloud.OpsVScale         `json:"vscale,omitempty"`
+	Restart     *kbcloud.OpsRestart        `json:"restart,omitempty"`
+	Reconfigure *kbcloud.ReconfigureCreate `json:"reconfigure,omitempty"`
+
+	// Deadline, when set, expires the operation if no window opened before it.
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	Status         OpStatus   `json:"status"`
+	OpsRequestName string     `json:"opsRequestName,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	QueuedAt       time.Time  `json:"queuedAt"`
+	StartedAt      *time.Time `json:"startedAt,omitempty"`
+	FinishedAt     *time.Time `json:"finishedAt,omitempty"`
+	// AlertsMuted records that the scheduler disabled cluster alerts for this
+	// operation, so they can be re-enabled after a crash.
+	AlertsMuted bool `json:"alertsMuted,omitempty"`
+}
+
+// Validate checks that the payload matches the operation type.
+func (op *Op) Validate() error {
+	if op.OrgName == "" || op.ClusterName == "" {
+		return fmt.Errorf("operation requires orgName and clusterName")
+	}
+	var ok bool
+	switch op.Type {
+	case OpTypeUpgrade:
+		ok = op.Upgrade != nil
+	case OpTypeVScale:
+		ok = op.VScale != nil
+	case OpTypeRestart:
+		ok = op.Restart != nil
+	case OpTypeReconfigure:
+		ok = op.Reconfigure != nil
+	default:
+		return fmt.Errorf("unsupported operation type %q", op.Type)
+	}
+	if !ok {
+		return fmt.Errorf("operation of type %s has no matching payload", op.Type)
+	}
+	return nil
+}
+
+// Done reports whether the operation reached a terminal status.
+func (op *Op) Done() bool {
+	switch op.Status {
+	case OpStatusSucceeded, OpStatusFailed, OpStatusExpired:
+		return true
+	}
+	return false
+}
+
+func (op *Op) key() string {
+	return clusterKey(op.OrgName, op.ClusterName)
+}
+
+func clusterKey(orgName, clusterName string) string {
+	return orgName + "/" + clusterName
+}
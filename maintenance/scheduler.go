@@ -0,0 +1,470 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apiutil"
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// ErrNoWindow is returned when an operation is queued for a cluster without a maintenance window.
+var ErrNoWindow = errors.New("no maintenance window configured for cluster")
+
+// SchedulerOptions configures a Scheduler.
+type SchedulerOptions struct {
+	// TickInterval is how often Run checks for due operations. Defaults to one minute.
+	TickInterval time.Duration
+	// PollInterval is the interval used while waiting for an operation to settle.
+	PollInterval time.Duration
+	// SettleGrace is how long to wait for the cluster to leave the Running status after
+	// an operation is submitted. Defaults to one minute.
+	SettleGrace time.Duration
+	// KeepAlertsEnabled disables muting alerts while operations run.
+	KeepAlertsEnabled bool
+	// Report, when set, is called with every operation reaching a terminal status.
+	// Clusters run concurrently, so Report may be called concurrently.
+	Report func(op Op)
+}
+
+// Scheduler executes queued operations inside the maintenance window of their cluster.
+// Operations of the same cluster run sequentially in queue order, and
+// clusters run concurrently.
+type Scheduler struct {
+	client *common.APIClient
+	api    apis
+	store  Store
+	opts   SchedulerOptions
+	now    func() time.Time
+
+	// mu guards busy, the clusters with a running worker, and window updates.
+	mu   sync.Mutex
+	busy map[string]bool
+
+	// queueMu serializes read-modify-write cycles on the store.
+	queueMu sync.Mutex
+}
+
+// NewScheduler returns a Scheduler using client and persisting its queue and
+// windows to store. A nil store keeps them in memory.
+func NewScheduler(client *common.APIClient, store Store, opts SchedulerOptions) *Scheduler {
+	if opts.TickInterval <= 0 {
+		opts.TickInterval = time.Minute
+	}
+	if opts.SettleGrace <= 0 {
+		opts.SettleGrace = time.Minute
+	}
+	if store == nil {
+		store = &MemoryStore{}
+	}
+	return &Scheduler{
+		client: client,
+		api:    newAPIs(client),
+		store:  store,
+		opts:   opts,
+		now:    time.Now,
+		busy:   map[string]bool{},
+	}
+}
+
+// apis are the API clients of a worker. The generated client sets the
+// transport of its HTTP client on every request, so every worker gets its own.
+type apis struct {
+	cluster *kbcloud.ClusterApi
+	ops     *kbcloud.OpsrequestApi
+	alert   *kbcloud.ClusterAlertSwitchApi
+}
+
+func newAPIs(client *common.APIClient) apis {
+	return apis{
+		cluster: kbcloud.NewClusterApi(client),
+		ops:     kbcloud.NewOpsrequestApi(client),
+		alert:   kbcloud.NewClusterAlertSwitchApi(client),
+	}
+}
+
+// SetWindow persists the maintenance window of a cluster. A nil window removes it.
+func (s *Scheduler) SetWindow(orgName, clusterName string, w *Window) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	windows, err := s.store.LoadWindows()
+	if err != nil {
+		return fmt.Errorf("load maintenance windows: %w", err)
+	}
+	kept := windows[:0]
+	for _, cw := range windows {
+		if cw.OrgName != orgName || cw.ClusterName != clusterName {
+			kept = append(kept, cw)
+		}
+	}
+	if w != nil {
+		kept = append(kept, ClusterWindow{OrgName: orgName, ClusterName: clusterName, Window: w})
+	}
+	if err := s.store.SaveWindows(kept); err != nil {
+		return fmt.Errorf("save maintenance windows: %w", err)
+	}
+	return nil
+}
+
+// Windows returns the persisted maintenance windows.
+func (s *Scheduler) Windows() ([]ClusterWindow, error) {
+	return s.store.LoadWindows()
+}
+
+func (s *Scheduler) windows() (map[string]*Window, error) {
+	list, err := s.store.LoadWindows()
+	if err != nil {
+		return nil, fmt.Errorf("load maintenance windows: %w", err)
+	}
+	windows := make(map[string]*Window, len(list))
+	for _, cw := range list {
+		windows[clusterKey(cw.OrgName, cw.ClusterName)] = cw.Window
+	}
+	return windows, nil
+}
+
+// Enqueue validates and persists op as pending, and returns it with its assigned ID.
+func (s *Scheduler) Enqueue(op Op) (Op, error) {
+	if err := op.Validate(); err != nil {
+		return op, err
+	}
+	windows, err := s.windows()
+	if err != nil {
+		return op, err
+	}
+	if _, ok := windows[op.key()]; !ok {
+		return op, fmt.Errorf("%w: %s", ErrNoWindow, op.key())
+	}
+
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	ops, err := s.store.Load()
+	if err != nil {
+		return op, err
+	}
+	if op.ID == "" {
+		op.ID = uuid.NewString()
+	}
+	op.Status = OpStatusPending
+	op.QueuedAt = s.now().UTC()
+	ops = append(ops, op)
+	return op, s.store.Save(ops)
+}
+
+// Ops returns all persisted operations.
+func (s *Scheduler) Ops() ([]Op, error) {
+	return s.store.Load()
+}
+
+// Run starts workers for due operations every TickInterval until ctx is done,
+// without waiting for the workers of other clusters, and returns once every
+// worker stopped. Operations left running by a previous process are marked
+// failed and their alerts restored first.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := s.Recover(ctx); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(s.opts.TickInterval)
+	defer ticker.Stop()
+
+	done := make(chan error)
+	running := 0
+	var runErr error
+loop:
+	for tick := true; ; {
+		if tick {
+			n, err := s.dispatch(ctx, done)
+			running += n
+			if err != nil && ctx.Err() == nil {
+				runErr = err
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			runErr = ctx.Err()
+			break loop
+		case <-ticker.C:
+			tick = true
+		case err := <-done:
+			running--
+			tick = false
+			if err != nil && ctx.Err() == nil {
+				runErr = err
+				break loop
+			}
+		}
+	}
+	for ; running > 0; running-- {
+		<-done
+	}
+	return runErr
+}
+
+// Recover marks operations interrupted while running as failed and re-enables
+// the alerts they muted.
+func (s *Scheduler) Recover(ctx context.Context) error {
+	ops, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+	for i := range ops {
+		op := ops[i]
+		if op.Status != OpStatusRunning {
+			continue
+		}
+		if op.AlertsMuted {
+			if err := s.setAlertsDisabled(ctx, s.api, &op, false); err != nil {
+				return fmt.Errorf("re-enable alerts of %s: %w", op.key(), err)
+			}
+			op.AlertsMuted = false
+		}
+		s.finish(&op, OpStatusFailed, errors.New("interrupted by scheduler restart"))
+		if err := s.persist(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunOnce executes every pending operation whose cluster maintenance window
+// is currently open, and expires operations past their deadline. Clusters run
+// concurrently, each in queue order; RunOnce returns once all of them finished.
+// Clusters already served by a worker of Run are skipped.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	done := make(chan error)
+	n, err := s.dispatch(ctx, done)
+	errs := []error{err}
+	for ; n > 0; n-- {
+		errs = append(errs, <-done)
+	}
+	return errors.Join(errs...)
+}
+
+// dispatch starts a worker for every cluster without one that has a pending
+// operation due now, and returns how many it started. Every worker sends its
+// result on done.
+func (s *Scheduler) dispatch(ctx context.Context, done chan<- error) (int, error) {
+	ops, err := s.store.Load()
+	if err != nil {
+		return 0, err
+	}
+	windows, err := s.windows()
+	if err != nil {
+		return 0, err
+	}
+	now := s.now()
+	var (
+		keys    []string
+		pending = map[string][]Op{}
+		due     = map[string]bool{}
+	)
+	for _, op := range ops {
+		if op.Status != OpStatusPending {
+			continue
+		}
+		key := op.key()
+		if _, ok := pending[key]; !ok {
+			keys = append(keys, key)
+		}
+		pending[key] = append(pending[key], op)
+		if w := windows[key]; expired(op, now) || (w != nil && w.Contains(now)) {
+			due[key] = true
+		}
+	}
+
+	started := 0
+	for _, key := range keys {
+		if !due[key] {
+			continue
+		}
+		s.mu.Lock()
+		busy := s.busy[key]
+		s.busy[key] = true
+		s.mu.Unlock()
+		if busy {
+			continue
+		}
+		started++
+		api := newAPIs(apiutil.Clone(s.client))
+		go func(key string, ops []Op, w *Window) {
+			err := s.work(ctx, api, ops, w)
+			s.mu.Lock()
+			delete(s.busy, key)
+			s.mu.Unlock()
+			done <- err
+		}(key, pending[key], windows[key])
+	}
+	return started, nil
+}
+
+// work runs the pending operations of a cluster in queue order, expiring those
+// past their deadline. A nil window only expires operations.
+func (s *Scheduler) work(ctx context.Context, api apis, ops []Op, w *Window) error {
+	for i := range ops {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		op := &ops[i]
+		now := s.now()
+		if expired(*op, now) {
+			s.finish(op, OpStatusExpired, errors.New("deadline passed before a maintenance window opened"))
+			if err := s.persist(*op); err != nil {
+				return err
+			}
+			continue
+		}
+		if w == nil {
+			continue
+		}
+		_, end, open := w.Current(now)
+		if !open {
+			continue
+		}
+		if err := s.execute(ctx, api, op, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expired(op Op, now time.Time) bool {
+	return op.Deadline != nil && now.After(*op.Deadline)
+}
+
+// execute runs op until it settles or the window closes, persisting every state change.
+func (s *Scheduler) execute(ctx context.Context, api apis, op *Op, windowEnd time.Time) error {
+	started := s.now().UTC()
+	op.Status = OpStatusRunning
+	op.StartedAt = &started
+	if err := s.persist(*op); err != nil {
+		return err
+	}
+
+	var runErr error
+	if !s.opts.KeepAlertsEnabled {
+		alert, _, err := api.alert.GetClusterAlertDisabled(ctx, op.OrgName, op.ClusterName)
+		if err != nil {
+			s.finish(op, OpStatusFailed, fmt.Errorf("get alert switch: %w", err))
+			return s.persist(*op)
+		}
+		// Alerts already disabled by someone else are left untouched.
+		if !alert.Disabled {
+			// Persist the mute before disabling alerts, so that Recover
+			// re-enables them after a crash in between.
+			op.AlertsMuted = true
+			if err := s.persist(*op); err != nil {
+				return err
+			}
+			if err := s.setAlertsDisabled(ctx, api, op, true); err != nil {
+				runErr = fmt.Errorf("mute alerts: %w", err)
+			}
+		}
+	}
+
+	if runErr == nil {
+		runErr = s.submitAndWait(ctx, api, op, windowEnd)
+	}
+
+	if op.AlertsMuted {
+		if err := s.setAlertsDisabled(context.WithoutCancel(ctx), api, op, false); err != nil {
+			runErr = errors.Join(runErr, fmt.Errorf("re-enable alerts: %w", err))
+		} else {
+			op.AlertsMuted = false
+		}
+	}
+	if runErr != nil {
+		s.finish(op, OpStatusFailed, runErr)
+	} else {
+		s.finish(op, OpStatusSucceeded, nil)
+	}
+	return s.persist(*op)
+}
+
+func (s *Scheduler) submitAndWait(ctx context.Context, api apis, op *Op, windowEnd time.Time) error {
+	var (
+		name kbcloud.OpsRequestName
+		err  error
+	)
+	switch op.Type {
+	case OpTypeUpgrade:
+		name, _, err = api.ops.UpgradeCluster(ctx, op.OrgName, op.ClusterName, *op.Upgrade)
+	case OpTypeVScale:
+		name, _, err = api.ops.VerticalScaleCluster(ctx, op.OrgName, op.ClusterName, *op.VScale)
+	case OpTypeRestart:
+		name, _, err = api.ops.RestartCluster(ctx, op.OrgName, op.ClusterName, *op.Restart)
+	case OpTypeReconfigure:
+		name, _, err = api.ops.ReconfigureCluster(ctx, op.OrgName, op.ClusterName, *op.Reconfigure)
+	default:
+		err = fmt.Errorf("unsupported operation type %q", op.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("submit %s: %w", op.Type, err)
+	}
+	op.OpsRequestName = name.OpsRequestName
+
+	// Give the cluster a chance to leave Running before waiting for it to come back,
+	// otherwise an operation that has not started yet would look finished.
+	_ = wait.Poll(ctx, s.opts.PollInterval, s.opts.SettleGrace, func(ctx context.Context) (bool, error) {
+		cluster, _, err := api.cluster.GetCluster(ctx, op.OrgName, op.ClusterName)
+		return err == nil && cluster.GetStatus() != wait.ClusterStatusRunning, nil
+	})
+
+	timeout := windowEnd.Sub(s.now())
+	if timeout <= 0 {
+		return fmt.Errorf("maintenance window closed before %s settled", op.OpsRequestName)
+	}
+	if _, err := wait.ForClusterRunning(ctx, api.cluster, op.OrgName, op.ClusterName, s.opts.PollInterval, timeout); err != nil {
+		if errors.Is(err, wait.ErrTimeout) {
+			return fmt.Errorf("%s did not settle before the maintenance window closed", op.OpsRequestName)
+		}
+		return err
+	}
+	return nil
+}
+
+// persist replaces the stored operation with the same ID, keeping operations enqueued meanwhile.
+func (s *Scheduler) persist(op Op) error {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+	ops, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+	for i := range ops {
+		if ops[i].ID == op.ID {
+			ops[i] = op
+			return s.store.Save(ops)
+		}
+	}
+	return fmt.Errorf("operation %s is no longer queued", op.ID)
+}
+
+func (s *Scheduler) setAlertsDisabled(ctx context.Context, api apis, op *Op, disabled bool) error {
+	params := kbcloud.NewSetClusterAlertDisabledOptionalParameters().WithBody(kbcloud.AlertCluster{Disabled: disabled})
+	_, _, err := api.alert.SetClusterAlertDisabled(ctx, op.OrgName, op.ClusterName, *params)
+	return err
+}
+
+func (s *Scheduler) finish(op *Op, status OpStatus, err error) {
+	finished := s.now().UTC()
+	op.Status = status
+	op.FinishedAt = &finished
+	if err != nil {
+		op.Error = err.Error()
+	}
+	if s.opts.Report != nil {
+		s.opts.Report(*op)
+	}
+}
@@ -0,0 +1,178 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package maintenance
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+)
+
+// Store persists the operation queue and the maintenance windows, so that a
+// restarted Scheduler resumes where the previous one stopped.
+type Store interface {
+	// Load returns all persisted operations in queue order.
+	Load() ([]Op, error)
+	// Save replaces the persisted operations.
+	Save(ops []Op) error
+	// LoadWindows returns the persisted windows by cluster.
+	LoadWindows() ([]ClusterWindow, error)
+	// SaveWindows replaces the persisted windows.
+	SaveWindows(windows []ClusterWindow) error
+}
+
+// ClusterWindow is the maintenance window of a cluster.
+type ClusterWindow struct {
+	OrgName     string  `json:"orgName"`
+	ClusterName string  `json:"clusterName"`
+	Window      *Window `json:"window"`
+}
+
+// MemoryStore is a Store keeping the queue and windows in memory.
+type MemoryStore struct {
+	mu      sync.Mutex
+	ops     []Op
+	windows []ClusterWindow
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// Load returns the operations.
+func (s *MemoryStore) Load() ([]Op, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Op(nil), s.ops...), nil
+}
+
+// Save stores a copy of ops.
+func (s *MemoryStore) Save(ops []Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ops = append([]Op(nil), ops...)
+	return nil
+}
+
+// LoadWindows returns the windows.
+func (s *MemoryStore) LoadWindows() ([]ClusterWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ClusterWindow(nil), s.windows...), nil
+}
+
+// SaveWindows stores a copy of windows.
+func (s *MemoryStore) SaveWindows(windows []ClusterWindow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.windows = append([]ClusterWindow(nil), windows...)
+	return nil
+}
+
+// FileStore is a Store keeping the queue and windows in a local JSON file.
+// Writes go through a temporary file and a rename so the file is never left half written.
+type FileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+var _ Store = (*FileStore)(nil)
+
+// fileState is the content of a FileStore file.
+type fileState struct {
+	Ops     []Op            `json:"ops"`
+	Windows []ClusterWindow `json:"windows"`
+}
+
+// NewFileStore returns a FileStore persisting to path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load returns all persisted operations. A missing file is an empty queue.
+func (s *FileStore) Load() ([]Op, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	return state.Ops, err
+}
+
+// Save replaces the persisted operations.
+func (s *FileStore) Save(ops []Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	if err != nil {
+		return err
+	}
+	state.Ops = ops
+	return s.write(state)
+}
+
+// LoadWindows returns the persisted windows. A missing file has no windows.
+func (s *FileStore) LoadWindows() ([]ClusterWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	return state.Windows, err
+}
+
+// SaveWindows replaces the persisted windows.
+func (s *FileStore) SaveWindows(windows []ClusterWindow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.read()
+	if err != nil {
+		return err
+	}
+	state.Windows = windows
+	return s.write(state)
+}
+
+func (s *FileStore) read() (fileState, error) {
+	var state fileState
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = common.Unmarshal(data, &state)
+	return state, err
+}
+
+func (s *FileStore) write(state fileState) error {
+	data, err := common.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic writes data to a temporary file in the target directory and renames it into place.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,98 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package maintenance queues cluster operations and executes them only inside
+// per-cluster maintenance windows, muting alerts while they run.
+package maintenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/schedule"
+)
+
+// Window is a recurring maintenance window: it opens at every activation of a
+// cron expression, evaluated in a time zone, and stays open for a fixed duration.
+type Window struct {
+	cron     *schedule.Cron
+	duration time.Duration
+	location *time.Location
+}
+
+// NewWindow returns a Window opening at every activation of cronExpr in the
+// named IANA time zone and lasting duration. An empty timezone means UTC.
+func NewWindow(cronExpr string, duration time.Duration, timezone string) (*Window, error) {
+	cron, err := schedule.ParseCron(cronExpr)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("maintenance window duration must be positive, got %s", duration)
+	}
+	loc := time.UTC
+	if timezone != "" {
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid maintenance window timezone %q: %w", timezone, err)
+		}
+	}
+	return &Window{cron: cron, duration: duration, location: loc}, nil
+}
+
+// Current returns the bounds of the window containing t, and false if the window is closed at t.
+func (w *Window) Current(t time.Time) (start, end time.Time, open bool) {
+	start = w.cron.Prev(t.In(w.location))
+	if start.IsZero() {
+		return time.Time{}, time.Time{}, false
+	}
+	end = start.Add(w.duration)
+	return start, end, t.Before(end)
+}
+
+// Contains reports whether the window is open at t.
+func (w *Window) Contains(t time.Time) bool {
+	_, _, open := w.Current(t)
+	return open
+}
+
+// Next returns the start of the next window opening strictly after t.
+func (w *Window) Next(t time.Time) time.Time {
+	return w.cron.Next(t.In(w.location))
+}
+
+// String describes the window.
+func (w *Window) String() string {
+	return fmt.Sprintf("%s for %s (%s)", w.cron, w.duration, w.location)
+}
+
+// windowJSON is the persisted form of a Window.
+type windowJSON struct {
+	Cron     string `json:"cron"`
+	Duration string `json:"duration"`
+	Timezone string `json:"timezone"`
+}
+
+// MarshalJSON encodes the window as its cron expression, duration and time zone.
+func (w *Window) MarshalJSON() ([]byte, error) {
+	return common.Marshal(windowJSON{Cron: w.cron.String(), Duration: w.duration.String(), Timezone: w.location.String()})
+}
+
+// UnmarshalJSON decodes a window encoded by MarshalJSON.
+func (w *Window) UnmarshalJSON(data []byte) error {
+	var raw windowJSON
+	if err := common.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(raw.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid maintenance window duration %q: %w", raw.Duration, err)
+	}
+	parsed, err := NewWindow(raw.Cron, d, raw.Timezone)
+	if err != nil {
+		return err
+	}
+	*w = *parsed
+	return nil
+}
@@ -0,0 +1,40 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// QueryInstant evaluates query at a point in time. A zero at evaluates it now.
+func QueryInstant(ctx context.Context, client *common.APIClient, orgName, clusterName, query string, at time.Time) (Vector, error) {
+	var params kbcloud.QueryClusterMetricsOptionalParameters
+	if !at.IsZero() {
+		params.WithStart(at.Unix()).WithEnd(at.Unix())
+	}
+	m, _, err := kbcloud.NewMetricsApi(client).QueryClusterMetrics(ctx, orgName, clusterName, query, kbcloud.MetricsQueryTypeInstant, params)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeVector(m)
+}
+
+// QueryRange evaluates query over [start, end]. The resolution is left to the server.
+func QueryRange(ctx context.Context, client *common.APIClient, orgName, clusterName, query string, start, end time.Time) (Matrix, error) {
+	if end.Before(start) {
+		return nil, fmt.Errorf("invalid metrics range: end %s is before start %s", end, start)
+	}
+	params := kbcloud.NewQueryClusterMetricsOptionalParameters().WithStart(start.Unix()).WithEnd(end.Unix())
+	m, _, err := kbcloud.NewMetricsApi(client).QueryClusterMetrics(ctx, orgName, clusterName, query, kbcloud.MetricsQueryTypeRange, *params)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeMatrix(m)
+}
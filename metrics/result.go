@@ -0,0 +1,233 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package metrics provides typed Prometheus results on top of the metrics
+// endpoint of the KubeBlocks Cloud API.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// Sample is a value of a series at a point in time.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Labels are the labels identifying a series.
+type Labels map[string]string
+
+// String formats the labels like Prometheus does, e.g. {pod="mysql-0"}.
+func (l Labels) String() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		if name != "__name__" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+strconv.Quote(l[name]))
+	}
+	return l["__name__"] + "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Series is a labeled series of samples, ordered by time.
+type Series struct {
+	Labels  Labels
+	Samples []Sample
+}
+
+// VectorSample is the sample of a series in an instant vector.
+type VectorSample struct {
+	Labels Labels
+	Sample
+}
+
+// Vector is the result of an instant query.
+type Vector []VectorSample
+
+// Matrix is the result of a range query.
+type Matrix []Series
+
+// DecodeVector decodes the result of an instant query.
+func DecodeVector(m kbcloud.ClusterMetrics) (Vector, error) {
+	series, err := decode(m)
+	if err != nil {
+		return nil, err
+	}
+	v := make(Vector, 0, len(series))
+	for _, s := range series {
+		if len(s.Samples) == 0 {
+			continue
+		}
+		v = append(v, VectorSample{Labels: s.Labels, Sample: s.Samples[len(s.Samples)-1]})
+	}
+	return v, nil
+}
+
+// DecodeMatrix decodes the result of a range query.
+func DecodeMatrix(m kbcloud.ClusterMetrics) (Matrix, error) {
+	series, err := decode(m)
+	if err != nil {
+		return nil, err
+	}
+	return Matrix(series), nil
+}
+
+// decode reads the series of a result. The result is either a single series,
+// whose labels are under "metric" if any, or a Prometheus query result with
+// the series under "result" or "data.result".
+func decode(m kbcloud.ClusterMetrics) ([]Series, error) {
+	if m.UnparsedObject != nil {
+		return decodeObject(m.UnparsedObject)
+	}
+	if results, ok := resultList(m.AdditionalProperties); ok {
+		return decodeResults(results)
+	}
+	if m.Value == nil && m.Values == nil {
+		return nil, nil
+	}
+	s, err := decodeSeries(m.AdditionalProperties["metric"], m.Value, toPairs(m.Values))
+	if err != nil {
+		return nil, err
+	}
+	return []Series{s}, nil
+}
+
+func decodeObject(obj map[string]interface{}) ([]Series, error) {
+	if results, ok := resultList(obj); ok {
+		return decodeResults(results)
+	}
+	value, _ := obj["value"].([]interface{})
+	values, _ := obj["values"].([]interface{})
+	if value == nil && values == nil {
+		return nil, fmt.Errorf("unexpected metrics result with keys %v", keys(obj))
+	}
+	s, err := decodeSeries(obj["metric"], value, values)
+	if err != nil {
+		return nil, err
+	}
+	return []Series{s}, nil
+}
+
+// resultList returns the series list of a Prometheus query result.
+func resultList(obj map[string]interface{}) ([]interface{}, bool) {
+	if data, ok := obj["data"].(map[string]interface{}); ok {
+		obj = data
+	}
+	results, ok := obj["result"].([]interface{})
+	return results, ok
+}
+
+func decodeResults(results []interface{}) ([]Series, error) {
+	out := make([]Series, 0, len(results))
+	for i, r := range results {
+		obj, ok := r.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("series %d: unexpected %T", i, r)
+		}
+		value, _ := obj["value"].([]interface{})
+		values, _ := obj["values"].([]interface{})
+		s, err := decodeSeries(obj["metric"], value, values)
+		if err != nil {
+			return nil, fmt.Errorf("series %d: %w", i, err)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func decodeSeries(metric interface{}, value []interface{}, values []interface{}) (Series, error) {
+	s := Series{Labels: Labels{}}
+	if labels, ok := metric.(map[string]interface{}); ok {
+		for k, v := range labels {
+			s.Labels[k] = fmt.Sprint(v)
+		}
+	}
+	if value != nil {
+		sample, err := ParseSample(value)
+		if err != nil {
+			return Series{}, err
+		}
+		s.Samples = append(s.Samples, sample)
+	}
+	for _, v := range values {
+		pair, ok := v.([]interface{})
+		if !ok {
+			return Series{}, fmt.Errorf("unexpected sample %v", v)
+		}
+		sample, err := ParseSample(pair)
+		if err != nil {
+			return Series{}, err
+		}
+		s.Samples = append(s.Samples, sample)
+	}
+	return s, nil
+}
+
+// ParseSample parses a Prometheus sample, a [timestamp, "value"] pair where
+// the timestamp is in Unix seconds and the value may be NaN or ±Inf.
+func ParseSample(pair []interface{}) (Sample, error) {
+	if len(pair) != 2 {
+		return Sample{}, fmt.Errorf("sample %v is not a [timestamp, value] pair", pair)
+	}
+	ts, err := toFloat(pair[0])
+	if err != nil {
+		return Sample{}, fmt.Errorf("sample timestamp: %w", err)
+	}
+	value, err := toFloat(pair[1])
+	if err != nil {
+		return Sample{}, fmt.Errorf("sample value: %w", err)
+	}
+	sec, frac := math.Modf(ts)
+	return Sample{Time: time.Unix(int64(sec), int64(math.Round(frac*1e3))*int64(time.Millisecond)), Value: value}, nil
+}
+
+// toFloat converts a JSON number or a string-encoded float, including NaN,
+// +Inf and -Inf, to a float64.
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case interface{ Float64() (float64, error) }:
+		return v.Float64()
+	}
+	return 0, fmt.Errorf("unexpected %T %v", v, v)
+}
+
+func toPairs(values [][]interface{}) []interface{} {
+	if values == nil {
+		return nil
+	}
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
+
+func keys(obj map[string]interface{}) []string {
+	out := make([]string, 0, len(obj))
+	for k := range obj {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,76 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package metrics
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+func TestDecode(t *testing.T) {
+	var single kbcloud.ClusterMetrics
+	if err := common.Unmarshal([]byte(`{"metric":{"pod":"mysql-0"},"values":[[1700000000,"1.5"],[1700000015.5,"NaN"],[1700000030,"+Inf"]]}`), &single); err != nil {
+		t.Fatal(err)
+	}
+	m, err := DecodeMatrix(single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 1 || len(m[0].Samples) != 3 || m[0].Labels["pod"] != "mysql-0" {
+		t.Fatalf("unexpected matrix %+v", m)
+	}
+	s := m[0].Samples
+	if s[0].Value != 1.5 || !math.IsNaN(s[1].Value) || !math.IsInf(s[2].Value, 1) {
+		t.Errorf("unexpected values %+v", s)
+	}
+	if want := time.Unix(1700000015, 500*int64(time.Millisecond)); !s[1].Time.Equal(want) {
+		t.Errorf("sample time is %s, want %s", s[1].Time, want)
+	}
+
+	var prom kbcloud.ClusterMetrics
+	if err := common.Unmarshal([]byte(`{"data":{"resultType":"vector","result":[
+		{"metric":{"__name__":"up","pod":"mysql-0"},"value":[1700000000,"1"]},
+		{"metric":{"__name__":"up","pod":"mysql-1"},"value":[1700000000,"-Inf"]}]}}`), &prom); err != nil {
+		t.Fatal(err)
+	}
+	v, err := DecodeVector(prom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 2 || v[0].Value != 1 || !math.IsInf(v[1].Value, -1) {
+		t.Fatalf("unexpected vector %+v", v)
+	}
+	if got := v[1].Labels.String(); got != `up{pod="mysql-1"}` {
+		t.Errorf("labels are %s", got)
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	client := apitest.NewClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if apitest.OrgPath(r, "org") != "/clusters/cluster/metrics" || q.Get("query") != "up" ||
+			q.Get("queryType") != "range" || q.Get("start") != "1700000000" || q.Get("end") != "1700000060" {
+			http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		apitest.WriteJSON(w, http.StatusOK, `{"values":[[1700000000,"1"],[1700000030,"2"],[1700000060,"3"]]}`)
+	}))
+
+	start := time.Unix(1700000000, 0)
+	m, err := QueryRange(context.Background(), client, "org", "cluster", "up", start, start.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 1 || len(m[0].Samples) != 3 || m[0].Samples[2].Value != 3 {
+		t.Errorf("unexpected matrix %+v", m)
+	}
+}
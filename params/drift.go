@@ -0,0 +1,379 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package params
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/connstr"
+)
+
+// Source is what a parameter value is compared against.
+type Source string
+
+// List of Source.
+const (
+	SourceTemplate Source = "template"
+	SourceDefault  Source = "default"
+)
+
+// Drift is a parameter whose value differs from its expected value.
+type Drift struct {
+	File string `json:"file"`
+	Name string `json:"name"`
+	// Actual is the value in the configuration of the cluster, empty when
+	// the parameter is not set.
+	Actual   string `json:"actual"`
+	Expected string `json:"expected"`
+	Source   Source `json:"source"`
+	// Template is the template setting the expected value, for SourceTemplate.
+	Template    string `json:"template,omitempty"`
+	NeedRestart bool   `json:"needRestart"`
+	// Immutable is set for parameters that cannot be reconfigured; their
+	// drift is reported but has no remediation.
+	Immutable bool `json:"immutable,omitempty"`
+}
+
+// ClusterDrift is the parameter drift of a cluster component.
+type ClusterDrift struct {
+	Cluster   string `json:"cluster"`
+	Engine    string `json:"engine"`
+	Component string `json:"component,omitempty"`
+	// Templates are the parameter templates applied to the cluster.
+	Templates []string `json:"templates"`
+	Drifts    []Drift  `json:"drifts"`
+}
+
+// Remediation is a reconfigure request converging drifted parameters.
+type Remediation struct {
+	Cluster     string                    `json:"cluster"`
+	NeedRestart bool                      `json:"needRestart"`
+	Request     kbcloud.ReconfigureCreate `json:"request"`
+}
+
+// Remediations returns the requests setting every drifted parameter to its
+// expected value, one per configuration file and restart requirement.
+// Requests that do not restart the component come first. Immutable drifts
+// are left out, as Reconfigure refuses them.
+func (d ClusterDrift) Remediations() []Remediation {
+	type key struct {
+		restart bool
+		file    string
+	}
+	groups := map[key]map[string]string{}
+	for _, drift := range d.Drifts {
+		if drift.Immutable {
+			continue
+		}
+		k := key{drift.NeedRestart, drift.File}
+		if groups[k] == nil {
+			groups[k] = map[string]string{}
+		}
+		groups[k][drift.Name] = drift.Expected
+	}
+	keys := make([]key, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].restart != keys[j].restart {
+			return !keys[i].restart
+		}
+		return keys[i].file < keys[j].file
+	})
+	rems := make([]Remediation, 0, len(keys))
+	for _, k := range keys {
+		req := kbcloud.ReconfigureCreate{Parameters: groups[k]}
+		if d.Component != "" {
+			req.Component = common.PtrString(d.Component)
+		}
+		if k.file != "" {
+			req.ConfigFileName = common.PtrString(k.file)
+		}
+		rems = append(rems, Remediation{Cluster: d.Cluster, NeedRestart: k.restart, Request: req})
+	}
+	return rems
+}
+
+// DetectorOptions configures a Detector.
+type DetectorOptions struct {
+	// Component is the component of every cluster to check. Empty selects
+	// the default component.
+	Component       string
+	EnvironmentName string
+	// Filter, when set, selects the clusters to check.
+	Filter func(kbcloud.ClusterListItem) bool
+	// Defaults also compares the parameters no template sets against the
+	// engine defaults of the parameter specs.
+	Defaults bool
+}
+
+// Detector reports the parameters of the clusters of an organization that
+// drifted from their parameter templates.
+type Detector struct {
+	clusterApi   *kbcloud.ClusterApi
+	parameterApi *kbcloud.ParameterApi
+	paramTplApi  *kbcloud.ParamTplApi
+	client       *common.APIClient
+	orgName      string
+	opts         DetectorOptions
+}
+
+// NewDetector returns a Detector of the clusters of orgName.
+func NewDetector(client *common.APIClient, orgName string, opts DetectorOptions) *Detector {
+	return &Detector{
+		clusterApi:   kbcloud.NewClusterApi(client),
+		parameterApi: kbcloud.NewParameterApi(client),
+		paramTplApi:  kbcloud.NewParamTplApi(client),
+		client:       client,
+		orgName:      orgName,
+		opts:         opts,
+	}
+}
+
+// Detect checks every cluster of the organization, in name order. Failures of
+// single clusters do not stop the scan and are returned joined, together with
+// the drift of the other clusters.
+func (d *Detector) Detect(ctx context.Context) ([]ClusterDrift, error) {
+	params := kbcloud.NewListClusterOptionalParameters()
+	if d.opts.EnvironmentName != "" {
+		params = params.WithEnvironmentName(d.opts.EnvironmentName)
+	}
+	clusters, _, err := d.clusterApi.ListCluster(ctx, d.orgName, *params)
+	if err != nil {
+		return nil, fmt.Errorf("list clusters: %w", err)
+	}
+	drifts := []ClusterDrift{}
+	var errs []error
+	for _, c := range clusters.Items {
+		if d.opts.Filter != nil && !d.opts.Filter(c) {
+			continue
+		}
+		drift, err := d.DetectCluster(ctx, c.Name, c.Engine)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			errs = append(errs, err)
+			continue
+		}
+		drifts = append(drifts, drift)
+	}
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Cluster < drifts[j].Cluster })
+	return drifts, errors.Join(errs...)
+}
+
+// DetectCluster checks a cluster running engine. When several templates set
+// a parameter, the first template listed by the API wins.
+func (d *Detector) DetectCluster(ctx context.Context, clusterName, engine string) (ClusterDrift, error) {
+	cd := ClusterDrift{Cluster: clusterName, Engine: engine, Component: d.opts.Component, Templates: []string{}, Drifts: []Drift{}}
+	specs, err := LoadSpecs(ctx, d.client, d.orgName, clusterName, d.opts.Component, engine)
+	if err != nil {
+		return cd, fmt.Errorf("cluster %s: %w", clusterName, err)
+	}
+
+	cfgParams := kbcloud.NewListConfigurationsOptionalParameters()
+	tplParams := kbcloud.NewGetClusterParamTplsOptionalParameters().WithEngineName(engine)
+	if d.opts.Component != "" {
+		cfgParams = cfgParams.WithComponent(d.opts.Component)
+		tplParams = tplParams.WithComponent(d.opts.Component)
+	}
+	configs, _, err := d.parameterApi.ListConfigurations(ctx, d.orgName, clusterName, *cfgParams)
+	if err != nil {
+		return cd, fmt.Errorf("list configurations of cluster %s: %w", clusterName, err)
+	}
+	actual := map[string]map[string]string{}
+	for _, c := range configs.Items {
+		actual[c.FileName] = parseConfig(specs.engine, c.FileName, c.Content)
+	}
+
+	tpls, _, err := d.paramTplApi.GetClusterParamTpls(ctx, d.orgName, clusterName, *tplParams)
+	if err != nil {
+		return cd, fmt.Errorf("get parameter templates of cluster %s: %w", clusterName, err)
+	}
+	// expected maps file and parameter to the value and template setting it.
+	type setting struct{ value, template string }
+	expected := map[string]map[string]setting{}
+	for _, t := range tpls.Items {
+		cd.Templates = append(cd.Templates, t.Name)
+		params := kbcloud.NewReadParamTplOptionalParameters()
+		if t.Partition != "" {
+			params = params.WithPartition(kbcloud.ParamTplPartition(t.Partition))
+		}
+		tpl, _, err := d.paramTplApi.ReadParamTpl(ctx, d.orgName, t.Name, *params)
+		if err != nil {
+			return cd, fmt.Errorf("read parameter template %s of cluster %s: %w", t.Name, clusterName, err)
+		}
+		for _, item := range tpl.Items {
+			file := item.Config.FileName
+			if expected[file] == nil {
+				expected[file] = map[string]setting{}
+			}
+			for name, value := range parseConfig(specs.engine, file, item.Config.Content) {
+				if _, ok := expected[file][name]; !ok {
+					expected[file][name] = setting{value, t.Name}
+				}
+			}
+		}
+	}
+
+	for file, values := range expected {
+		if _, ok := actual[file]; !ok {
+			// The file is not rendered for this component.
+			continue
+		}
+		for name, want := range values {
+			got := actual[file][name]
+			if specs.Equal(file, name, got, want.value) {
+				continue
+			}
+			spec, _ := specs.Lookup(file, name)
+			cd.Drifts = append(cd.Drifts, Drift{
+				File: file, Name: name, Actual: got, Expected: want.value,
+				Source: SourceTemplate, Template: want.template, NeedRestart: spec.NeedRestart, Immutable: spec.Immutable,
+			})
+		}
+	}
+	if d.opts.Defaults {
+		for file, values := range actual {
+			for name, got := range values {
+				if _, ok := expected[file][name]; ok {
+					continue
+				}
+				spec, ok := specs.Lookup(file, name)
+				if !ok || spec.Default == "" || spec.Immutable || specs.Equal(file, name, got, spec.Default) {
+					continue
+				}
+				cd.Drifts = append(cd.Drifts, Drift{
+					File: file, Name: name, Actual: got, Expected: spec.Default,
+					Source: SourceDefault, NeedRestart: spec.NeedRestart,
+				})
+			}
+		}
+	}
+	sort.Slice(cd.Drifts, func(i, j int) bool {
+		if cd.Drifts[i].File != cd.Drifts[j].File {
+			return cd.Drifts[i].File < cd.Drifts[j].File
+		}
+		return cd.Drifts[i].Name < cd.Drifts[j].Name
+	})
+	return cd, nil
+}
+
+// Equal reports whether two values of a parameter are the same setting,
+// comparing booleans and numbers with units by value.
+func (s *Specs) Equal(file, name, a, b string) bool {
+	a, b = unquote(a), unquote(b)
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	spec, ok := s.Lookup(file, name)
+	if !ok {
+		return false
+	}
+	switch spec.Type {
+	case TypeInteger, "int", TypeNumber, "float", "real":
+		na, ea, erra := s.number(a)
+		nb, eb, errb := s.number(b)
+		return erra == nil && errb == nil && ea && eb && na == nb
+	case TypeBoolean, "bool":
+		ba, oka := parseBool(a)
+		bb, okb := parseBool(b)
+		return oka && okb && ba == bb
+	}
+	return false
+}
+
+// serverGroups are the option groups of MySQL option files read by the
+// MySQL and MariaDB servers. Each may also be suffixed with a server version.
+var serverGroups = []string{"mysqld", "server", "mariadb", "mariadbd", "galera"}
+
+// parseConfig returns the parameters set in the content of a configuration
+// file: ini files with sections, postgresql.conf and redis.conf alike. Only
+// the server groups of MySQL option files are read, as the other groups hold
+// the options of client programs. Values rendered from template expressions
+// are skipped.
+func parseConfig(engine connstr.Engine, file, content string) map[string]string {
+	// Only ini files take ; comments: a value of postgresql.conf may hold a semicolon.
+	semicolon := engine == connstr.EngineMySQL || strings.HasSuffix(file, ".cnf") || strings.HasSuffix(file, ".ini")
+	options := engine == connstr.EngineMySQL || strings.HasSuffix(file, ".cnf")
+	server := true
+	values := map[string]string{}
+	sc := bufio.NewScanner(strings.NewReader(content))
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(stripComment(sc.Text(), semicolon))
+		if strings.HasPrefix(line, "[") {
+			if options {
+				server = isServerGroup(strings.TrimSpace(strings.Trim(line, "[]")))
+			}
+			continue
+		}
+		if !server || line == "" || strings.HasPrefix(line, "!") || strings.Contains(line, "{{") {
+			continue
+		}
+		var name, value string
+		if i := strings.IndexAny(line, "= \t"); i < 0 {
+			// Bare MySQL options such as skip-name-resolve.
+			name, value = line, "ON"
+		} else {
+			name = strings.TrimSpace(line[:i])
+			value = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line[i:]), "="))
+		}
+		if engine == connstr.EngineMySQL {
+			// MySQL treats dashes and underscores in option names alike.
+			name = strings.ReplaceAll(name, "-", "_")
+		}
+		if name == "include" || name == "include_dir" || name == "include_if_exists" {
+			continue
+		}
+		values[name] = unquote(value)
+	}
+	return values
+}
+
+func isServerGroup(group string) bool {
+	group = strings.ToLower(group)
+	for _, g := range serverGroups {
+		if group == g || strings.HasPrefix(group, g+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// stripComment removes a # comment outside quotes, and a ; comment when
+// semicolon is set.
+func stripComment(line string, semicolon bool) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '#' || semicolon && r == ';':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
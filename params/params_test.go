@@ -0,0 +1,314 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package params
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+const mysqlSpecs = `{"items": [{"fileName": "my.cnf", "specs": [
+	{"name": "max_connections", "type": "integer", "minimum": 1, "maximum": 100000, "default": 151, "needRestart": false},
+	{"name": "innodb_buffer_pool_size", "type": "integer", "minimum": 5242880, "maximum": 68719476736, "needRestart": true},
+	{"name": "lower_case_table_names", "type": "integer", "immutable": true},
+	{"name": "binlog_format", "type": "string", "enum": ["ROW", "STATEMENT", "MIXED"], "default": "ROW"},
+	{"name": "slow_query_log", "type": "boolean", "default": {"value": "OFF"}},
+	{"name": "long_query_time", "type": "number", "minimum": 0, "maximum": 3600},
+	{"name": "thread_cache_size", "type": "integer", "minimum": 1, "maximum": null},
+	{"name": "wait_timeout", "type": "integer", "minimum": 1}
+]}]}`
+
+// paramStandIn serves parameter specs, configurations and templates, and
+// records reconfigure requests.
+type paramStandIn struct {
+	specs       string
+	clusters    string
+	configs     map[string]string
+	templates   map[string]string
+	reconfigure []kbcloud.ReconfigureCreate
+	// brokenCluster, when set, fails every request about that cluster.
+	brokenCluster string
+}
+
+func newParamStandIn(t *testing.T, specs string) (*paramStandIn, *common.APIClient) {
+	s := &paramStandIn{specs: specs}
+	return s, apitest.NewClient(t, s)
+}
+
+func (s *paramStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := apitest.OrgPath(r, "org")
+	if s.brokenCluster != "" && strings.HasPrefix(path, "/clusters/"+s.brokenCluster+"/") {
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case path == "/clusters":
+		apitest.WriteJSON(w, http.StatusOK, s.clusters)
+	case strings.HasSuffix(path, "/configurations"):
+		apitest.WriteJSON(w, http.StatusOK, s.configs[strings.Split(path, "/")[2]])
+	case strings.HasPrefix(path, "/clusters/") && strings.HasSuffix(path, "/paramTpls"):
+		apitest.WriteJSON(w, http.StatusOK, `{"items": [{"name": "mysql-tuned", "partition": "custom", "count": 3, "needRestart": false}]}`)
+	case strings.HasPrefix(path, "/paramTpls/"):
+		if r.URL.Query().Get("partition") != "custom" {
+			http.NotFound(w, r)
+			return
+		}
+		apitest.WriteJSON(w, http.StatusOK, s.templates[strings.TrimPrefix(path, "/paramTpls/")])
+	case strings.HasSuffix(path, "/parameterSpecs"):
+		apitest.WriteJSON(w, http.StatusOK, s.specs)
+	case strings.HasSuffix(path, "/reconfigure") && r.Method == http.MethodPost:
+		var body kbcloud.ReconfigureCreate
+		json.NewDecoder(r.Body).Decode(&body)
+		s.reconfigure = append(s.reconfigure, body)
+		apitest.WriteJSON(w, http.StatusOK, `{"opsRequestName": "ops-1"}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func loadSpecs(t *testing.T, engine, data string) *Specs {
+	t.Helper()
+	var list kbcloud.ParameterSpecList
+	if err := common.Unmarshal([]byte(data), &list); err != nil {
+		t.Fatal(err)
+	}
+	return NewSpecs(engine, list.Items)
+}
+
+func TestSpecs(t *testing.T) {
+	specs := loadSpecs(t, "apecloud-mysql", mysqlSpecs)
+	spec, ok := specs.Lookup("", "slow_query_log")
+	if !ok || spec.Default != "OFF" || spec.Type != TypeBoolean || spec.File != "my.cnf" {
+		t.Fatalf("slow_query_log = %+v, %v", spec, ok)
+	}
+	spec, _ = specs.Lookup("my.cnf", "binlog_format")
+	if !reflect.DeepEqual(spec.Enum, []string{"ROW", "STATEMENT", "MIXED"}) || spec.Default != "ROW" {
+		t.Fatalf("binlog_format = %+v", spec)
+	}
+	spec, _ = specs.Lookup("", "max_connections")
+	if spec.Minimum == nil || *spec.Maximum != 100000 || spec.Default != "151" {
+		t.Fatalf("max_connections = %+v", spec)
+	}
+	if spec, _ := specs.Lookup("", "lower_case_table_names"); !spec.Immutable || spec.Minimum != nil {
+		t.Fatalf("lower_case_table_names = %+v", spec)
+	}
+	if _, ok := specs.Lookup("other.cnf", "max_connections"); ok {
+		t.Fatal("lookup in another file found max_connections")
+	}
+	if spec, _ := specs.Lookup("", "wait_timeout"); spec.Minimum == nil || *spec.Minimum != 1 || spec.Maximum != nil {
+		t.Fatalf("wait_timeout = %+v", spec)
+	}
+	if n := len(specs.All()); n != 8 {
+		t.Fatalf("All() has %d specs", n)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	mysql := loadSpecs(t, "apecloud-mysql", mysqlSpecs)
+	tests := []struct {
+		name, value string
+		problem     string
+		number      float64
+	}{
+		{"max_connections", "500", "", 500},
+		{"max_connections", "0", "below the minimum 1", 0},
+		{"max_connections", "1.5", "not an integer", 0},
+		{"max_connections", "many", "not a number", 0},
+		{"innodb_buffer_pool_size", "128M", "", 128 << 20},
+		{"innodb_buffer_pool_size", "1m", "below the minimum", 0},
+		{"innodb_buffer_pool_size", "1P", "unsupported unit", 0},
+		{"lower_case_table_names", "1", "immutable", 0},
+		{"binlog_format", "row", "", 0},
+		{"binlog_format", "none", "not one of ROW, STATEMENT, MIXED", 0},
+		{"slow_query_log", "ON", "", 0},
+		{"slow_query_log", "maybe", "not a boolean", 0},
+		{"long_query_time", "0.5", "", 0.5},
+		{"thread_cache_size", "200", "", 200},
+		{"thread_cache_size", "0", "below the minimum 1", 0},
+		{"wait_timeout", "28800", "", 28800},
+		{"wait_timeout", "0", "below the minimum 1", 0},
+		{"sql_mode_x", "1", "unknown parameter", 0},
+	}
+	for _, tt := range tests {
+		r := mysql.Validate(kbcloud.ReconfigureCreate{Parameters: map[string]string{tt.name: tt.value}})
+		c := r.Changes[0]
+		got := strings.Join(c.Problems, "; ")
+		if tt.problem == "" && got != "" || !strings.Contains(got, tt.problem) {
+			t.Errorf("%s=%s: problems %q, want %q", tt.name, tt.value, got, tt.problem)
+		}
+		if tt.number != 0 && (c.Number == nil || *c.Number != tt.number) {
+			t.Errorf("%s=%s: number %v, want %v", tt.name, tt.value, c.Number, tt.number)
+		}
+	}
+
+	pg := loadSpecs(t, "postgresql", `{"items": [{"fileName": "postgresql.conf", "specs": [
+		{"name": "shared_buffers", "type": "integer", "minimum": 16, "maximum": 1073741823, "needRestart": true}
+	]}]}`)
+	r := pg.Validate(kbcloud.ReconfigureCreate{Parameters: map[string]string{"shared_buffers": "1GB"}})
+	if err := r.Err(); err != nil {
+		t.Fatalf("shared_buffers=1GB: %v", err)
+	}
+	if !r.NeedRestart() || !reflect.DeepEqual(r.Restarts(), []string{"shared_buffers"}) {
+		t.Fatalf("restarts = %v", r.Restarts())
+	}
+	r = pg.Validate(kbcloud.ReconfigureCreate{Parameters: map[string]string{"shared_buffers": "8"}})
+	if r.Valid() {
+		t.Fatal("shared_buffers=8 is valid")
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	s, client := newParamStandIn(t, mysqlSpecs)
+	ctx := context.Background()
+
+	req := kbcloud.ReconfigureCreate{
+		Component:  common.PtrString("mysql"),
+		Parameters: map[string]string{"max_connections": "1000", "lower_case_table_names": "0"},
+	}
+	report, _, err := Reconfigure(ctx, client, "org", "c1", "apecloud-mysql", req)
+	if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "lower_case_table_names: parameter is immutable") {
+		t.Fatalf("immutable change: %v", err)
+	}
+	if report == nil || len(s.reconfigure) != 0 {
+		t.Fatalf("report %v, %d requests created", report, len(s.reconfigure))
+	}
+
+	req.Parameters = map[string]string{"max_connections": "1000", "innodb_buffer_pool_size": "1G"}
+	report, ops, err := Reconfigure(ctx, client, "org", "c1", "apecloud-mysql", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops.OpsRequestName != "ops-1" || len(s.reconfigure) != 1 || s.reconfigure[0].Parameters["innodb_buffer_pool_size"] != "1G" {
+		t.Fatalf("ops %+v, requests %+v", ops, s.reconfigure)
+	}
+	if !reflect.DeepEqual(report.Restarts(), []string{"innodb_buffer_pool_size"}) {
+		t.Fatalf("restarts = %v", report.Restarts())
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	mysql := parseConfig("mysql", "my.cnf", `[client]
+port = 3307
+[mysqld]
+port = 3306
+max-connections = 1000 # tuned
+wait_timeout = 600 ; tuned
+sql_mode = "STRICT_TRANS_TABLES;NO_ZERO_DATE"
+skip-name-resolve
+server_id = {{ .ServerID }}
+!includedir /etc/mysql/conf.d
+[mysqldump]
+max_allowed_packet = 16M
+[mysqld-8.0]
+binlog_format = ROW
+`)
+	want := map[string]string{"port": "3306", "binlog_format": "ROW", "max_connections": "1000", "wait_timeout": "600", "sql_mode": "STRICT_TRANS_TABLES;NO_ZERO_DATE", "skip_name_resolve": "ON"}
+	if !reflect.DeepEqual(mysql, want) {
+		t.Fatalf("mysql = %v", mysql)
+	}
+	pg := parseConfig("postgresql", "postgresql.conf", "shared_buffers = '1GB'\ninclude 'extra.conf'\nlog_line_prefix = '%m [%p] '\nsearch_path = a;b # schemas")
+	if !reflect.DeepEqual(pg, map[string]string{"shared_buffers": "1GB", "log_line_prefix": "%m [%p] ", "search_path": "a;b"}) {
+		t.Fatalf("postgresql = %v", pg)
+	}
+	redis := parseConfig("redis", "redis.conf", "maxmemory-policy allkeys-lru\nsave 900 1")
+	if !reflect.DeepEqual(redis, map[string]string{"maxmemory-policy": "allkeys-lru", "save": "900 1"}) {
+		t.Fatalf("redis = %v", redis)
+	}
+}
+
+func TestDetector(t *testing.T) {
+	s, client := newParamStandIn(t, mysqlSpecs)
+	s.clusters = `{"items": [
+		{"id": "2", "name": "db2", "engine": "apecloud-mysql", "environmentName": "prod", "status": "Running", "cloudProvider": "aws", "terminationPolicy": "Delete", "version": "8.0", "createdAt": "2024-01-01T00:00:00Z", "updatedAt": "2024-01-01T00:00:00Z"},
+		{"id": "1", "name": "db1", "engine": "apecloud-mysql", "environmentName": "prod", "status": "Running", "cloudProvider": "aws", "terminationPolicy": "Delete", "version": "8.0", "createdAt": "2024-01-01T00:00:00Z", "updatedAt": "2024-01-01T00:00:00Z"}]}`
+	s.configs = map[string]string{
+		"db1": `{"items": [{"fileName": "my.cnf", "content": "[mysqld]\nmax_connections=1000\ninnodb_buffer_pool_size=1G\nslow_query_log=1\nbinlog_format=ROW\nlower_case_table_names=1"}]}`,
+		"db2": `{"items": [{"fileName": "my.cnf", "content": "[mysqld]\nmax_connections=500\ninnodb_buffer_pool_size=512M\nslow_query_log=ON\nbinlog_format=MIXED\nlower_case_table_names=0"}]}`,
+	}
+	s.templates = map[string]string{
+		"mysql-tuned": `{"family": "mysql-8.0", "items": [{"specName": "mysql-config", "config": {"fileName": "my.cnf", "regex": "", "content": "[mysqld]\nmax_connections = 1000\ninnodb_buffer_pool_size = 1073741824\nslow_query_log = ON\nlower_case_table_names = 1\nserver_id = {{ .ServerID }}"}, "parameterSpec": {"fileName": "my.cnf", "specs": []}}]}`,
+	}
+	ctx := context.Background()
+
+	drifts, err := NewDetector(client, "org", DetectorOptions{Component: "mysql"}).Detect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 2 || drifts[0].Cluster != "db1" || len(drifts[0].Drifts) != 0 {
+		t.Fatalf("drifts = %+v", drifts)
+	}
+	db2 := drifts[1]
+	if !reflect.DeepEqual(db2.Templates, []string{"mysql-tuned"}) || len(db2.Drifts) != 3 {
+		t.Fatalf("db2 = %+v", db2)
+	}
+	if d := db2.Drifts[0]; d.Name != "innodb_buffer_pool_size" || d.Actual != "512M" || d.Source != SourceTemplate || d.Template != "mysql-tuned" || !d.NeedRestart {
+		t.Fatalf("drift = %+v", d)
+	}
+	// Immutable parameters are flagged and left out of the remediations.
+	if d := db2.Drifts[1]; d.Name != "lower_case_table_names" || !d.Immutable || db2.Drifts[0].Immutable {
+		t.Fatalf("immutable drift = %+v", d)
+	}
+
+	rems := db2.Remediations()
+	if len(rems) != 2 || rems[0].NeedRestart || !rems[1].NeedRestart {
+		t.Fatalf("remediations = %+v", rems)
+	}
+	if got := rems[0].Request; got.GetComponent() != "mysql" || got.GetConfigFileName() != "my.cnf" || !reflect.DeepEqual(got.Parameters, map[string]string{"max_connections": "1000"}) {
+		t.Fatalf("remediation = %+v", got)
+	}
+	if got := rems[1].Request.Parameters; !reflect.DeepEqual(got, map[string]string{"innodb_buffer_pool_size": "1073741824"}) {
+		t.Fatalf("restart remediation = %v", got)
+	}
+	specs := loadSpecs(t, "apecloud-mysql", mysqlSpecs)
+	for _, rem := range rems {
+		if err := specs.Validate(rem.Request).Err(); err != nil {
+			t.Fatalf("remediation is invalid: %v", err)
+		}
+	}
+
+	d := NewDetector(client, "org", DetectorOptions{Defaults: true, Filter: func(c kbcloud.ClusterListItem) bool { return c.Name == "db2" }})
+	drifts, err = d.Detect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 || len(drifts[0].Drifts) != 4 {
+		t.Fatalf("drifts = %+v", drifts)
+	}
+	if d := drifts[0].Drifts[0]; d.Name != "binlog_format" || d.Source != SourceDefault || d.Expected != "ROW" {
+		t.Fatalf("default drift = %+v", d)
+	}
+}
+
+func TestDetectorClusterError(t *testing.T) {
+	s, client := newParamStandIn(t, mysqlSpecs)
+	s.clusters = `{"items": [
+		{"id": "2", "name": "db2", "engine": "apecloud-mysql", "environmentName": "prod", "status": "Running", "cloudProvider": "aws", "terminationPolicy": "Delete", "version": "8.0", "createdAt": "2024-01-01T00:00:00Z", "updatedAt": "2024-01-01T00:00:00Z"},
+		{"id": "1", "name": "db1", "engine": "apecloud-mysql", "environmentName": "prod", "status": "Running", "cloudProvider": "aws", "terminationPolicy": "Delete", "version": "8.0", "createdAt": "2024-01-01T00:00:00Z", "updatedAt": "2024-01-01T00:00:00Z"}]}`
+	s.configs = map[string]string{
+		"db2": `{"items": [{"fileName": "my.cnf", "content": "[mysqld]\nmax_connections=500"}]}`,
+	}
+	s.templates = map[string]string{
+		"mysql-tuned": `{"family": "mysql-8.0", "items": [{"specName": "mysql-config", "config": {"fileName": "my.cnf", "regex": "", "content": "[mysqld]\nmax_connections = 1000"}, "parameterSpec": {"fileName": "my.cnf", "specs": []}}]}`,
+	}
+	s.brokenCluster = "db1"
+
+	// The failure of db1 does not stop the scan of db2.
+	drifts, err := NewDetector(client, "org", DetectorOptions{}).Detect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "db1") {
+		t.Fatalf("got error %v, want an error about db1", err)
+	}
+	if len(drifts) != 1 || drifts[0].Cluster != "db2" || len(drifts[0].Drifts) != 1 {
+		t.Fatalf("drifts = %+v", drifts)
+	}
+}
@@ -0,0 +1,210 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package params checks cluster parameter changes against the parameter
+// specs of the engine before they are applied, and detects parameters that
+// drifted from the templates applied to a cluster.
+package params
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/connstr"
+)
+
+// Spec describes a parameter of a configuration file.
+type Spec struct {
+	File        string `json:"file,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type"`
+	// Default is the engine default, empty if unknown.
+	Default     string   `json:"default,omitempty"`
+	NeedRestart bool     `json:"needRestart"`
+	Immutable   bool     `json:"immutable"`
+	Minimum     *float64 `json:"minimum,omitempty"`
+	Maximum     *float64 `json:"maximum,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// Specs are the parameter specs of a cluster component, by file and name.
+type Specs struct {
+	engine connstr.Engine
+	files  []string
+	specs  map[string]map[string]Spec
+}
+
+// LoadSpecs returns the parameter specs of a component of a cluster running engine.
+func LoadSpecs(ctx context.Context, client *common.APIClient, orgName, clusterName, component, engine string) (*Specs, error) {
+	params := kbcloud.NewListParameterSpecsOptionalParameters()
+	if component != "" {
+		params = params.WithComponent(component)
+	}
+	list, _, err := kbcloud.NewParameterApi(client).ListParameterSpecs(ctx, orgName, clusterName, *params)
+	if err != nil {
+		return nil, fmt.Errorf("list parameter specs: %w", err)
+	}
+	return NewSpecs(engine, list.Items), nil
+}
+
+// NewSpecs indexes the parameter specs of a component of a cluster running engine.
+func NewSpecs(engine string, items []kbcloud.ParameterSpecListItem) *Specs {
+	family, _ := connstr.EngineOf(engine)
+	s := &Specs{engine: family, specs: map[string]map[string]Spec{}}
+	for _, item := range items {
+		file, raws := item.GetFileName(), make([]map[string]interface{}, 0, len(item.Specs))
+		for _, p := range item.Specs {
+			raws = append(raws, rawSpec(p))
+		}
+		// Specs omitting fields the generated model requires, such as
+		// default, leave the whole item unparsed.
+		if raw := item.UnparsedObject; raw != nil {
+			file, _ = raw["fileName"].(string)
+			list, _ := raw["specs"].([]interface{})
+			for _, p := range list {
+				if m, ok := p.(map[string]interface{}); ok {
+					raws = append(raws, m)
+				}
+			}
+		}
+		if _, ok := s.specs[file]; !ok {
+			s.files = append(s.files, file)
+			s.specs[file] = map[string]Spec{}
+		}
+		for _, raw := range raws {
+			spec := specOf(raw)
+			spec.File = file
+			s.specs[file][spec.Name] = spec
+		}
+	}
+	sort.Strings(s.files)
+	return s
+}
+
+// Lookup returns the spec of a parameter. With an empty file, every file is
+// searched in name order.
+func (s *Specs) Lookup(file, name string) (Spec, bool) {
+	if file != "" {
+		spec, ok := s.specs[file][name]
+		return spec, ok
+	}
+	for _, f := range s.files {
+		if spec, ok := s.specs[f][name]; ok {
+			return spec, true
+		}
+	}
+	return Spec{}, false
+}
+
+// All returns every spec, ordered by file and name.
+func (s *Specs) All() []Spec {
+	var all []Spec
+	for _, f := range s.files {
+		names := make([]string, 0, len(s.specs[f]))
+		for name := range s.specs[f] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			all = append(all, s.specs[f][name])
+		}
+	}
+	return all
+}
+
+// rawSpec returns a spec from the API as JSON values. Scalar defaults and
+// enum values do not fit the generated model and are kept in its unparsed
+// object.
+func rawSpec(p kbcloud.ParameterSpec) map[string]interface{} {
+	if p.UnparsedObject != nil {
+		return p.UnparsedObject
+	}
+	raw := map[string]interface{}{
+		"name": p.Name, "description": p.Description, "type": p.Type,
+		"needRestart": p.NeedRestart, "immutable": p.Immutable,
+		"minimum": p.Minimum, "maximum": p.Maximum,
+	}
+	if len(p.Default) > 0 {
+		raw["default"] = p.Default
+	}
+	enum := make([]interface{}, len(p.Enum))
+	for i, e := range p.Enum {
+		enum[i] = e
+	}
+	raw["enum"] = enum
+	return raw
+}
+
+// specOf converts a spec decoded as JSON values.
+func specOf(raw map[string]interface{}) Spec {
+	str := func(k string) string {
+		if v, ok := raw[k]; ok && v != nil {
+			return scalar(v)
+		}
+		return ""
+	}
+	// num returns nil for a bound that is missing or null.
+	num := func(k string) *float64 {
+		f, err := strconv.ParseFloat(str(k), 64)
+		if err != nil {
+			return nil
+		}
+		return &f
+	}
+	spec := Spec{
+		Name:        str("name"),
+		Description: str("description"),
+		Type:        strings.ToLower(str("type")),
+		Default:     str("default"),
+		NeedRestart: str("needRestart") == "true",
+		Immutable:   str("immutable") == "true",
+	}
+	spec.Minimum, spec.Maximum = num("minimum"), num("maximum")
+	// Zero bounds on both sides mean the parameter is unbounded.
+	if spec.Minimum != nil && spec.Maximum != nil && *spec.Minimum == 0 && *spec.Maximum == 0 {
+		spec.Minimum, spec.Maximum = nil, nil
+	}
+	if enum, ok := raw["enum"].([]interface{}); ok {
+		for _, e := range enum {
+			if v := scalar(e); v != "" {
+				spec.Enum = append(spec.Enum, v)
+			}
+		}
+	}
+	return spec
+}
+
+// scalar renders a JSON value as a parameter value. Objects holding a single
+// value, such as {"value": "ON"}, render as that value.
+func scalar(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case bool:
+		return strconv.FormatBool(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case map[string]interface{}:
+		if len(x) == 1 {
+			for _, inner := range x {
+				return scalar(inner)
+			}
+		}
+		if len(x) == 0 {
+			return ""
+		}
+		data, _ := common.Marshal(x)
+		return string(data)
+	default:
+		return fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,263 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package params
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/connstr"
+)
+
+// ErrInvalid is returned by Reconfigure when a change fails validation.
+var ErrInvalid = errors.New("invalid parameter change")
+
+// List of parameter types.
+const (
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeBoolean = "boolean"
+	TypeString  = "string"
+)
+
+// Change is the validation result of a parameter change.
+type Change struct {
+	File  string `json:"file,omitempty"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Number is the value in the base unit of the parameter, for numeric
+	// parameters whose value could be converted.
+	Number      *float64 `json:"number,omitempty"`
+	NeedRestart bool     `json:"needRestart"`
+	Problems    []string `json:"problems,omitempty"`
+}
+
+// Report is the validation result of a ReconfigureCreate.
+type Report struct {
+	Changes []Change `json:"changes"`
+}
+
+// Valid reports whether no change has a problem.
+func (r *Report) Valid() bool {
+	for _, c := range r.Changes {
+		if len(c.Problems) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// NeedRestart reports whether applying the changes restarts the component.
+func (r *Report) NeedRestart() bool {
+	return len(r.Restarts()) > 0
+}
+
+// Restarts returns the names of the parameters whose change restarts the component.
+func (r *Report) Restarts() []string {
+	var names []string
+	for _, c := range r.Changes {
+		if c.NeedRestart {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// Err returns an error listing every problem, or nil.
+func (r *Report) Err() error {
+	var msgs []string
+	for _, c := range r.Changes {
+		for _, p := range c.Problems {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", c.Name, p))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrInvalid, strings.Join(msgs, "; "))
+}
+
+// Validate checks the parameters of req against the specs. Changes are
+// reported in name order.
+func (s *Specs) Validate(req kbcloud.ReconfigureCreate) *Report {
+	file := req.GetConfigFileName()
+	names := make([]string, 0, len(req.Parameters))
+	for name := range req.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r := &Report{Changes: make([]Change, 0, len(names))}
+	for _, name := range names {
+		r.Changes = append(r.Changes, s.check(file, name, req.Parameters[name]))
+	}
+	return r
+}
+
+func (s *Specs) check(file, name, value string) Change {
+	c := Change{File: file, Name: name, Value: value}
+	spec, ok := s.Lookup(file, name)
+	if !ok {
+		c.Problems = append(c.Problems, "unknown parameter")
+		return c
+	}
+	c.File, c.NeedRestart = spec.File, spec.NeedRestart
+	if spec.Immutable {
+		c.Problems = append(c.Problems, "parameter is immutable")
+		return c
+	}
+	if len(spec.Enum) > 0 && !containsFold(spec.Enum, value) {
+		c.Problems = append(c.Problems, fmt.Sprintf("%q is not one of %s", value, strings.Join(spec.Enum, ", ")))
+		return c
+	}
+	switch spec.Type {
+	case TypeInteger, "int":
+		n, exact, err := s.number(value)
+		if err != nil {
+			c.Problems = append(c.Problems, err.Error())
+			return c
+		}
+		if n != math.Trunc(n) {
+			c.Problems = append(c.Problems, fmt.Sprintf("%q is not an integer", value))
+			return c
+		}
+		c.Number = &n
+		if exact {
+			c.Problems = append(c.Problems, bounds(spec, n)...)
+		}
+	case TypeNumber, "float", "real":
+		n, exact, err := s.number(value)
+		if err != nil {
+			c.Problems = append(c.Problems, err.Error())
+			return c
+		}
+		c.Number = &n
+		if exact {
+			c.Problems = append(c.Problems, bounds(spec, n)...)
+		}
+	case TypeBoolean, "bool":
+		if _, ok := parseBool(value); !ok {
+			c.Problems = append(c.Problems, fmt.Sprintf("%q is not a boolean", value))
+		}
+	}
+	return c
+}
+
+func bounds(spec Spec, n float64) []string {
+	if spec.Minimum != nil && n < *spec.Minimum {
+		return []string{fmt.Sprintf("%s is below the minimum %s", fmtNum(n), fmtNum(*spec.Minimum))}
+	}
+	if spec.Maximum != nil && n > *spec.Maximum {
+		return []string{fmt.Sprintf("%s is above the maximum %s", fmtNum(n), fmtNum(*spec.Maximum))}
+	}
+	return nil
+}
+
+func fmtNum(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// number parses a numeric value with the unit suffixes of the engine. exact
+// is false when the value carries a unit whose base unit depends on the
+// parameter, so its bounds cannot be checked.
+func (s *Specs) number(value string) (n float64, exact bool, err error) {
+	v := strings.TrimSpace(value)
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return f, true, nil
+	}
+	i := strings.IndexFunc(v, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '-' && r != '+'
+	})
+	if i <= 0 {
+		return 0, false, fmt.Errorf("%q is not a number", value)
+	}
+	f, err := strconv.ParseFloat(v[:i], 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("%q is not a number", value)
+	}
+	unit := strings.TrimSpace(v[i:])
+	switch s.engine {
+	case connstr.EngineMySQL:
+		// MySQL sizes take K, M, G or T suffixes, in powers of 1024.
+		if m, ok := binaryUnits[strings.ToUpper(unit)]; ok {
+			return f * m, true, nil
+		}
+	case connstr.EngineRedis:
+		// Redis sizes are k, m, g in powers of 1000 and kb, mb, gb in powers of 1024.
+		if m, ok := redisUnits[strings.ToLower(unit)]; ok {
+			return f * m, true, nil
+		}
+	case connstr.EnginePostgreSQL:
+		// PostgreSQL scales values to the unit of each parameter, e.g. 8kB
+		// pages for shared_buffers, which the specs do not expose.
+		if postgresUnits[unit] {
+			return f, false, nil
+		}
+	}
+	return 0, false, fmt.Errorf("%q has an unsupported unit %q", value, unit)
+}
+
+var binaryUnits = map[string]float64{
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+var redisUnits = map[string]float64{
+	"k": 1e3, "kb": 1 << 10,
+	"m": 1e6, "mb": 1 << 20,
+	"g": 1e9, "gb": 1 << 30,
+}
+
+var postgresUnits = map[string]bool{
+	"B": true, "kB": true, "MB": true, "GB": true, "TB": true,
+	"us": true, "ms": true, "s": true, "min": true, "h": true, "d": true,
+}
+
+func parseBool(v string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "on", "true", "yes", "1":
+		return true, true
+	case "off", "false", "no", "0":
+		return false, true
+	}
+	return false, false
+}
+
+func containsFold(values []string, v string) bool {
+	for _, x := range values {
+		if strings.EqualFold(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconfigure validates req against the parameter specs of the component of
+// clusterName and creates the reconfigure ops request. Invalid changes are
+// refused with ErrInvalid, without creating a request. The report is
+// returned in both cases.
+func Reconfigure(ctx context.Context, client *common.APIClient, orgName, clusterName, engine string, req kbcloud.ReconfigureCreate) (*Report, kbcloud.OpsRequestName, error) {
+	specs, err := LoadSpecs(ctx, client, orgName, clusterName, req.GetComponent(), engine)
+	if err != nil {
+		return nil, kbcloud.OpsRequestName{}, err
+	}
+	report := specs.Validate(req)
+	if err := report.Err(); err != nil {
+		return report, kbcloud.OpsRequestName{}, err
+	}
+	ops, _, err := kbcloud.NewOpsrequestApi(client).ReconfigureCluster(ctx, orgName, clusterName, req)
+	if err != nil {
+		return report, kbcloud.OpsRequestName{}, fmt.Errorf("reconfigure cluster %s: %w", clusterName, err)
+	}
+	return report, ops, nil
+}
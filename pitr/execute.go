@@ -0,0 +1,77 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package pitr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/wait"
+)
+
+// Execute runs a plan and waits until the restored cluster is running. The
+// recoverable window and the base backup are checked again first, since
+// retention may have moved or deleted them since the plan was made.
+func (p *Planner) Execute(ctx context.Context, plan *Plan) (kbcloud.Cluster, error) {
+	window, _, err := p.restoreApi.GetRestoreTimeRange(ctx, plan.OrgName, plan.ClusterId)
+	if err != nil {
+		return kbcloud.Cluster{}, fmt.Errorf("get restore time range: %w", err)
+	}
+	at, _ := time.Parse(RestoreTimeLayout, plan.RestoreTime)
+	if window.TimeRangeStart == nil || window.TimeRangeEnd == nil ||
+		at.Before(*window.TimeRangeStart) || at.After(*window.TimeRangeEnd) {
+		return kbcloud.Cluster{}, fmt.Errorf("%w: %s is no longer recoverable", ErrOutOfRange, plan.RestoreTime)
+	}
+	if err := p.checkBaseBackup(ctx, plan); err != nil {
+		return kbcloud.Cluster{}, err
+	}
+
+	interval := p.opts.PollInterval
+	switch plan.Mode {
+	case ModeNewCluster:
+		if _, _, err := p.restoreApi.RestoreCluster(ctx, plan.OrgName, *plan.NewCluster); err != nil {
+			return kbcloud.Cluster{}, fmt.Errorf("restore cluster: %w", err)
+		}
+		return wait.ForClusterRunning(ctx, p.clusterApi, plan.OrgName, plan.NewCluster.Cluster.Name, interval, p.opts.Timeout)
+	case ModeInPlace:
+		for _, r := range plan.Restores {
+			created, _, err := p.restoreApi.DoRestore(ctx, plan.OrgName, plan.Cluster, r)
+			if err != nil {
+				return kbcloud.Cluster{}, fmt.Errorf("restore component %s: %w", r.ComponentName, err)
+			}
+			name := created.GetName()
+			if name == "" {
+				name = created.GetId()
+			}
+			if _, err := wait.ForRestore(ctx, p.restoreApi, plan.OrgName, plan.Cluster, name, interval, p.opts.Timeout); err != nil {
+				return kbcloud.Cluster{}, fmt.Errorf("wait for restore of component %s: %w", r.ComponentName, err)
+			}
+		}
+		return wait.ForClusterRunning(ctx, p.clusterApi, plan.OrgName, plan.Cluster, interval, p.opts.Timeout)
+	}
+	return kbcloud.Cluster{}, fmt.Errorf("unknown restore mode %q", plan.Mode)
+}
+
+// checkBaseBackup verifies that the base backup of plan is still a completed backup.
+func (p *Planner) checkBaseBackup(ctx context.Context, plan *Plan) error {
+	id := plan.BaseBackup.GetId()
+	if id == "" {
+		id = plan.BaseBackup.Name
+	}
+	backup, resp, err := p.backupApi.GetBackup(ctx, plan.OrgName, id)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: base backup %s was deleted", ErrNoBaseBackup, plan.BaseBackup.Name)
+		}
+		return fmt.Errorf("get base backup %s: %w", plan.BaseBackup.Name, err)
+	}
+	if backup.Status != kbcloud.BackupStatusCompleted {
+		return fmt.Errorf("%w: base backup %s is %s", ErrNoBaseBackup, plan.BaseBackup.Name, backup.Status)
+	}
+	return nil
+}
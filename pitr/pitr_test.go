@@ -0,0 +1,210 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package pitr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/internal/apitest"
+)
+
+// backupJSON returns a backup of cluster db with every field the generated model requires.
+func backupJSON(name, backupType, status string, fields map[string]interface{}) map[string]interface{} {
+	b := map[string]interface{}{
+		"id": name, "name": name, "backupType": backupType, "status": status,
+		"autoBackup": true, "backupMethod": "xtrabackup", "backupPolicyName": "db-policy",
+		"creationTimestamp": "2023-12-31T00:00:00Z", "orgName": "org", "snapshotVolumes": false,
+		"sourceCluster": "db", "totalSize": "1Gi", "retentionPeriod": "7d", "cloudProvider": "aws",
+		"cloudRegion": "us-east-1", "environmentName": "prod", "engine": "mysql",
+	}
+	for k, v := range fields {
+		b[k] = v
+	}
+	return b
+}
+
+// restoreStandIn serves cluster db, its backups and its recoverable window,
+// and records restore requests.
+type restoreStandIn struct {
+	mu       sync.Mutex
+	backups  map[string]map[string]interface{}
+	restores map[string][]map[string]interface{}
+}
+
+func newRestoreStandIn() *restoreStandIn {
+	s := &restoreStandIn{backups: map[string]map[string]interface{}{}, restores: map[string][]map[string]interface{}{}}
+	for _, b := range []map[string]interface{}{
+		backupJSON("old", "Full", "Completed", map[string]interface{}{"completionTimestamp": "2023-12-31T02:00:00Z"}),
+		backupJSON("b1", "Full", "Completed", map[string]interface{}{"completionTimestamp": "2024-01-01T02:00:00Z"}),
+		backupJSON("b2", "Full", "Completed", map[string]interface{}{"timeRangeEnd": "2024-01-02T02:00:00Z", "completionTimestamp": "2024-01-02T02:05:00Z"}),
+		backupJSON("failed", "Full", "Failed", map[string]interface{}{"completionTimestamp": "2024-01-02T10:00:00Z"}),
+		backupJSON("incr", "Incremental", "Completed", map[string]interface{}{"completionTimestamp": "2024-01-02T11:00:00Z"}),
+		backupJSON("b3", "Full", "Completed", map[string]interface{}{"completionTimestamp": "2024-01-02T20:00:00Z"}),
+	} {
+		s.backups[b["name"].(string)] = b
+	}
+	return s
+}
+
+func (s *restoreStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := apitest.OrgPath(r, "org")
+	if r.Method == http.MethodPost {
+		var body map[string]interface{}
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &body)
+		s.restores[path] = append(s.restores[path], body)
+	}
+	switch {
+	case r.Method == http.MethodGet && path == "/clusters/db":
+		apitest.WriteJSON(w, http.StatusOK, `{"id": 42, "name": "db", "engine": "mysql", "environmentName": "prod", "status": "Running",
+			"version": "8.0.33", "components": [{"component": "mysql", "replicas": 2, "codeShort": "xyz"}, {"component": "proxy", "replicas": 1}]}`)
+	case r.Method == http.MethodGet && path == "/clusters/db-new":
+		apitest.WriteJSON(w, http.StatusOK, `{"id": 43, "name": "db-new", "engine": "mysql", "environmentName": "prod", "status": "Running"}`)
+	case r.Method == http.MethodGet && path == "/clustersWithDelete/restoreTimeRange":
+		if r.URL.Query().Get("clusterID") != "42" {
+			http.Error(w, "unexpected cluster "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		apitest.WriteJSON(w, http.StatusOK, backupJSON("log", "Continuous", "Running", map[string]interface{}{
+			"id": "log-1", "timeRangeStart": "2024-01-01T00:00:00Z", "timeRangeEnd": "2024-01-03T00:00:00Z",
+		}))
+	case r.Method == http.MethodGet && path == "/backups":
+		if r.URL.Query().Get("clusterID") != "42" {
+			http.Error(w, "unexpected cluster "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		items := []interface{}{}
+		for _, b := range s.backups {
+			items = append(items, b)
+		}
+		apitest.WriteJSON(w, http.StatusOK, map[string]interface{}{"items": items})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/backups/"):
+		b, ok := s.backups[strings.TrimPrefix(path, "/backups/")]
+		if !ok {
+			apitest.WriteJSON(w, http.StatusNotFound, `{"code": 404, "message": "backup not found"}`)
+			return
+		}
+		apitest.WriteJSON(w, http.StatusOK, b)
+	case r.Method == http.MethodPost && path == "/restore":
+		apitest.WriteJSON(w, http.StatusOK, `{"id": 43, "name": "db-new", "engine": "mysql", "environmentName": "prod"}`)
+	case r.Method == http.MethodPost && path == "/clusters/db/restore":
+		apitest.WriteJSON(w, http.StatusOK, `{"name": "restore-1", "backupName": "log", "clusterName": "db", "componentName": "mysql"}`)
+	case r.Method == http.MethodGet && path == "/clusters/db/restore":
+		apitest.WriteJSON(w, http.StatusOK, `{"items": [{"name": "restore-1", "backupName": "log", "clusterName": "db", "componentName": "mysql", "status": {"phase": "Completed"}}]}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var target = time.Date(2024, 1, 2, 12, 0, 30, 500e6, time.UTC)
+
+func TestPlan(t *testing.T) {
+	planner := NewPlanner(apitest.NewClient(t, newRestoreStandIn()), PlannerOptions{})
+	plan, err := planner.Plan(context.Background(), "org", "db", target, RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.ClusterId != "42" || plan.RestoreTime != "2024-01-02T12:00:30Z" || plan.Mode != ModeInPlace {
+		t.Fatalf("plan = %+v", plan)
+	}
+	// b2 is consistent at the end of its time range, before it completed.
+	if plan.BaseBackup.Name != "b2" || !plan.BaseBackupEnd.Equal(time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC)) {
+		t.Fatalf("base backup = %s at %s", plan.BaseBackup.Name, plan.BaseBackupEnd)
+	}
+	if len(plan.Restores) != 2 || plan.Restores[0].ComponentName != "mysql" || plan.Restores[1].ComponentName != "proxy" ||
+		plan.Restores[0].BackupName != "log" || plan.Restores[0].GetRestoreTime() != plan.RestoreTime {
+		t.Fatalf("restores = %+v", plan.Restores)
+	}
+	if s := plan.String(); !strings.Contains(s, "base backup:        b2") || !strings.Contains(s, "from 2024-01-02T02:00:00Z to 2024-01-02T12:00:30Z (10h0m30s)") {
+		t.Errorf("explanation:\n%s", s)
+	}
+
+	plan, err = planner.Plan(context.Background(), "org", "db", target, RestoreOptions{NewClusterName: "db-new", EnvironmentName: "staging", Components: []string{"ignored"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := plan.NewCluster
+	if plan.Mode != ModeNewCluster || req.BackupId != "log-1" || req.GetRestoreTimeStr() != plan.RestoreTime ||
+		req.Cluster.Name != "db-new" || req.EnvironmentName != "staging" || req.Cluster.Components[0].CodeShort != nil {
+		t.Fatalf("new cluster request = %+v", req)
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	planner := NewPlanner(apitest.NewClient(t, newRestoreStandIn()), PlannerOptions{})
+	for _, tc := range []struct {
+		target time.Time
+		err    error
+	}{
+		{time.Date(2023, 12, 31, 12, 0, 0, 0, time.UTC), ErrOutOfRange},
+		{time.Date(2024, 1, 3, 0, 0, 1, 0, time.UTC), ErrOutOfRange},
+		// The only full backup before is older than the recoverable window.
+		{time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), ErrNoBaseBackup},
+	} {
+		if _, err := planner.Plan(context.Background(), "org", "db", tc.target, RestoreOptions{}); !errors.Is(err, tc.err) {
+			t.Errorf("plan at %s: %v, want %v", tc.target, err, tc.err)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	s := newRestoreStandIn()
+	planner := NewPlanner(apitest.NewClient(t, s), PlannerOptions{PollInterval: time.Millisecond, Timeout: time.Second})
+	ctx := context.Background()
+
+	plan, err := planner.Plan(ctx, "org", "db", target, RestoreOptions{NewClusterName: "db-new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster, err := planner.Execute(ctx, plan); err != nil || cluster.Name != "db-new" {
+		t.Fatalf("execute new cluster: %s, %v", cluster.Name, err)
+	}
+	if body := s.restores["/restore"]; len(body) != 1 || body[0]["backupId"] != "log-1" || body[0]["restoreTimeStr"] != plan.RestoreTime {
+		t.Fatalf("restore requests = %v", body)
+	}
+
+	plan, err = planner.Plan(ctx, "org", "db", target, RestoreOptions{Components: []string{"mysql"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster, err := planner.Execute(ctx, plan); err != nil || cluster.Name != "db" {
+		t.Fatalf("execute in place: %s, %v", cluster.Name, err)
+	}
+	if body := s.restores["/clusters/db/restore"]; len(body) != 1 || body[0]["componentName"] != "mysql" {
+		t.Fatalf("restore requests = %v", body)
+	}
+}
+
+func TestExecuteWithoutBaseBackup(t *testing.T) {
+	s := newRestoreStandIn()
+	planner := NewPlanner(apitest.NewClient(t, s), PlannerOptions{PollInterval: time.Millisecond, Timeout: time.Second})
+	ctx := context.Background()
+	plan, err := planner.Plan(ctx, "org", "db", target, RestoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.backups["b2"]["status"] = "Deleting"
+	if _, err := planner.Execute(ctx, plan); !errors.Is(err, ErrNoBaseBackup) {
+		t.Fatalf("execute with a deleting base backup: %v", err)
+	}
+	delete(s.backups, "b2")
+	if _, err := planner.Execute(ctx, plan); !errors.Is(err, ErrNoBaseBackup) {
+		t.Fatalf("execute with a deleted base backup: %v", err)
+	}
+	if len(s.restores) != 0 {
+		t.Fatalf("restores submitted: %v", s.restores)
+	}
+}
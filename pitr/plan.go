@@ -0,0 +1,278 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package pitr plans and executes point-in-time restores of clusters.
+package pitr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+	"github.com/apecloud/kb-cloud-client-go/internal/apiutil"
+)
+
+// RestoreTimeLayout is the layout of restore times sent to the API.
+const RestoreTimeLayout = time.RFC3339
+
+// FormatRestoreTime formats t as a restore time: UTC, truncated to the second.
+func FormatRestoreTime(t time.Time) string {
+	return t.UTC().Truncate(time.Second).Format(RestoreTimeLayout)
+}
+
+// Mode is how a point-in-time restore is applied.
+type Mode string
+
+// List of Mode.
+const (
+	// ModeInPlace restores components of the source cluster with DoRestore.
+	ModeInPlace Mode = "InPlace"
+	// ModeNewCluster restores into a new cluster with RestoreCluster.
+	ModeNewCluster Mode = "NewCluster"
+)
+
+var (
+	// ErrOutOfRange is returned when the target time is outside the recoverable window.
+	ErrOutOfRange = errors.New("target time is outside the recoverable window")
+	// ErrNoBaseBackup is returned when no completed full backup precedes the target time.
+	ErrNoBaseBackup = errors.New("no completed full backup before the target time")
+)
+
+// RestoreOptions selects how a plan restores the cluster.
+type RestoreOptions struct {
+	// NewClusterName restores into a new cluster of that name. The restore is
+	// in place when empty.
+	NewClusterName string
+	// EnvironmentName is the environment of the new cluster. Defaults to the source environment.
+	EnvironmentName string
+	// Components limits an in-place restore to the given components. All components are restored when empty.
+	Components []string
+	// VolumeRestorePolicy is passed to RestoreCluster when set.
+	VolumeRestorePolicy kbcloud.VolumeRestorePolicy
+}
+
+// Plan describes a point-in-time restore. It can be printed as a dry run and
+// passed to Planner.Execute.
+type Plan struct {
+	OrgName   string    `json:"orgName"`
+	Cluster   string    `json:"cluster"`
+	ClusterId string    `json:"clusterId"`
+	Target    time.Time `json:"target"`
+	// RestoreTime is Target formatted for the API.
+	RestoreTime string `json:"restoreTime"`
+	// WindowStart and WindowEnd bound the recoverable window.
+	WindowStart time.Time `json:"windowStart"`
+	WindowEnd   time.Time `json:"windowEnd"`
+	Mode        Mode      `json:"mode"`
+	// BaseBackup is the full backup the restore starts from. Execute refuses
+	// to run once it is no longer a completed backup.
+	BaseBackup kbcloud.Backup `json:"baseBackup"`
+	// LogBackup is the continuous backup whose logs are replayed from
+	// BaseBackupEnd up to Target.
+	LogBackup     kbcloud.Backup `json:"logBackup"`
+	BaseBackupEnd time.Time      `json:"baseBackupEnd"`
+	// NewCluster is the RestoreCluster request of a ModeNewCluster plan.
+	NewCluster *kbcloud.RestoreCreate `json:"newCluster,omitempty"`
+	// Restores are the DoRestore requests of a ModeInPlace plan, one per component.
+	Restores []kbcloud.Restore `json:"restores,omitempty"`
+}
+
+// String explains the plan in a few lines, suitable for a dry run.
+func (p *Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Point-in-time restore of cluster %s to %s\n", p.Cluster, p.RestoreTime)
+	fmt.Fprintf(&b, "  recoverable window: %s to %s\n", FormatRestoreTime(p.WindowStart), FormatRestoreTime(p.WindowEnd))
+	fmt.Fprintf(&b, "  base backup:        %s (%s, %s), consistent at %s\n",
+		p.BaseBackup.Name, p.BaseBackup.BackupMethod, p.BaseBackup.TotalSize, FormatRestoreTime(p.BaseBackupEnd))
+	fmt.Fprintf(&b, "  log replay:         %s from %s to %s (%s)\n",
+		p.LogBackup.Name, FormatRestoreTime(p.BaseBackupEnd), p.RestoreTime, p.Target.Truncate(time.Second).Sub(p.BaseBackupEnd))
+	switch p.Mode {
+	case ModeNewCluster:
+		fmt.Fprintf(&b, "  target:             new cluster %s in environment %s\n", p.NewCluster.Cluster.Name, p.NewCluster.EnvironmentName)
+	case ModeInPlace:
+		components := make([]string, len(p.Restores))
+		for i, r := range p.Restores {
+			components[i] = r.ComponentName
+		}
+		fmt.Fprintf(&b, "  target:             in place, components %s\n", strings.Join(components, ", "))
+	}
+	return b.String()
+}
+
+// PlannerOptions configures a Planner.
+type PlannerOptions struct {
+	// PollInterval is how often progress is polled during Execute. Defaults to wait.DefaultInterval.
+	PollInterval time.Duration
+	// Timeout bounds each wait during Execute. Zero waits until the context is done.
+	Timeout time.Duration
+}
+
+// Planner plans and executes point-in-time restores.
+type Planner struct {
+	clusterApi *kbcloud.ClusterApi
+	backupApi  *kbcloud.BackupApi
+	restoreApi *kbcloud.RestoreApi
+	opts       PlannerOptions
+}
+
+// NewPlanner returns a Planner using client.
+func NewPlanner(client *common.APIClient, opts PlannerOptions) *Planner {
+	return &Planner{
+		clusterApi: kbcloud.NewClusterApi(client),
+		backupApi:  kbcloud.NewBackupApi(client),
+		restoreApi: kbcloud.NewRestoreApi(client),
+		opts:       opts,
+	}
+}
+
+// Plan validates target against the recoverable window of the cluster, picks
+// the base backup and builds the restore requests without changing anything.
+func (p *Planner) Plan(ctx context.Context, orgName, clusterName string, target time.Time, opts RestoreOptions) (*Plan, error) {
+	cluster, _, err := p.clusterApi.GetCluster(ctx, orgName, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("get cluster: %w", err)
+	}
+	clusterId := apiutil.FormatID(cluster.Id)
+	window, _, err := p.restoreApi.GetRestoreTimeRange(ctx, orgName, clusterId)
+	if err != nil {
+		return nil, fmt.Errorf("get restore time range: %w", err)
+	}
+	if window.TimeRangeStart == nil || window.TimeRangeEnd == nil {
+		return nil, fmt.Errorf("%w: cluster %s has no continuous backup", ErrOutOfRange, clusterName)
+	}
+
+	plan := &Plan{
+		OrgName:     orgName,
+		Cluster:     clusterName,
+		ClusterId:   clusterId,
+		Target:      target,
+		RestoreTime: FormatRestoreTime(target),
+		WindowStart: *window.TimeRangeStart,
+		WindowEnd:   *window.TimeRangeEnd,
+		LogBackup:   window,
+	}
+	// The API works at second precision, so validate the time that is sent.
+	at, _ := time.Parse(RestoreTimeLayout, plan.RestoreTime)
+	if at.Before(plan.WindowStart) || at.After(plan.WindowEnd) {
+		return nil, fmt.Errorf("%w: %s is not within %s to %s", ErrOutOfRange,
+			plan.RestoreTime, FormatRestoreTime(plan.WindowStart), FormatRestoreTime(plan.WindowEnd))
+	}
+
+	if err := p.pickBaseBackup(ctx, plan, at); err != nil {
+		return nil, err
+	}
+
+	if opts.NewClusterName != "" {
+		plan.Mode = ModeNewCluster
+		plan.NewCluster = newClusterRequest(cluster, plan, opts)
+		return plan, nil
+	}
+	plan.Mode = ModeInPlace
+	components := opts.Components
+	if len(components) == 0 {
+		for _, c := range cluster.Components {
+			components = append(components, componentName(c))
+		}
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("cluster %s has no components to restore", clusterName)
+	}
+	for _, name := range components {
+		r := kbcloud.NewRestore(plan.LogBackup.Name, clusterName, name)
+		r.SetRestoreTime(plan.RestoreTime)
+		plan.Restores = append(plan.Restores, *r)
+	}
+	return plan, nil
+}
+
+// pickBaseBackup selects the latest completed full backup that is consistent
+// at or before at and whose end is covered by the log backup.
+func (p *Planner) pickBaseBackup(ctx context.Context, plan *Plan, at time.Time) error {
+	params := kbcloud.NewListBackupsOptionalParameters().WithClusterId(plan.ClusterId)
+	backups, _, err := p.backupApi.ListBackups(ctx, plan.OrgName, *params)
+	if err != nil {
+		return fmt.Errorf("list backups: %w", err)
+	}
+	var found bool
+	for _, b := range backups.Items {
+		if b.Status != kbcloud.BackupStatusCompleted || b.BackupType != kbcloud.BackupTypeFull {
+			continue
+		}
+		end := consistentAt(b)
+		if end.IsZero() || end.After(at) || end.Before(plan.WindowStart) {
+			continue
+		}
+		if !found || end.After(plan.BaseBackupEnd) {
+			plan.BaseBackup, plan.BaseBackupEnd, found = b, end, true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: cluster %s, target %s", ErrNoBaseBackup, plan.Cluster, plan.RestoreTime)
+	}
+	return nil
+}
+
+// consistentAt returns the time a full backup is consistent at.
+func consistentAt(b kbcloud.Backup) time.Time {
+	switch {
+	case b.TimeRangeEnd != nil:
+		return *b.TimeRangeEnd
+	case b.CompletionTimestamp != nil:
+		return *b.CompletionTimestamp
+	}
+	return time.Time{}
+}
+
+func newClusterRequest(source kbcloud.Cluster, plan *Plan, opts RestoreOptions) *kbcloud.RestoreCreate {
+	cluster := kbcloud.Cluster{
+		EnvironmentName:        source.EnvironmentName,
+		Project:                source.Project,
+		Name:                   opts.NewClusterName,
+		Engine:                 source.Engine,
+		ParamTpls:              source.ParamTpls,
+		Version:                source.Version,
+		TerminationPolicy:      source.TerminationPolicy,
+		TlsEnabled:             source.TlsEnabled,
+		NodePortEnabled:        source.NodePortEnabled,
+		Mode:                   source.Mode,
+		ProxyEnabled:           source.ProxyEnabled,
+		Extra:                  source.Extra,
+		Tolerations:            source.Tolerations,
+		SingleZone:             source.SingleZone,
+		AvailabilityZones:      source.AvailabilityZones,
+		PodAntiAffinityEnabled: source.PodAntiAffinityEnabled,
+		NodeGroup:              source.NodeGroup,
+		Static:                 source.Static,
+		NetworkMode:            source.NetworkMode,
+	}
+	if opts.EnvironmentName != "" {
+		cluster.EnvironmentName = opts.EnvironmentName
+	}
+	for _, comp := range source.Components {
+		comp.CodeShort = nil
+		cluster.Components = append(cluster.Components, comp)
+	}
+
+	backupId := plan.LogBackup.GetId()
+	if backupId == "" {
+		backupId = plan.LogBackup.Name
+	}
+	req := kbcloud.NewRestoreCreate(cluster.EnvironmentName, backupId, cluster)
+	req.SetRestoreTimeStr(plan.RestoreTime)
+	if opts.VolumeRestorePolicy != "" {
+		req.SetVolumeRestorePolicy(opts.VolumeRestorePolicy)
+	}
+	return req
+}
+
+func componentName(c kbcloud.ComponentItem) string {
+	if c.GetName() != "" {
+		return c.GetName()
+	}
+	return c.GetComponent()
+}
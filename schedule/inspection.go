@@ -0,0 +1,138 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// ErrNotRepresentable is returned when a cron expression has no AutoInspection equivalent.
+var ErrNotRepresentable = errors.New("cron expression cannot be represented as an auto inspection schedule")
+
+// FromAutoInspection converts the schedule of an auto inspection to a cron expression.
+// Hourly schedules run at Minute past every hour; daily, weekly and monthly
+// schedules run at Hour:Minute on every day, on DaysOfWeek (0 is Sunday) or on DaysOfMonth.
+func FromAutoInspection(ai kbcloud.AutoInspection) (*Cron, error) {
+	if ai.RunEvery == nil {
+		return nil, errors.New("auto inspection has no runEvery unit")
+	}
+	minute, hour := ai.GetMinute(), ai.GetHour()
+	if minute < 0 || minute > 59 {
+		return nil, fmt.Errorf("auto inspection minute %d out of range [0, 59]", minute)
+	}
+	if hour < 0 || hour > 23 {
+		return nil, fmt.Errorf("auto inspection hour %d out of range [0, 23]", hour)
+	}
+
+	var expr string
+	switch *ai.RunEvery {
+	case kbcloud.AutoInspectionRunUnitHour:
+		expr = fmt.Sprintf("%d * * * *", minute)
+	case kbcloud.AutoInspectionRunUnitDay:
+		expr = fmt.Sprintf("%d %d * * *", minute, hour)
+	case kbcloud.AutoInspectionRunUnitWeek:
+		if len(ai.DaysOfWeek) == 0 {
+			return nil, errors.New("weekly auto inspection has no daysOfWeek")
+		}
+		expr = fmt.Sprintf("%d %d * * %s", minute, hour, joinInts(ai.DaysOfWeek))
+	case kbcloud.AutoInspectionRunUnitMonth:
+		if len(ai.DaysOfMonth) == 0 {
+			return nil, errors.New("monthly auto inspection has no daysOfMonth")
+		}
+		expr = fmt.Sprintf("%d %d %s * *", minute, hour, joinInts(ai.DaysOfMonth))
+	default:
+		return nil, fmt.Errorf("unknown auto inspection runEvery unit %q", *ai.RunEvery)
+	}
+	return ParseCron(expr)
+}
+
+// ToAutoInspection returns an auto inspection whose RunEvery, DaysOfWeek,
+// DaysOfMonth, Hour and Minute match c. It returns ErrNotRepresentable for
+// expressions with several minutes or hours, restricted months, or both day fields restricted.
+func ToAutoInspection(c *Cron) (kbcloud.AutoInspection, error) {
+	var ai kbcloud.AutoInspection
+	minute, ok := single(c.minute)
+	if !ok {
+		return ai, fmt.Errorf("%w: %q must fire at a single minute", ErrNotRepresentable, c.expr)
+	}
+	if !full(c.month, monthField) {
+		return ai, fmt.Errorf("%w: %q restricts months", ErrNotRepresentable, c.expr)
+	}
+	ai.Minute = common.PtrInt32(int32(minute))
+
+	domAll, dowAll := full(c.dom, domField), full(c.dow, field{min: 0, max: 6})
+	if full(c.hour, hourField) {
+		if !domAll || !dowAll {
+			return ai, fmt.Errorf("%w: %q runs hourly on restricted days", ErrNotRepresentable, c.expr)
+		}
+		ai.RunEvery = kbcloud.AutoInspectionRunUnitHour.Ptr()
+		return ai, nil
+	}
+	hour, ok := single(c.hour)
+	if !ok {
+		return ai, fmt.Errorf("%w: %q must fire at a single hour", ErrNotRepresentable, c.expr)
+	}
+	ai.Hour = common.PtrInt32(int32(hour))
+
+	switch {
+	case domAll && dowAll:
+		ai.RunEvery = kbcloud.AutoInspectionRunUnitDay.Ptr()
+	case domAll:
+		ai.RunEvery = kbcloud.AutoInspectionRunUnitWeek.Ptr()
+		ai.DaysOfWeek = members(c.dow)
+	case dowAll:
+		ai.RunEvery = kbcloud.AutoInspectionRunUnitMonth.Ptr()
+		ai.DaysOfMonth = members(c.dom)
+	default:
+		return ai, fmt.Errorf("%w: %q restricts both day of month and day of week", ErrNotRepresentable, c.expr)
+	}
+	return ai, nil
+}
+
+// single returns the only value of set, if it has exactly one.
+func single(set uint64) (int, bool) {
+	if bits.OnesCount64(set) != 1 {
+		return 0, false
+	}
+	return bits.TrailingZeros64(set), true
+}
+
+// full reports whether set holds every value of f.
+func full(set uint64, f field) bool {
+	for v := f.min; v <= f.max; v++ {
+		if set&(1<<uint(v)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func members(set uint64) []int32 {
+	var out []int32
+	for v := 0; v < 64; v++ {
+		if set&(1<<uint(v)) != 0 {
+			out = append(out, int32(v))
+		}
+	}
+	return out
+}
+
+func joinInts(values []int32) string {
+	sorted := append([]int32(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	parts := make([]string, len(sorted))
+	for i, v := range sorted {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,144 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// BackupWindow is the time a cluster's scheduled backups occupy its backup repository.
+type BackupWindow struct {
+	Cluster    string
+	BackupRepo string
+	Cron       *Cron
+	// Duration is how long a backup is expected to run.
+	Duration time.Duration
+}
+
+// Overlap is a period during which scheduled backups of two clusters run
+// against the same backup repository.
+type Overlap struct {
+	BackupRepo string
+	Clusters   [2]string
+	Start      time.Time
+	End        time.Time
+}
+
+// FindOverlaps returns every overlap between backup windows sharing a backup
+// repository for runs starting in [from, to), sorted by start time. Cron
+// expressions are evaluated in the location of from.
+func FindOverlaps(windows []BackupWindow, from, to time.Time) []Overlap {
+	type interval struct{ start, end time.Time }
+	runs := make([][]interval, len(windows))
+	for i, w := range windows {
+		// Include runs started before from that are still in progress at from.
+		for t := w.Cron.Next(from.Add(-w.Duration - time.Minute)); !t.IsZero() && t.Before(to); t = w.Cron.Next(t) {
+			end := t.Add(w.Duration)
+			if !end.After(from) {
+				continue
+			}
+			// Runs lasting longer than the schedule interval merge into one
+			// busy period, keeping the intervals of a window disjoint.
+			if n := len(runs[i]); n > 0 && !t.After(runs[i][n-1].end) {
+				runs[i][n-1].end = end
+				continue
+			}
+			runs[i] = append(runs[i], interval{t, end})
+		}
+	}
+
+	var overlaps []Overlap
+	for i := range windows {
+		for j := i + 1; j < len(windows); j++ {
+			if windows[i].BackupRepo != windows[j].BackupRepo || windows[i].Cluster == windows[j].Cluster {
+				continue
+			}
+			a, b := runs[i], runs[j]
+			for x, y := 0, 0; x < len(a) && y < len(b); {
+				start, end := a[x].start, a[x].end
+				if b[y].start.After(start) {
+					start = b[y].start
+				}
+				if b[y].end.Before(end) {
+					end = b[y].end
+				}
+				if start.Before(end) {
+					overlaps = append(overlaps, Overlap{
+						BackupRepo: windows[i].BackupRepo,
+						Clusters:   [2]string{windows[i].Cluster, windows[j].Cluster},
+						Start:      start,
+						End:        end,
+					})
+				}
+				if a[x].end.Before(b[y].end) {
+					x++
+				} else {
+					y++
+				}
+			}
+		}
+	}
+	sort.SliceStable(overlaps, func(i, j int) bool { return overlaps[i].Start.Before(overlaps[j].Start) })
+	return overlaps
+}
+
+// LoadBackupWindows returns the backup windows of the clusters of an
+// organization that have automatic backups enabled. The duration of a window is
+// the longest recent automatic backup of the cluster, or defaultDuration when
+// the cluster has none.
+func LoadBackupWindows(ctx context.Context, client *common.APIClient, orgName string, defaultDuration time.Duration) ([]BackupWindow, error) {
+	clusterApi := kbcloud.NewClusterApi(client)
+	backupApi := kbcloud.NewBackupApi(client)
+
+	clusters, _, err := clusterApi.ListCluster(ctx, orgName)
+	if err != nil {
+		return nil, fmt.Errorf("list clusters: %w", err)
+	}
+	backups, _, err := backupApi.ListBackups(ctx, orgName)
+	if err != nil {
+		return nil, fmt.Errorf("list backups: %w", err)
+	}
+	durations := map[string]time.Duration{}
+	for _, b := range backups.Items {
+		if !b.AutoBackup || b.Status != kbcloud.BackupStatusCompleted || b.StartTimestamp == nil || b.CompletionTimestamp == nil {
+			continue
+		}
+		if d := b.CompletionTimestamp.Sub(*b.StartTimestamp); d > durations[b.SourceCluster] {
+			durations[b.SourceCluster] = d
+		}
+	}
+
+	var windows []BackupWindow
+	for _, c := range clusters.Items {
+		policy, _, err := backupApi.GetClusterBackupPolicy(ctx, orgName, c.Name)
+		if err != nil {
+			return nil, fmt.Errorf("get backup policy of cluster %s: %w", c.Name, err)
+		}
+		if !policy.GetAutoBackup() {
+			continue
+		}
+		cron, err := ParseCron(policy.GetCronExpression())
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", c.Name, err)
+		}
+		d := durations[c.Name]
+		if d == 0 {
+			d = defaultDuration
+		}
+		windows = append(windows, BackupWindow{
+			Cluster:    c.Name,
+			BackupRepo: policy.GetBackupRepo(),
+			Cron:       cron,
+			Duration:   d,
+		})
+	}
+	return windows, nil
+}
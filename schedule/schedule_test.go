@@ -0,0 +1,240 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/common"
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-01 is a Monday.
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		expr string
+		want []string
+	}{
+		{"*/20 * * * *", []string{"01-01 00:20", "01-01 00:40", "01-01 01:00"}},
+		{"0 2 * * *", []string{"01-01 02:00", "01-02 02:00", "01-03 02:00"}},
+		{"@weekly", []string{"01-07 00:00", "01-14 00:00", "01-21 00:00"}},
+		{"0 0 * * 1/2", []string{"01-03 00:00", "01-05 00:00", "01-08 00:00", "01-10 00:00"}},
+		{"0 0 * * */3", []string{"01-03 00:00", "01-06 00:00", "01-07 00:00"}},
+		{"0 0 * * 5-7", []string{"01-05 00:00", "01-06 00:00", "01-07 00:00", "01-12 00:00"}},
+		{"0 0 * * 7", []string{"01-07 00:00", "01-14 00:00"}},
+		{"0 0 * * sat,SUN", []string{"01-06 00:00", "01-07 00:00", "01-13 00:00"}},
+		// Restricted day of month and day of week match either.
+		{"0 0 15 * fri", []string{"01-05 00:00", "01-12 00:00", "01-15 00:00", "01-19 00:00"}},
+		{"0 0 31 * *", []string{"01-31 00:00", "03-31 00:00", "05-31 00:00"}},
+		{"0 12 29 feb *", []string{"02-29 12:00"}},
+		{"15 10-12/2 * jan-feb mon", []string{"01-01 10:15", "01-01 12:15", "01-08 10:15"}},
+	} {
+		c, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		var got []string
+		for _, at := range c.NextN(from, len(tc.want)) {
+			got = append(got, at.Format("01-02 15:04"))
+		}
+		if strings.Join(got, ", ") != strings.Join(tc.want, ", ") {
+			t.Errorf("%s: next = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestCronPrev(t *testing.T) {
+	c := MustParseCron("30 1 * * sat")
+	at := time.Date(2024, 1, 6, 1, 30, 0, 0, time.UTC)
+	if got := c.Prev(at); !got.Equal(at) {
+		t.Errorf("prev at an activation = %s", got)
+	}
+	if got := c.Prev(at.Add(-time.Minute)); !got.Equal(at.AddDate(0, 0, -7)) {
+		t.Errorf("prev before an activation = %s", got)
+	}
+	if got := MustParseCron("0 0 30 feb *").Prev(at); !got.IsZero() {
+		t.Errorf("prev of a cron never firing = %s", got)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"1,,2 * * * *",
+		"* * * * mon-",
+		"@reboot",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+	if err := ValidateCron("0 0 30 feb *"); err == nil {
+		t.Error("ValidateCron accepted a cron that never fires")
+	}
+}
+
+func TestCronDaylightSaving(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Clocks skip 02:00-03:00 on 2024-03-10 and repeat 01:00-02:00 on 2024-11-03.
+	for _, tc := range []struct {
+		expr string
+		from time.Time
+		want []string
+	}{
+		{"30 2 * * *", time.Date(2024, 3, 9, 12, 0, 0, 0, ny), []string{"03-11 02:30 EDT", "03-12 02:30 EDT"}},
+		{"0 * * * *", time.Date(2024, 3, 10, 0, 30, 0, 0, ny), []string{"03-10 01:00 EST", "03-10 03:00 EDT", "03-10 04:00 EDT"}},
+		{"0 3 * * *", time.Date(2024, 3, 9, 12, 0, 0, 0, ny), []string{"03-10 03:00 EDT", "03-11 03:00 EDT"}},
+		{"30 1 * * *", time.Date(2024, 11, 2, 12, 0, 0, 0, ny), []string{"11-03 01:30 EDT", "11-03 01:30 EST", "11-04 01:30 EST"}},
+		{"0 2 * * *", time.Date(2024, 11, 2, 12, 0, 0, 0, ny), []string{"11-03 02:00 EST", "11-04 02:00 EST"}},
+	} {
+		var got []string
+		for _, at := range MustParseCron(tc.expr).NextN(tc.from, len(tc.want)) {
+			got = append(got, at.Format("01-02 15:04 MST"))
+		}
+		if strings.Join(got, ", ") != strings.Join(tc.want, ", ") {
+			t.Errorf("%s from %s: next = %v, want %v", tc.expr, tc.from, got, tc.want)
+		}
+	}
+
+	if got := MustParseCron("30 2 * * *").Prev(time.Date(2024, 3, 10, 12, 0, 0, 0, ny)); got.IsZero() || got.After(time.Date(2024, 3, 10, 12, 0, 0, 0, ny)) {
+		t.Errorf("prev across the skipped hour = %s", got)
+	}
+}
+
+func TestAutoInspection(t *testing.T) {
+	unit := func(u kbcloud.AutoInspectionRunUnit) *kbcloud.AutoInspectionRunUnit { return &u }
+	for _, tc := range []struct {
+		ai   kbcloud.AutoInspection
+		expr string
+	}{
+		{kbcloud.AutoInspection{RunEvery: unit(kbcloud.AutoInspectionRunUnitHour), Minute: common.PtrInt32(15)}, "15 * * * *"},
+		{kbcloud.AutoInspection{RunEvery: unit(kbcloud.AutoInspectionRunUnitDay), Hour: common.PtrInt32(3), Minute: common.PtrInt32(0)}, "0 3 * * *"},
+		{kbcloud.AutoInspection{RunEvery: unit(kbcloud.AutoInspectionRunUnitWeek), Hour: common.PtrInt32(23), Minute: common.PtrInt32(59), DaysOfWeek: []int32{6, 0}}, "59 23 * * 0,6"},
+		{kbcloud.AutoInspection{RunEvery: unit(kbcloud.AutoInspectionRunUnitMonth), Hour: common.PtrInt32(1), Minute: common.PtrInt32(30), DaysOfMonth: []int32{31, 1, 15}}, "30 1 1,15,31 * *"},
+	} {
+		c, err := FromAutoInspection(tc.ai)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if c.String() != tc.expr {
+			t.Errorf("FromAutoInspection = %s, want %s", c, tc.expr)
+		}
+		back, err := ToAutoInspection(c)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		again, err := FromAutoInspection(back)
+		if err != nil || again.String() != tc.expr {
+			t.Errorf("%s: round trip = %v, %v", tc.expr, again, err)
+		}
+	}
+
+	// Sunday written as 7 and day of week ranges convert too.
+	ai, err := ToAutoInspection(MustParseCron("0 4 * * 5-7"))
+	if err != nil || fmt.Sprint(ai.DaysOfWeek) != "[0 5 6]" || *ai.RunEvery != kbcloud.AutoInspectionRunUnitWeek {
+		t.Errorf("weekend inspection = %+v, %v", ai, err)
+	}
+	if ai, err := ToAutoInspection(MustParseCron("0 4 * * *")); err != nil || *ai.RunEvery != kbcloud.AutoInspectionRunUnitDay {
+		t.Errorf("daily inspection = %+v, %v", ai, err)
+	}
+
+	for _, expr := range []string{"*/5 * * * *", "0 1,13 * * *", "0 4 * jan *", "0 4 1 * mon", "0 * * * mon"} {
+		if _, err := ToAutoInspection(MustParseCron(expr)); !errors.Is(err, ErrNotRepresentable) {
+			t.Errorf("ToAutoInspection(%q): %v", expr, err)
+		}
+	}
+	for _, ai := range []kbcloud.AutoInspection{
+		{},
+		{RunEvery: unit(kbcloud.AutoInspectionRunUnitDay), Hour: common.PtrInt32(24)},
+		{RunEvery: unit(kbcloud.AutoInspectionRunUnitHour), Minute: common.PtrInt32(-1)},
+		{RunEvery: unit(kbcloud.AutoInspectionRunUnitWeek)},
+		{RunEvery: unit(kbcloud.AutoInspectionRunUnitMonth), DaysOfMonth: []int32{32}},
+		{RunEvery: unit("year")},
+	} {
+		if c, err := FromAutoInspection(ai); err == nil {
+			t.Errorf("FromAutoInspection(%+v) = %s", ai, c)
+		}
+	}
+}
+
+func TestFindOverlaps(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 2)
+	window := func(cluster, repo, expr string, d time.Duration) BackupWindow {
+		return BackupWindow{Cluster: cluster, BackupRepo: repo, Cron: MustParseCron(expr), Duration: d}
+	}
+	render := func(overlaps []Overlap) string {
+		var out []string
+		for _, o := range overlaps {
+			out = append(out, fmt.Sprintf("%s %s+%s %s-%s", o.BackupRepo, o.Clusters[0], o.Clusters[1], o.Start.Format("02T15:04"), o.End.Format("02T15:04")))
+		}
+		return strings.Join(out, ", ")
+	}
+	for _, tc := range []struct {
+		name    string
+		windows []BackupWindow
+		want    string
+	}{
+		{
+			name: "shared repository",
+			windows: []BackupWindow{
+				window("a", "s3", "0 2 * * *", time.Hour),
+				window("b", "s3", "30 2 * * *", time.Hour),
+				window("c", "oss", "0 2 * * *", time.Hour),
+			},
+			want: "s3 a+b 01T02:30-01T03:00, s3 a+b 02T02:30-02T03:00",
+		},
+		{
+			name: "back to back runs do not overlap",
+			windows: []BackupWindow{
+				window("a", "s3", "0 2 * * *", time.Hour),
+				window("b", "s3", "0 3 * * *", time.Hour),
+			},
+		},
+		{
+			name: "run started before from",
+			windows: []BackupWindow{
+				window("a", "s3", "0 23 * * *", 3*time.Hour),
+				window("b", "s3", "0 1 1 * *", time.Hour),
+			},
+			want: "s3 a+b 01T01:00-01T02:00",
+		},
+		{
+			name: "runs longer than the interval",
+			windows: []BackupWindow{
+				window("a", "s3", "0 */2 1 * *", 3*time.Hour),
+				window("b", "s3", "0 11 1 * *", 5*time.Hour),
+			},
+			want: "s3 a+b 01T11:00-01T16:00",
+		},
+		{
+			name: "windows of one cluster",
+			windows: []BackupWindow{
+				window("a", "s3", "0 2 * * *", time.Hour),
+				window("a", "s3", "0 2 * * *", time.Hour),
+			},
+		},
+	} {
+		if got := render(FindOverlaps(tc.windows, from, to)); got != tc.want {
+			t.Errorf("%s: overlaps = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Unless explicitly stated otherwise all files in this repository are licensed under the Apache-2.0 License.
+// This product includes software developed at ApeCloud (https://www.apecloud.com/).
+// Copyright 2022-Present ApeCloud Co., Ltd
+
+// Package wait provides polling helpers used to wait for asynchronous
+// KubeBlocks Cloud operations to settle.
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apecloud/kb-cloud-client-go/api/kbcloud"
+)
+
+// Cluster status values reported by the KubeBlocks Cloud API.
+const (
+	ClusterStatusCreating = "Creating"
+	ClusterStatusRunning  = "Running"
+	ClusterStatusUpdating = "Updating"
+	ClusterStatusStopped  = "Stopped"
+	ClusterStatusDeleting = "Deleting"
+	ClusterStatusFailed   = "Failed"
+	ClusterStatusAbnormal = "Abnormal"
+)
+
+// DefaultInterval is the polling interval used when none is configured.
+const DefaultInterval = 10 * time.Second
+
+// ErrTimeout is returned when the condition is not met before the timeout expires.
+var ErrTimeout = errors.New("timed out waiting for the condition")
+
+// ConditionFunc reports whether the awaited state has been reached.
+// Returning a non-nil error stops polling immediately.
+type ConditionFunc func(ctx context.Context) (done bool, err error)
+
+// Poll evaluates condition immediately and then every interval until it returns true,
+// returns an error, the timeout expires or ctx is done. A zero timeout waits until ctx is done.
+func Poll(ctx context.Context, interval, timeout time.Duration, condition ConditionFunc) error {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		done, err := condition(ctx)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrTimeout
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ForClusterStatus waits until the cluster reports one of the given statuses and returns it.
+// A cluster entering the Failed status, unless explicitly awaited, aborts the wait.
+func ForClusterStatus(ctx context.Context, api *kbcloud.ClusterApi, orgName, clusterName string, interval, timeout time.Duration, statuses ...string) (kbcloud.Cluster, error) {
+	var cluster kbcloud.Cluster
+	err := Poll(ctx, interval, timeout, func(ctx context.Context) (bool, error) {
+		var err error
+		cluster, _, err = api.GetCluster(ctx, orgName, clusterName)
+		if err != nil {
+			return false, err
+		}
+		status := cluster.GetStatus()
+		for _, s := range statuses {
+			if status == s {
+				return true, nil
+			}
+		}
+		if status == ClusterStatusFailed {
+			return false, fmt.Errorf("cluster %s entered status %s", clusterName, status)
+		}
+		return false, nil
+	})
+	return cluster, err
+}
+
+// ForClusterRunning waits until the cluster reports the Running status.
+func ForClusterRunning(ctx context.Context, api *kbcloud.ClusterApi, orgName, clusterName string, interval, timeout time.Duration) (kbcloud.Cluster, error) {
+	return ForClusterStatus(ctx, api, orgName, clusterName, interval, timeout, ClusterStatusRunning)
+}
+
+// ForBackup waits until the backup completes and returns it. A failed backup aborts the wait.
+func ForBackup(ctx context.Context, api *kbcloud.BackupApi, orgName, backupId string, interval, timeout time.Duration) (kbcloud.Backup, error) {
+	var backup kbcloud.Backup
+	err := Poll(ctx, interval, timeout, func(ctx context.Context) (bool, error) {
+		var err error
+		backup, _, err = api.GetBackup(ctx, orgName, backupId)
+		if err != nil {
+			return false, err
+		}
+		switch backup.Status {
+		case kbcloud.BackupStatusCompleted:
+			return true, nil
+		case kbcloud.BackupStatusFailed:
+			return false, fmt.Errorf("backup %s failed: %s", backup.Name, backup.GetFailureReason())
+		}
+		return false, nil
+	})
+	return backup, err
+}
+
+// Restore phase values reported by the KubeBlocks Cloud API.
+const (
+	RestorePhaseCompleted = "Completed"
+	RestorePhaseFailed    = "Failed"
+)
+
+// ForRestore polls the restores of a cluster until the restore named restoreName
+// completes. A failed restore ends the wait with an error.
+func ForRestore(ctx context.Context, api *kbcloud.RestoreApi, orgName, clusterName, restoreName string, interval, timeout time.Duration) (kbcloud.Restore, error) {
+	var restore kbcloud.Restore
+	err := Poll(ctx, interval, timeout, func(ctx context.Context) (bool, error) {
+		list, _, err := api.ListClusterRestore(ctx, orgName, clusterName)
+		if err != nil {
+			return false, err
+		}
+		for _, r := range list.Items {
+			if r.GetName() != restoreName && r.GetId() != restoreName {
+				continue
+			}
+			restore = r
+			switch r.Status.GetPhase() {
+			case RestorePhaseCompleted:
+				return true, nil
+			case RestorePhaseFailed:
+				return false, fmt.Errorf("restore %s failed", restoreName)
+			}
+		}
+		return false, nil
+	})
+	return restore, err
+}